@@ -2,17 +2,52 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/abteilung6/tilmancloud/pkg/api/endpoints"
+	"github.com/abteilung6/tilmancloud/pkg/awsconfig"
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
 	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/eip"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+	"github.com/abteilung6/tilmancloud/pkg/idempotency"
 	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/abteilung6/tilmancloud/pkg/pool"
+	"github.com/abteilung6/tilmancloud/pkg/provider/qemu"
+	"github.com/abteilung6/tilmancloud/pkg/provider/sim"
+	"github.com/abteilung6/tilmancloud/pkg/spot"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
+// Node security groups can only be deleted once their instance has fully
+// terminated, which happens well after DELETE /nodes returns.
+const securityGroupJanitorInterval = 5 * time.Minute
+
+// envProvider selects the compute provider: ec2 (the default), sim, which
+// serves simulated nodes without AWS, or qemu, which runs nodes as local
+// QEMU processes.
+const envProvider = "TILMAN_PROVIDER"
+
+// simRegion labels simulated nodes and images.
+const simRegion = "sim"
+
+// localRegion labels nodes and images of the QEMU provider.
+const localRegion = "local"
+
+// envChaos turns on chaos mode: every EC2 client injects the faults,
+// latency and eventual consistency it describes, see ec2.ParseFaultConfig.
+const envChaos = "TILMAN_EC2_CHAOS"
+
 type Server struct {
 	Router *chi.Mux
 }
@@ -20,55 +55,161 @@ type Server struct {
 func CreateNewServer() (*Server, error) {
 	server := &Server{}
 	server.Router = chi.NewRouter()
-	return server, nil
-}
 
-func MountHandlers(server *Server, nodesHandler *endpoints.NodesHandler, imagesHandler *endpoints.ImagesHandler, healthHandler *endpoints.HealthHandler) {
-	// Middleware
+	// Middleware must be in place before the first route is mounted
 	server.Router.Use(middleware.Logger)
 	server.Router.Use(middleware.Recoverer)
 
 	server.Router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"},
-		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", endpoints.ActorHeader, "Cache-Control", "Last-Event-ID", endpoints.IdempotencyKeyHeader},
+		ExposedHeaders:   []string{"Link", endpoints.CacheAgeHeader, endpoints.IdempotentReplayedHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
+	// Every mutating route honours Idempotency-Key
+	server.Router.Use(endpoints.Idempotent(idempotency.NewStore()))
+	return server, nil
+}
 
-	// Routes
+func MountHandlers(server *Server, nodesHandler *endpoints.NodesHandler, imagesHandler *endpoints.ImagesHandler, templatesHandler *endpoints.TemplatesHandler, inventoryHandler *endpoints.InventoryHandler, eventsHandler *endpoints.EventsHandler, healthHandler *endpoints.HealthHandler) {
 	server.Router.Get("/health", healthHandler.Health)
 	server.Router.Get("/nodes", nodesHandler.ListNodes)
 	server.Router.Post("/nodes", nodesHandler.CreateNode)
+	server.Router.Post("/nodes:batchCreate", nodesHandler.BatchCreateNodes)
+	server.Router.Post("/nodes:batchDelete", nodesHandler.BatchDeleteNodes)
+	server.Router.Get("/nodes/{nodeId}", nodesHandler.GetNode)
 	server.Router.Delete("/nodes/{nodeId}", nodesHandler.DeleteNode)
+	server.Router.Post("/nodes/{nodeId}:start", nodesHandler.StartNode)
+	server.Router.Post("/nodes/{nodeId}:stop", nodesHandler.StopNode)
+	server.Router.Post("/nodes/{nodeId}:reboot", nodesHandler.RebootNode)
+	server.Router.Post("/nodes/{nodeId}:force-stop", nodesHandler.ForceStopNode)
+	server.Router.Get("/nodes/{nodeId}/console", nodesHandler.GetNodeConsole)
+	server.Router.Get("/nodes/{nodeId}/screenshot", nodesHandler.GetNodeScreenshot)
 	server.Router.Get("/images", imagesHandler.ListImages)
+	server.Router.Get("/templates", templatesHandler.ListTemplates)
+	server.Router.Post("/templates", templatesHandler.CreateTemplate)
+	server.Router.Get("/templates/{templateName}", templatesHandler.GetTemplate)
+	server.Router.Put("/templates/{templateName}", templatesHandler.UpdateTemplate)
+	server.Router.Delete("/templates/{templateName}", templatesHandler.DeleteTemplate)
+	server.Router.Post("/templates/{templateName}:render", templatesHandler.RenderTemplate)
+	server.Router.Get("/inventory/nodes", inventoryHandler.ListNodes)
+	server.Router.Get("/inventory/images", inventoryHandler.ListImages)
+	server.Router.Get("/inventory/builds", inventoryHandler.ListBuilds)
+	server.Router.Get("/operations", inventoryHandler.ListOperations)
+	server.Router.Get("/events", eventsHandler.StreamEvents)
 }
 
-func main() {
-	ctx := context.Background()
-	region := "eu-central-1"
+// MountEC2Handlers mounts the routes that manage EC2 resources besides nodes
+// and images.
+func MountEC2Handlers(server *Server, keysHandler *endpoints.KeysHandler, firewallHandler *endpoints.FirewallHandler, poolsHandler *endpoints.PoolsHandler, volumesHandler *endpoints.VolumesHandler, addressesHandler *endpoints.AddressesHandler) {
+	server.Router.Get("/nodes/{nodeId}/firewall", firewallHandler.GetNodeFirewall)
+	server.Router.Put("/nodes/{nodeId}/firewall", firewallHandler.UpdateNodeFirewall)
+	server.Router.Get("/keys", keysHandler.ListKeys)
+	server.Router.Post("/keys", keysHandler.CreateKey)
+	server.Router.Delete("/keys/{keyName}", keysHandler.DeleteKey)
+	server.Router.Get("/pools", poolsHandler.ListPools)
+	server.Router.Post("/pools", poolsHandler.CreatePool)
+	server.Router.Get("/pools/{poolName}", poolsHandler.GetPool)
+	server.Router.Delete("/pools/{poolName}", poolsHandler.DeletePool)
+	server.Router.Post("/pools/{poolName}:scale", poolsHandler.ScalePool)
+	server.Router.Get("/volumes", volumesHandler.ListVolumes)
+	server.Router.Post("/volumes", volumesHandler.CreateVolume)
+	server.Router.Get("/volumes/{volumeId}", volumesHandler.GetVolume)
+	server.Router.Delete("/volumes/{volumeId}", volumesHandler.DeleteVolume)
+	server.Router.Post("/volumes/{volumeId}:attach", volumesHandler.AttachVolume)
+	server.Router.Post("/volumes/{volumeId}:detach", volumesHandler.DetachVolume)
+	server.Router.Get("/addresses", addressesHandler.ListAddresses)
+	server.Router.Post("/addresses", addressesHandler.AllocateAddress)
+	server.Router.Get("/addresses/{allocationId}", addressesHandler.GetAddress)
+	server.Router.Delete("/addresses/{allocationId}", addressesHandler.ReleaseAddress)
+	server.Router.Post("/addresses/{allocationId}:associate", addressesHandler.AssociateAddress)
+	server.Router.Post("/addresses/{allocationId}:disassociate", addressesHandler.DisassociateAddress)
+}
 
-	ec2Client, err := ec2.NewClient(ctx, region)
-	if err != nil {
-		log.Fatalf("Failed to create EC2 client: %v", err)
+// MountUnsupported answers the EC2-only routes with 501, so clients of a
+// provider without them get a clear error instead of a 404.
+func MountUnsupported(server *Server, providerName string) {
+	unsupported := func(w http.ResponseWriter, r *http.Request) {
+		endpoints.WriteProblem(w, http.StatusNotImplemented, fmt.Sprintf("Not supported by the %s provider", providerName))
+	}
+	server.Router.HandleFunc("/nodes/{nodeId}/firewall", unsupported)
+	for _, prefix := range []string{"/keys", "/pools", "/volumes", "/addresses"} {
+		server.Router.HandleFunc(prefix, unsupported)
+		server.Router.HandleFunc(prefix+"/*", unsupported)
 	}
+}
+
+func main() {
+	awsSettings := awsconfig.FromEnv()
+	awsSettings.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	ctx := context.Background()
 
-	amiRegistrar, err := image.NewAMIRegistrar(ctx, region)
+	// The image builder records its builds into the same file
+	inventoryStore, err := inventory.OpenFileStore(inventory.PathFromEnv())
 	if err != nil {
-		log.Fatalf("Failed to create AMI registrar: %v", err)
+		log.Fatalf("Failed to open inventory: %v", err)
 	}
 
-	nodesHandler := endpoints.NewNodesHandler(ec2Client, amiRegistrar)
-	imagesHandler := endpoints.NewImagesHandler(amiRegistrar)
-	healthHandler := endpoints.NewHealthHandler()
+	eventBus := events.NewBus(events.DefaultBufferSize)
+	nodeEvents := events.NewNodeTracker(eventBus)
+	templateStore := cloudinit.NewTemplateStore()
 
 	server, err := CreateNewServer()
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
-	MountHandlers(server, nodesHandler, imagesHandler, healthHandler)
+	var nodesHandler *endpoints.NodesHandler
+	var imagesHandler *endpoints.ImagesHandler
+	var templatesHandler *endpoints.TemplatesHandler
+	switch providerName := os.Getenv(envProvider); providerName {
+	case "", "ec2":
+		nodesHandler, imagesHandler, templatesHandler = startEC2(ctx, awsSettings, server, inventoryStore, eventBus, nodeEvents, templateStore)
+	case "sim":
+		simConfig, err := sim.FromEnv()
+		if err != nil {
+			log.Fatalf("Failed to configure simulator: %v", err)
+		}
+		simProvider := sim.New(simConfig)
+		nodesHandler = endpoints.NewNodesHandler(nil, simProvider)
+		nodesHandler.Provider = simProvider
+		nodesHandler.Region = simRegion
+		imagesHandler = endpoints.NewImagesHandler(simProvider)
+		imagesHandler.Region = simRegion
+		templatesHandler = endpoints.NewTemplatesHandler(templateStore, nil)
+		MountUnsupported(server, providerName)
+		slog.Info("Serving simulated nodes", "boot_delay", simConfig.Delays.Boot, "failure_rate", simConfig.FailureRate, "launch_failure_rate", simConfig.LaunchFailureRate)
+	case "qemu":
+		qemuConfig, err := qemu.FromEnv()
+		if err != nil {
+			log.Fatalf("Failed to configure QEMU provider: %v", err)
+		}
+		qemuProvider, err := qemu.New(qemuConfig)
+		if err != nil {
+			log.Fatalf("Failed to create QEMU provider: %v", err)
+		}
+		nodesHandler = endpoints.NewNodesHandler(nil, qemuProvider)
+		nodesHandler.Provider = qemuProvider
+		nodesHandler.Region = localRegion
+		imagesHandler = endpoints.NewImagesHandler(qemuProvider)
+		imagesHandler.Region = localRegion
+		templatesHandler = endpoints.NewTemplatesHandler(templateStore, nil)
+		MountUnsupported(server, providerName)
+		slog.Info("Serving local QEMU nodes", "image_dir", qemuConfig.ImageDir, "state_dir", qemuConfig.StateDir)
+	default:
+		log.Fatalf("Unknown provider %q, expected ec2, sim or qemu", providerName)
+	}
+	nodesHandler.Templates = templateStore
+	nodesHandler.Inventory = inventoryStore
+	nodesHandler.Events = nodeEvents
+	inventoryHandler := endpoints.NewInventoryHandler(inventoryStore)
+	eventsHandler := endpoints.NewEventsHandler(eventBus)
+	healthHandler := endpoints.NewHealthHandler()
+
+	MountHandlers(server, nodesHandler, imagesHandler, templatesHandler, inventoryHandler, eventsHandler, healthHandler)
 
 	port := ":8080"
 	log.Printf("Admin API server starting on port %s", port)
@@ -77,3 +218,127 @@ func main() {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// startEC2 builds the handlers backed by AWS, mounts the EC2-only routes and
+// starts the background loops.
+func startEC2(ctx context.Context, awsConfig awsconfig.Config, server *Server, inventoryStore inventory.Store, eventBus *events.Bus, nodeEvents *events.NodeTracker, templateStore *cloudinit.TemplateStore) (*endpoints.NodesHandler, *endpoints.ImagesHandler, *endpoints.TemplatesHandler) {
+	awsConfigs, err := awsconfig.LoadAll(ctx, awsConfig)
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+
+	// Pools, volumes, addresses and the background loops manage the
+	// default region; nodes and images are served across all regions
+	region := awsConfig.AllRegions()[0]
+	newEC2Client := ec2.NewClient
+	if spec := os.Getenv(envChaos); spec != "" {
+		chaos, err := ec2.ParseFaultConfig(spec)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", envChaos, err)
+		}
+		newEC2Client = func(cfg aws.Config) ec2.EC2Client {
+			return ec2.NewFaultClient(ec2.NewClient(cfg), chaos)
+		}
+		slog.Warn("Chaos mode enabled, EC2 calls inject faults", "faults", len(chaos.Faults), "latency", chaos.Latency, "jitter", chaos.Jitter, "visibility", chaos.Visibility)
+	}
+	ec2Client := newEC2Client(awsConfigs[region])
+	amiRegistrar := image.NewAMIRegistrar(awsConfigs[region])
+	regions := make(map[string]endpoints.Region)
+	for name, cfg := range awsConfigs {
+		if name == region {
+			continue
+		}
+		registrar := image.NewAMIRegistrar(cfg)
+		regions[name] = endpoints.Region{EC2Client: newEC2Client(cfg), AMIFinder: registrar, Images: registrar}
+	}
+	slog.Info("Serving AWS regions", "default", region, "regions", awsConfig.AllRegions())
+
+	nodesHandler := endpoints.NewNodesHandler(ec2Client, amiRegistrar)
+	nodesHandler.Region = region
+	nodesHandler.Regions = regions
+	imagesHandler := endpoints.NewImagesHandler(amiRegistrar)
+	imagesHandler.Region = region
+	imagesHandler.Regions = regions
+	keysHandler := endpoints.NewKeysHandler(ec2Client)
+	firewallHandler := endpoints.NewFirewallHandler(ec2Client)
+	firewallHandler.Instances = nodesHandler.Instances
+	templatesHandler := endpoints.NewTemplatesHandler(templateStore, ec2Client)
+	poolStore, err := pool.OpenStore(ctx, inventoryStore)
+	if err != nil {
+		log.Fatalf("Failed to load pools: %v", err)
+	}
+	poolReconciler := pool.NewReconciler(ec2Client, poolStore, amiRegistrar, templateStore)
+	poolReconciler.Inventory = inventoryStore
+	poolReconciler.OnChange = nodesHandler.Instances.Invalidate
+	poolReconciler.Events = nodeEvents
+	poolsHandler := endpoints.NewPoolsHandler(ec2Client, poolStore, templateStore, poolReconciler)
+	volumesHandler := endpoints.NewVolumesHandler(ec2Client)
+	volumesHandler.Inventory = inventoryStore
+	volumesHandler.Instances = nodesHandler.Instances
+	addressReconciler := eip.NewReconciler(ec2Client, inventoryStore)
+	addressReconciler.OnChange = nodesHandler.Instances.Invalidate
+	nodesHandler.Addresses = addressReconciler
+	addressesHandler := endpoints.NewAddressesHandler(ec2Client)
+	addressesHandler.Inventory = inventoryStore
+	addressesHandler.Instances = nodesHandler.Instances
+	addressesHandler.Reconciler = addressReconciler
+	inventorySyncer := inventory.NewSyncer(inventoryStore, ec2Client, amiRegistrar)
+	inventorySyncer.Events = eventBus
+	inventorySyncer.NodeEvents = nodeEvents
+	inventorySyncer.Region = region
+	spotHandler := spot.NewHandler(ec2Client, inventoryStore)
+	spotHandler.OnChange = nodesHandler.Instances.Invalidate
+	spotHandler.Events = eventBus
+	spotHandler.NodeEvents = nodeEvents
+	spotHandler.Region = region
+	// Static IPs, spot interruptions and the inventory are handled in the
+	// region of their node, so every other region gets its own reconciler,
+	// spot handler and inventory syncer
+	var regionalWorkers []func(context.Context)
+	for name, other := range regions {
+		reconciler := eip.NewReconciler(other.EC2Client, inventoryStore)
+		reconciler.OnChange = nodesHandler.Instances.Invalidate
+		other.Addresses = reconciler
+		regions[name] = other
+		handler := spot.NewHandler(other.EC2Client, inventoryStore)
+		handler.OnChange = nodesHandler.Instances.Invalidate
+		handler.Events = eventBus
+		handler.NodeEvents = nodeEvents
+		handler.Region = name
+		syncer := inventory.NewSyncer(inventoryStore, other.EC2Client, other.Images)
+		syncer.Events = eventBus
+		syncer.NodeEvents = nodeEvents
+		syncer.Region = name
+		syncer.DefaultRegion = false
+		regionalWorkers = append(regionalWorkers, reconciler.Run, handler.Run, syncer.Run)
+	}
+
+	MountEC2Handlers(server, keysHandler, firewallHandler, poolsHandler, volumesHandler, addressesHandler)
+
+	go runSecurityGroupJanitor(ctx, ec2Client, securityGroupJanitorInterval)
+	go poolReconciler.Run(ctx)
+	go inventorySyncer.Run(ctx)
+	go spotHandler.Run(ctx)
+	go addressReconciler.Run(ctx)
+	for _, run := range regionalWorkers {
+		go run(ctx)
+	}
+
+	return nodesHandler, imagesHandler, templatesHandler
+}
+
+func runSecurityGroupJanitor(ctx context.Context, ec2Client ec2.EC2Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ec2.CleanupOrphanedSecurityGroups(ctx, ec2Client); err != nil {
+				slog.Warn("Security group cleanup failed", "error", err)
+			}
+		}
+	}
+}
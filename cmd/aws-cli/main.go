@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/abteilung6/tilmancloud/pkg/awsconfig"
 	"github.com/abteilung6/tilmancloud/pkg/ec2"
 	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
@@ -15,27 +20,45 @@ func main() {
 	if len(os.Args) < 2 {
 		fmt.Fprintf(os.Stderr, "Error: command required\n")
 		fmt.Fprintf(os.Stderr, "Usage: %s <command>\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Commands: create, list, delete\n")
+		fmt.Fprintf(os.Stderr, "Commands: create, list, delete, start, stop, reboot, force-stop, console\n")
 		os.Exit(1)
 	}
 
 	command := os.Args[1]
 	ctx := context.Background()
 
-	ec2Client, err := ec2.NewClient(ctx, "eu-central-1")
+	awsConfig, err := awsconfig.Load(ctx, awsconfig.FromEnv())
 	if err != nil {
-		log.Fatalf("Failed to create EC2 client: %v", err)
+		log.Fatalf("Failed to load AWS config: %v", err)
 	}
+	nodes := provider.NewEC2(ec2.NewClient(awsConfig), image.NewAMIRegistrar(awsConfig))
 
 	switch command {
 	case "create":
-		region := "eu-central-1"
-		amiRegistrar, err := image.NewAMIRegistrar(ctx, region)
-		if err != nil {
-			log.Fatalf("Failed to create AMI registrar: %v", err)
+		fs := flag.NewFlagSet("create", flag.ExitOnError)
+		requestedName := fs.String("name", "", "node name (generated when empty); the name prefix with --count")
+		count := fs.Int("count", 1, "number of nodes to launch, named <name>-1 to <name>-<count>")
+		keyName := fs.String("key", "", "name of a managed SSH key to launch with")
+		statusChecks := fs.Bool("status-checks", false, "also wait until the instance status checks pass")
+		timeout := fs.Duration("timeout", ec2.DefaultWaitTimeout, "how long to wait for the instance")
+		spot := fs.Bool("spot", false, "launch a spot instance")
+		maxPrice := fs.String("max-price", "", "maximum hourly spot price in USD (defaults to the on-demand price)")
+		interruption := fs.String("interruption", "terminate", "what happens when a spot instance is reclaimed: terminate, stop or hibernate")
+		hibernation := fs.Bool("hibernation", false, "enable hibernation, which encrypts the root volume")
+		fs.Parse(os.Args[2:])
+
+		var spotOptions *ec2.SpotOptions
+		if *spot {
+			spotOptions = &ec2.SpotOptions{
+				MaxPrice:             *maxPrice,
+				InterruptionBehavior: types.InstanceInterruptionBehavior(*interruption),
+			}
+			if err := spotOptions.Validate(); err != nil {
+				log.Fatalf("Invalid spot options: %v", err)
+			}
 		}
 
-		amiID, err := amiRegistrar.FindLatestAMI(ctx)
+		amiID, err := nodes.FindLatestAMI(ctx)
 		if err != nil {
 			log.Fatalf("No AMI available. Please build an AMI first: %v", err)
 		}
@@ -43,23 +66,38 @@ func main() {
 		config := ec2.CreateInstanceConfig{
 			ImageID:      amiID,
 			InstanceType: types.InstanceTypeT4gMicro,
+			KeyName:      *keyName,
+			Spot:         spotOptions,
+			Hibernation:  *hibernation,
+		}
+		opts := newWaitOptions(*timeout, types.InstanceStateNameRunning)
+		opts.RequireStatusChecks = *statusChecks
+
+		if *count != 1 {
+			runBatchCreate(ctx, nodes, config, *requestedName, *count, opts)
+			break
 		}
 
-		instanceInfo, err := ec2.CreateInstance(ctx, ec2Client, config)
+		config.Name, err = nodes.AssignNodeName(ctx, *requestedName)
+		if err != nil {
+			log.Fatalf("Invalid node name: %v", err)
+		}
+
+		instanceInfo, err := nodes.CreateNode(ctx, config)
 		if err != nil {
 			log.Fatalf("Create command failed: %v", err)
 		}
 
-		fmt.Printf("Instance launched! Instance ID: %s\n", instanceInfo.InstanceID)
+		fmt.Printf("Instance launched! Name: %s, Instance ID: %s\n", instanceInfo.Name, instanceInfo.InstanceID)
 		fmt.Printf("Current state: %s\n", instanceInfo.State)
 
-		if err := ec2.WaitForInstanceRunning(ctx, ec2Client, instanceInfo.InstanceID); err != nil {
+		if _, err := nodes.WaitForNode(ctx, instanceInfo.InstanceID, opts); err != nil {
 			log.Fatalf("Failed to wait for instance: %v", err)
 		}
 
 		fmt.Printf("\n✓ Instance %s is now running!\n", instanceInfo.InstanceID)
 	case "list":
-		instances, err := ec2.ListInstances(ctx, ec2Client)
+		instances, err := nodes.ListNodes(ctx)
 		if err != nil {
 			log.Fatalf("List command failed: %v", err)
 		}
@@ -70,8 +108,8 @@ func main() {
 		}
 
 		fmt.Printf("\nFound %d instance(s):\n\n", len(instances))
-		fmt.Printf("%-20s %-15s %-18s %-18s %-12s\n", "Instance ID", "State", "Type", "Public IP", "Private IP")
-		fmt.Println("--------------------------------------------------------------------------------")
+		fmt.Printf("%-24s %-20s %-15s %-18s %-18s %-12s\n", "Name", "Instance ID", "State", "Type", "Public IP", "Private IP")
+		fmt.Println("---------------------------------------------------------------------------------------------------------")
 
 		for _, info := range instances {
 			publicIP := info.PublicIP
@@ -82,21 +120,254 @@ func main() {
 			if privateIP == "" {
 				privateIP = "N/A"
 			}
-			fmt.Printf("%-20s %-15s %-18s %-18s %-12s\n",
-				info.InstanceID, info.State, info.InstanceType, publicIP, privateIP)
+			name := info.Name
+			if name == "" {
+				name = "-"
+			}
+			fmt.Printf("%-24s %-20s %-15s %-18s %-18s %-12s\n",
+				name, info.InstanceID, info.State, info.InstanceType, publicIP, privateIP)
 		}
 	case "delete":
-		if len(os.Args) < 3 {
-			log.Fatal("Delete command requires instance ID. Usage: delete <instance-id>")
+		fs := flag.NewFlagSet("delete", flag.ExitOnError)
+		wait := fs.Bool("wait", false, "wait until the instance is terminated")
+		timeout := fs.Duration("timeout", ec2.DefaultWaitTimeout, "how long to wait for the instance")
+		selector := fs.String("selector", "", "delete every managed node with these tags instead, e.g. env=test,team=ci")
+		nodeRef, err := parseInstanceArgs(fs, os.Args[2:])
+		if *selector != "" {
+			if nodeRef != "" {
+				log.Fatal("Delete command takes either an instance ID or name or --selector, not both")
+			}
+			runBatchDelete(ctx, nodes, *selector, *wait, *timeout)
+			break
+		}
+		if err != nil {
+			log.Fatal("Delete command requires instance ID or name. Usage: delete <instance-id|name> [--wait] or delete --selector key=value [--wait]")
+		}
+		instanceID, err := nodes.ResolveNode(ctx, nodeRef)
+		if err != nil {
+			log.Fatalf("Delete command failed: %v", err)
 		}
-		instanceID := os.Args[2]
 		fmt.Printf("--- Deleting EC2 Instance: %s ---\n", instanceID)
-		if err := ec2.DeleteInstance(ctx, ec2Client, instanceID); err != nil {
+		if err := nodes.DeleteNode(ctx, instanceID); err != nil {
 			log.Fatalf("Delete command failed: %v", err)
 		}
 		fmt.Println("Instance termination in progress...")
+		if !*wait {
+			break
+		}
+
+		if _, err := nodes.WaitForNode(ctx, instanceID, newWaitOptions(*timeout, types.InstanceStateNameTerminated)); err != nil {
+			log.Fatalf("Failed to wait for instance: %v", err)
+		}
+		fmt.Printf("\n✓ Instance %s is now terminated\n", instanceID)
+	case "start", "stop", "reboot", "force-stop":
+		runPowerAction(ctx, nodes, ec2.PowerAction(command), os.Args[2:])
+	case "console":
+		runConsole(ctx, nodes, os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", command)
 		os.Exit(1)
 	}
 }
+
+func runPowerAction(ctx context.Context, nodes provider.Provider, action ec2.PowerAction, args []string) {
+	fs := flag.NewFlagSet(string(action), flag.ExitOnError)
+	// A rebooting instance stays running, so there is nothing to wait for
+	wait := new(bool)
+	timeout := new(time.Duration)
+	if _, ok := action.SettledState(); ok {
+		fs.BoolVar(wait, "wait", false, "wait until the instance has settled")
+		fs.DurationVar(timeout, "timeout", ec2.DefaultWaitTimeout, "how long to wait with --wait")
+	}
+	hibernate := false
+	if action == ec2.PowerActionStop {
+		fs.BoolVar(&hibernate, "hibernate", false, "hibernate instead of stopping")
+	}
+
+	nodeRef, err := parseInstanceArgs(fs, args)
+	if err != nil {
+		log.Fatalf("%s command requires instance ID or name. Usage: %s <instance-id|name> [flags]", action, action)
+	}
+
+	instanceID, err := nodes.ResolveNode(ctx, nodeRef)
+	if err != nil {
+		log.Fatalf("%s command failed: %v", action, err)
+	}
+
+	if hibernate {
+		action = ec2.PowerActionHibernate
+	}
+	if err := nodes.PowerNode(ctx, instanceID, action); err != nil {
+		log.Fatalf("%s command failed: %v", action, err)
+	}
+
+	fmt.Printf("Instance %s: %s in progress...\n", instanceID, action)
+	if !*wait {
+		return
+	}
+
+	settled, _ := action.SettledState()
+	if _, err := nodes.WaitForNode(ctx, instanceID, newWaitOptions(*timeout, settled)); err != nil {
+		log.Fatalf("Failed to wait for instance: %v", err)
+	}
+	fmt.Printf("\n✓ Instance %s is now %s\n", instanceID, settled)
+}
+
+// runBatchCreate launches count nodes at once. Nodes EC2 had no capacity
+// for are reported; the launched ones are kept and waited for.
+func runBatchCreate(ctx context.Context, nodes provider.Provider, config ec2.CreateInstanceConfig, prefix string, count int, opts ec2.WaitOptions) {
+	if count < 1 {
+		log.Fatal("Create command requires a positive --count")
+	}
+	names, err := provider.AssignNames(ctx, nodes, prefix, count, "")
+	if err != nil {
+		log.Fatalf("Invalid node name: %v", err)
+	}
+
+	launched, err := nodes.CreateNodes(ctx, config, names)
+	if len(launched) == 0 {
+		log.Fatalf("Create command failed: %v", err)
+	}
+	for _, info := range launched {
+		fmt.Printf("Instance launched! Name: %s, Instance ID: %s\n", info.Name, info.InstanceID)
+	}
+	if err != nil {
+		fmt.Printf("Only %d of %d instances launched: %v\n", len(launched), count, err)
+	}
+
+	failed := 0
+	for _, info := range launched {
+		if _, err := nodes.WaitForNode(ctx, info.InstanceID, opts); err != nil {
+			fmt.Printf("✗ Instance %s: %v\n", info.InstanceID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("✓ Instance %s is now running!\n", info.InstanceID)
+	}
+	if failed > 0 || len(launched) < count {
+		os.Exit(1)
+	}
+}
+
+// runBatchDelete deletes the managed nodes matching a selector. A failure
+// does not stop the other deletions.
+func runBatchDelete(ctx context.Context, nodes provider.Provider, rawSelector string, wait bool, timeout time.Duration) {
+	selector, err := provider.ParseSelector(rawSelector)
+	if err != nil {
+		log.Fatalf("Delete command failed: %v", err)
+	}
+	selected, err := provider.SelectNodes(ctx, nodes, selector)
+	if err != nil {
+		log.Fatalf("Delete command failed: %v", err)
+	}
+	if len(selected) == 0 {
+		fmt.Printf("No instances match %s.\n", selector)
+		return
+	}
+
+	fmt.Printf("--- Deleting %d EC2 Instance(s) matching %s ---\n", len(selected), selector)
+	var deleted []string
+	failed := 0
+	for _, info := range selected {
+		if err := nodes.DeleteNode(ctx, info.InstanceID); err != nil {
+			fmt.Printf("✗ %s (%s): %v\n", info.Name, info.InstanceID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("  %s (%s): termination in progress...\n", info.Name, info.InstanceID)
+		deleted = append(deleted, info.InstanceID)
+	}
+
+	if wait {
+		for _, instanceID := range deleted {
+			if _, err := nodes.WaitForNode(ctx, instanceID, newWaitOptions(timeout, types.InstanceStateNameTerminated)); err != nil {
+				fmt.Printf("✗ Instance %s: %v\n", instanceID, err)
+				failed++
+				continue
+			}
+			fmt.Printf("✓ Instance %s is now terminated\n", instanceID)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runConsole prints the serial console output of a node. With --follow it
+// keeps polling and prints only the new lines, until the node terminates.
+func runConsole(ctx context.Context, nodes provider.Provider, args []string) {
+	fs := flag.NewFlagSet("console", flag.ExitOnError)
+	follow := fs.Bool("follow", false, "keep polling and print new lines as they appear")
+	latest := fs.Bool("latest", false, "fetch the most recent output instead of the buffered one (Nitro instances only)")
+	interval := fs.Duration("interval", 5*time.Second, "how often to poll with --follow")
+
+	nodeRef, err := parseInstanceArgs(fs, args)
+	if err != nil {
+		log.Fatal("Console command requires instance ID or name. Usage: console <instance-id|name> [--follow] [--latest]")
+	}
+	instanceID, err := nodes.ResolveNode(ctx, nodeRef)
+	if err != nil {
+		log.Fatalf("Console command failed: %v", err)
+	}
+
+	if !*follow {
+		output, err := nodes.ConsoleOutput(ctx, instanceID, *latest)
+		if err != nil {
+			log.Fatalf("Console command failed: %v", err)
+		}
+		fmt.Print(output.Output)
+		return
+	}
+
+	var follower ec2.ConsoleFollower
+	for {
+		output, err := nodes.ConsoleOutput(ctx, instanceID, *latest)
+		if err != nil {
+			log.Fatalf("Console command failed: %v", err)
+		}
+		fmt.Print(follower.Next(output.Output))
+
+		info, err := nodes.GetNode(ctx, instanceID)
+		if err != nil {
+			log.Fatalf("Console command failed: %v", err)
+		}
+		if info.State == string(types.InstanceStateNameTerminated) {
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// newWaitOptions prints every state change while waiting.
+func newWaitOptions(timeout time.Duration, targets ...types.InstanceStateName) ec2.WaitOptions {
+	var lastState types.InstanceStateName
+	return ec2.WaitOptions{
+		TargetStates: targets,
+		Timeout:      timeout,
+		OnProgress: func(progress ec2.WaitProgress) {
+			if progress.State == "" || progress.State == lastState {
+				return
+			}
+			lastState = progress.State
+			fmt.Printf("  [%s] %s\n", progress.Elapsed.Round(time.Second), progress.State)
+		},
+	}
+}
+
+// parseInstanceArgs accepts the node reference either before or after the flags.
+func parseInstanceArgs(fs *flag.FlagSet, args []string) (string, error) {
+	var instanceID string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		instanceID, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if instanceID == "" {
+		instanceID = fs.Arg(0)
+	}
+	if instanceID == "" {
+		return "", fmt.Errorf("instance ID or name is required")
+	}
+	return instanceID, nil
+}
@@ -2,95 +2,157 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
+	"github.com/abteilung6/tilmancloud/pkg/awsconfig"
 	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
 )
 
 func main() {
-	runBuild()
+	awsConfig := awsconfig.FromEnv()
+	awsConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	runBuild(awsConfig)
 }
 
-func runBuild() {
+func runBuild(awsSettings awsconfig.Config) {
 	ctx := context.Background()
 	downloader := image.NewDownloader("build/images")
 	cloud_base_image_url := "https://download.fedoraproject.org/pub/fedora/linux/releases/43/Cloud/aarch64/images/Fedora-Cloud-Base-AmazonEC2-43-1.6.aarch64.raw.xz"
 
+	build := newBuildRecorder(ctx, cloud_base_image_url)
+
+	build.stage(inventory.BuildStageDownload)
 	err := downloader.Download(ctx, cloud_base_image_url)
 	if err != nil {
-		slog.Error("Failed to download image", "error", err)
-		os.Exit(1)
+		build.fail("Failed to download image", err)
 	}
 
+	build.stage(inventory.BuildStageDecompress)
 	compressedPath := downloader.GetCompressedPath(cloud_base_image_url)
 	rawPath, err := downloader.Decompress(ctx, compressedPath)
 	if err != nil {
-		slog.Error("Failed to decompress image", "error", err)
-		os.Exit(1)
+		build.fail("Failed to decompress image", err)
 	}
 
 	imageID, err := image.GenerateImageIDFromFile(rawPath)
 	if err != nil {
-		slog.Error("Failed to generate ImageID", "error", err)
-		os.Exit(1)
+		build.fail("Failed to generate ImageID", err)
 	}
 	slog.Info("Generated ImageID", "image_id", imageID)
+	build.record.ImageID = imageID
 
 	bucket := os.Getenv("AWS_S3_BUCKET")
 	if bucket == "" {
-		slog.Error("AWS_S3_BUCKET environment variable not set")
-		os.Exit(1)
-	}
-
-	region := os.Getenv("AWS_REGION")
-	if region == "" {
-		region = "eu-central-1"
+		build.fail("AWS_S3_BUCKET environment variable not set", nil)
 	}
 
-	uploader, err := image.NewS3Uploader(ctx, bucket, region)
+	awsConfig, err := awsconfig.Load(ctx, awsSettings)
 	if err != nil {
-		slog.Error("Failed to create S3 uploader", "error", err)
-		os.Exit(1)
+		build.fail("Failed to load AWS config", err)
 	}
 
+	uploader := image.NewS3Uploader(awsConfig, bucket, awsSettings.S3Options()...)
+
+	build.stage(inventory.BuildStageUpload)
 	s3Key := image.GenerateS3Key(rawPath)
 	err = uploader.Upload(ctx, rawPath, s3Key)
 	if err != nil {
-		slog.Error("Failed to upload image to S3", "error", err)
-		os.Exit(1)
+		build.fail("Failed to upload image to S3", err)
 	}
 	fmt.Printf("Image uploaded to S3: %s\n", uploader.GetS3URL(s3Key))
 
-	importer, err := image.NewImporter(ctx, region)
-	if err != nil {
-		slog.Error("Failed to create importer", "error", err)
-		os.Exit(1)
-	}
+	importer := image.NewImporter(awsConfig)
 
+	build.stage(inventory.BuildStageImport)
 	description := "Fedora 43 aarch64 base image"
 	snapshotID, err := importer.ImportSnapshot(ctx, bucket, s3Key, description, imageID)
 	if err != nil {
-		slog.Error("Failed to import snapshot", "error", err)
-		os.Exit(1)
+		build.fail("Failed to import snapshot", err)
 	}
 
 	fmt.Printf("Snapshot created: %s\n", snapshotID)
+	build.record.SnapshotID = snapshotID
 
-	registrar, err := image.NewAMIRegistrar(ctx, region)
-	if err != nil {
-		slog.Error("Failed to create AMI registrar", "error", err)
-		os.Exit(1)
-	}
+	registrar := image.NewAMIRegistrar(awsConfig)
 
+	build.stage(inventory.BuildStageRegister)
 	amiName := fmt.Sprintf("fedora-43-aarch64-base-%s", imageID)
 	amiID, err := registrar.RegisterAMI(ctx, snapshotID, imageID, amiName, description)
 	if err != nil {
-		slog.Error("Failed to register AMI", "error", err)
-		os.Exit(1)
+		build.fail("Failed to register AMI", err)
 	}
 
 	fmt.Printf("AMI registered: %s\n", amiID)
+	build.record.AMIID = amiID
+	build.finish(nil)
+}
+
+// buildRecorder records the build in the inventory file shared with the
+// admin API. Recording is best effort and never fails the build.
+type buildRecorder struct {
+	ctx    context.Context
+	store  inventory.Store
+	record inventory.BuildRecord
+}
+
+func newBuildRecorder(ctx context.Context, sourceURL string) *buildRecorder {
+	b := &buildRecorder{
+		ctx: ctx,
+		record: inventory.BuildRecord{
+			ID:        inventory.NewID("build"),
+			SourceURL: sourceURL,
+			CreatedBy: os.Getenv("USER"),
+			Status:    inventory.OperationRunning,
+			StartedAt: time.Now().UTC(),
+		},
+	}
+	store, err := inventory.OpenFileStore(inventory.PathFromEnv())
+	if err != nil {
+		slog.Warn("Inventory unavailable, build will not be recorded", "error", err)
+		return b
+	}
+	b.store = store
+	return b
+}
+
+func (b *buildRecorder) stage(stage string) {
+	b.record.Stage = stage
+	b.save()
+}
+
+func (b *buildRecorder) fail(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "error", err)
+		b.finish(fmt.Errorf("%s: %w", msg, err))
+	} else {
+		slog.Error(msg)
+		b.finish(fmt.Errorf("%s", msg))
+	}
+	os.Exit(1)
+}
 
+func (b *buildRecorder) finish(err error) {
+	finished := time.Now().UTC()
+	b.record.FinishedAt = &finished
+	b.record.Status = inventory.OperationSucceeded
+	if err != nil {
+		b.record.Status = inventory.OperationFailed
+		b.record.Error = err.Error()
+	}
+	b.save()
+}
+
+func (b *buildRecorder) save() {
+	if b.store == nil {
+		return
+	}
+	if err := b.store.PutBuild(b.ctx, b.record); err != nil {
+		slog.Warn("Failed to record build", "build_id", b.record.ID, "error", err)
+	}
 }
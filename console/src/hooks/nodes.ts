@@ -13,12 +13,16 @@ export const useNodesQuery = () => {
   })
 }
 
+// Each create is sent with its own Idempotency-Key, so retries of the same
+// create never launch a second node
 export const useCreateNode = () => {
   const queryClient = useQueryClient()
 
   return useMutation({
-    mutationFn: async () => {
-      const response = await apiClient.createNode()
+    mutationFn: async (idempotencyKey: string) => {
+      const response = await apiClient.createNode({
+        headers: { 'Idempotency-Key': idempotencyKey },
+      })
       return response.data
     },
     onSuccess: () => {
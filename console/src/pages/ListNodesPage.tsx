@@ -124,7 +124,7 @@ const ListNodesPage: React.FC = () => {
   })
 
   const handleCreateNode = () => {
-    createNodeMutation.mutate()
+    createNodeMutation.mutate(crypto.randomUUID())
   }
 
   return (
@@ -0,0 +1,246 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/eip"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/go-chi/chi/v5"
+)
+
+type AddressesHandler struct {
+	EC2Client ec2.EC2Client
+	// Inventory records every operation run against addresses. It defaults
+	// to an in-memory store.
+	Inventory inventory.Store
+	// Instances is invalidated after associate and disassociate, which
+	// change the public IP of a node; optional
+	Instances *InstanceCache
+	// Reconciler reports which addresses are idle; optional
+	Reconciler *eip.Reconciler
+}
+
+func NewAddressesHandler(ec2Client ec2.EC2Client) *AddressesHandler {
+	return &AddressesHandler{
+		EC2Client: ec2Client,
+		Inventory: inventory.NewMemoryStore(),
+	}
+}
+
+func (h *AddressesHandler) ListAddresses(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	addresses, err := ec2.ListAddresses(ctx, h.EC2Client)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	response := make([]generated.Address, 0, len(addresses))
+	for _, address := range addresses {
+		response = append(response, h.convertAddressInfoToAddress(address))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AddressesHandler) AllocateAddress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request generated.AllocateAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	config := ec2.AllocateAddressConfig{
+		Name:            derefString(request.Name),
+		ReleaseWithNode: derefBool(request.ReleaseWithNode),
+	}
+	if request.NodeId != nil && *request.NodeId != "" {
+		instanceID, err := ec2.ResolveInstanceID(ctx, h.EC2Client, *request.NodeId)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		config.NodeID = instanceID
+	} else if config.ReleaseWithNode {
+		WriteProblem(w, http.StatusBadRequest, "releaseWithNode requires nodeId")
+		return
+	}
+
+	started := time.Now()
+	address, err := ec2.AllocateAddress(ctx, h.EC2Client, config)
+	op := inventory.OperationRecord{Type: "allocate-address", Target: config.Name, Actor: requestActor(r)}
+	if config.NodeID != "" {
+		op.Params = map[string]string{"nodeId": config.NodeID}
+		if config.ReleaseWithNode {
+			op.Params["releaseWithNode"] = "true"
+		}
+	}
+	if err == nil {
+		op.Target = address.AllocationID
+	}
+	recordOperation(ctx, h.Inventory, op, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	if config.NodeID != "" {
+		started = time.Now()
+		address, err = ec2.AssociateAddress(ctx, h.EC2Client, address.AllocationID, config.NodeID)
+		recordOperation(ctx, h.Inventory, inventory.OperationRecord{
+			Type:   "associate-address",
+			Target: op.Target,
+			Actor:  requestActor(r),
+			Params: map[string]string{"nodeId": config.NodeID},
+		}, started, err)
+		if err != nil {
+			// The address stays tied to the node and is associated by the
+			// reconciler once the node can take it
+			WriteError(w, err)
+			return
+		}
+		h.Instances.Invalidate()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h.convertAddressInfoToAddress(address))
+}
+
+func (h *AddressesHandler) GetAddress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	allocationID := chi.URLParam(r, "allocationId")
+
+	if allocationID == "" {
+		WriteProblem(w, http.StatusBadRequest, "allocationId is required")
+		return
+	}
+
+	address, err := ec2.GetAddress(ctx, h.EC2Client, allocationID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.convertAddressInfoToAddress(address))
+}
+
+func (h *AddressesHandler) ReleaseAddress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	allocationID := chi.URLParam(r, "allocationId")
+
+	if allocationID == "" {
+		WriteProblem(w, http.StatusBadRequest, "allocationId is required")
+		return
+	}
+
+	started := time.Now()
+	err := ec2.ReleaseAddress(ctx, h.EC2Client, allocationID)
+	recordOperation(ctx, h.Inventory, inventory.OperationRecord{Type: "release-address", Target: allocationID, Actor: requestActor(r)}, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AddressesHandler) AssociateAddress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	allocationID := chi.URLParam(r, "allocationId")
+
+	if allocationID == "" {
+		WriteProblem(w, http.StatusBadRequest, "allocationId is required")
+		return
+	}
+
+	var request generated.AssociateAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.NodeId == "" {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body, nodeId is required")
+		return
+	}
+
+	instanceID, err := ec2.ResolveInstanceID(ctx, h.EC2Client, request.NodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	started := time.Now()
+	address, err := ec2.AssociateAddress(ctx, h.EC2Client, allocationID, instanceID)
+	recordOperation(ctx, h.Inventory, inventory.OperationRecord{
+		Type:   "associate-address",
+		Target: allocationID,
+		Actor:  requestActor(r),
+		Params: map[string]string{"nodeId": instanceID},
+	}, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	h.Instances.Invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.convertAddressInfoToAddress(address))
+}
+
+func (h *AddressesHandler) DisassociateAddress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	allocationID := chi.URLParam(r, "allocationId")
+
+	if allocationID == "" {
+		WriteProblem(w, http.StatusBadRequest, "allocationId is required")
+		return
+	}
+
+	started := time.Now()
+	address, err := ec2.DisassociateAddress(ctx, h.EC2Client, allocationID)
+	recordOperation(ctx, h.Inventory, inventory.OperationRecord{Type: "disassociate-address", Target: allocationID, Actor: requestActor(r)}, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	h.Instances.Invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.convertAddressInfoToAddress(address))
+}
+
+func (h *AddressesHandler) convertAddressInfoToAddress(address ec2.AddressInfo) generated.Address {
+	response := generated.Address{
+		Id:              address.AllocationID,
+		PublicIp:        address.PublicIP,
+		Name:            stringPtrOrNil(address.Name),
+		NodeId:          stringPtrOrNil(address.NodeID),
+		Associated:      address.Associated(),
+		AssociationId:   stringPtrOrNil(address.AssociationID),
+		ReleaseWithNode: address.ReleaseWithNode,
+	}
+	if address.InstanceID != "" {
+		response.NodeId = &address.InstanceID
+	}
+	if !address.Associated() {
+		// Unassociated addresses are billed even before the reconciler
+		// has seen them
+		response.Idle = true
+		if since, ok := h.Reconciler.IdleSince(address.AllocationID); ok {
+			response.IdleSince = &since
+		}
+	}
+	return response
+}
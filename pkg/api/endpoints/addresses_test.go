@@ -0,0 +1,137 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/go-chi/chi/v5"
+)
+
+func withAllocationID(req *http.Request, allocationID string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("allocationId", allocationID)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// newAddressesMock serves one managed address, which is associated once
+// AssociateAddress is called.
+func newAddressesMock(t *testing.T) *ec2.MockEC2Client {
+	t.Helper()
+	address := types.Address{
+		AllocationId: aws.String("eipalloc-1"),
+		PublicIp:     aws.String("3.120.0.10"),
+		Tags:         []types.Tag{{Key: aws.String(ec2.TagManagedBy), Value: aws.String(ec2.ManagedByValue)}},
+	}
+	return &ec2.MockEC2Client{
+		AllocateAddressFunc: func(ctx context.Context, params *awsec2.AllocateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AllocateAddressOutput, error) {
+			address.Tags = params.TagSpecifications[0].Tags
+			return &awsec2.AllocateAddressOutput{AllocationId: address.AllocationId, PublicIp: address.PublicIp}, nil
+		},
+		DescribeAddressesFunc: func(ctx context.Context, params *awsec2.DescribeAddressesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeAddressesOutput, error) {
+			return &awsec2.DescribeAddressesOutput{Addresses: []types.Address{address}}, nil
+		},
+		AssociateAddressFunc: func(ctx context.Context, params *awsec2.AssociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AssociateAddressOutput, error) {
+			address.AssociationId = aws.String("eipassoc-1")
+			address.InstanceId = params.InstanceId
+			return &awsec2.AssociateAddressOutput{AssociationId: address.AssociationId}, nil
+		},
+		CreateTagsFunc: func(ctx context.Context, params *awsec2.CreateTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateTagsOutput, error) {
+			address.Tags = append(address.Tags, params.Tags...)
+			return &awsec2.CreateTagsOutput{}, nil
+		},
+		ReleaseAddressFunc: func(ctx context.Context, params *awsec2.ReleaseAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.ReleaseAddressOutput, error) {
+			return &awsec2.ReleaseAddressOutput{}, nil
+		},
+	}
+}
+
+func TestAddressesHandler_AllocateAddress(t *testing.T) {
+	handler := NewAddressesHandler(newAddressesMock(t))
+
+	body := `{"name": "ingress", "nodeId": "i-1234567890abcdef0", "releaseWithNode": true}`
+	req := httptest.NewRequest("POST", "/addresses", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.AllocateAddress(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response generated.Address
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Id != "eipalloc-1" || !response.Associated || response.Idle || !response.ReleaseWithNode {
+		t.Errorf("unexpected address %+v", response)
+	}
+	if response.NodeId == nil || *response.NodeId != "i-1234567890abcdef0" {
+		t.Errorf("expected node i-1234567890abcdef0, got %v", response.NodeId)
+	}
+
+	ops, _ := handler.Inventory.ListOperations(context.Background(), "eipalloc-1")
+	if len(ops) != 2 || ops[0].Type != "associate-address" || ops[1].Type != "allocate-address" {
+		t.Errorf("expected allocate-address and associate-address operations, got %+v", ops)
+	}
+}
+
+func TestAddressesHandler_AllocateAddress_ReleaseWithoutNode(t *testing.T) {
+	handler := NewAddressesHandler(newAddressesMock(t))
+
+	req := httptest.NewRequest("POST", "/addresses", strings.NewReader(`{"releaseWithNode": true}`))
+	w := httptest.NewRecorder()
+
+	handler.AllocateAddress(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAddressesHandler_ListAddresses_Idle(t *testing.T) {
+	handler := NewAddressesHandler(newAddressesMock(t))
+
+	req := httptest.NewRequest("GET", "/addresses", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListAddresses(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response []generated.Address
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response) != 1 || !response[0].Idle || response[0].Associated {
+		t.Errorf("expected one idle address, got %+v", response)
+	}
+}
+
+func TestAddressesHandler_ReleaseAddress_Associated(t *testing.T) {
+	mockClient := newAddressesMock(t)
+	handler := NewAddressesHandler(mockClient)
+
+	if _, err := ec2.AssociateAddress(context.Background(), mockClient, "eipalloc-1", "i-1234567890abcdef0"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	req := withAllocationID(httptest.NewRequest("DELETE", "/addresses/eipalloc-1", nil), "eipalloc-1")
+	w := httptest.NewRecorder()
+
+	handler.ReleaseAddress(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+}
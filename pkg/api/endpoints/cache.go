@@ -0,0 +1,36 @@
+package endpoints
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/cache"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+)
+
+// CacheAgeHeader reports how many seconds old a cached list response is.
+const CacheAgeHeader = "X-Cache-Age"
+
+// InstanceCache caches ec2.ListInstances for GET /nodes. Handlers that change
+// instances invalidate it.
+type InstanceCache = cache.Cache[[]ec2.InstanceInfo]
+
+// cacheOptions honours Cache-Control: no-cache (and the HTTP/1.0 Pragma
+// equivalent) by forcing a refresh.
+func cacheOptions(r *http.Request) cache.GetOptions {
+	for _, header := range []string{"Cache-Control", "Pragma"} {
+		for _, directive := range strings.Split(r.Header.Get(header), ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+				return cache.GetOptions{Refresh: true}
+			}
+		}
+	}
+	return cache.GetOptions{}
+}
+
+func writeCacheAge[T any](w http.ResponseWriter, entry cache.Entry[T]) {
+	age := max(entry.Age(time.Now()), 0)
+	w.Header().Set(CacheAgeHeader, strconv.Itoa(int(age/time.Second)))
+}
@@ -0,0 +1,83 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetNodeConsole returns the serial console output of a node, e.g. to see
+// why a node never became reachable. With ?latest=true the most recent
+// output is fetched rather than the buffered one.
+func (h *NodesHandler) GetNodeConsole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	nodeId := chi.URLParam(r, "nodeId")
+
+	if nodeId == "" {
+		WriteProblem(w, http.StatusBadRequest, "nodeId is required")
+		return
+	}
+
+	latest, err := parseBoolParam(r, "latest")
+	if err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid latest parameter")
+		return
+	}
+
+	_, region, instanceID, err := h.locateNode(r, nodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	output, err := region.Provider.ConsoleOutput(ctx, instanceID, latest)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	response := generated.ConsoleOutput{
+		NodeId: output.InstanceID,
+		Output: output.Output,
+	}
+	if !output.Timestamp.IsZero() {
+		response.Timestamp = &output.Timestamp
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetNodeScreenshot returns a PNG screenshot of a node's display.
+func (h *NodesHandler) GetNodeScreenshot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	nodeId := chi.URLParam(r, "nodeId")
+
+	if nodeId == "" {
+		WriteProblem(w, http.StatusBadRequest, "nodeId is required")
+		return
+	}
+
+	_, region, instanceID, err := h.locateNode(r, nodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	screenshot, err := region.Provider.ConsoleScreenshot(ctx, instanceID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(screenshot)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(screenshot)
+}
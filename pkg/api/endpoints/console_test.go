@@ -0,0 +1,118 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/provider/sim"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/go-chi/chi/v5"
+)
+
+func withNodeID(req *http.Request, nodeID string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", nodeID)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestNodesHandler_GetNodeConsole(t *testing.T) {
+	mockClient := &ec2.MockEC2Client{
+		GetConsoleOutputFunc: func(ctx context.Context, params *awsec2.GetConsoleOutputInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleOutputOutput, error) {
+			if !aws.ToBool(params.Latest) {
+				t.Error("expected the latest output to be requested")
+			}
+			return &awsec2.GetConsoleOutputOutput{
+				InstanceId: params.InstanceId,
+				Output:     aws.String(base64.StdEncoding.EncodeToString([]byte("web login: \n"))),
+			}, nil
+		},
+	}
+	handler := NewNodesHandler(mockClient, nil)
+
+	req := withNodeID(httptest.NewRequest("GET", "/nodes/i-1234567890abcdef0/console?latest=true", nil), "i-1234567890abcdef0")
+	w := httptest.NewRecorder()
+	handler.GetNodeConsole(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response generated.ConsoleOutput
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.NodeId != "i-1234567890abcdef0" || response.Output != "web login: \n" || response.Timestamp != nil {
+		t.Errorf("expected the decoded output without a timestamp, got %+v", response)
+	}
+}
+
+func TestNodesHandler_GetNodeScreenshot(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatalf("failed to encode JPEG: %v", err)
+	}
+	mockClient := &ec2.MockEC2Client{
+		GetConsoleScreenshotFunc: func(ctx context.Context, params *awsec2.GetConsoleScreenshotInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleScreenshotOutput, error) {
+			return &awsec2.GetConsoleScreenshotOutput{
+				InstanceId: params.InstanceId,
+				ImageData:  aws.String(base64.StdEncoding.EncodeToString(jpg.Bytes())),
+			}, nil
+		},
+	}
+	handler := NewNodesHandler(mockClient, nil)
+
+	req := withNodeID(httptest.NewRequest("GET", "/nodes/i-1234567890abcdef0/screenshot", nil), "i-1234567890abcdef0")
+	w := httptest.NewRecorder()
+	handler.GetNodeScreenshot(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("expected content type image/png, got %s", contentType)
+	}
+	if !bytes.HasPrefix(w.Body.Bytes(), []byte("\x89PNG")) {
+		t.Error("expected a PNG body")
+	}
+}
+
+func TestNodesHandler_GetNodeScreenshot_Unsupported(t *testing.T) {
+	simProvider := sim.New(sim.Config{})
+	t.Cleanup(simProvider.Close)
+	handler := NewNodesHandler(nil, simProvider)
+	handler.Provider = simProvider
+
+	info, err := simProvider.CreateNode(context.Background(), ec2.CreateInstanceConfig{Name: "web", ImageID: "ami-0000000000000sim0"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	req := withNodeID(httptest.NewRequest("GET", "/nodes/web/screenshot", nil), "web")
+	w := httptest.NewRecorder()
+	handler.GetNodeScreenshot(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = withNodeID(httptest.NewRequest("GET", "/nodes/web/console", nil), "web")
+	w = httptest.NewRecorder()
+	handler.GetNodeConsole(w, req)
+
+	var response generated.ConsoleOutput
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.NodeId != info.InstanceID || response.Output == "" || response.Timestamp == nil {
+		t.Errorf("expected the simulated boot output, got %+v", response)
+	}
+}
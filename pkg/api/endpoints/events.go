@@ -0,0 +1,162 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+)
+
+// DefaultKeepAlive is how often an idle event stream sends a comment so
+// proxies do not close the connection.
+const DefaultKeepAlive = 15 * time.Second
+
+// resetEvent is sent without an ID, so it does not move the client's
+// resume position.
+const resetEvent = "reset"
+
+var knownEventTypes = []events.Type{events.TypeNodeState, events.TypeBuildStage, events.TypeImageState, events.TypeSpotInterruption}
+
+type EventsHandler struct {
+	Bus       *events.Bus
+	KeepAlive time.Duration
+}
+
+func NewEventsHandler(bus *events.Bus) *EventsHandler {
+	return &EventsHandler{
+		Bus:       bus,
+		KeepAlive: DefaultKeepAlive,
+	}
+}
+
+// StreamEvents streams bus events as Server-Sent Events. Clients resume with
+// the Last-Event-ID header, which EventSource sends on reconnect, or the
+// lastEventId query parameter. When events after that ID were already
+// dropped, a reset event comes first, telling the client to reload its
+// state instead of relying on the replay.
+func (h *EventsHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	types, err := parseEventTypes(r.URL.Query().Get("types"))
+	if err != nil {
+		WriteProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var afterID uint64
+	if lastEventID != "" {
+		afterID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			WriteProblem(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	sub := h.Bus.Subscribe(ctx, afterID, types...)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Disable response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if sub.Truncated {
+		if _, err := io.WriteString(w, "event: "+resetEvent+"\ndata: {\"reason\":\"truncated\"}\n\n"); err != nil {
+			return
+		}
+	}
+	for _, event := range sub.Replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(h.KeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// Fell too far behind; the client reconnects with
+				// Last-Event-ID and resumes from the ring buffer
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(convertEventToGenerated(event))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+func parseEventTypes(value string) ([]events.Type, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var types []events.Type
+	for _, name := range strings.Split(value, ",") {
+		typ := events.Type(strings.TrimSpace(name))
+		if !isKnownEventType(typ) {
+			return nil, fmt.Errorf("unknown event type %q", name)
+		}
+		types = append(types, typ)
+	}
+	return types, nil
+}
+
+func isKnownEventType(typ events.Type) bool {
+	for _, known := range knownEventTypes {
+		if typ == known {
+			return true
+		}
+	}
+	return false
+}
+
+func convertEventToGenerated(event events.Event) generated.Event {
+	converted := generated.Event{
+		Id:      strconv.FormatUint(event.ID, 10),
+		Type:    generated.EventType(event.Type),
+		Time:    event.Time,
+		Subject: event.Subject,
+	}
+	// Round-trip the typed payload into the generic schema
+	if raw, err := json.Marshal(event.Data); err == nil {
+		json.Unmarshal(raw, &converted.Data)
+	}
+	return converted
+}
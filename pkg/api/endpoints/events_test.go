@@ -0,0 +1,174 @@
+package endpoints
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+)
+
+type sseMessage struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSE reads the next message from an event stream, skipping comments.
+func readSSE(reader *bufio.Reader) (sseMessage, error) {
+	var msg sseMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return msg, err
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if msg.id != "" || msg.event != "" {
+				return msg, nil
+			}
+		case strings.HasPrefix(line, "id: "):
+			msg.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// openEventStream starts a test server for the handler and connects to it.
+// The stream is closed before the server on cleanup, since the server waits
+// for open streams.
+func openEventStream(t *testing.T, handler *EventsHandler, path, lastEventID string) *bufio.Reader {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(handler.StreamEvents))
+	t.Cleanup(server.Close)
+
+	req, _ := http.NewRequest("GET", server.URL+path, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", contentType)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestEventsHandler_StreamEvents(t *testing.T) {
+	bus := events.NewBus(0)
+	stream := openEventStream(t, NewEventsHandler(bus), "/events?types=node.state", "")
+
+	// Publish until the subscription is registered; earlier events are only
+	// delivered through the ring buffer
+	type result struct {
+		msg sseMessage
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		msg, err := readSSE(stream)
+		done <- result{msg, err}
+	}()
+
+	var msg sseMessage
+	deadline := time.After(5 * time.Second)
+	for msg.id == "" {
+		bus.Publish(events.TypeBuildStage, "build-1", events.BuildStageChanged{BuildID: "build-1"})
+		bus.Publish(events.TypeNodeState, "i-1", events.NodeStateChanged{InstanceID: "i-1", State: "running"})
+		select {
+		case r := <-done:
+			if r.err != nil {
+				t.Fatalf("failed to read event stream: %v", r.err)
+			}
+			msg = r.msg
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+
+	if msg.event != "node.state" {
+		t.Errorf("expected only node.state events, got %q", msg.event)
+	}
+	var event generated.Event
+	if err := json.Unmarshal([]byte(msg.data), &event); err != nil {
+		t.Fatalf("failed to decode event data: %v", err)
+	}
+	if event.Id != msg.id || event.Subject != "i-1" || event.Data["state"] != "running" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestEventsHandler_StreamEvents_Resume(t *testing.T) {
+	bus := events.NewBus(0)
+	bus.Publish(events.TypeNodeState, "i-1", events.NodeStateChanged{InstanceID: "i-1", State: "pending"})
+	bus.Publish(events.TypeNodeState, "i-1", events.NodeStateChanged{InstanceID: "i-1", State: "running"})
+	bus.Publish(events.TypeImageState, "ami-1", events.ImageStateChanged{AMIID: "ami-1", State: "available"})
+
+	stream := openEventStream(t, NewEventsHandler(bus), "/events", "1")
+
+	first, err := readSSE(stream)
+	if err != nil {
+		t.Fatalf("failed to read event stream: %v", err)
+	}
+	second, err := readSSE(stream)
+	if err != nil {
+		t.Fatalf("failed to read event stream: %v", err)
+	}
+	if first.id != "2" || second.id != "3" || second.event != "image.state" {
+		t.Errorf("expected events 2 and 3 to be replayed, got %+v and %+v", first, second)
+	}
+}
+
+func TestEventsHandler_StreamEvents_ResetWhenTruncated(t *testing.T) {
+	bus := events.NewBus(2)
+	for _, state := range []string{"pending", "running", "stopping", "stopped"} {
+		bus.Publish(events.TypeNodeState, "i-1", events.NodeStateChanged{InstanceID: "i-1", State: state})
+	}
+
+	// Events 1 and 2 were dropped from the buffer
+	stream := openEventStream(t, NewEventsHandler(bus), "/events", "1")
+
+	reset, err := readSSE(stream)
+	if err != nil {
+		t.Fatalf("failed to read event stream: %v", err)
+	}
+	if reset.event != "reset" || reset.id != "" {
+		t.Errorf("expected a reset without an ID first, got %+v", reset)
+	}
+	replayed, err := readSSE(stream)
+	if err != nil {
+		t.Fatalf("failed to read event stream: %v", err)
+	}
+	if replayed.id != "3" {
+		t.Errorf("expected the buffered events to follow, got %+v", replayed)
+	}
+}
+
+func TestEventsHandler_StreamEvents_InvalidParams(t *testing.T) {
+	handler := NewEventsHandler(events.NewBus(0))
+
+	for _, target := range []string{"/events?types=node.bogus", "/events?lastEventId=abc"} {
+		w := httptest.NewRecorder()
+		handler.StreamEvents(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", target, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/go-chi/chi/v5"
+)
+
+type FirewallHandler struct {
+	EC2Client ec2.EC2Client
+	// Instances is the node list cache to invalidate when a node's security
+	// groups change; optional
+	Instances *InstanceCache
+}
+
+func NewFirewallHandler(ec2Client ec2.EC2Client) *FirewallHandler {
+	return &FirewallHandler{
+		EC2Client: ec2Client,
+	}
+}
+
+func (h *FirewallHandler) GetNodeFirewall(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	nodeId := chi.URLParam(r, "nodeId")
+
+	if nodeId == "" {
+		WriteProblem(w, http.StatusBadRequest, "nodeId is required")
+		return
+	}
+
+	instanceID, err := ec2.ResolveInstanceID(ctx, h.EC2Client, nodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	groupID, rules, err := ec2.GetFirewallRules(ctx, h.EC2Client, instanceID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertFirewallRulesToNodeFirewall(groupID, rules))
+}
+
+func (h *FirewallHandler) UpdateNodeFirewall(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	nodeId := chi.URLParam(r, "nodeId")
+
+	if nodeId == "" {
+		WriteProblem(w, http.StatusBadRequest, "nodeId is required")
+		return
+	}
+
+	var request generated.UpdateNodeFirewallRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rules := make([]ec2.FirewallRule, 0, len(request.Rules))
+	for _, rule := range request.Rules {
+		rules = append(rules, convertGeneratedFirewallRule(rule))
+	}
+
+	instanceID, err := ec2.ResolveInstanceID(ctx, h.EC2Client, nodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	groupID, applied, err := ec2.SetFirewallRules(ctx, h.EC2Client, instanceID, rules)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	h.Instances.Invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertFirewallRulesToNodeFirewall(groupID, applied))
+}
+
+func convertGeneratedFirewallRule(rule generated.FirewallRule) ec2.FirewallRule {
+	converted := ec2.FirewallRule{
+		Protocol: string(rule.Protocol),
+	}
+	// Rules for all protocols cover every port
+	if converted.Protocol != ec2.ProtocolAll {
+		if rule.FromPort != nil {
+			converted.FromPort = *rule.FromPort
+		}
+		if rule.ToPort != nil {
+			converted.ToPort = *rule.ToPort
+		} else {
+			// A single port can be given as just fromPort
+			converted.ToPort = converted.FromPort
+		}
+	}
+	if rule.Cidr != nil {
+		converted.CIDR = *rule.Cidr
+	}
+	if rule.SourceGroupId != nil {
+		converted.SourceGroupID = *rule.SourceGroupId
+	}
+	if rule.Description != nil {
+		converted.Description = *rule.Description
+	}
+	return converted
+}
+
+func convertFirewallRulesToNodeFirewall(groupID string, rules []ec2.FirewallRule) generated.NodeFirewall {
+	firewall := generated.NodeFirewall{
+		GroupId: stringPtrOrNil(groupID),
+		Rules:   make([]generated.FirewallRule, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		converted := generated.FirewallRule{
+			Protocol:      generated.FirewallRuleProtocol(rule.Protocol),
+			Cidr:          stringPtrOrNil(rule.CIDR),
+			SourceGroupId: stringPtrOrNil(rule.SourceGroupID),
+			Description:   stringPtrOrNil(rule.Description),
+		}
+		if rule.Protocol != ec2.ProtocolAll {
+			fromPort, toPort := rule.FromPort, rule.ToPort
+			converted.FromPort = &fromPort
+			converted.ToPort = &toPort
+		}
+		firewall.Rules = append(firewall.Rules, converted)
+	}
+	return firewall
+}
@@ -0,0 +1,109 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestFirewallHandler_GetNodeFirewall(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+	expectedGroupID := "sg-0123456789abcdef0"
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeSecurityGroupsFunc: func(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+			return &awsec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []types.SecurityGroup{
+					{
+						GroupId: aws.String(expectedGroupID),
+						IpPermissions: []types.IpPermission{
+							{
+								IpProtocol:       aws.String("-1"),
+								UserIdGroupPairs: []types.UserIdGroupPair{{GroupId: aws.String("sg-0987654321fedcba0")}},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewFirewallHandler(mockClient)
+
+	req := httptest.NewRequest("GET", "/nodes/"+expectedInstanceID+"/firewall", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.GetNodeFirewall(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response generated.NodeFirewall
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if response.GroupId == nil || *response.GroupId != expectedGroupID {
+		t.Errorf("expected group ID %s, got %v", expectedGroupID, response.GroupId)
+	}
+	if len(response.Rules) != 1 {
+		t.Fatalf("expected 1 rule, got %d", len(response.Rules))
+	}
+	if response.Rules[0].Protocol != generated.All {
+		t.Errorf("expected protocol all, got %s", response.Rules[0].Protocol)
+	}
+	if response.Rules[0].SourceGroupId == nil || *response.Rules[0].SourceGroupId != "sg-0987654321fedcba0" {
+		t.Errorf("expected source group sg-0987654321fedcba0, got %v", response.Rules[0].SourceGroupId)
+	}
+}
+
+func TestFirewallHandler_UpdateNodeFirewall_InvalidRule(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	handler := NewFirewallHandler(&ec2.MockEC2Client{})
+
+	body := `{"rules": [{"protocol": "tcp", "fromPort": 22}]}`
+	req := httptest.NewRequest("PUT", "/nodes/"+expectedInstanceID+"/firewall", strings.NewReader(body))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.UpdateNodeFirewall(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestFirewallHandler_GetNodeFirewall_NotFound(t *testing.T) {
+	mockClient := &ec2.MockEC2Client{
+		DescribeSecurityGroupsFunc: func(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+			return &awsec2.DescribeSecurityGroupsOutput{}, nil
+		},
+		DescribeInstancesFunc: emptyDescribeInstances,
+	}
+	handler := NewFirewallHandler(mockClient)
+
+	req := withNodeID(httptest.NewRequest("GET", "/nodes/i-0000000000000000f/firewall", nil), "i-0000000000000000f")
+	w := httptest.NewRecorder()
+	handler.GetNodeFirewall(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
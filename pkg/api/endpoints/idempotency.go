@@ -0,0 +1,102 @@
+package endpoints
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/abteilung6/tilmancloud/pkg/idempotency"
+)
+
+// IdempotencyKeyHeader carries the client-chosen key that makes a mutating
+// request safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader marks a response replayed for a retried request.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength bounds the keys clients may send.
+const maxIdempotencyKeyLength = 255
+
+// Idempotent replays the recorded response when a mutating request is
+// retried with the same Idempotency-Key, and answers 409 when the key is
+// reused for a different request or its first request is still in
+// progress. Server errors are not recorded, so the request can be retried.
+// Handlers find the key in the request context, see
+// idempotency.KeyFromContext.
+func Idempotent(store *idempotency.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				WriteProblem(w, http.StatusBadRequest, "Idempotency-Key must not be longer than 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			response, err := store.Begin(key, idempotency.Fingerprint(r.Method, r.URL.RequestURI(), body))
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			if response != nil {
+				for name, values := range response.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(response.Status)
+				w.Write(response.Body)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				if !completed {
+					store.Release(key)
+				}
+			}()
+			next.ServeHTTP(recorder, r.WithContext(idempotency.WithKey(r.Context(), key)))
+			if recorder.status < http.StatusInternalServerError {
+				store.Complete(key, idempotency.Response{
+					Status: recorder.status,
+					Header: recorder.Header(),
+					Body:   recorder.body.Bytes(),
+				})
+				completed = true
+			}
+		})
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
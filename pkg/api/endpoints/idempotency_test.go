@@ -0,0 +1,117 @@
+package endpoints
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/idempotency"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestIdempotent_CreateNode(t *testing.T) {
+	var clientTokens []string
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			clientTokens = append(clientTokens, aws.ToString(params.ClientToken))
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{{
+					InstanceId: aws.String("i-1234567890abcdef0"),
+					State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+				}},
+			}, nil
+		},
+	}
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+	handler := Idempotent(idempotency.NewStore())(http.HandlerFunc(NewNodesHandler(mockClient, mockAMIFinder).CreateNode))
+
+	createNode := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/nodes", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "create-web")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	first := createNode(`{"name":"web"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, first.Code, first.Body.String())
+	}
+	if len(clientTokens) != 1 || clientTokens[0] != idempotency.ClientToken("create-web") {
+		t.Errorf("expected the client token derived from the key, got %v", clientTokens)
+	}
+
+	retried := createNode(`{"name":"web"}`)
+	if retried.Code != http.StatusCreated || retried.Body.String() != first.Body.String() {
+		t.Errorf("expected the original response, got %d: %s", retried.Code, retried.Body.String())
+	}
+	if retried.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected the replayed response to be marked")
+	}
+	if len(clientTokens) != 1 {
+		t.Errorf("expected a single launch, got %d", len(clientTokens))
+	}
+
+	reused := createNode(`{"name":"db"}`)
+	if reused.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, reused.Code)
+	}
+	if problem := decodeProblem(t, reused); problem.Code != generated.Conflict {
+		t.Errorf("expected a conflict problem, got %+v", problem)
+	}
+}
+
+func TestIdempotent_ServerErrorNotRecorded(t *testing.T) {
+	calls := 0
+	handler := Idempotent(idempotency.NewStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			WriteProblem(w, http.StatusServiceUnavailable, "try again")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, expected := range []int{http.StatusServiceUnavailable, http.StatusNoContent, http.StatusNoContent} {
+		req := httptest.NewRequest("DELETE", "/nodes/web", nil)
+		req.Header.Set(IdempotencyKeyHeader, "delete-web")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("expected status code %d, got %d", expected, w.Code)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected the handler to run until it succeeded, got %d calls", calls)
+	}
+}
+
+func TestIdempotent_WithoutKey(t *testing.T) {
+	calls := 0
+	handler := Idempotent(idempotency.NewStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if key := idempotency.KeyFromContext(r.Context()); key != "" {
+			t.Errorf("expected no key, got %q", key)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for range 2 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/nodes", nil))
+	}
+	if calls != 2 {
+		t.Errorf("expected requests without a key to run every time, got %d calls", calls)
+	}
+}
@@ -1,40 +1,88 @@
 package endpoints
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/cache"
 	"github.com/abteilung6/tilmancloud/pkg/image"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
 type ImagesHandler struct {
 	ImageLister image.ImageLister
+	// Region names the region of ImageLister; images are labelled with it
+	Region string
+	// Regions are the regions served besides Region, keyed by name. Images
+	// are listed across all of them; optional
+	Regions map[string]Region
+	// Images caches the AMI list behind GET /images
+	Images *cache.Cache[[]RegionImage]
+}
+
+// RegionImage is an AMI and the region it is registered in.
+type RegionImage struct {
+	Region string
+	types.Image
 }
 
 func NewImagesHandler(imageLister image.ImageLister) *ImagesHandler {
-	return &ImagesHandler{
+	h := &ImagesHandler{
 		ImageLister: imageLister,
 	}
+	h.Images = cache.New(func(ctx context.Context) ([]RegionImage, error) {
+		var all []RegionImage
+		for _, name := range regionNames(h.Region, h.Regions) {
+			lister := h.ImageLister
+			if name != h.Region {
+				lister = h.Regions[name].Images
+			}
+			images, err := lister.ListImages(ctx)
+			if err != nil {
+				if len(h.Regions) > 0 {
+					return nil, fmt.Errorf("region %s: %w", name, err)
+				}
+				return nil, err
+			}
+			for _, awsImage := range images {
+				all = append(all, RegionImage{Region: name, Image: awsImage})
+			}
+		}
+		return all, nil
+	})
+	return h
 }
 
 func (h *ImagesHandler) ListImages(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	awsImages, err := h.ImageLister.ListImages(ctx)
+	region, err := regionParam(r, h.Region, h.Regions)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	entry, err := h.Images.Get(ctx, cacheOptions(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 
-	images := make([]generated.Image, 0, len(awsImages))
-	for _, awsImage := range awsImages {
-		image := convertAWSImageToGenerated(awsImage)
+	images := make([]generated.Image, 0, len(entry.Value))
+	for _, regionImage := range entry.Value {
+		if region != "" && regionImage.Region != region {
+			continue
+		}
+		image := convertAWSImageToGenerated(regionImage.Image)
+		image.Region = stringPtrOrNil(regionImage.Region)
 		images = append(images, image)
 	}
 
+	writeCacheAge(w, entry)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(images)
@@ -223,3 +223,37 @@ func TestImagesHandler_ListImages_MissingTags(t *testing.T) {
 		t.Errorf("expected snapshotId to be nil when tag is missing, got %v", image.SnapshotId)
 	}
 }
+
+func TestImagesHandler_ListImages_Cached(t *testing.T) {
+	calls := 0
+	mockLister := &image.MockImageLister{
+		ListImagesFunc: func(ctx context.Context) ([]types.Image, error) {
+			calls++
+			return []types.Image{{ImageId: aws.String("ami-1234567890abcdef0")}}, nil
+		},
+	}
+
+	handler := NewImagesHandler(mockLister)
+	handler.Images.MinRefreshInterval = 0
+
+	for range 3 {
+		w := httptest.NewRecorder()
+		handler.ListImages(w, httptest.NewRequest("GET", "/images", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if w.Header().Get(CacheAgeHeader) != "0" {
+			t.Errorf("expected %s 0, got %q", CacheAgeHeader, w.Header().Get(CacheAgeHeader))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 DescribeImages call, got %d", calls)
+	}
+
+	req := httptest.NewRequest("GET", "/images", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	handler.ListImages(httptest.NewRecorder(), req)
+	if calls != 2 {
+		t.Errorf("expected no-cache to force a reload, got %d calls", calls)
+	}
+}
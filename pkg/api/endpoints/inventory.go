@@ -0,0 +1,204 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+)
+
+// ActorHeader names the caller a mutating request is attributed to.
+const ActorHeader = "X-Actor"
+
+type InventoryHandler struct {
+	Store inventory.Store
+}
+
+func NewInventoryHandler(store inventory.Store) *InventoryHandler {
+	return &InventoryHandler{
+		Store: store,
+	}
+}
+
+func (h *InventoryHandler) ListNodes(w http.ResponseWriter, r *http.Request) {
+	records, err := h.Store.ListNodes(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	nodes := make([]generated.InventoryNode, 0, len(records))
+	for _, record := range records {
+		nodes = append(nodes, convertNodeRecordToGenerated(record))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(nodes)
+}
+
+func (h *InventoryHandler) ListImages(w http.ResponseWriter, r *http.Request) {
+	records, err := h.Store.ListImages(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	images := make([]generated.InventoryImage, 0, len(records))
+	for _, record := range records {
+		images = append(images, convertImageRecordToGenerated(record))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(images)
+}
+
+func (h *InventoryHandler) ListBuilds(w http.ResponseWriter, r *http.Request) {
+	records, err := h.Store.ListBuilds(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	builds := make([]generated.InventoryBuild, 0, len(records))
+	for _, record := range records {
+		builds = append(builds, generated.InventoryBuild{
+			Id:         record.ID,
+			SourceUrl:  stringPtrOrNil(record.SourceURL),
+			ImageId:    stringPtrOrNil(record.ImageID),
+			SnapshotId: stringPtrOrNil(record.SnapshotID),
+			AmiId:      stringPtrOrNil(record.AMIID),
+			CreatedBy:  stringPtrOrNil(record.CreatedBy),
+			Stage:      stringPtrOrNil(record.Stage),
+			Status:     generated.OperationStatus(record.Status),
+			Error:      stringPtrOrNil(record.Error),
+			StartedAt:  record.StartedAt,
+			FinishedAt: record.FinishedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(builds)
+}
+
+func (h *InventoryHandler) ListOperations(w http.ResponseWriter, r *http.Request) {
+	records, err := h.Store.ListOperations(r.Context(), r.URL.Query().Get("target"))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	operations := make([]generated.Operation, 0, len(records))
+	for _, record := range records {
+		operations = append(operations, generated.Operation{
+			Id:         record.ID,
+			Type:       record.Type,
+			Target:     stringPtrOrNil(record.Target),
+			Actor:      stringPtrOrNil(record.Actor),
+			Params:     mapPtrOrNil(record.Params),
+			Status:     generated.OperationStatus(record.Status),
+			Error:      stringPtrOrNil(record.Error),
+			StartedAt:  record.StartedAt,
+			FinishedAt: record.FinishedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(operations)
+}
+
+// requestActor returns who a request is attributed to: the X-Actor header,
+// or the client address when it is not set.
+func requestActor(r *http.Request) string {
+	if actor := r.Header.Get(ActorHeader); actor != "" {
+		return actor
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// recordOperation appends a finished operation to the inventory. Inventory
+// failures are logged and never fail the request itself.
+func recordOperation(ctx context.Context, store inventory.Store, op inventory.OperationRecord, started time.Time, err error) {
+	finished := time.Now().UTC()
+	op.StartedAt = started.UTC()
+	op.FinishedAt = &finished
+	op.Status = inventory.OperationSucceeded
+	if err != nil {
+		op.Status = inventory.OperationFailed
+		op.Error = err.Error()
+	}
+	// The request context may already be cancelled by a timed-out wait
+	if _, recordErr := store.AddOperation(context.WithoutCancel(ctx), op); recordErr != nil {
+		slog.Warn("Failed to record operation", "type", op.Type, "target", op.Target, "error", recordErr)
+	}
+}
+
+func convertNodeRecordToGenerated(record inventory.NodeRecord) generated.InventoryNode {
+	node := generated.InventoryNode{
+		Id:          record.InstanceID,
+		Name:        stringPtrOrNil(record.Name),
+		Pool:        stringPtrOrNil(record.Pool),
+		CreatedBy:   stringPtrOrNil(record.CreatedBy),
+		CreatedAt:   timePtrOrNil(record.CreatedAt),
+		Params:      mapPtrOrNil(record.Params),
+		State:       stringPtrOrNil(record.State),
+		StateReason: stringPtrOrNil(record.StateReason),
+		LastSeenAt:  record.LastSeenAt,
+		DeletedBy:   stringPtrOrNil(record.DeletedBy),
+		DeletedAt:   record.DeletedAt,
+		DriftDetail: stringPtrOrNil(record.DriftDetail),
+	}
+	if record.Drift != inventory.DriftNone {
+		drift := generated.Drift(record.Drift)
+		node.Drift = &drift
+	}
+	return node
+}
+
+func convertImageRecordToGenerated(record inventory.ImageRecord) generated.InventoryImage {
+	image := generated.InventoryImage{
+		AmiId:       record.AMIID,
+		Name:        stringPtrOrNil(record.Name),
+		ImageId:     stringPtrOrNil(record.ImageID),
+		SnapshotId:  stringPtrOrNil(record.SnapshotID),
+		BuildId:     stringPtrOrNil(record.BuildID),
+		State:       stringPtrOrNil(record.State),
+		CreatedAt:   timePtrOrNil(record.CreatedAt),
+		LastSeenAt:  record.LastSeenAt,
+		RemovedAt:   record.RemovedAt,
+		DriftDetail: stringPtrOrNil(record.DriftDetail),
+	}
+	if record.Drift != inventory.DriftNone {
+		drift := generated.Drift(record.Drift)
+		image.Drift = &drift
+	}
+	return image
+}
+
+func timePtrOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func mapPtrOrNil(m map[string]string) *map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	m = maps.Clone(m)
+	return &m
+}
@@ -0,0 +1,84 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+)
+
+func TestInventoryHandler_ListNodes(t *testing.T) {
+	ctx := context.Background()
+	store := inventory.NewMemoryStore()
+	store.PutNode(ctx, inventory.NodeRecord{
+		InstanceID: "i-1",
+		Name:       "brave-otter",
+		CreatedBy:  "alice",
+		CreatedAt:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Params:     map[string]string{"instanceType": "t4g.micro"},
+		Drift:      inventory.DriftMissing,
+	})
+	store.PutNode(ctx, inventory.NodeRecord{InstanceID: "i-2", CreatedAt: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)})
+
+	handler := NewInventoryHandler(store)
+
+	req := httptest.NewRequest("GET", "/inventory/nodes", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListNodes(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var nodes []generated.InventoryNode
+	if err := json.NewDecoder(w.Body).Decode(&nodes); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(nodes))
+	}
+	if nodes[0].Id != "i-1" || nodes[0].CreatedBy == nil || *nodes[0].CreatedBy != "alice" {
+		t.Errorf("unexpected node %+v", nodes[0])
+	}
+	if nodes[0].Drift == nil || *nodes[0].Drift != generated.Missing {
+		t.Errorf("expected drift %q, got %v", generated.Missing, nodes[0].Drift)
+	}
+	if nodes[0].Params == nil || (*nodes[0].Params)["instanceType"] != "t4g.micro" {
+		t.Errorf("expected params to be returned, got %v", nodes[0].Params)
+	}
+	if nodes[1].Drift != nil || nodes[1].CreatedBy != nil {
+		t.Errorf("expected empty fields to be omitted, got %+v", nodes[1])
+	}
+}
+
+func TestInventoryHandler_ListOperations(t *testing.T) {
+	ctx := context.Background()
+	store := inventory.NewMemoryStore()
+	store.AddOperation(ctx, inventory.OperationRecord{Type: "create-node", Target: "i-1", Status: inventory.OperationSucceeded})
+	store.AddOperation(ctx, inventory.OperationRecord{Type: "create-node", Target: "i-2", Status: inventory.OperationFailed, Error: "boom"})
+
+	handler := NewInventoryHandler(store)
+
+	req := httptest.NewRequest("GET", "/operations?target=i-2", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListOperations(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var ops []generated.Operation
+	if err := json.NewDecoder(w.Body).Decode(&ops); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(ops) != 1 || ops[0].Status != generated.OperationStatusFailed || ops[0].Error == nil || *ops[0].Error != "boom" {
+		t.Errorf("unexpected operations %+v", ops)
+	}
+}
@@ -0,0 +1,94 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/go-chi/chi/v5"
+)
+
+type KeysHandler struct {
+	EC2Client ec2.EC2Client
+}
+
+func NewKeysHandler(ec2Client ec2.EC2Client) *KeysHandler {
+	return &KeysHandler{
+		EC2Client: ec2Client,
+	}
+}
+
+func (h *KeysHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	keyPairs, err := ec2.ListKeyPairs(ctx, h.EC2Client)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	keys := make([]generated.Key, 0, len(keyPairs))
+	for _, keyPair := range keyPairs {
+		keys = append(keys, convertKeyPairInfoToKey(keyPair))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (h *KeysHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request generated.CreateKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	keyPair, err := ec2.ImportKeyPair(ctx, h.EC2Client, request.Name, request.PublicKey)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(convertKeyPairInfoToKey(keyPair))
+}
+
+func (h *KeysHandler) DeleteKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keyName := chi.URLParam(r, "keyName")
+
+	if keyName == "" {
+		WriteProblem(w, http.StatusBadRequest, "keyName is required")
+		return
+	}
+
+	if err := ec2.DeleteKeyPair(ctx, h.EC2Client, keyName); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func convertKeyPairInfoToKey(keyPair ec2.KeyPairInfo) generated.Key {
+	key := generated.Key{
+		Name:        keyPair.Name,
+		Id:          stringPtrOrNil(keyPair.KeyPairID),
+		Fingerprint: keyPair.Fingerprint,
+		PublicKey:   stringPtrOrNil(keyPair.PublicKey),
+	}
+	if keyPair.Type != "" {
+		keyType := generated.KeyType(keyPair.Type)
+		key.Type = &keyType
+	}
+	if !keyPair.CreatedAt.IsZero() {
+		createdAt := keyPair.CreatedAt
+		key.CreatedAt = &createdAt
+	}
+	return key
+}
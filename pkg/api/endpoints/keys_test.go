@@ -0,0 +1,170 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/go-chi/chi/v5"
+)
+
+const testPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOHq0aMV4QaLQDtJPTuCcADy0zAGZEFCwO2z7OqNVhTW alice@laptop"
+
+func TestKeysHandler_CreateKey(t *testing.T) {
+	expectedName := "alice-laptop"
+	expectedKeyPairID := "key-0123456789abcdef0"
+
+	mockClient := &ec2.MockEC2Client{
+		ImportKeyPairFunc: func(ctx context.Context, params *awsec2.ImportKeyPairInput, optFns ...func(*awsec2.Options)) (*awsec2.ImportKeyPairOutput, error) {
+			if params.KeyName == nil || *params.KeyName != expectedName {
+				t.Errorf("expected key name %s, got %v", expectedName, params.KeyName)
+			}
+			if string(params.PublicKeyMaterial) != testPublicKey {
+				t.Errorf("expected public key material %q, got %q", testPublicKey, params.PublicKeyMaterial)
+			}
+			return &awsec2.ImportKeyPairOutput{
+				KeyName:   aws.String(expectedName),
+				KeyPairId: aws.String(expectedKeyPairID),
+			}, nil
+		},
+	}
+
+	handler := NewKeysHandler(mockClient)
+
+	body := `{"name": "` + expectedName + `", "publicKey": "` + testPublicKey + `"}`
+	req := httptest.NewRequest("POST", "/keys", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreateKey(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var response generated.Key
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if response.Name != expectedName {
+		t.Errorf("expected name %s, got %s", expectedName, response.Name)
+	}
+	if response.Id == nil || *response.Id != expectedKeyPairID {
+		t.Errorf("expected key pair ID %s, got %v", expectedKeyPairID, response.Id)
+	}
+	if response.Fingerprint != "SHA256:RnhYSu+YTO0ACnAa1yPXDpGgEUogIkOnNPDunlXHmOQ" {
+		t.Errorf("unexpected fingerprint %s", response.Fingerprint)
+	}
+	if response.Type == nil || *response.Type != generated.Ed25519 {
+		t.Errorf("expected type %s, got %v", generated.Ed25519, response.Type)
+	}
+}
+
+func TestKeysHandler_CreateKey_InvalidKey(t *testing.T) {
+	handler := NewKeysHandler(&ec2.MockEC2Client{})
+
+	body := `{"name": "alice-laptop", "publicKey": "ssh-dss AAAAB3NzaC1kc3M="}`
+	req := httptest.NewRequest("POST", "/keys", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreateKey(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestKeysHandler_CreateKey_Duplicate(t *testing.T) {
+	mockClient := &ec2.MockEC2Client{
+		ImportKeyPairFunc: func(ctx context.Context, params *awsec2.ImportKeyPairInput, optFns ...func(*awsec2.Options)) (*awsec2.ImportKeyPairOutput, error) {
+			return nil, &smithy.GenericAPIError{Code: "InvalidKeyPair.Duplicate", Message: "The keypair already exists"}
+		},
+	}
+
+	handler := NewKeysHandler(mockClient)
+
+	body := `{"name": "alice-laptop", "publicKey": "` + testPublicKey + `"}`
+	req := httptest.NewRequest("POST", "/keys", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreateKey(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestKeysHandler_ListKeys(t *testing.T) {
+	mockClient := &ec2.MockEC2Client{
+		DescribeKeyPairsFunc: func(ctx context.Context, params *awsec2.DescribeKeyPairsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeKeyPairsOutput, error) {
+			if params.IncludePublicKey == nil || !*params.IncludePublicKey {
+				t.Error("expected public keys to be included")
+			}
+			return &awsec2.DescribeKeyPairsOutput{
+				KeyPairs: []types.KeyPairInfo{
+					{
+						KeyName:        aws.String("alice-laptop"),
+						KeyPairId:      aws.String("key-0123456789abcdef0"),
+						KeyType:        types.KeyTypeEd25519,
+						KeyFingerprint: aws.String("ec2-format-fingerprint"),
+						PublicKey:      aws.String(testPublicKey),
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewKeysHandler(mockClient)
+
+	req := httptest.NewRequest("GET", "/keys", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListKeys(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response []generated.Key
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if len(response) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(response))
+	}
+	if response[0].Fingerprint != "SHA256:RnhYSu+YTO0ACnAa1yPXDpGgEUogIkOnNPDunlXHmOQ" {
+		t.Errorf("expected OpenSSH fingerprint, got %s", response[0].Fingerprint)
+	}
+}
+
+func TestKeysHandler_DeleteKey_NotFound(t *testing.T) {
+	mockClient := &ec2.MockEC2Client{
+		DescribeKeyPairsFunc: func(ctx context.Context, params *awsec2.DescribeKeyPairsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeKeyPairsOutput, error) {
+			return nil, &smithy.GenericAPIError{Code: "InvalidKeyPair.NotFound", Message: "The key pair does not exist"}
+		},
+	}
+
+	handler := NewKeysHandler(mockClient)
+
+	req := httptest.NewRequest("DELETE", "/keys/unknown", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("keyName", "unknown")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.DeleteKey(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
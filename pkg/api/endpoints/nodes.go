@@ -1,13 +1,26 @@
 package endpoints
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/cache"
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
 	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/eip"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+	"github.com/abteilung6/tilmancloud/pkg/idempotency"
 	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/go-chi/chi/v5"
 )
@@ -15,44 +28,261 @@ import (
 type NodesHandler struct {
 	EC2Client ec2.EC2Client
 	AMIFinder image.AMIFinder
+	// Provider runs the node lifecycle in the default region. It defaults
+	// to EC2 through EC2Client and AMIFinder; key pairs, static IPs and spot
+	// nodes are only available with an EC2Client.
+	Provider provider.Provider
+	// Templates resolves cloud-init templates referenced on creation. It
+	// defaults to an empty store and is shared with the TemplatesHandler.
+	Templates *cloudinit.TemplateStore
+	// WaitOptions tunes timeout and backoff for ?wait=true requests; the
+	// target states are set per request
+	WaitOptions ec2.WaitOptions
+	// Inventory records who created and deleted nodes and every operation
+	// run against them. It defaults to an in-memory store.
+	Inventory inventory.Store
+	// Instances caches the instance list behind GET /nodes and is
+	// invalidated by every mutation made through this handler
+	Instances *InstanceCache
+	// Events publishes the node state transitions this handler observes,
+	// including those seen while waiting; optional
+	Events *events.NodeTracker
+	// Addresses is triggered after a node with a static IP was created in
+	// Region without waiting, to associate the address once the node runs;
+	// optional. Other regions bring their own.
+	Addresses *eip.Reconciler
+	// Region names the region of EC2Client and AMIFinder; nodes are
+	// labelled with it
+	Region string
+	// Regions are the regions served besides Region, keyed by name. Nodes
+	// are listed across all of them; optional
+	Regions map[string]Region
 }
 
 func NewNodesHandler(ec2Client ec2.EC2Client, amiFinder image.AMIFinder) *NodesHandler {
-	return &NodesHandler{
+	h := &NodesHandler{
 		EC2Client: ec2Client,
 		AMIFinder: amiFinder,
+		Templates: cloudinit.NewTemplateStore(),
+		Inventory: inventory.NewMemoryStore(),
 	}
+	h.Instances = cache.New(func(ctx context.Context) ([]ec2.InstanceInfo, error) {
+		var all []ec2.InstanceInfo
+		for _, name := range regionNames(h.Region, h.Regions) {
+			region, err := h.region(name)
+			if err != nil {
+				return nil, err
+			}
+			instances, err := region.Provider.ListNodes(ctx)
+			if err != nil {
+				if len(h.Regions) > 0 {
+					return nil, fmt.Errorf("region %s: %w", name, err)
+				}
+				return nil, err
+			}
+			for i := range instances {
+				instances[i].Region = name
+			}
+			h.attachSpotStatus(ctx, region, instances)
+			all = append(all, instances...)
+		}
+		return all, nil
+	})
+	return h
 }
 
 func (h *NodesHandler) CreateNode(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	amiID, err := h.AMIFinder.FindLatestAMI(ctx)
+	var request generated.CreateNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	wait, err := parseWaitParam(r)
+	if err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid wait parameter")
+		return
+	}
+	statusChecks, err := parseBoolParam(r, "statusChecks")
+	if err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid statusChecks parameter")
+		return
+	}
+	spot, err := spotOptions(request)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	regionName := derefString(request.Region)
+	region, err := h.region(regionName)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if regionName == "" {
+		regionName = h.Region
+	}
+	client := region.EC2Client
+
+	staticIP := derefBool(request.StaticIp)
+	if client == nil {
+		if err := requireEC2(request, staticIP); err != nil {
+			WriteError(w, err)
+			return
+		}
+	}
+
+	amiID, err := region.Provider.FindLatestAMI(ctx)
 	if err != nil {
-		http.Error(w, "No AMI available. Please build an AMI first.", http.StatusServiceUnavailable)
+		if errors.Is(err, image.ErrNoAMI) {
+			WriteProblem(w, http.StatusServiceUnavailable, "No AMI available. Please build an AMI first.")
+			return
+		}
+		WriteError(w, err)
 		return
 	}
 
 	config := ec2.CreateInstanceConfig{
 		ImageID:      amiID,
 		InstanceType: types.InstanceTypeT4gMicro,
+		Spot:         spot,
+		Hibernation:  derefBool(request.Hibernation),
+		Tags:         map[string]string{},
+	}
+	if request.Spot != nil && derefBool(request.Spot.ReplaceOnInterruption) {
+		config.Tags[ec2.TagSpotReplace] = "true"
+	}
+
+	// A retry that reaches EC2 again still launches only one instance. The
+	// instance of an earlier attempt, e.g. one that failed after the launch,
+	// is found by the request tag and keeps its name, as EC2 only replays a
+	// launch whose parameters are unchanged.
+	var launched ec2.InstanceInfo
+	retried := false
+	if key := idempotency.KeyFromContext(ctx); key != "" {
+		config.ClientToken = idempotency.ClientToken(key)
+		config.Tags[ec2.TagRequest] = newRequestID(config.ClientToken)
+		launched, retried, err = provider.FindTagged(ctx, region.Provider, ec2.TagRequest, config.Tags[ec2.TagRequest])
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+	}
+
+	name := launched.Name
+	if !retried {
+		requestedName := ""
+		if request.Name != nil {
+			requestedName = *request.Name
+		}
+		name, err = region.Provider.AssignNodeName(ctx, requestedName)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+	}
+	config.Name = name
+
+	if request.KeyName != nil && *request.KeyName != "" {
+		if _, err := ec2.GetKeyPair(ctx, client, *request.KeyName); err != nil {
+			if errors.Is(err, ec2.ErrKeyPairNotFound) {
+				WriteProblem(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteError(w, err)
+			return
+		}
+		config.KeyName = *request.KeyName
+	}
+
+	if request.UserData != nil {
+		templateName := derefString(request.UserData.Template)
+		userData, err := renderUserData(ctx, client, h.Templates, templateName, request.UserData.Variables, name)
+		if err != nil {
+			if errors.Is(err, cloudinit.ErrTemplateNotFound) {
+				WriteProblem(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			writeTemplateError(w, err)
+			return
+		}
+		config.UserData = userData.Content
+	}
+
+	started := time.Now()
+	actor := requestActor(r)
+	params := createParams(config, request.UserData)
+	if len(h.Regions) > 0 {
+		params["region"] = regionName
+	}
+	if staticIP {
+		params["staticIp"] = "true"
 	}
 
-	instanceInfo, err := ec2.CreateInstance(ctx, h.EC2Client, config)
+	instanceInfo, err := region.Provider.CreateNode(ctx, config)
+	op := inventory.OperationRecord{Type: "create-node", Target: name, Actor: actor, Params: params}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		recordOperation(ctx, h.Inventory, op, started, err)
+		WriteError(w, err)
 		return
 	}
 
-	state := generated.NodeState(instanceInfo.State)
-	response := generated.Node{
-		Name:         instanceInfo.InstanceID,
-		State:        &state,
-		InstanceType: stringPtrOrNil(instanceInfo.InstanceType),
-		PublicIp:     stringPtrOrNil(instanceInfo.PublicIP),
-		PrivateIp:    stringPtrOrNil(instanceInfo.PrivateIP),
+	instanceInfo.Region = regionName
+	h.Instances.Invalidate()
+	h.observeNode(instanceInfo)
+	op.Target = instanceInfo.InstanceID
+	recordOperation(ctx, h.Inventory, op, started, nil)
+	h.recordNode(ctx, inventory.NodeRecord{
+		InstanceID: instanceInfo.InstanceID,
+		Name:       instanceInfo.Name,
+		Region:     regionName,
+		CreatedBy:  actor,
+		CreatedAt:  started.UTC(),
+		Params:     params,
+		State:      instanceInfo.State,
+	})
+
+	var address ec2.AddressInfo
+	if staticIP {
+		address, err = h.allocateStaticIP(ctx, client, instanceInfo, actor, retried)
+		if err != nil {
+			WriteProblem(w, http.StatusInternalServerError, fmt.Sprintf("Node %s created, but allocating its static IP failed: %v", instanceInfo.InstanceID, err))
+			return
+		}
 	}
 
+	if wait {
+		instanceInfo, err = h.waitForNode(ctx, region.Provider, instanceInfo.InstanceID, statusChecks, types.InstanceStateNameRunning)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		instanceInfo.Region = regionName
+		if staticIP {
+			started := time.Now()
+			_, err := ec2.AssociateAddress(ctx, client, address.AllocationID, instanceInfo.InstanceID)
+			recordOperation(ctx, h.Inventory, inventory.OperationRecord{
+				Type:   "associate-address",
+				Target: address.AllocationID,
+				Actor:  actor,
+				Params: map[string]string{"nodeId": instanceInfo.InstanceID},
+			}, started, err)
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			h.Instances.Invalidate()
+			instanceInfo.PublicIP = address.PublicIP
+		}
+	} else if staticIP {
+		// The node is still pending and cannot take the address yet
+		region.Addresses.Trigger()
+	}
+
+	response := convertInstanceInfoToNode(instanceInfo)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
@@ -61,52 +291,534 @@ func (h *NodesHandler) CreateNode(w http.ResponseWriter, r *http.Request) {
 func (h *NodesHandler) ListNodes(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	instances, err := ec2.ListInstances(ctx, h.EC2Client)
+	region, err := regionParam(r, h.Region, h.Regions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 
-	nodes := make([]generated.Node, 0, len(instances))
-	for _, instanceInfo := range instances {
-		state := generated.NodeState(instanceInfo.State)
-		node := generated.Node{
-			Name:         instanceInfo.InstanceID,
-			State:        &state,
-			InstanceType: stringPtrOrNil(instanceInfo.InstanceType),
-			PublicIp:     stringPtrOrNil(instanceInfo.PublicIP),
-			PrivateIp:    stringPtrOrNil(instanceInfo.PrivateIP),
+	entry, err := h.Instances.Get(ctx, cacheOptions(r))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	nodes := make([]generated.Node, 0, len(entry.Value))
+	for _, instanceInfo := range entry.Value {
+		if region != "" && instanceInfo.Region != region {
+			continue
 		}
-		nodes = append(nodes, node)
+		nodes = append(nodes, convertInstanceInfoToNode(instanceInfo))
 	}
 
+	writeCacheAge(w, entry)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(nodes)
 }
 
+func (h *NodesHandler) GetNode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	nodeId := chi.URLParam(r, "nodeId")
+
+	if nodeId == "" {
+		WriteProblem(w, http.StatusBadRequest, "nodeId is required")
+		return
+	}
+
+	regionName, region, instanceID, err := h.locateNode(r, nodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	instanceInfo, err := region.Provider.GetNode(ctx, instanceID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	instanceInfo.Region = regionName
+	instances := []ec2.InstanceInfo{instanceInfo}
+	h.attachSpotStatus(ctx, region, instances)
+
+	response := convertInstanceInfoToNode(instances[0])
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
 func (h *NodesHandler) DeleteNode(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	nodeId := chi.URLParam(r, "nodeId")
 
 	if nodeId == "" {
-		http.Error(w, "nodeId is required", http.StatusBadRequest)
+		WriteProblem(w, http.StatusBadRequest, "nodeId is required")
 		return
 	}
 
-	err := ec2.DeleteInstance(ctx, h.EC2Client, nodeId)
+	wait, err := parseWaitParam(r)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "InvalidInstanceID") {
-			http.Error(w, "Node not found", http.StatusNotFound)
+		WriteProblem(w, http.StatusBadRequest, "Invalid wait parameter")
+		return
+	}
+
+	_, region, instanceID, err := h.locateNode(r, nodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	if err := h.deleteNode(ctx, region, instanceID, requestActor(r)); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	if wait {
+		if _, err := h.waitForNode(ctx, region.Provider, instanceID, false, types.InstanceStateNameTerminated); err != nil {
+			WriteError(w, err)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// deleteNode terminates a node and records it, releasing the static IPs
+// released with it.
+func (h *NodesHandler) deleteNode(ctx context.Context, region Region, instanceID, actor string) error {
+	started := time.Now()
+	err := region.Provider.DeleteNode(ctx, instanceID)
+	recordOperation(ctx, h.Inventory, inventory.OperationRecord{Type: "delete-node", Target: instanceID, Actor: actor}, started, err)
+	if err != nil {
+		return err
+	}
+	h.Instances.Invalidate()
+	h.Events.Observe(events.NodeStateChanged{InstanceID: instanceID, State: string(types.InstanceStateNameShuttingDown)})
+	if err := inventory.MarkNodeDeleted(ctx, h.Inventory, instanceID, actor); err != nil {
+		slog.Warn("Failed to record node deletion", "instance_id", instanceID, "error", err)
+	}
+	if region.EC2Client != nil {
+		h.releaseStaticIPs(ctx, region.EC2Client, instanceID, actor)
+		h.deleteSecurityGroup(ctx, region.EC2Client, instanceID)
+	}
+	return nil
+}
+
+func (h *NodesHandler) StartNode(w http.ResponseWriter, r *http.Request) {
+	h.handlePowerAction(w, r, ec2.PowerActionStart)
+}
+
+func (h *NodesHandler) StopNode(w http.ResponseWriter, r *http.Request) {
+	var request generated.StopNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	action := ec2.PowerActionStop
+	if request.Hibernate != nil && *request.Hibernate {
+		action = ec2.PowerActionHibernate
+	}
+	h.handlePowerAction(w, r, action)
+}
+
+func (h *NodesHandler) ForceStopNode(w http.ResponseWriter, r *http.Request) {
+	h.handlePowerAction(w, r, ec2.PowerActionForceStop)
+}
+
+func (h *NodesHandler) RebootNode(w http.ResponseWriter, r *http.Request) {
+	h.handlePowerAction(w, r, ec2.PowerActionReboot)
+}
+
+// handlePowerAction runs a power action against a node. With ?wait=true the
+// response is only sent once the node has settled in its target state.
+func (h *NodesHandler) handlePowerAction(w http.ResponseWriter, r *http.Request, action ec2.PowerAction) {
+	ctx := r.Context()
+	nodeId := chi.URLParam(r, "nodeId")
+
+	if nodeId == "" {
+		WriteProblem(w, http.StatusBadRequest, "nodeId is required")
+		return
+	}
+
+	wait, err := parseWaitParam(r)
+	if err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid wait parameter")
+		return
+	}
+	settled, canSettle := action.SettledState()
+	if wait && !canSettle {
+		WriteProblem(w, http.StatusBadRequest, fmt.Sprintf("Waiting is not supported for %s: the node stays running", action))
+		return
+	}
+
+	regionName, region, instanceID, err := h.locateNode(r, nodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	started := time.Now()
+	err = region.Provider.PowerNode(ctx, instanceID, action)
+	op := inventory.OperationRecord{Type: string(action) + "-node", Target: instanceID, Actor: requestActor(r)}
+	recordOperation(ctx, h.Inventory, op, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	h.Instances.Invalidate()
+
+	status := http.StatusAccepted
+	var instanceInfo ec2.InstanceInfo
+	if wait {
+		instanceInfo, err = h.waitForNode(ctx, region.Provider, instanceID, false, settled)
+		status = http.StatusOK
+	} else {
+		instanceInfo, err = region.Provider.GetNode(ctx, instanceID)
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	instanceInfo.Region = regionName
+	h.observeNode(instanceInfo)
+
+	response := convertInstanceInfoToNode(instanceInfo)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *NodesHandler) waitForNode(ctx context.Context, nodes provider.Provider, instanceID string, statusChecks bool, targets ...types.InstanceStateName) (ec2.InstanceInfo, error) {
+	// The node has changed state by the time the wait returns
+	defer h.Instances.Invalidate()
+
+	opts := h.WaitOptions
+	opts.TargetStates = targets
+	opts.RequireStatusChecks = statusChecks
+	onProgress := opts.OnProgress
+	opts.OnProgress = func(progress ec2.WaitProgress) {
+		h.Events.Observe(events.NodeStateChanged{InstanceID: progress.InstanceID, State: string(progress.State)})
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+
+	info, err := nodes.WaitForNode(ctx, instanceID, opts)
+	if err == nil {
+		h.observeNode(info)
+	}
+	return info, err
+}
+
+func (h *NodesHandler) observeNode(info ec2.InstanceInfo) {
+	h.Events.Observe(events.NodeStateChanged{
+		InstanceID: info.InstanceID,
+		Name:       info.Name,
+		Pool:       info.Tags[ec2.TagPool],
+		State:      info.State,
+		Reason:     info.StateReason,
+	})
+}
+
+// region returns the clients of a served region. The empty name selects the
+// default region.
+func (h *NodesHandler) region(name string) (Region, error) {
+	if name == "" || name == h.Region {
+		return Region{EC2Client: h.EC2Client, AMIFinder: h.AMIFinder, Provider: h.Provider, Addresses: h.Addresses}.withProvider(), nil
+	}
+	region, ok := h.Regions[name]
+	if !ok {
+		return Region{}, fmt.Errorf("%w: %s", ErrUnknownRegion, name)
+	}
+	return region.withProvider(), nil
+}
+
+// locateNode resolves a node reference in the region given by the region
+// query parameter. Without it the node is looked up in the region it was
+// last listed in, falling back to the default region.
+func (h *NodesHandler) locateNode(r *http.Request, nodeRef string) (string, Region, string, error) {
+	ctx := r.Context()
+
+	name, err := regionParam(r, h.Region, h.Regions)
+	if err != nil {
+		return "", Region{}, "", err
+	}
+	if name == "" && len(h.Regions) > 0 {
+		if entry, err := h.Instances.Get(ctx, cache.GetOptions{}); err == nil {
+			for _, instance := range entry.Value {
+				if instance.InstanceID == nodeRef || instance.Name == nodeRef {
+					name = instance.Region
+					break
+				}
+			}
+		}
+	}
+	region, err := h.region(name)
+	if err != nil {
+		return "", Region{}, "", err
+	}
+	if name == "" {
+		name = h.Region
+	}
+
+	instanceID, err := region.Provider.ResolveNode(ctx, nodeRef)
+	if err != nil {
+		return "", Region{}, "", err
+	}
+	return name, region, instanceID, nil
+}
+
+// allocateStaticIP allocates an address tied to a new node and released with
+// it. It is associated once the node is running. A retried create reuses
+// the address an earlier attempt allocated for the node.
+func (h *NodesHandler) allocateStaticIP(ctx context.Context, client ec2.EC2Client, instanceInfo ec2.InstanceInfo, actor string, retried bool) (ec2.AddressInfo, error) {
+	if retried {
+		addresses, err := ec2.ListNodeAddresses(ctx, client, instanceInfo.InstanceID)
+		if err != nil {
+			return ec2.AddressInfo{}, err
+		}
+		if len(addresses) > 0 {
+			return addresses[0], nil
+		}
+	}
+	started := time.Now()
+	address, err := ec2.AllocateAddress(ctx, client, ec2.AllocateAddressConfig{
+		Name:            instanceInfo.Name,
+		NodeID:          instanceInfo.InstanceID,
+		ReleaseWithNode: true,
+	})
+	op := inventory.OperationRecord{
+		Type:   "allocate-address",
+		Target: instanceInfo.InstanceID,
+		Actor:  actor,
+		Params: map[string]string{"nodeId": instanceInfo.InstanceID, "releaseWithNode": "true"},
+	}
+	if err == nil {
+		op.Target = address.AllocationID
+	}
+	recordOperation(ctx, h.Inventory, op, started, err)
+	return address, err
+}
+
+// releaseStaticIPs releases the addresses released with a deleted node.
+// Failures are only logged; the reconciler releases them on its next pass.
+func (h *NodesHandler) releaseStaticIPs(ctx context.Context, client ec2.EC2Client, instanceID, actor string) {
+	started := time.Now()
+	released, err := ec2.ReleaseNodeAddresses(ctx, client, instanceID)
+	for _, address := range released {
+		recordOperation(ctx, h.Inventory, inventory.OperationRecord{
+			Type:   "release-address",
+			Target: address.AllocationID,
+			Actor:  actor,
+			Params: map[string]string{"nodeId": instanceID, "reason": "node-deleted"},
+		}, started, nil)
+	}
+	if err != nil {
+		slog.Warn("Failed to release static IPs of node", "instance_id", instanceID, "error", err)
+	}
+}
+
+// deleteSecurityGroup deletes the managed security group of a deleted node
+// in the background, once the instance is terminated. Groups left behind,
+// e.g. when admin-api stops first, are cleaned up by the janitor.
+func (h *NodesHandler) deleteSecurityGroup(ctx context.Context, client ec2.EC2Client, instanceID string) {
+	groupID, err := ec2.FindNodeSecurityGroup(ctx, client, instanceID)
+	if err != nil {
+		slog.Warn("Failed to look up security group of node", "instance_id", instanceID, "error", err)
+		return
+	}
+	if groupID == "" {
+		return
+	}
+	go func() {
+		if err := ec2.DeleteNodeSecurityGroup(context.WithoutCancel(ctx), client, instanceID, groupID, ec2.WaitOptions{}); err != nil {
+			slog.Warn("Failed to delete security group of node", "instance_id", instanceID, "group_id", groupID, "error", err)
+		}
+	}()
+}
+
+// attachSpotStatus adds the spot request status to spot nodes. A failed
+// lookup only loses the status, so the node is still returned. Regions
+// without an EC2Client have no spot nodes.
+func (h *NodesHandler) attachSpotStatus(ctx context.Context, region Region, instances []ec2.InstanceInfo) {
+	if region.EC2Client == nil {
+		return
+	}
+	if err := ec2.AttachSpotStatus(ctx, region.EC2Client, instances); err != nil {
+		slog.Warn("Failed to look up spot status", "error", err)
+	}
+}
+
+func (h *NodesHandler) recordNode(ctx context.Context, node inventory.NodeRecord) {
+	if err := h.Inventory.PutNode(context.WithoutCancel(ctx), node); err != nil {
+		slog.Warn("Failed to record node", "instance_id", node.InstanceID, "error", err)
+	}
+}
+
+// createParams returns the operation params recording how a node was
+// launched from config.
+func createParams(config ec2.CreateInstanceConfig, userData *generated.NodeUserData) map[string]string {
+	params := map[string]string{
+		"imageId":      config.ImageID,
+		"instanceType": string(config.InstanceType),
+	}
+	if config.KeyName != "" {
+		params["keyName"] = config.KeyName
+	}
+	if userData != nil && userData.Template != nil {
+		params["template"] = *userData.Template
+	}
+	if spot := config.Spot; spot != nil {
+		params["lifecycle"] = string(generated.CreateNodeRequestLifecycleSpot)
+		if spot.MaxPrice != "" {
+			params["maxPrice"] = spot.MaxPrice
+		}
+		if spot.InterruptionBehavior != "" {
+			params["interruptionBehavior"] = string(spot.InterruptionBehavior)
+		}
+	}
+	if config.Hibernation {
+		params["hibernation"] = "true"
+	}
+	return params
+}
+
+// requireEC2 rejects the create request options that only EC2 offers.
+func requireEC2(request generated.CreateNodeRequest, staticIP bool) error {
+	switch {
+	case derefString(request.KeyName) != "":
+		return fmt.Errorf("%w: key pairs", provider.ErrUnsupported)
+	case staticIP:
+		return fmt.Errorf("%w: static IPs", provider.ErrUnsupported)
+	case request.Lifecycle != nil && *request.Lifecycle == generated.CreateNodeRequestLifecycleSpot:
+		return fmt.Errorf("%w: spot nodes", provider.ErrUnsupported)
+	}
+	return nil
+}
+
+// spotOptions maps the lifecycle and spot fields of a create request to
+// spot options; nil means an on-demand node.
+func spotOptions(request generated.CreateNodeRequest) (*ec2.SpotOptions, error) {
+	lifecycle := generated.CreateNodeRequestLifecycleOnDemand
+	if request.Lifecycle != nil {
+		lifecycle = *request.Lifecycle
+	}
+
+	switch lifecycle {
+	case generated.CreateNodeRequestLifecycleOnDemand:
+		if request.Spot != nil {
+			return nil, fmt.Errorf("%w: spot options require lifecycle spot", ec2.ErrInvalidSpotOptions)
+		}
+		return nil, nil
+	case generated.CreateNodeRequestLifecycleSpot:
+	default:
+		return nil, fmt.Errorf("%w: unknown lifecycle %q", ec2.ErrInvalidSpotOptions, lifecycle)
+	}
+
+	options := &ec2.SpotOptions{}
+	if request.Spot != nil {
+		options.MaxPrice = derefString(request.Spot.MaxPrice)
+		if request.Spot.InterruptionBehavior != nil {
+			options.InterruptionBehavior = types.InstanceInterruptionBehavior(*request.Spot.InterruptionBehavior)
+		}
+		// Stopped and hibernated nodes are resumed by EC2, there is nothing
+		// to replace
+		if derefBool(request.Spot.ReplaceOnInterruption) &&
+			options.InterruptionBehavior != "" && options.InterruptionBehavior != types.InstanceInterruptionBehaviorTerminate {
+			return nil, fmt.Errorf("%w: replaceOnInterruption requires interruption behavior terminate", ec2.ErrInvalidSpotOptions)
+		}
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func parseWaitParam(r *http.Request) (bool, error) {
+	return parseBoolParam(r, "wait")
+}
+
+func parseBoolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func convertInstanceInfoToNode(instanceInfo ec2.InstanceInfo) generated.Node {
+	name := instanceInfo.Name
+	if name == "" {
+		// Instances launched outside the control plane have no Name tag
+		name = instanceInfo.InstanceID
+	}
+
+	state := generated.NodeState(instanceInfo.State)
+	node := generated.Node{
+		Id:               instanceInfo.InstanceID,
+		Name:             name,
+		State:            &state,
+		InstanceType:     stringPtrOrNil(instanceInfo.InstanceType),
+		PublicIp:         stringPtrOrNil(instanceInfo.PublicIP),
+		PrivateIp:        stringPtrOrNil(instanceInfo.PrivateIP),
+		AvailabilityZone: stringPtrOrNil(instanceInfo.AvailabilityZone),
+		SubnetId:         stringPtrOrNil(instanceInfo.SubnetID),
+		VpcId:            stringPtrOrNil(instanceInfo.VpcID),
+		AmiId:            stringPtrOrNil(instanceInfo.AMIID),
+		ImageId:          stringPtrOrNil(instanceInfo.ImageID),
+		Architecture:     stringPtrOrNil(instanceInfo.Architecture),
+		KeyName:          stringPtrOrNil(instanceInfo.KeyName),
+		StateReason:      stringPtrOrNil(instanceInfo.StateReason),
+		Region:           stringPtrOrNil(instanceInfo.Region),
+	}
+
+	if !instanceInfo.LaunchTime.IsZero() {
+		launchTime := instanceInfo.LaunchTime
+		node.LaunchTime = &launchTime
+	}
+	if instanceInfo.Lifecycle != "" {
+		lifecycle := generated.NodeLifecycle(instanceInfo.Lifecycle)
+		node.Lifecycle = &lifecycle
+	}
+	if instanceInfo.Spot != nil {
+		spot := instanceInfo.Spot
+		node.Spot = &generated.NodeSpotStatus{
+			RequestId:            spot.RequestID,
+			State:                stringPtrOrNil(spot.State),
+			StatusCode:           stringPtrOrNil(spot.StatusCode),
+			StatusMessage:        stringPtrOrNil(spot.StatusMessage),
+			MaxPrice:             stringPtrOrNil(spot.MaxPrice),
+			InterruptionBehavior: stringPtrOrNil(spot.InterruptionBehavior),
+			Interrupted:          spot.Interrupted(),
+		}
+	}
+	if len(instanceInfo.SecurityGroups) > 0 {
+		groups := make([]generated.NodeSecurityGroup, 0, len(instanceInfo.SecurityGroups))
+		for _, group := range instanceInfo.SecurityGroups {
+			groups = append(groups, generated.NodeSecurityGroup{
+				Id:   group.GroupID,
+				Name: stringPtrOrNil(group.GroupName),
+			})
+		}
+		node.SecurityGroups = &groups
+	}
+	if len(instanceInfo.Tags) > 0 {
+		tags := instanceInfo.Tags
+		node.Tags = &tags
+	}
+	if instanceInfo.RootVolume != nil {
+		node.RootVolume = &generated.NodeRootVolume{
+			DeviceName: instanceInfo.RootVolume.DeviceName,
+			VolumeId:   stringPtrOrNil(instanceInfo.RootVolume.VolumeID),
+		}
+	}
+
+	return node
+}
+
 func stringPtrOrNil(s string) *string {
 	if s == "" {
 		return nil
@@ -0,0 +1,321 @@
+package endpoints
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/idempotency"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// MaxBatchSize is the most nodes a single batch create may launch.
+const MaxBatchSize = 50
+
+// reservedBatchTagKeys are set by the API itself and cannot be requested as
+// tags of a batch.
+var reservedBatchTagKeys = []string{ec2.TagName, ec2.TagManagedBy, ec2.TagPool, ec2.TagNodeID, ec2.TagBatch, ec2.TagRequest, ec2.TagSpotReplace}
+
+// BatchCreateNodes launches count nodes with one call to the provider.
+// Launching is not all or nothing: nodes EC2 had no capacity for are
+// reported as failed results next to the launched ones. Every node is tagged
+// with the batch ID returned, so the batch can be selected later.
+func (h *NodesHandler) BatchCreateNodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request generated.BatchCreateNodesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if request.Count < 1 || request.Count > MaxBatchSize {
+		WriteProblem(w, http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", MaxBatchSize))
+		return
+	}
+	if request.Tags != nil {
+		for key := range *request.Tags {
+			if slices.Contains(reservedBatchTagKeys, key) || strings.HasPrefix(key, "aws:") {
+				WriteProblem(w, http.StatusBadRequest, fmt.Sprintf("tag key %q is reserved", key))
+				return
+			}
+		}
+	}
+
+	// Every node is launched with the options of a single create
+	single := generated.CreateNodeRequest{
+		KeyName:   request.KeyName,
+		Lifecycle: (*generated.CreateNodeRequestLifecycle)(request.Lifecycle),
+		Region:    request.Region,
+		Spot:      request.Spot,
+		UserData:  request.UserData,
+	}
+	spot, err := spotOptions(single)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	regionName := derefString(request.Region)
+	region, err := h.region(regionName)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if regionName == "" {
+		regionName = h.Region
+	}
+	client := region.EC2Client
+	if client == nil {
+		if err := requireEC2(single, false); err != nil {
+			WriteError(w, err)
+			return
+		}
+	}
+
+	amiID, err := region.Provider.FindLatestAMI(ctx)
+	if err != nil {
+		if errors.Is(err, image.ErrNoAMI) {
+			WriteProblem(w, http.StatusServiceUnavailable, "No AMI available. Please build an AMI first.")
+			return
+		}
+		WriteError(w, err)
+		return
+	}
+
+	config := ec2.CreateInstanceConfig{
+		ImageID:      amiID,
+		InstanceType: types.InstanceTypeT4gMicro,
+		Spot:         spot,
+		Hibernation:  derefBool(request.Hibernation),
+		Tags:         map[string]string{},
+	}
+	if request.Tags != nil {
+		maps.Copy(config.Tags, *request.Tags)
+	}
+	if request.Spot != nil && derefBool(request.Spot.ReplaceOnInterruption) {
+		config.Tags[ec2.TagSpotReplace] = "true"
+	}
+	if key := idempotency.KeyFromContext(ctx); key != "" {
+		config.ClientToken = idempotency.ClientToken(key)
+	}
+	batchID := newBatchID(config.ClientToken)
+	config.Tags[ec2.TagBatch] = batchID
+
+	// A replayed batch finds the nodes of its original launch by the batch
+	// tag and keeps their names
+	names, err := provider.AssignNames(ctx, region.Provider, derefString(request.NamePrefix), request.Count, batchID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	if request.KeyName != nil && *request.KeyName != "" {
+		if _, err := ec2.GetKeyPair(ctx, client, *request.KeyName); err != nil {
+			if errors.Is(err, ec2.ErrKeyPairNotFound) {
+				WriteProblem(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteError(w, err)
+			return
+		}
+		config.KeyName = *request.KeyName
+	}
+
+	if request.UserData != nil {
+		// The nodes share their user data, so the hostname is only set when
+		// the variables name one
+		templateName := derefString(request.UserData.Template)
+		userData, err := renderUserData(ctx, client, h.Templates, templateName, request.UserData.Variables, "")
+		if err != nil {
+			if errors.Is(err, cloudinit.ErrTemplateNotFound) {
+				WriteProblem(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			writeTemplateError(w, err)
+			return
+		}
+		config.UserData = userData.Content
+	}
+
+	started := time.Now()
+	actor := requestActor(r)
+	params := createParams(config, request.UserData)
+	params["count"] = strconv.Itoa(request.Count)
+	params["batch"] = batchID
+	if len(h.Regions) > 0 {
+		params["region"] = regionName
+	}
+
+	nodes, err := region.Provider.CreateNodes(ctx, config, names)
+	if len(nodes) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no nodes were created")
+		}
+		for _, name := range names {
+			recordOperation(ctx, h.Inventory, inventory.OperationRecord{Type: "create-node", Target: name, Actor: actor, Params: params}, started, err)
+		}
+		WriteError(w, err)
+		return
+	}
+	h.Instances.Invalidate()
+
+	results := make([]generated.BatchNodeResult, 0, len(names))
+	for i, name := range names {
+		if i >= len(nodes) {
+			recordOperation(ctx, h.Inventory, inventory.OperationRecord{Type: "create-node", Target: name, Actor: actor, Params: params}, started, err)
+			results = append(results, failedResult(name, "", err))
+			continue
+		}
+
+		instanceInfo := nodes[i]
+		instanceInfo.Region = regionName
+		h.observeNode(instanceInfo)
+		recordOperation(ctx, h.Inventory, inventory.OperationRecord{Type: "create-node", Target: instanceInfo.InstanceID, Actor: actor, Params: params}, started, nil)
+		h.recordNode(ctx, inventory.NodeRecord{
+			InstanceID: instanceInfo.InstanceID,
+			Name:       instanceInfo.Name,
+			Region:     regionName,
+			CreatedBy:  actor,
+			CreatedAt:  started.UTC(),
+			Params:     params,
+			State:      instanceInfo.State,
+		})
+
+		if instanceInfo.Name != "" {
+			name = instanceInfo.Name
+		}
+		node := convertInstanceInfoToNode(instanceInfo)
+		results = append(results, generated.BatchNodeResult{
+			Name:      stringPtrOrNil(name),
+			Id:        stringPtrOrNil(instanceInfo.InstanceID),
+			Succeeded: true,
+			Node:      &node,
+		})
+	}
+
+	response := batchResponse(results)
+	response.BatchId = &batchID
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// BatchDeleteNodes deletes the listed nodes, or the managed nodes matching
+// a tag selector. Each node is deleted on its own, so a failure does not
+// stop the others.
+func (h *NodesHandler) BatchDeleteNodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request generated.BatchDeleteNodesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if (request.Nodes == nil) == (request.Selector == nil) {
+		WriteProblem(w, http.StatusBadRequest, "Exactly one of nodes and selector is required")
+		return
+	}
+
+	region, err := h.region(derefString(request.Region))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	// Nodes that cannot be resolved fail right away
+	var results []generated.BatchNodeResult
+	if request.Nodes != nil {
+		if len(*request.Nodes) == 0 {
+			WriteProblem(w, http.StatusBadRequest, "nodes must not be empty")
+			return
+		}
+		for _, nodeRef := range *request.Nodes {
+			instanceID, err := region.Provider.ResolveNode(ctx, nodeRef)
+			if err != nil {
+				results = append(results, failedResult(nodeRef, "", err))
+				continue
+			}
+			results = append(results, generated.BatchNodeResult{Name: stringPtrOrNil(nodeRef), Id: stringPtrOrNil(instanceID)})
+		}
+	} else {
+		nodes, err := provider.SelectNodes(ctx, region.Provider, provider.Selector(*request.Selector))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		for _, node := range nodes {
+			results = append(results, generated.BatchNodeResult{Name: stringPtrOrNil(node.Name), Id: stringPtrOrNil(node.InstanceID)})
+		}
+	}
+
+	actor := requestActor(r)
+	for i, result := range results {
+		if result.Error != nil {
+			continue
+		}
+		if err := h.deleteNode(ctx, region, *result.Id, actor); err != nil {
+			results[i] = failedResult(derefString(result.Name), *result.Id, err)
+			continue
+		}
+		results[i].Succeeded = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(batchResponse(results))
+}
+
+func failedResult(name, instanceID string, err error) generated.BatchNodeResult {
+	problem := errorProblem(err)
+	return generated.BatchNodeResult{
+		Name:  stringPtrOrNil(name),
+		Id:    stringPtrOrNil(instanceID),
+		Error: &problem,
+	}
+}
+
+func batchResponse(results []generated.BatchNodeResult) generated.BatchNodesResponse {
+	response := generated.BatchNodesResponse{
+		Requested: len(results),
+		Results:   make([]generated.BatchNodeResult, 0, len(results)),
+	}
+	for _, result := range results {
+		if result.Succeeded {
+			response.Succeeded++
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response
+}
+
+// newBatchID returns the ID nodes of a batch create are tagged with. A
+// batch retried with the same client token gets the same ID, as EC2 only
+// replays a launch whose parameters are unchanged.
+func newBatchID(clientToken string) string {
+	if clientToken != "" {
+		return "batch-" + clientToken[:12]
+	}
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "batch-" + hex.EncodeToString(b)
+}
+
+// newRequestID returns the ID a node created with an idempotency key is
+// tagged with, so a retry finds the node of an earlier attempt.
+func newRequestID(clientToken string) string {
+	return "request-" + clientToken[:12]
+}
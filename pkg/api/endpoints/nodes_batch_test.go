@@ -0,0 +1,198 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/idempotency"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/provider/sim"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func decodeBatchResponse(t *testing.T, w *httptest.ResponseRecorder) generated.BatchNodesResponse {
+	t.Helper()
+	var response generated.BatchNodesResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return response
+}
+
+func TestNodesHandler_BatchCreateNodes_PartialLaunch(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			if aws.ToInt32(params.MaxCount) != 2 {
+				t.Errorf("expected up to 2 instances, got %d", aws.ToInt32(params.MaxCount))
+			}
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{{InstanceId: aws.String("i-1"), State: &types.InstanceState{Name: types.InstanceStateNamePending}}},
+			}, nil
+		},
+		CreateTagsFunc: func(ctx context.Context, params *awsec2.CreateTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateTagsOutput, error) {
+			return &awsec2.CreateTagsOutput{}, nil
+		},
+	}
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+
+	req := httptest.NewRequest("POST", "/nodes:batchCreate", strings.NewReader(`{"count": 2, "namePrefix": "web"}`))
+	w := httptest.NewRecorder()
+	handler.BatchCreateNodes(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	response := decodeBatchResponse(t, w)
+	if response.Requested != 2 || response.Succeeded != 1 || len(response.Results) != 2 {
+		t.Fatalf("expected 1 of 2 nodes to succeed, got %+v", response)
+	}
+	launched, missing := response.Results[0], response.Results[1]
+	if !launched.Succeeded || launched.Node == nil || launched.Node.Name != "web-1" || derefString(launched.Id) != "i-1" {
+		t.Errorf("expected web-1 to be launched as i-1, got %+v", launched)
+	}
+	if missing.Succeeded || derefString(missing.Name) != "web-2" || missing.Error == nil || missing.Error.Code != generated.Unavailable {
+		t.Errorf("expected web-2 to fail as unavailable, got %+v", missing)
+	}
+}
+
+func TestNodesHandler_BatchCreateNodes_InvalidCount(t *testing.T) {
+	handler := NewNodesHandler(&ec2.MockEC2Client{}, &image.MockAMIFinder{})
+
+	for _, body := range []string{`{"count": 0}`, `{"count": 51}`, `{}`} {
+		req := httptest.NewRequest("POST", "/nodes:batchCreate", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.BatchCreateNodes(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
+
+func TestNodesHandler_BatchCreateNodes_Replay(t *testing.T) {
+	simProvider := sim.New(sim.Config{})
+	t.Cleanup(simProvider.Close)
+	handler := NewNodesHandler(nil, simProvider)
+	handler.Provider = simProvider
+	ctx := idempotency.WithKey(context.Background(), "batch-key")
+
+	create := func() generated.BatchNodesResponse {
+		t.Helper()
+		body := `{"count": 2, "namePrefix": "web", "tags": {"env": "test"}}`
+		req := httptest.NewRequest("POST", "/nodes:batchCreate", strings.NewReader(body)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		handler.BatchCreateNodes(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		return decodeBatchResponse(t, w)
+	}
+
+	first := create()
+	if first.BatchId == nil || first.Succeeded != 2 {
+		t.Fatalf("expected two nodes in a batch, got %+v", first)
+	}
+	node := first.Results[0].Node
+	if node.Tags == nil || (*node.Tags)["env"] != "test" || (*node.Tags)[ec2.TagBatch] != *first.BatchId {
+		t.Errorf("expected the requested and batch tags, got %v", node.Tags)
+	}
+
+	// A retry that reaches the provider again launches and names nothing new
+	replay := create()
+	if derefString(replay.BatchId) != *first.BatchId {
+		t.Errorf("expected batch %s again, got %v", *first.BatchId, replay.BatchId)
+	}
+	for i, result := range replay.Results {
+		if derefString(result.Name) != derefString(first.Results[i].Name) || derefString(result.Id) != derefString(first.Results[i].Id) {
+			t.Errorf("expected result %d to match the original launch, got %+v", i, result)
+		}
+	}
+	nodes, _ := simProvider.ListNodes(context.Background())
+	if len(nodes) != 2 {
+		t.Errorf("expected 2 nodes, got %d", len(nodes))
+	}
+}
+
+func TestNodesHandler_BatchCreateNodes_ReservedTag(t *testing.T) {
+	handler := NewNodesHandler(&ec2.MockEC2Client{}, &image.MockAMIFinder{})
+
+	for _, body := range []string{`{"count": 1, "tags": {"Batch": "x"}}`, `{"count": 1, "tags": {"aws:foo": "x"}}`} {
+		req := httptest.NewRequest("POST", "/nodes:batchCreate", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.BatchCreateNodes(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
+
+func TestNodesHandler_BatchDeleteNodes(t *testing.T) {
+	simProvider := sim.New(sim.Config{})
+	t.Cleanup(simProvider.Close)
+	handler := NewNodesHandler(nil, simProvider)
+	handler.Provider = simProvider
+
+	ctx := context.Background()
+	for _, name := range []string{"web-1", "web-2", "db"} {
+		config := ec2.CreateInstanceConfig{Name: name, ImageID: "ami-0000000000000sim0"}
+		if strings.HasPrefix(name, "web") {
+			config.Tags = map[string]string{"role": "web"}
+		}
+		if _, err := simProvider.CreateNode(ctx, config); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/nodes:batchDelete", strings.NewReader(`{"selector": {"role": "web"}}`))
+	w := httptest.NewRecorder()
+	handler.BatchDeleteNodes(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	response := decodeBatchResponse(t, w)
+	if response.Requested != 2 || response.Succeeded != 2 {
+		t.Errorf("expected both web nodes to be deleted, got %+v", response)
+	}
+
+	req = httptest.NewRequest("POST", "/nodes:batchDelete", strings.NewReader(`{"nodes": ["db", "cache"]}`))
+	w = httptest.NewRecorder()
+	handler.BatchDeleteNodes(w, req)
+
+	response = decodeBatchResponse(t, w)
+	if response.Requested != 2 || response.Succeeded != 1 {
+		t.Fatalf("expected 1 of 2 nodes to be deleted, got %+v", response)
+	}
+	if missing := response.Results[1]; missing.Succeeded || missing.Error == nil || missing.Error.Code != generated.NotFound {
+		t.Errorf("expected cache to fail as not found, got %+v", missing)
+	}
+}
+
+func TestNodesHandler_BatchDeleteNodes_InvalidRequest(t *testing.T) {
+	handler := NewNodesHandler(&ec2.MockEC2Client{}, &image.MockAMIFinder{})
+
+	for _, body := range []string{`{}`, `{"nodes": ["db"], "selector": {"role": "web"}}`, `{"nodes": []}`, `{"selector": {}}`} {
+		req := httptest.NewRequest("POST", "/nodes:batchDelete", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.BatchDeleteNodes(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
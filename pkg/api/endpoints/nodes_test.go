@@ -2,22 +2,34 @@ package endpoints
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
 	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+	"github.com/abteilung6/tilmancloud/pkg/idempotency"
 	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/abteilung6/tilmancloud/pkg/provider/sim"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 	"github.com/go-chi/chi/v5"
 )
 
+func emptyDescribeInstances(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+	return &awsec2.DescribeInstancesOutput{}, nil
+}
+
 func TestNodesHandler_CreateNode(t *testing.T) {
 	expectedInstanceID := "i-1234567890abcdef0"
 	expectedState := types.InstanceStateNamePending
@@ -33,6 +45,7 @@ func TestNodesHandler_CreateNode(t *testing.T) {
 	}
 
 	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
 		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
 			if params.ImageId == nil || *params.ImageId != expectedImageID {
 				t.Errorf("expected image ID %s, got %v", expectedImageID, params.ImageId)
@@ -72,8 +85,8 @@ func TestNodesHandler_CreateNode(t *testing.T) {
 		t.Fatalf("failed to decode response: %v", err)
 	}
 
-	if response.Name != expectedInstanceID {
-		t.Errorf("expected instance ID %s, got %s", expectedInstanceID, response.Name)
+	if response.Id != expectedInstanceID {
+		t.Errorf("expected instance ID %s, got %s", expectedInstanceID, response.Id)
 	}
 	if response.State == nil || *response.State != generated.NodeState(expectedState) {
 		t.Errorf("expected state %s, got %v", expectedState, response.State)
@@ -102,6 +115,7 @@ func TestNodesHandler_CreateNode_WithNilIPs(t *testing.T) {
 	}
 
 	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
 		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
 			return &awsec2.RunInstancesOutput{
 				Instances: []types.Instance{
@@ -134,8 +148,8 @@ func TestNodesHandler_CreateNode_WithNilIPs(t *testing.T) {
 		t.Fatalf("failed to decode response: %v", err)
 	}
 
-	if response.Name != expectedInstanceID {
-		t.Errorf("expected instance ID %s, got %s", expectedInstanceID, response.Name)
+	if response.Id != expectedInstanceID {
+		t.Errorf("expected instance ID %s, got %s", expectedInstanceID, response.Id)
 	}
 	if response.PublicIp != nil {
 		t.Errorf("expected public IP to be nil, got %v", response.PublicIp)
@@ -148,7 +162,7 @@ func TestNodesHandler_CreateNode_WithNilIPs(t *testing.T) {
 func TestNodesHandler_CreateNode_NoAMI(t *testing.T) {
 	mockAMIFinder := &image.MockAMIFinder{
 		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
-			return "", fmt.Errorf("no available AMIs found")
+			return "", fmt.Errorf("%w in channel latest", image.ErrNoAMI)
 		},
 	}
 
@@ -165,11 +179,9 @@ func TestNodesHandler_CreateNode_NoAMI(t *testing.T) {
 		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
 	}
 
-	expectedBody := "No AMI available. Please build an AMI first."
-	// http.Error appends a newline, so trim it for comparison
-	actualBody := strings.TrimSpace(w.Body.String())
-	if actualBody != expectedBody {
-		t.Errorf("expected body %q, got %q", expectedBody, actualBody)
+	problem := decodeProblem(t, w)
+	if problem.Code != generated.Unavailable || derefString(problem.Detail) != "No AMI available. Please build an AMI first." {
+		t.Errorf("expected an unavailable problem, got %+v", problem)
 	}
 }
 
@@ -181,6 +193,7 @@ func TestNodesHandler_CreateNode_Error(t *testing.T) {
 	}
 
 	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
 		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
 			return nil, fmt.Errorf("AWS API error")
 		},
@@ -362,6 +375,7 @@ func TestNodesHandler_DeleteNode(t *testing.T) {
 	expectedInstanceID := "i-1234567890abcdef0"
 
 	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
 		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
 			if len(params.InstanceIds) == 0 || params.InstanceIds[0] != expectedInstanceID {
 				return nil, fmt.Errorf("InvalidInstanceID.NotFound")
@@ -411,8 +425,12 @@ func TestNodesHandler_DeleteNode_NotFound(t *testing.T) {
 	expectedInstanceID := "i-nonexistent"
 
 	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
 		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
-			return nil, fmt.Errorf("InvalidInstanceID.NotFound: The instance ID '%s' does not exist", expectedInstanceID)
+			return nil, &smithy.GenericAPIError{
+				Code:    "InvalidInstanceID.NotFound",
+				Message: fmt.Sprintf("The instance ID '%s' does not exist", expectedInstanceID),
+			}
 		},
 	}
 
@@ -441,6 +459,7 @@ func TestNodesHandler_DeleteNode_Error(t *testing.T) {
 	expectedInstanceID := "i-1234567890abcdef0"
 
 	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
 		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
 			return nil, fmt.Errorf("AWS API error: insufficient permissions")
 		},
@@ -466,3 +485,1162 @@ func TestNodesHandler_DeleteNode_Error(t *testing.T) {
 		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, w.Code)
 	}
 }
+
+func TestNodesHandler_GetNode(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+	expectedAMIID := "ami-1234567890abcdef0"
+	expectedImageID := "fedora-43-aarch64-76f2ddd3bac7da2b"
+	expectedAZ := "eu-central-1a"
+	expectedGroupID := "sg-0123456789abcdef0"
+	expectedVolumeID := "vol-0123456789abcdef0"
+	expectedLaunchTime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			if len(params.InstanceIds) != 1 || params.InstanceIds[0] != expectedInstanceID {
+				t.Errorf("expected instance ID %s, got %v", expectedInstanceID, params.InstanceIds)
+			}
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{
+						Instances: []types.Instance{
+							{
+								InstanceId:     aws.String(expectedInstanceID),
+								InstanceType:   types.InstanceTypeT4gMicro,
+								State:          &types.InstanceState{Name: types.InstanceStateNameRunning},
+								ImageId:        aws.String(expectedAMIID),
+								Architecture:   types.ArchitectureValuesArm64,
+								LaunchTime:     aws.Time(expectedLaunchTime),
+								Placement:      &types.Placement{AvailabilityZone: aws.String(expectedAZ)},
+								SecurityGroups: []types.GroupIdentifier{{GroupId: aws.String(expectedGroupID), GroupName: aws.String("default")}},
+								RootDeviceName: aws.String("/dev/xvda"),
+								BlockDeviceMappings: []types.InstanceBlockDeviceMapping{
+									{
+										DeviceName: aws.String("/dev/xvda"),
+										Ebs:        &types.EbsInstanceBlockDevice{VolumeId: aws.String(expectedVolumeID)},
+									},
+								},
+								Tags: []types.Tag{{Key: aws.String("Team"), Value: aws.String("platform")}},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		DescribeImagesFunc: func(ctx context.Context, params *awsec2.DescribeImagesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeImagesOutput, error) {
+			return &awsec2.DescribeImagesOutput{
+				Images: []types.Image{
+					{
+						ImageId: aws.String(expectedAMIID),
+						Tags:    []types.Tag{{Key: aws.String("ImageID"), Value: aws.String(expectedImageID)}},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+
+	req := httptest.NewRequest("GET", "/nodes/"+expectedInstanceID, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.GetNode(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if response.Name != expectedInstanceID {
+		t.Errorf("expected instance ID %s, got %s", expectedInstanceID, response.Name)
+	}
+	if response.AmiId == nil || *response.AmiId != expectedAMIID {
+		t.Errorf("expected AMI ID %s, got %v", expectedAMIID, response.AmiId)
+	}
+	if response.ImageId == nil || *response.ImageId != expectedImageID {
+		t.Errorf("expected ImageID %s, got %v", expectedImageID, response.ImageId)
+	}
+	if response.AvailabilityZone == nil || *response.AvailabilityZone != expectedAZ {
+		t.Errorf("expected availability zone %s, got %v", expectedAZ, response.AvailabilityZone)
+	}
+	if response.LaunchTime == nil || !response.LaunchTime.Equal(expectedLaunchTime) {
+		t.Errorf("expected launch time %v, got %v", expectedLaunchTime, response.LaunchTime)
+	}
+	if response.Lifecycle == nil || *response.Lifecycle != generated.NodeLifecycleOnDemand {
+		t.Errorf("expected lifecycle %s, got %v", generated.NodeLifecycleOnDemand, response.Lifecycle)
+	}
+	if response.SecurityGroups == nil || len(*response.SecurityGroups) != 1 || (*response.SecurityGroups)[0].Id != expectedGroupID {
+		t.Errorf("expected security group %s, got %v", expectedGroupID, response.SecurityGroups)
+	}
+	if response.RootVolume == nil || response.RootVolume.VolumeId == nil || *response.RootVolume.VolumeId != expectedVolumeID {
+		t.Errorf("expected root volume %s, got %v", expectedVolumeID, response.RootVolume)
+	}
+	if response.Tags == nil || (*response.Tags)["Team"] != "platform" {
+		t.Errorf("expected tag Team=platform, got %v", response.Tags)
+	}
+}
+
+func TestNodesHandler_GetNode_NotFound(t *testing.T) {
+	expectedInstanceID := "i-nonexistent"
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return nil, &smithy.GenericAPIError{
+				Code:    "InvalidInstanceID.NotFound",
+				Message: fmt.Sprintf("The instance ID '%s' does not exist", expectedInstanceID),
+			}
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+
+	req := httptest.NewRequest("GET", "/nodes/"+expectedInstanceID, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.GetNode(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestNodesHandler_StopNode_Hibernate(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+	stopped := false
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			state := types.InstanceStateNameRunning
+			if stopped {
+				state = types.InstanceStateNameStopping
+			}
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{
+						Instances: []types.Instance{
+							{
+								InstanceId:         aws.String(expectedInstanceID),
+								State:              &types.InstanceState{Name: state},
+								HibernationOptions: &types.HibernationOptions{Configured: aws.Bool(true)},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		StopInstancesFunc: func(ctx context.Context, params *awsec2.StopInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StopInstancesOutput, error) {
+			if params.Hibernate == nil || !*params.Hibernate {
+				t.Errorf("expected hibernate to be set, got %v", params.Hibernate)
+			}
+			stopped = true
+			return &awsec2.StopInstancesOutput{}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+
+	req := httptest.NewRequest("POST", "/nodes/"+expectedInstanceID+":stop", strings.NewReader(`{"hibernate": true}`))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.StopNode(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	var response generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.State == nil || *response.State != generated.NodeStateStopping {
+		t.Errorf("expected state %s, got %v", generated.NodeStateStopping, response.State)
+	}
+}
+
+func TestNodesHandler_StopNode_HibernationNotConfigured(t *testing.T) {
+	simProvider := sim.New(sim.Config{})
+	t.Cleanup(simProvider.Close)
+	handler := NewNodesHandler(nil, simProvider)
+	handler.Provider = simProvider
+
+	ctx := context.Background()
+	info, err := simProvider.CreateNode(ctx, ec2.CreateInstanceConfig{Name: "web", ImageID: "ami-0000000000000sim0"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := simProvider.WaitForNode(ctx, info.InstanceID, ec2.WaitOptions{
+		TargetStates: []types.InstanceStateName{types.InstanceStateNameRunning},
+		Timeout:      time.Second,
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	req := withNodeID(httptest.NewRequest("POST", "/nodes/web:stop", strings.NewReader(`{"hibernate": true}`)), "web")
+	w := httptest.NewRecorder()
+	handler.StopNode(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+}
+
+func TestNodesHandler_StartNode_Conflict(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{
+						Instances: []types.Instance{
+							{
+								InstanceId: aws.String(expectedInstanceID),
+								State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+
+	req := httptest.NewRequest("POST", "/nodes/"+expectedInstanceID+":start", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.StartNode(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestNodesHandler_StopNode_WaitTimeout(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+	stopped := false
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			state := types.InstanceStateNameRunning
+			if stopped {
+				// Never settles, so the waiter has to give up
+				state = types.InstanceStateNameStopping
+			}
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{
+						Instances: []types.Instance{
+							{
+								InstanceId: aws.String(expectedInstanceID),
+								State:      &types.InstanceState{Name: state},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		StopInstancesFunc: func(ctx context.Context, params *awsec2.StopInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StopInstancesOutput, error) {
+			stopped = true
+			return &awsec2.StopInstancesOutput{}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+	handler.WaitOptions = ec2.WaitOptions{Timeout: 20 * time.Millisecond, InitialInterval: time.Millisecond}
+
+	req := httptest.NewRequest("POST", "/nodes/"+expectedInstanceID+":stop?wait=true", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.StopNode(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status code %d, got %d", http.StatusGatewayTimeout, w.Code)
+	}
+}
+
+func TestNodesHandler_RebootNode_WaitRejected(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+	rebooted := false
+	mockClient := &ec2.MockEC2Client{
+		RebootInstancesFunc: func(ctx context.Context, params *awsec2.RebootInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RebootInstancesOutput, error) {
+			rebooted = true
+			return &awsec2.RebootInstancesOutput{}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+
+	req := httptest.NewRequest("POST", "/nodes/"+expectedInstanceID+":reboot?wait=true", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.RebootNode(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if rebooted {
+		t.Error("expected the node not to be rebooted")
+	}
+}
+
+func TestNodesHandler_CreateNode_Wait(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+	expectedName := "brave-otter"
+	polls := 0
+
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			if len(params.InstanceIds) == 0 {
+				// Name uniqueness lookup
+				return &awsec2.DescribeInstancesOutput{}, nil
+			}
+			polls++
+			state := types.InstanceStateNamePending
+			if polls > 1 {
+				state = types.InstanceStateNameRunning
+			}
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{
+						Instances: []types.Instance{
+							{
+								InstanceId:      aws.String(expectedInstanceID),
+								State:           &types.InstanceState{Name: state},
+								PublicIpAddress: aws.String("54.123.45.67"),
+								Tags:            []types.Tag{{Key: aws.String(ec2.TagName), Value: aws.String(expectedName)}},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{
+					{
+						InstanceId: aws.String(expectedInstanceID),
+						State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+	handler.WaitOptions = ec2.WaitOptions{InitialInterval: time.Millisecond}
+
+	req := httptest.NewRequest("POST", "/nodes?wait=true", strings.NewReader(`{"name": "`+expectedName+`"}`))
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.State == nil || *response.State != generated.NodeStateRunning {
+		t.Errorf("expected state %s, got %v", generated.NodeStateRunning, response.State)
+	}
+	if response.PublicIp == nil {
+		t.Error("expected public IP from the settled instance")
+	}
+	if polls != 2 {
+		t.Errorf("expected 2 polls, got %d", polls)
+	}
+}
+
+func TestNodesHandler_CreateNode_WithName(t *testing.T) {
+	expectedName := "build-runner-1"
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			tags := map[string]string{}
+			for _, spec := range params.TagSpecifications {
+				for _, tag := range spec.Tags {
+					tags[*tag.Key] = *tag.Value
+				}
+			}
+			if tags[ec2.TagName] != expectedName {
+				t.Errorf("expected Name tag %s, got %s", expectedName, tags[ec2.TagName])
+			}
+			if tags[ec2.TagManagedBy] != ec2.ManagedByValue {
+				t.Errorf("expected ManagedBy tag %s, got %s", ec2.ManagedByValue, tags[ec2.TagManagedBy])
+			}
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{
+					{
+						InstanceId: aws.String(expectedInstanceID),
+						State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(`{"name": "`+expectedName+`"}`))
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var response generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Name != expectedName {
+		t.Errorf("expected name %s, got %s", expectedName, response.Name)
+	}
+	if response.Id != expectedInstanceID {
+		t.Errorf("expected instance ID %s, got %s", expectedInstanceID, response.Id)
+	}
+}
+
+func TestNodesHandler_CreateNode_WithUserData(t *testing.T) {
+	expectedName := "brave-otter"
+
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+
+	var userData string
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			if params.UserData == nil {
+				t.Fatal("expected user data to be set")
+			}
+			decoded, err := base64.StdEncoding.DecodeString(*params.UserData)
+			if err != nil {
+				t.Fatalf("expected base64 user data: %v", err)
+			}
+			userData = string(decoded)
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{
+					{
+						InstanceId: aws.String("i-1234567890abcdef0"),
+						State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+	handler.Templates.Create(cloudinit.Template{
+		Name:   "web-server",
+		Config: cloudinit.CloudConfig{Packages: []string{"nginx"}},
+	})
+
+	body := `{"name": "` + expectedName + `", "userData": {"template": "web-server", "variables": {"runcmd": ["uptime"]}}}`
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	// The hostname defaults to the node name
+	for _, expected := range []string{"#cloud-config", `hostname: "` + expectedName + `"`, `"nginx"`, `"uptime"`} {
+		if !strings.Contains(userData, expected) {
+			t.Errorf("expected user data to contain %q, got:\n%s", expected, userData)
+		}
+	}
+}
+
+func TestNodesHandler_CreateNode_UnknownTemplate(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(`{"userData": {"template": "unknown"}}`))
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestNodesHandler_CreateNode_NameTaken(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{Instances: []types.Instance{{InstanceId: aws.String("i-0987654321fedcba0")}}},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(`{"name": "brave-otter"}`))
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestNodesHandler_CreateNode_InvalidName(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+
+	handler := NewNodesHandler(&ec2.MockEC2Client{}, mockAMIFinder)
+
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(`{"name": "i-looks-like-an-id"}`))
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestNodesHandler_DeleteNode_ByName(t *testing.T) {
+	expectedName := "brave-otter"
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			for _, filter := range params.Filters {
+				if *filter.Name == "tag:"+ec2.TagName && filter.Values[0] != expectedName {
+					t.Errorf("expected name filter %s, got %v", expectedName, filter.Values)
+				}
+			}
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{Instances: []types.Instance{{InstanceId: aws.String(expectedInstanceID)}}},
+				},
+			}, nil
+		},
+		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+			if len(params.InstanceIds) == 0 || params.InstanceIds[0] != expectedInstanceID {
+				t.Errorf("expected instance ID %s, got %v", expectedInstanceID, params.InstanceIds)
+			}
+			return &awsec2.TerminateInstancesOutput{
+				TerminatingInstances: []types.InstanceStateChange{
+					{
+						InstanceId:    aws.String(expectedInstanceID),
+						PreviousState: &types.InstanceState{Name: types.InstanceStateNameRunning},
+						CurrentState:  &types.InstanceState{Name: types.InstanceStateNameShuttingDown},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+
+	req := httptest.NewRequest("DELETE", "/nodes/"+expectedName, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedName)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.DeleteNode(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+}
+
+func TestNodesHandler_CreateNode_RecordsInventory(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{
+					{
+						InstanceId: aws.String(expectedInstanceID),
+						State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+	bus := events.NewBus(0)
+	handler.Events = events.NewNodeTracker(bus)
+
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(`{"name": "brave-otter"}`))
+	req.Header.Set(ActorHeader, "alice")
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	node, err := handler.Inventory.GetNode(context.Background(), expectedInstanceID)
+	if err != nil {
+		t.Fatalf("expected node to be recorded: %v", err)
+	}
+	if node.CreatedBy != "alice" || node.Name != "brave-otter" || node.Params["imageId"] != "ami-1234567890abcdef0" {
+		t.Errorf("unexpected node record %+v", node)
+	}
+
+	ops, _ := handler.Inventory.ListOperations(context.Background(), expectedInstanceID)
+	if len(ops) != 1 || ops[0].Type != "create-node" || ops[0].Status != inventory.OperationSucceeded || ops[0].Actor != "alice" {
+		t.Errorf("unexpected operations %+v", ops)
+	}
+
+	if bus.LastID() != 1 {
+		t.Fatalf("expected one node event, got %d", bus.LastID())
+	}
+}
+
+func TestNodesHandler_DeleteNode_RecordsInventory(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+			return &awsec2.TerminateInstancesOutput{
+				TerminatingInstances: []types.InstanceStateChange{
+					{
+						InstanceId:    aws.String(expectedInstanceID),
+						PreviousState: &types.InstanceState{Name: types.InstanceStateNameRunning},
+						CurrentState:  &types.InstanceState{Name: types.InstanceStateNameShuttingDown},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+	handler.Inventory.PutNode(context.Background(), inventory.NodeRecord{InstanceID: expectedInstanceID, CreatedBy: "alice"})
+
+	req := httptest.NewRequest("DELETE", "/nodes/"+expectedInstanceID, nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.DeleteNode(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	// Without X-Actor the client address is recorded
+	node, _ := handler.Inventory.GetNode(context.Background(), expectedInstanceID)
+	if node.DeletedAt == nil || node.DeletedBy != "192.0.2.10" || node.CreatedBy != "alice" {
+		t.Errorf("unexpected node record %+v", node)
+	}
+}
+
+func TestNodesHandler_ListNodes_Cached(t *testing.T) {
+	describes := 0
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			if len(params.InstanceIds) > 0 {
+				return &awsec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: []types.Instance{{
+					InstanceId: aws.String(params.InstanceIds[0]),
+					State:      &types.InstanceState{Name: types.InstanceStateNameStopped},
+				}}}}}, nil
+			}
+			// Only unfiltered describes back the node list
+			describes++
+			return &awsec2.DescribeInstancesOutput{}, nil
+		},
+		StartInstancesFunc: func(ctx context.Context, params *awsec2.StartInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StartInstancesOutput, error) {
+			return &awsec2.StartInstancesOutput{}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+	handler.Instances.MinRefreshInterval = 0
+
+	list := func(cacheControl string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/nodes", nil)
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		w := httptest.NewRecorder()
+		handler.ListNodes(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		return w
+	}
+
+	list("")
+	w := list("")
+	if describes != 1 {
+		t.Errorf("expected second list to be served from cache, got %d describes", describes)
+	}
+	if w.Header().Get(CacheAgeHeader) == "" {
+		t.Errorf("expected %s header", CacheAgeHeader)
+	}
+
+	list("max-age=0, no-cache")
+	if describes != 2 {
+		t.Errorf("expected no-cache to force a reload, got %d describes", describes)
+	}
+
+	// Our own mutations invalidate the cache
+	req := httptest.NewRequest("POST", "/nodes/i-1234567890abcdef0:start", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", "i-1234567890abcdef0")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	start := httptest.NewRecorder()
+	handler.StartNode(start, req)
+	if start.Code != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusAccepted, start.Code, start.Body.String())
+	}
+	list("")
+	if describes != 3 {
+		t.Errorf("expected reload after invalidation, got %d describes", describes)
+	}
+}
+
+func TestNodesHandler_CreateNode_Spot(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			market := params.InstanceMarketOptions
+			if market == nil || market.MarketType != types.MarketTypeSpot {
+				t.Fatalf("expected spot market options, got %+v", market)
+			}
+			if aws.ToString(market.SpotOptions.MaxPrice) != "0.005" {
+				t.Errorf("expected max price 0.005, got %v", market.SpotOptions.MaxPrice)
+			}
+			replaceTagged := false
+			for _, tag := range params.TagSpecifications[0].Tags {
+				if aws.ToString(tag.Key) == ec2.TagSpotReplace && aws.ToString(tag.Value) == "true" {
+					replaceTagged = true
+				}
+			}
+			if !replaceTagged {
+				t.Errorf("expected %s tag, got %+v", ec2.TagSpotReplace, params.TagSpecifications[0].Tags)
+			}
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{
+					{
+						InstanceId:            aws.String("i-1234567890abcdef0"),
+						State:                 &types.InstanceState{Name: types.InstanceStateNamePending},
+						InstanceLifecycle:     types.InstanceLifecycleTypeSpot,
+						SpotInstanceRequestId: aws.String("sir-1"),
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+
+	body := `{"lifecycle": "spot", "spot": {"maxPrice": "0.005", "interruptionBehavior": "terminate", "replaceOnInterruption": true}}`
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Lifecycle == nil || *response.Lifecycle != generated.NodeLifecycleSpot {
+		t.Errorf("expected lifecycle %s, got %v", generated.NodeLifecycleSpot, response.Lifecycle)
+	}
+
+	ops, _ := handler.Inventory.ListOperations(context.Background(), "i-1234567890abcdef0")
+	if len(ops) != 1 || ops[0].Params["lifecycle"] != "spot" || ops[0].Params["maxPrice"] != "0.005" {
+		t.Errorf("expected spot params to be recorded, got %+v", ops)
+	}
+}
+
+func TestNodesHandler_CreateNode_InvalidSpotOptions(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+
+	handler := NewNodesHandler(&ec2.MockEC2Client{}, mockAMIFinder)
+
+	for _, body := range []string{
+		`{"spot": {"maxPrice": "0.005"}}`,
+		`{"lifecycle": "reserved"}`,
+		`{"lifecycle": "spot", "spot": {"maxPrice": "cheap"}}`,
+		`{"lifecycle": "spot", "spot": {"interruptionBehavior": "explode"}}`,
+		`{"lifecycle": "spot", "spot": {"interruptionBehavior": "stop", "replaceOnInterruption": true}}`,
+	} {
+		req := httptest.NewRequest("POST", "/nodes", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.CreateNode(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestNodesHandler_GetNode_SpotStatus(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{{
+					Instances: []types.Instance{{
+						InstanceId:            aws.String(expectedInstanceID),
+						State:                 &types.InstanceState{Name: types.InstanceStateNameRunning},
+						InstanceLifecycle:     types.InstanceLifecycleTypeSpot,
+						SpotInstanceRequestId: aws.String("sir-1"),
+					}},
+				}},
+			}, nil
+		},
+		DescribeSpotInstanceRequestsFunc: func(ctx context.Context, params *awsec2.DescribeSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSpotInstanceRequestsOutput, error) {
+			return &awsec2.DescribeSpotInstanceRequestsOutput{
+				SpotInstanceRequests: []types.SpotInstanceRequest{{
+					SpotInstanceRequestId: aws.String("sir-1"),
+					State:                 types.SpotInstanceStateActive,
+					Status:                &types.SpotInstanceStatus{Code: aws.String("marked-for-termination")},
+				}},
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, &image.MockAMIFinder{})
+
+	req := httptest.NewRequest("GET", "/nodes/"+expectedInstanceID, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", expectedInstanceID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.GetNode(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Spot == nil || response.Spot.RequestId != "sir-1" || !response.Spot.Interrupted {
+		t.Errorf("expected interrupted spot status, got %+v", response.Spot)
+	}
+}
+
+func TestNodesHandler_CreateNode_StaticIP(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+	var allocated *awsec2.AllocateAddressInput
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{
+					{
+						InstanceId: aws.String("i-1234567890abcdef0"),
+						State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+					},
+				},
+			}, nil
+		},
+		AllocateAddressFunc: func(ctx context.Context, params *awsec2.AllocateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AllocateAddressOutput, error) {
+			allocated = params
+			return &awsec2.AllocateAddressOutput{
+				AllocationId: aws.String("eipalloc-1"),
+				PublicIp:     aws.String("3.120.0.10"),
+			}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(`{"staticIp": true}`))
+	w := httptest.NewRecorder()
+
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if allocated == nil {
+		t.Fatal("expected an Elastic IP to be allocated")
+	}
+	tags := map[string]string{}
+	for _, tag := range allocated.TagSpecifications[0].Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if tags[ec2.TagNodeID] != "i-1234567890abcdef0" || tags[ec2.TagReleaseWithNode] != "true" {
+		t.Errorf("expected the address to be tied to the node, got %v", tags)
+	}
+
+	ops, _ := handler.Inventory.ListOperations(context.Background(), "eipalloc-1")
+	if len(ops) != 1 || ops[0].Type != "allocate-address" {
+		t.Errorf("expected allocate-address operation, got %+v", ops)
+	}
+}
+
+func TestNodesHandler_CreateNode_RetryAfterServerError(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+
+	for _, body := range []string{`{"staticIp": true}`, `{"name": "web", "staticIp": true}`} {
+		// EC2 replays a launch with a known client token only if its
+		// parameters are unchanged
+		launches := map[string]*awsec2.RunInstancesInput{}
+		var instances []types.Instance
+		allocations := 0
+		mockClient := &ec2.MockEC2Client{
+			DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+				return &awsec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: instances}}}, nil
+			},
+			RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+				token := aws.ToString(params.ClientToken)
+				if first, ok := launches[token]; ok {
+					if fmt.Sprint(tagMap(first.TagSpecifications[0].Tags)) != fmt.Sprint(tagMap(params.TagSpecifications[0].Tags)) {
+						return nil, &smithy.GenericAPIError{Code: "IdempotentParameterMismatch"}
+					}
+					return &awsec2.RunInstancesOutput{Instances: instances}, nil
+				}
+				launches[token] = params
+				instances = append(instances, types.Instance{
+					InstanceId: aws.String("i-1234567890abcdef0"),
+					State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+					Tags:       params.TagSpecifications[0].Tags,
+				})
+				return &awsec2.RunInstancesOutput{Instances: instances}, nil
+			},
+			AllocateAddressFunc: func(ctx context.Context, params *awsec2.AllocateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AllocateAddressOutput, error) {
+				allocations++
+				if allocations == 1 {
+					return nil, fmt.Errorf("address limit exceeded")
+				}
+				return &awsec2.AllocateAddressOutput{
+					AllocationId: aws.String("eipalloc-1"),
+					PublicIp:     aws.String("3.120.0.10"),
+				}, nil
+			},
+			DescribeAddressesFunc: func(ctx context.Context, params *awsec2.DescribeAddressesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeAddressesOutput, error) {
+				return &awsec2.DescribeAddressesOutput{}, nil
+			},
+		}
+		handler := NewNodesHandler(mockClient, mockAMIFinder)
+		ctx := idempotency.WithKey(context.Background(), "create-key")
+
+		create := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/nodes", strings.NewReader(body)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			handler.CreateNode(w, req)
+			return w
+		}
+
+		if w := create(); w.Code != http.StatusInternalServerError {
+			t.Fatalf("%s: expected status code %d, got %d: %s", body, http.StatusInternalServerError, w.Code, w.Body.String())
+		}
+		// The middleware releases the key after a 5xx, so the retry runs again
+		w := create()
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s: expected retry to succeed, got %d: %s", body, w.Code, w.Body.String())
+		}
+		var node generated.Node
+		if err := json.NewDecoder(w.Body).Decode(&node); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if node.Id != "i-1234567890abcdef0" || len(instances) != 1 {
+			t.Errorf("%s: expected the instance of the first attempt, got %s and %d instances", body, node.Id, len(instances))
+		}
+	}
+}
+
+func tagMap(tags []types.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
+
+func TestNodesHandler_DeleteNode_ReleasesStaticIP(t *testing.T) {
+	mockAMIFinder := &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+	var released []string
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: emptyDescribeInstances,
+		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+			return &awsec2.TerminateInstancesOutput{
+				TerminatingInstances: []types.InstanceStateChange{
+					{
+						InstanceId:    aws.String("i-1234567890abcdef0"),
+						PreviousState: &types.InstanceState{Name: types.InstanceStateNameRunning},
+						CurrentState:  &types.InstanceState{Name: types.InstanceStateNameShuttingDown},
+					},
+				},
+			}, nil
+		},
+		DescribeAddressesFunc: func(ctx context.Context, params *awsec2.DescribeAddressesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeAddressesOutput, error) {
+			return &awsec2.DescribeAddressesOutput{
+				Addresses: []types.Address{{
+					AllocationId:  aws.String("eipalloc-1"),
+					AssociationId: aws.String("eipassoc-1"),
+					InstanceId:    aws.String("i-1234567890abcdef0"),
+					Tags: []types.Tag{
+						{Key: aws.String(ec2.TagNodeID), Value: aws.String("i-1234567890abcdef0")},
+						{Key: aws.String(ec2.TagReleaseWithNode), Value: aws.String("true")},
+					},
+				}},
+			}, nil
+		},
+		DisassociateAddressFunc: func(ctx context.Context, params *awsec2.DisassociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.DisassociateAddressOutput, error) {
+			return &awsec2.DisassociateAddressOutput{}, nil
+		},
+		ReleaseAddressFunc: func(ctx context.Context, params *awsec2.ReleaseAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.ReleaseAddressOutput, error) {
+			released = append(released, aws.ToString(params.AllocationId))
+			return &awsec2.ReleaseAddressOutput{}, nil
+		},
+	}
+
+	handler := NewNodesHandler(mockClient, mockAMIFinder)
+
+	req := httptest.NewRequest("DELETE", "/nodes/i-1234567890abcdef0", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", "i-1234567890abcdef0")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.DeleteNode(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if len(released) != 1 || released[0] != "eipalloc-1" {
+		t.Errorf("expected the static IP to be released, got %v", released)
+	}
+}
+
+func TestNodesHandler_Provider(t *testing.T) {
+	simProvider := sim.New(sim.Config{Delays: sim.Delays{Boot: 10 * time.Millisecond}})
+	t.Cleanup(simProvider.Close)
+	handler := NewNodesHandler(nil, simProvider)
+	handler.Provider = simProvider
+	handler.WaitOptions = ec2.WaitOptions{Timeout: time.Second}
+
+	req := httptest.NewRequest("POST", "/nodes?wait=true", strings.NewReader(`{"name": "web"}`))
+	w := httptest.NewRecorder()
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var node generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&node); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if node.State == nil || *node.State != generated.NodeStateRunning || node.Name != "web" {
+		t.Errorf("expected a running node named web, got %+v", node)
+	}
+
+	req = httptest.NewRequest("POST", "/nodes", strings.NewReader(`{"staticIp": true}`))
+	w = httptest.NewRecorder()
+	handler.CreateNode(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d for a static IP, got %d", http.StatusBadRequest, w.Code)
+	}
+}
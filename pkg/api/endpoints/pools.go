@@ -0,0 +1,229 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/pool"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/go-chi/chi/v5"
+)
+
+type PoolsHandler struct {
+	EC2Client  ec2.EC2Client
+	Store      *pool.Store
+	Templates  *cloudinit.TemplateStore
+	Reconciler *pool.Reconciler
+}
+
+func NewPoolsHandler(ec2Client ec2.EC2Client, store *pool.Store, templates *cloudinit.TemplateStore, reconciler *pool.Reconciler) *PoolsHandler {
+	return &PoolsHandler{
+		EC2Client:  ec2Client,
+		Store:      store,
+		Templates:  templates,
+		Reconciler: reconciler,
+	}
+}
+
+func (h *PoolsHandler) ListPools(w http.ResponseWriter, r *http.Request) {
+	pools := h.Store.List()
+
+	response := make([]generated.NodePool, 0, len(pools))
+	for _, p := range pools {
+		response = append(response, convertPoolToGenerated(p))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *PoolsHandler) CreatePool(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request generated.CreateNodePoolRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	newPool := pool.Pool{
+		Name:         request.Name,
+		InstanceType: types.InstanceTypeT4gMicro,
+		ImageChannel: image.LatestChannel,
+		DesiredCount: request.DesiredCount,
+	}
+	if request.InstanceType != nil {
+		newPool.InstanceType = types.InstanceType(*request.InstanceType)
+	}
+	if request.ImageChannel != nil && *request.ImageChannel != "" {
+		newPool.ImageChannel = *request.ImageChannel
+	}
+	if request.Tags != nil {
+		newPool.Tags = *request.Tags
+	}
+
+	if request.KeyName != nil && *request.KeyName != "" {
+		if _, err := ec2.GetKeyPair(ctx, h.EC2Client, *request.KeyName); err != nil {
+			writePoolError(w, err)
+			return
+		}
+		newPool.KeyName = *request.KeyName
+	}
+
+	if request.UserData != nil {
+		userData := &pool.UserData{Template: derefString(request.UserData.Template)}
+		if userData.Template != "" {
+			// The template is kept with the pool, so members keep launching
+			// after a restart or once the template is deleted
+			tmpl, err := h.Templates.Get(userData.Template)
+			if err != nil {
+				writePoolError(w, err)
+				return
+			}
+			userData.Snapshot = &tmpl
+		}
+		// Key names are resolved once here, so members keep launching even
+		// if a key is deleted later
+		vars, err := convertUserDataVariables(ctx, h.EC2Client, request.UserData.Variables)
+		if err != nil {
+			writePoolError(w, err)
+			return
+		}
+		userData.Variables = vars
+		newPool.UserData = userData
+	}
+
+	created, err := h.Store.Create(ctx, newPool)
+	if err != nil {
+		writePoolError(w, err)
+		return
+	}
+	h.Reconciler.Trigger()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(convertPoolToGenerated(created))
+}
+
+func (h *PoolsHandler) GetPool(w http.ResponseWriter, r *http.Request) {
+	poolName := chi.URLParam(r, "poolName")
+
+	if poolName == "" {
+		WriteProblem(w, http.StatusBadRequest, "poolName is required")
+		return
+	}
+
+	p, err := h.Store.Get(poolName)
+	if err != nil {
+		writePoolError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertPoolToGenerated(p))
+}
+
+func (h *PoolsHandler) ScalePool(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	poolName := chi.URLParam(r, "poolName")
+
+	if poolName == "" {
+		WriteProblem(w, http.StatusBadRequest, "poolName is required")
+		return
+	}
+
+	var request generated.ScaleNodePoolRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	p, err := h.Store.SetDesiredCount(ctx, poolName, request.DesiredCount)
+	if err != nil {
+		writePoolError(w, err)
+		return
+	}
+	h.Reconciler.Trigger()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertPoolToGenerated(p))
+}
+
+func (h *PoolsHandler) DeletePool(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	poolName := chi.URLParam(r, "poolName")
+
+	if poolName == "" {
+		WriteProblem(w, http.StatusBadRequest, "poolName is required")
+		return
+	}
+
+	// Marking the pool first keeps the reconciler from replacing members
+	// while they are drained; the pool is only removed once they are gone
+	if err := h.Store.MarkDeleting(ctx, poolName); err != nil {
+		writePoolError(w, err)
+		return
+	}
+
+	if err := h.Reconciler.Delete(ctx, poolName); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writePoolError answers a pool that refers to a missing template or key
+// pair as invalid input rather than a missing pool.
+func writePoolError(w http.ResponseWriter, err error) {
+	if errors.Is(err, cloudinit.ErrTemplateNotFound) || errors.Is(err, ec2.ErrKeyPairNotFound) {
+		WriteProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	WriteError(w, err)
+}
+
+func convertPoolToGenerated(p pool.Pool) generated.NodePool {
+	response := generated.NodePool{
+		Name:         p.Name,
+		InstanceType: string(p.InstanceType),
+		ImageChannel: p.ImageChannel,
+		KeyName:      stringPtrOrNil(p.KeyName),
+		DesiredCount: p.DesiredCount,
+		Status: generated.NodePoolStatus{
+			Members:   p.Status.Members,
+			Pending:   p.Status.Pending,
+			Running:   p.Status.Running,
+			Unhealthy: p.Status.Unhealthy,
+			LastError: stringPtrOrNil(p.Status.LastError),
+		},
+	}
+	if response.Status.Members == nil {
+		response.Status.Members = []string{}
+	}
+	if len(p.Tags) > 0 {
+		tags := p.Tags
+		response.Tags = &tags
+	}
+	if !p.Status.LastReconciledAt.IsZero() {
+		lastReconciledAt := p.Status.LastReconciledAt
+		response.Status.LastReconciledAt = &lastReconciledAt
+	}
+	if !p.CreatedAt.IsZero() {
+		createdAt := p.CreatedAt
+		response.CreatedAt = &createdAt
+	}
+	if !p.UpdatedAt.IsZero() {
+		updatedAt := p.UpdatedAt
+		response.UpdatedAt = &updatedAt
+	}
+	return response
+}
@@ -0,0 +1,188 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/pool"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/go-chi/chi/v5"
+)
+
+func newTestPoolsHandler(mockClient *ec2.MockEC2Client) *PoolsHandler {
+	store := pool.NewStore()
+	templates := cloudinit.NewTemplateStore()
+	reconciler := pool.NewReconciler(mockClient, store, &image.MockChannelAMIFinder{}, templates)
+	return NewPoolsHandler(mockClient, store, templates, reconciler)
+}
+
+func withPoolName(req *http.Request, poolName string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("poolName", poolName)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestPoolsHandler_CreatePool(t *testing.T) {
+	expectedName := "ci-runners"
+	expectedDesiredCount := 3
+	handler := newTestPoolsHandler(&ec2.MockEC2Client{})
+
+	body := `{"name": "ci-runners", "desiredCount": 3, "tags": {"Team": "infra"}, "userData": {"variables": {"packages": ["git"]}}}`
+	req := httptest.NewRequest("POST", "/pools", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreatePool(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response generated.NodePool
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Name != expectedName {
+		t.Errorf("expected name %s, got %s", expectedName, response.Name)
+	}
+	if response.DesiredCount != expectedDesiredCount {
+		t.Errorf("expected desired count %d, got %d", expectedDesiredCount, response.DesiredCount)
+	}
+	if response.InstanceType != string(types.InstanceTypeT4gMicro) {
+		t.Errorf("expected default instance type %s, got %s", types.InstanceTypeT4gMicro, response.InstanceType)
+	}
+	if response.ImageChannel != image.LatestChannel {
+		t.Errorf("expected default image channel %s, got %s", image.LatestChannel, response.ImageChannel)
+	}
+	if response.Status.Members == nil {
+		t.Error("expected members to be an empty list")
+	}
+
+	stored, err := handler.Store.Get(expectedName)
+	if err != nil {
+		t.Fatalf("expected pool to be stored: %v", err)
+	}
+	if stored.UserData == nil || len(stored.UserData.Variables.Packages) != 1 {
+		t.Errorf("expected user data variables to be stored, got %+v", stored.UserData)
+	}
+}
+
+func TestPoolsHandler_CreatePool_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"reserved tag", `{"name": "ci", "desiredCount": 1, "tags": {"Pool": "other"}}`},
+		{"unknown instance type", `{"name": "ci", "desiredCount": 1, "instanceType": "t9.huge"}`},
+		{"unknown template", `{"name": "ci", "desiredCount": 1, "userData": {"template": "unknown"}}`},
+		{"too many members", `{"name": "ci", "desiredCount": 1000}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTestPoolsHandler(&ec2.MockEC2Client{})
+
+			req := httptest.NewRequest("POST", "/pools", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.CreatePool(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestPoolsHandler_ScalePool(t *testing.T) {
+	handler := newTestPoolsHandler(&ec2.MockEC2Client{})
+	handler.Store.Create(context.Background(), pool.Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: 1})
+
+	req := withPoolName(httptest.NewRequest("POST", "/pools/ci:scale", strings.NewReader(`{"desiredCount": 5}`)), "ci")
+	w := httptest.NewRecorder()
+
+	handler.ScalePool(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	stored, _ := handler.Store.Get("ci")
+	if stored.DesiredCount != 5 {
+		t.Errorf("expected desired count 5, got %d", stored.DesiredCount)
+	}
+}
+
+func TestPoolsHandler_ScalePool_NotFound(t *testing.T) {
+	handler := newTestPoolsHandler(&ec2.MockEC2Client{})
+
+	req := withPoolName(httptest.NewRequest("POST", "/pools/unknown:scale", strings.NewReader(`{"desiredCount": 5}`)), "unknown")
+	w := httptest.NewRecorder()
+
+	handler.ScalePool(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestPoolsHandler_DeletePool(t *testing.T) {
+	expectedInstanceID := "i-1234567890abcdef0"
+	var terminated []string
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{
+						Instances: []types.Instance{
+							{
+								InstanceId: aws.String(expectedInstanceID),
+								State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+			terminated = append(terminated, params.InstanceIds...)
+			return &awsec2.TerminateInstancesOutput{
+				TerminatingInstances: []types.InstanceStateChange{
+					{
+						InstanceId:    aws.String(expectedInstanceID),
+						PreviousState: &types.InstanceState{Name: types.InstanceStateNameRunning},
+						CurrentState:  &types.InstanceState{Name: types.InstanceStateNameShuttingDown},
+					},
+				},
+			}, nil
+		},
+	}
+
+	handler := newTestPoolsHandler(mockClient)
+	handler.Store.Create(context.Background(), pool.Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: 1})
+
+	req := withPoolName(httptest.NewRequest("DELETE", "/pools/ci", nil), "ci")
+	w := httptest.NewRecorder()
+
+	handler.DeletePool(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if len(terminated) != 1 || terminated[0] != expectedInstanceID {
+		t.Errorf("expected %s to be terminated, got %v", expectedInstanceID, terminated)
+	}
+	if len(handler.Store.List()) != 0 {
+		t.Error("expected pool to be removed")
+	}
+}
@@ -0,0 +1,91 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/smithy-go"
+)
+
+// ProblemContentType is the media type of error responses, see RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// kindStatus is the status each kind of error is answered with.
+var kindStatus = map[errkind.Kind]int{
+	errkind.NotFound:      http.StatusNotFound,
+	errkind.Conflict:      http.StatusConflict,
+	errkind.Throttled:     http.StatusTooManyRequests,
+	errkind.QuotaExceeded: http.StatusForbidden,
+	errkind.InvalidInput:  http.StatusBadRequest,
+	errkind.Unavailable:   http.StatusServiceUnavailable,
+	errkind.Timeout:       http.StatusGatewayTimeout,
+}
+
+// statusCode returns the problem code of a status. Kinds double as codes.
+func statusCode(status int) generated.ProblemCode {
+	for kind, kindStatus := range kindStatus {
+		if kindStatus == status {
+			return generated.ProblemCode(kind)
+		}
+	}
+	if status == http.StatusNotImplemented {
+		return generated.NotImplemented
+	}
+	return generated.Internal
+}
+
+// WriteProblem answers with a problem of status. Its code is the kind of
+// error the status stands for, e.g. not_found for 404.
+func WriteProblem(w http.ResponseWriter, status int, detail string) {
+	writeProblem(w, newProblem(status, detail))
+}
+
+// WriteError answers with the problem for err, whose status and code follow
+// from its errkind.Kind. AWS API errors are described by their message
+// rather than the request details the SDK wraps them in. Unclassified
+// errors are internal server errors.
+func WriteError(w http.ResponseWriter, err error) {
+	writeProblem(w, errorProblem(err))
+}
+
+func writeProblem(w http.ResponseWriter, problem generated.Problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func newProblem(status int, detail string) generated.Problem {
+	return generated.Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: stringPtrOrNil(detail),
+		Code:   statusCode(status),
+	}
+}
+
+// errorProblem describes err the way WriteError answers with it. Batch
+// responses carry it per item.
+func errorProblem(err error) generated.Problem {
+	status, ok := kindStatus[errkind.Of(err)]
+	if !ok {
+		slog.Error("Request failed", "error", err)
+		status = http.StatusInternalServerError
+	}
+
+	detail := err.Error()
+	var kindErr *errkind.Error
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &kindErr) && kindErr.Code == "":
+		// Package errors describe themselves
+	case errors.As(err, &apiErr) && apiErr.ErrorMessage() != "":
+		detail = apiErr.ErrorMessage()
+	}
+	return newProblem(status, detail)
+}
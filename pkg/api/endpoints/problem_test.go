@@ -0,0 +1,107 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/smithy-go"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) generated.Problem {
+	t.Helper()
+	if contentType := w.Header().Get("Content-Type"); contentType != ProblemContentType {
+		t.Fatalf("expected content type %s, got %s", ProblemContentType, contentType)
+	}
+	var problem generated.Problem
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+	if problem.Status != w.Code {
+		t.Errorf("expected status %d in the problem, got %d", w.Code, problem.Status)
+	}
+	return problem
+}
+
+func TestWriteProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	problem := decodeProblem(t, w)
+	if problem.Type != "about:blank" || problem.Title != "Bad Request" || problem.Code != generated.InvalidInput ||
+		derefString(problem.Detail) != "Invalid request body" {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   generated.ProblemCode
+		detail string
+	}{
+		{
+			name:   "package error",
+			err:    fmt.Errorf("%w: i-123", ec2.ErrInstanceNotFound),
+			status: http.StatusNotFound,
+			code:   generated.NotFound,
+			detail: "instance not found: i-123",
+		},
+		{
+			name:   "classified AWS error",
+			err:    fmt.Errorf("failed to run instances: %w", errkind.Classify(&smithy.GenericAPIError{Code: "RequestLimitExceeded", Message: "Request limit exceeded."})),
+			status: http.StatusTooManyRequests,
+			code:   generated.Throttled,
+			detail: "Request limit exceeded.",
+		},
+		{
+			name:   "unclassified AWS error",
+			err:    &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity", Message: "No capacity."},
+			status: http.StatusServiceUnavailable,
+			code:   generated.Unavailable,
+			detail: "No capacity.",
+		},
+		{
+			name:   "wait timeout",
+			err:    &ec2.WaitTimeoutError{InstanceID: "i-123"},
+			status: http.StatusGatewayTimeout,
+			code:   generated.Timeout,
+		},
+		{
+			name:   "internal error",
+			err:    errors.New("disk full"),
+			status: http.StatusInternalServerError,
+			code:   generated.Internal,
+			detail: "disk full",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WriteError(w, tt.err)
+
+			if w.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, w.Code)
+			}
+			problem := decodeProblem(t, w)
+			if problem.Code != tt.code {
+				t.Errorf("expected code %s, got %s", tt.code, problem.Code)
+			}
+			if tt.detail != "" && derefString(problem.Detail) != tt.detail {
+				t.Errorf("expected detail %q, got %q", tt.detail, derefString(problem.Detail))
+			}
+		})
+	}
+}
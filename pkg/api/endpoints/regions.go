@@ -0,0 +1,62 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/eip"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
+)
+
+var ErrUnknownRegion = errkind.New(errkind.InvalidInput, "region is not served")
+
+// Region holds the clients of one region served by the API.
+type Region struct {
+	EC2Client ec2.EC2Client
+	AMIFinder image.AMIFinder
+	Images    image.ImageLister
+	// Provider runs the node lifecycle; it defaults to EC2 through
+	// EC2Client and AMIFinder
+	Provider provider.Provider
+	// Addresses associates the static IPs of nodes in the region; optional
+	Addresses *eip.Reconciler
+}
+
+func (r Region) withProvider() Region {
+	if r.Provider == nil {
+		r.Provider = provider.NewEC2(r.EC2Client, r.AMIFinder)
+	}
+	return r
+}
+
+// regionNames returns the default region followed by the other served
+// regions in order.
+func regionNames(defaultRegion string, regions map[string]Region) []string {
+	names := []string{defaultRegion}
+	others := make([]string, 0, len(regions))
+	for name := range regions {
+		if name != defaultRegion {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+// regionParam returns the region query parameter, rejecting regions that are
+// not served.
+func regionParam(r *http.Request, defaultRegion string, regions map[string]Region) (string, error) {
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		return "", nil
+	}
+	if !slices.Contains(regionNames(defaultRegion, regions), region) {
+		return "", fmt.Errorf("%w: %s", ErrUnknownRegion, region)
+	}
+	return region, nil
+}
@@ -0,0 +1,190 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/eip"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/go-chi/chi/v5"
+)
+
+// newRegionClient serves one running instance and records launches.
+func newRegionClient(instanceID string, launched *[]string) *ec2.MockEC2Client {
+	return &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			// Name lookups find no conflicting node
+			for _, filter := range params.Filters {
+				if aws.ToString(filter.Name) == "tag:Name" {
+					return &awsec2.DescribeInstancesOutput{}, nil
+				}
+			}
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{{
+					Instances: []types.Instance{{
+						InstanceId: aws.String(instanceID),
+						State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+					}},
+				}},
+			}, nil
+		},
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			*launched = append(*launched, aws.ToString(params.ImageId))
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{{
+					InstanceId: aws.String("i-new"),
+					State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+				}},
+			}, nil
+		},
+	}
+}
+
+func newMultiRegionNodesHandler(launched *[]string) *NodesHandler {
+	handler := NewNodesHandler(newRegionClient("i-frankfurt", launched), &image.MockAMIFinder{
+		FindLatestAMIFunc: func(ctx context.Context) (string, error) { return "ami-frankfurt", nil },
+	})
+	handler.Region = "eu-central-1"
+	handler.Regions = map[string]Region{
+		"us-east-1": {
+			EC2Client: newRegionClient("i-virginia", launched),
+			AMIFinder: &image.MockAMIFinder{
+				FindLatestAMIFunc: func(ctx context.Context) (string, error) { return "ami-virginia", nil },
+			},
+		},
+	}
+	return handler
+}
+
+func TestNodesHandler_ListNodes_Regions(t *testing.T) {
+	handler := newMultiRegionNodesHandler(new([]string))
+
+	req := httptest.NewRequest("GET", "/nodes", nil)
+	w := httptest.NewRecorder()
+	handler.ListNodes(w, req)
+
+	var nodes []generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&nodes); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(nodes) != 2 || *nodes[0].Region != "eu-central-1" || *nodes[1].Region != "us-east-1" {
+		t.Fatalf("expected one node per region, got %+v", nodes)
+	}
+
+	req = httptest.NewRequest("GET", "/nodes?region=us-east-1", nil)
+	w = httptest.NewRecorder()
+	handler.ListNodes(w, req)
+
+	nodes = nil
+	if err := json.NewDecoder(w.Body).Decode(&nodes); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Id != "i-virginia" {
+		t.Errorf("expected only i-virginia, got %+v", nodes)
+	}
+
+	req = httptest.NewRequest("GET", "/nodes?region=ap-south-1", nil)
+	w = httptest.NewRecorder()
+	handler.ListNodes(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d for an unknown region, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestNodesHandler_CreateNode_Region(t *testing.T) {
+	var launched []string
+	handler := newMultiRegionNodesHandler(&launched)
+
+	req := httptest.NewRequest("POST", "/nodes", strings.NewReader(`{"region": "us-east-1"}`))
+	w := httptest.NewRecorder()
+	handler.CreateNode(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if len(launched) != 1 || launched[0] != "ami-virginia" {
+		t.Errorf("expected a launch from the us-east-1 AMI, got %v", launched)
+	}
+
+	var node generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&node); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if node.Region == nil || *node.Region != "us-east-1" {
+		t.Errorf("expected region us-east-1, got %v", node.Region)
+	}
+}
+
+func TestNodesHandler_Region_Addresses(t *testing.T) {
+	handler := newMultiRegionNodesHandler(new([]string))
+	handler.Addresses = eip.NewReconciler(handler.EC2Client, nil)
+	virginia := handler.Regions["us-east-1"]
+	virginia.Addresses = eip.NewReconciler(virginia.EC2Client, nil)
+	handler.Regions["us-east-1"] = virginia
+
+	// Static IPs are associated by the reconciler of the node's region
+	region, err := handler.region("")
+	if err != nil || region.Addresses != handler.Addresses {
+		t.Errorf("expected the default region's reconciler, got %p (%v)", region.Addresses, err)
+	}
+	region, err = handler.region("us-east-1")
+	if err != nil || region.Addresses != virginia.Addresses {
+		t.Errorf("expected the us-east-1 reconciler, got %p (%v)", region.Addresses, err)
+	}
+}
+
+func TestNodesHandler_GetNode_LocatesRegion(t *testing.T) {
+	handler := newMultiRegionNodesHandler(new([]string))
+
+	req := httptest.NewRequest("GET", "/nodes/i-virginia", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("nodeId", "i-virginia")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	handler.GetNode(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var node generated.Node
+	if err := json.NewDecoder(w.Body).Decode(&node); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if node.Region == nil || *node.Region != "us-east-1" {
+		t.Errorf("expected the node to be found in us-east-1, got %v", node.Region)
+	}
+}
+
+func TestImagesHandler_ListImages_Regions(t *testing.T) {
+	lister := func(amiID string) *image.MockImageLister {
+		return &image.MockImageLister{
+			ListImagesFunc: func(ctx context.Context) ([]types.Image, error) {
+				return []types.Image{{ImageId: aws.String(amiID)}}, nil
+			},
+		}
+	}
+	handler := NewImagesHandler(lister("ami-frankfurt"))
+	handler.Region = "eu-central-1"
+	handler.Regions = map[string]Region{"us-east-1": {Images: lister("ami-virginia")}}
+
+	req := httptest.NewRequest("GET", "/images?region=us-east-1", nil)
+	w := httptest.NewRecorder()
+	handler.ListImages(w, req)
+
+	var images []generated.Image
+	if err := json.NewDecoder(w.Body).Decode(&images); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(images) != 1 || images[0].Id != "ami-virginia" || images[0].Region == nil || *images[0].Region != "us-east-1" {
+		t.Errorf("expected ami-virginia in us-east-1, got %+v", images)
+	}
+}
@@ -0,0 +1,353 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
+	"github.com/go-chi/chi/v5"
+)
+
+type TemplatesHandler struct {
+	Store     *cloudinit.TemplateStore
+	EC2Client ec2.EC2Client
+}
+
+func NewTemplatesHandler(store *cloudinit.TemplateStore, ec2Client ec2.EC2Client) *TemplatesHandler {
+	return &TemplatesHandler{
+		Store:     store,
+		EC2Client: ec2Client,
+	}
+}
+
+func (h *TemplatesHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates := h.Store.List()
+
+	response := make([]generated.Template, 0, len(templates))
+	for _, tmpl := range templates {
+		response = append(response, convertTemplateToGenerated(tmpl))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *TemplatesHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var request generated.CreateTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tmpl, err := h.Store.Create(convertGeneratedTemplate(request.Name, request.Description, request.Config, request.Parts))
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(convertTemplateToGenerated(tmpl))
+}
+
+func (h *TemplatesHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	templateName := chi.URLParam(r, "templateName")
+
+	if templateName == "" {
+		WriteProblem(w, http.StatusBadRequest, "templateName is required")
+		return
+	}
+
+	tmpl, err := h.Store.Get(templateName)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertTemplateToGenerated(tmpl))
+}
+
+func (h *TemplatesHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	templateName := chi.URLParam(r, "templateName")
+
+	if templateName == "" {
+		WriteProblem(w, http.StatusBadRequest, "templateName is required")
+		return
+	}
+
+	var request generated.UpdateTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tmpl, err := h.Store.Update(convertGeneratedTemplate(templateName, request.Description, request.Config, request.Parts))
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertTemplateToGenerated(tmpl))
+}
+
+func (h *TemplatesHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	templateName := chi.URLParam(r, "templateName")
+
+	if templateName == "" {
+		WriteProblem(w, http.StatusBadRequest, "templateName is required")
+		return
+	}
+
+	if err := h.Store.Delete(templateName); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RenderTemplate is a dry run of what a node created with this template and
+// these variables would receive as user data.
+func (h *TemplatesHandler) RenderTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	templateName := chi.URLParam(r, "templateName")
+
+	if templateName == "" {
+		WriteProblem(w, http.StatusBadRequest, "templateName is required")
+		return
+	}
+
+	var request generated.UserDataVariables
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userData, err := renderUserData(ctx, h.EC2Client, h.Store, templateName, &request, "")
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	response := generated.RenderedUserData{
+		Content:     userData.Content,
+		ContentType: userData.ContentType,
+		Size:        userData.Size(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// renderUserData renders the named template (or only the variables when
+// templateName is empty), with the hostname falling back to defaultHostname.
+func renderUserData(ctx context.Context, client ec2.EC2Client, store *cloudinit.TemplateStore, templateName string, variables *generated.UserDataVariables, defaultHostname string) (cloudinit.UserData, error) {
+	var tmpl *cloudinit.Template
+	if templateName != "" {
+		found, err := store.Get(templateName)
+		if err != nil {
+			return cloudinit.UserData{}, err
+		}
+		tmpl = &found
+	}
+
+	vars, err := convertUserDataVariables(ctx, client, variables)
+	if err != nil {
+		return cloudinit.UserData{}, err
+	}
+	if vars.Hostname == "" {
+		vars.Hostname = defaultHostname
+	}
+
+	return cloudinit.Render(tmpl, vars)
+}
+
+// convertUserDataVariables resolves managed SSH key names to their public
+// keys, so the result no longer depends on the key pairs.
+func convertUserDataVariables(ctx context.Context, client ec2.EC2Client, variables *generated.UserDataVariables) (cloudinit.Variables, error) {
+	var vars cloudinit.Variables
+	if variables == nil {
+		return vars, nil
+	}
+
+	vars.Hostname = derefString(variables.Hostname)
+	if client == nil && len(derefSlice(variables.SshKeyNames)) > 0 {
+		return cloudinit.Variables{}, fmt.Errorf("%w: SSH key names", provider.ErrUnsupported)
+	}
+	for _, keyName := range derefSlice(variables.SshKeyNames) {
+		keyPair, err := ec2.GetKeyPair(ctx, client, keyName)
+		if err != nil {
+			return cloudinit.Variables{}, err
+		}
+		vars.SSHAuthorizedKeys = append(vars.SSHAuthorizedKeys, keyPair.PublicKey)
+	}
+	vars.SSHAuthorizedKeys = append(vars.SSHAuthorizedKeys, derefSlice(variables.SshAuthorizedKeys)...)
+	vars.Users = convertGeneratedCloudInitUsers(variables.Users)
+	vars.Packages = derefSlice(variables.Packages)
+	vars.Files = convertGeneratedCloudInitFiles(variables.Files)
+	vars.RunCmd = derefSlice(variables.Runcmd)
+	if variables.Vars != nil {
+		vars.Vars = *variables.Vars
+	}
+	return vars, nil
+}
+
+// writeTemplateError answers a template that refers to a missing key pair
+// as invalid input rather than a missing key pair.
+func writeTemplateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ec2.ErrKeyPairNotFound) {
+		WriteProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	WriteError(w, err)
+}
+
+func convertGeneratedTemplate(name string, description *string, config generated.CloudConfig, parts *[]generated.CloudInitPart) cloudinit.Template {
+	tmpl := cloudinit.Template{
+		Name: name,
+		Config: cloudinit.CloudConfig{
+			Users:             convertGeneratedCloudInitUsers(config.Users),
+			SSHAuthorizedKeys: derefSlice(config.SshAuthorizedKeys),
+			Packages:          derefSlice(config.Packages),
+			Files:             convertGeneratedCloudInitFiles(config.Files),
+			RunCmd:            derefSlice(config.Runcmd),
+		},
+	}
+	if description != nil {
+		tmpl.Description = *description
+	}
+	for _, part := range derefSlice(parts) {
+		tmpl.Parts = append(tmpl.Parts, cloudinit.Part{
+			ContentType: string(part.ContentType),
+			Filename:    derefString(part.Filename),
+			Content:     part.Content,
+		})
+	}
+	return tmpl
+}
+
+func convertGeneratedCloudInitUsers(users *[]generated.CloudInitUser) []cloudinit.User {
+	var converted []cloudinit.User
+	for _, user := range derefSlice(users) {
+		converted = append(converted, cloudinit.User{
+			Name:              user.Name,
+			Groups:            derefSlice(user.Groups),
+			Sudo:              derefString(user.Sudo),
+			Shell:             derefString(user.Shell),
+			SSHAuthorizedKeys: derefSlice(user.SshAuthorizedKeys),
+		})
+	}
+	return converted
+}
+
+func convertGeneratedCloudInitFiles(files *[]generated.CloudInitFile) []cloudinit.File {
+	var converted []cloudinit.File
+	for _, file := range derefSlice(files) {
+		converted = append(converted, cloudinit.File{
+			Path:        file.Path,
+			Content:     file.Content,
+			Permissions: derefString(file.Permissions),
+			Owner:       derefString(file.Owner),
+		})
+	}
+	return converted
+}
+
+func convertTemplateToGenerated(tmpl cloudinit.Template) generated.Template {
+	response := generated.Template{
+		Name:        tmpl.Name,
+		Description: stringPtrOrNil(tmpl.Description),
+		Config: generated.CloudConfig{
+			SshAuthorizedKeys: slicePtrOrNil(tmpl.Config.SSHAuthorizedKeys),
+			Packages:          slicePtrOrNil(tmpl.Config.Packages),
+			Runcmd:            slicePtrOrNil(tmpl.Config.RunCmd),
+		},
+	}
+
+	if len(tmpl.Config.Users) > 0 {
+		users := make([]generated.CloudInitUser, 0, len(tmpl.Config.Users))
+		for _, user := range tmpl.Config.Users {
+			users = append(users, generated.CloudInitUser{
+				Name:              user.Name,
+				Groups:            slicePtrOrNil(user.Groups),
+				Sudo:              stringPtrOrNil(user.Sudo),
+				Shell:             stringPtrOrNil(user.Shell),
+				SshAuthorizedKeys: slicePtrOrNil(user.SSHAuthorizedKeys),
+			})
+		}
+		response.Config.Users = &users
+	}
+
+	if len(tmpl.Config.Files) > 0 {
+		files := make([]generated.CloudInitFile, 0, len(tmpl.Config.Files))
+		for _, file := range tmpl.Config.Files {
+			files = append(files, generated.CloudInitFile{
+				Path:        file.Path,
+				Content:     file.Content,
+				Permissions: stringPtrOrNil(file.Permissions),
+				Owner:       stringPtrOrNil(file.Owner),
+			})
+		}
+		response.Config.Files = &files
+	}
+
+	if len(tmpl.Parts) > 0 {
+		parts := make([]generated.CloudInitPart, 0, len(tmpl.Parts))
+		for _, part := range tmpl.Parts {
+			parts = append(parts, generated.CloudInitPart{
+				ContentType: generated.CloudInitPartContentType(part.ContentType),
+				Filename:    stringPtrOrNil(part.Filename),
+				Content:     part.Content,
+			})
+		}
+		response.Parts = &parts
+	}
+
+	if !tmpl.CreatedAt.IsZero() {
+		createdAt := tmpl.CreatedAt
+		response.CreatedAt = &createdAt
+	}
+	if !tmpl.UpdatedAt.IsZero() {
+		updatedAt := tmpl.UpdatedAt
+		response.UpdatedAt = &updatedAt
+	}
+	return response
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefBool(b *bool) bool {
+	return b != nil && *b
+}
+
+func derefSlice[T any](s *[]T) []T {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+func slicePtrOrNil[T any](s []T) *[]T {
+	if len(s) == 0 {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,209 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/go-chi/chi/v5"
+)
+
+func withTemplateName(req *http.Request, templateName string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("templateName", templateName)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestTemplatesHandler_CreateTemplate(t *testing.T) {
+	expectedName := "web-server"
+	store := cloudinit.NewTemplateStore()
+	handler := NewTemplatesHandler(store, &ec2.MockEC2Client{})
+
+	body := `{"name": "web-server", "description": "nginx", "config": {"packages": ["nginx"], "runcmd": ["systemctl enable --now nginx"]}, "parts": [{"contentType": "text/x-shellscript", "content": "#!/bin/sh\n"}]}`
+	req := httptest.NewRequest("POST", "/templates", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreateTemplate(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response generated.Template
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Name != expectedName {
+		t.Errorf("expected name %s, got %s", expectedName, response.Name)
+	}
+	if response.Config.Packages == nil || len(*response.Config.Packages) != 1 {
+		t.Errorf("expected 1 package, got %v", response.Config.Packages)
+	}
+	if response.Parts == nil || (*response.Parts)[0].ContentType != generated.TextXShellscript {
+		t.Errorf("expected shell script part, got %v", response.Parts)
+	}
+	if response.CreatedAt == nil {
+		t.Error("expected createdAt to be set")
+	}
+
+	if _, err := store.Get(expectedName); err != nil {
+		t.Errorf("expected template to be stored: %v", err)
+	}
+}
+
+func TestTemplatesHandler_CreateTemplate_Invalid(t *testing.T) {
+	handler := NewTemplatesHandler(cloudinit.NewTemplateStore(), &ec2.MockEC2Client{})
+
+	body := `{"name": "web-server", "config": {"runcmd": ["echo {{.Hostname"]}}`
+	req := httptest.NewRequest("POST", "/templates", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreateTemplate(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestTemplatesHandler_CreateTemplate_Conflict(t *testing.T) {
+	store := cloudinit.NewTemplateStore()
+	store.Create(cloudinit.Template{Name: "web-server"})
+	handler := NewTemplatesHandler(store, &ec2.MockEC2Client{})
+
+	req := httptest.NewRequest("POST", "/templates", strings.NewReader(`{"name": "web-server", "config": {}}`))
+	w := httptest.NewRecorder()
+
+	handler.CreateTemplate(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestTemplatesHandler_UpdateTemplate(t *testing.T) {
+	store := cloudinit.NewTemplateStore()
+	store.Create(cloudinit.Template{Name: "web-server"})
+	handler := NewTemplatesHandler(store, &ec2.MockEC2Client{})
+
+	req := httptest.NewRequest("PUT", "/templates/web-server", strings.NewReader(`{"config": {"packages": ["git"]}}`))
+	req = withTemplateName(req, "web-server")
+	w := httptest.NewRecorder()
+
+	handler.UpdateTemplate(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	tmpl, _ := store.Get("web-server")
+	if len(tmpl.Config.Packages) != 1 || tmpl.Config.Packages[0] != "git" {
+		t.Errorf("expected packages [git], got %v", tmpl.Config.Packages)
+	}
+}
+
+func TestTemplatesHandler_GetTemplate_NotFound(t *testing.T) {
+	handler := NewTemplatesHandler(cloudinit.NewTemplateStore(), &ec2.MockEC2Client{})
+
+	req := withTemplateName(httptest.NewRequest("GET", "/templates/unknown", nil), "unknown")
+	w := httptest.NewRecorder()
+
+	handler.GetTemplate(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestTemplatesHandler_DeleteTemplate(t *testing.T) {
+	store := cloudinit.NewTemplateStore()
+	store.Create(cloudinit.Template{Name: "web-server"})
+	handler := NewTemplatesHandler(store, &ec2.MockEC2Client{})
+
+	req := withTemplateName(httptest.NewRequest("DELETE", "/templates/web-server", nil), "web-server")
+	w := httptest.NewRecorder()
+
+	handler.DeleteTemplate(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if len(store.List()) != 0 {
+		t.Errorf("expected template to be deleted")
+	}
+}
+
+func TestTemplatesHandler_RenderTemplate(t *testing.T) {
+	store := cloudinit.NewTemplateStore()
+	store.Create(cloudinit.Template{
+		Name:   "web-server",
+		Config: cloudinit.CloudConfig{RunCmd: []string{"echo {{.Vars.domain}}"}},
+	})
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeKeyPairsFunc: func(ctx context.Context, params *awsec2.DescribeKeyPairsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeKeyPairsOutput, error) {
+			return &awsec2.DescribeKeyPairsOutput{
+				KeyPairs: []types.KeyPairInfo{
+					{KeyName: aws.String("alice-laptop"), PublicKey: aws.String(testPublicKey)},
+				},
+			}, nil
+		},
+	}
+	handler := NewTemplatesHandler(store, mockClient)
+
+	body := `{"hostname": "brave-otter", "sshKeyNames": ["alice-laptop"], "vars": {"domain": "example.com"}}`
+	req := withTemplateName(httptest.NewRequest("POST", "/templates/web-server:render", strings.NewReader(body)), "web-server")
+	w := httptest.NewRecorder()
+
+	handler.RenderTemplate(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response generated.RenderedUserData
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.ContentType != cloudinit.ContentTypeCloudConfig {
+		t.Errorf("expected content type %s, got %s", cloudinit.ContentTypeCloudConfig, response.ContentType)
+	}
+	if response.Size != len(response.Content) {
+		t.Errorf("expected size %d, got %d", len(response.Content), response.Size)
+	}
+	for _, expected := range []string{`hostname: "brave-otter"`, testPublicKey, `"echo example.com"`} {
+		if !strings.Contains(response.Content, expected) {
+			t.Errorf("expected rendered user data to contain %q, got:\n%s", expected, response.Content)
+		}
+	}
+}
+
+func TestTemplatesHandler_RenderTemplate_UnknownKey(t *testing.T) {
+	store := cloudinit.NewTemplateStore()
+	store.Create(cloudinit.Template{Name: "web-server"})
+
+	mockClient := &ec2.MockEC2Client{
+		DescribeKeyPairsFunc: func(ctx context.Context, params *awsec2.DescribeKeyPairsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeKeyPairsOutput, error) {
+			return nil, &smithy.GenericAPIError{Code: "InvalidKeyPair.NotFound", Message: "The key pair does not exist"}
+		},
+	}
+	handler := NewTemplatesHandler(store, mockClient)
+
+	req := withTemplateName(httptest.NewRequest("POST", "/templates/web-server:render", strings.NewReader(`{"sshKeyNames": ["unknown"]}`)), "web-server")
+	w := httptest.NewRecorder()
+
+	handler.RenderTemplate(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,266 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/go-chi/chi/v5"
+)
+
+type VolumesHandler struct {
+	EC2Client ec2.EC2Client
+	// Inventory records every operation run against volumes. It defaults to
+	// an in-memory store.
+	Inventory inventory.Store
+	// Instances is invalidated after attach and detach, which change the
+	// block devices of a node; optional
+	Instances *InstanceCache
+}
+
+func NewVolumesHandler(ec2Client ec2.EC2Client) *VolumesHandler {
+	return &VolumesHandler{
+		EC2Client: ec2Client,
+		Inventory: inventory.NewMemoryStore(),
+	}
+}
+
+func (h *VolumesHandler) ListVolumes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	volumes, err := ec2.ListVolumes(ctx, h.EC2Client)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	response := make([]generated.Volume, 0, len(volumes))
+	for _, volume := range volumes {
+		response = append(response, convertVolumeInfoToVolume(volume))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *VolumesHandler) CreateVolume(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request generated.CreateVolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	config := ec2.VolumeConfig{
+		Name:             derefString(request.Name),
+		AvailabilityZone: request.AvailabilityZone,
+		SizeGiB:          int32(request.SizeGiB),
+		Encrypted:        derefBool(request.Encrypted),
+		KMSKeyID:         derefString(request.KmsKeyId),
+	}
+	if request.Type != nil {
+		config.Type = types.VolumeType(*request.Type)
+	}
+	if request.Iops != nil {
+		config.IOPS = int32(*request.Iops)
+	}
+	if request.Throughput != nil {
+		config.Throughput = int32(*request.Throughput)
+	}
+
+	started := time.Now()
+	volume, err := ec2.CreateVolume(ctx, h.EC2Client, config)
+	op := inventory.OperationRecord{
+		Type:   "create-volume",
+		Target: config.Name,
+		Actor:  requestActor(r),
+		Params: map[string]string{
+			"availabilityZone": config.AvailabilityZone,
+			"sizeGiB":          strconv.Itoa(int(config.SizeGiB)),
+		},
+	}
+	if config.Type != "" {
+		op.Params["type"] = string(config.Type)
+	}
+	if err == nil {
+		op.Target = volume.VolumeID
+	}
+	recordOperation(ctx, h.Inventory, op, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(convertVolumeInfoToVolume(volume))
+}
+
+func (h *VolumesHandler) GetVolume(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	volumeID := chi.URLParam(r, "volumeId")
+
+	if volumeID == "" {
+		WriteProblem(w, http.StatusBadRequest, "volumeId is required")
+		return
+	}
+
+	volume, err := ec2.GetVolume(ctx, h.EC2Client, volumeID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertVolumeInfoToVolume(volume))
+}
+
+func (h *VolumesHandler) DeleteVolume(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	volumeID := chi.URLParam(r, "volumeId")
+
+	if volumeID == "" {
+		WriteProblem(w, http.StatusBadRequest, "volumeId is required")
+		return
+	}
+
+	started := time.Now()
+	err := ec2.DeleteVolume(ctx, h.EC2Client, volumeID)
+	recordOperation(ctx, h.Inventory, inventory.OperationRecord{Type: "delete-volume", Target: volumeID, Actor: requestActor(r)}, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *VolumesHandler) AttachVolume(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	volumeID := chi.URLParam(r, "volumeId")
+
+	if volumeID == "" {
+		WriteProblem(w, http.StatusBadRequest, "volumeId is required")
+		return
+	}
+
+	var request generated.AttachVolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.NodeId == "" {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body, nodeId is required")
+		return
+	}
+
+	instanceID, err := ec2.ResolveInstanceID(ctx, h.EC2Client, request.NodeId)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	opts := ec2.AttachVolumeOptions{
+		DeviceName:          derefString(request.Device),
+		DeleteOnTermination: derefBool(request.DeleteOnTermination),
+	}
+	started := time.Now()
+	volume, err := ec2.AttachVolume(ctx, h.EC2Client, volumeID, instanceID, opts)
+	params := map[string]string{"nodeId": instanceID}
+	if len(volume.Attachments) > 0 {
+		params["device"] = volume.Attachments[0].DeviceName
+	}
+	if opts.DeleteOnTermination {
+		params["deleteOnTermination"] = "true"
+	}
+	recordOperation(ctx, h.Inventory, inventory.OperationRecord{Type: "attach-volume", Target: volumeID, Actor: requestActor(r), Params: params}, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	h.Instances.Invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertVolumeInfoToVolume(volume))
+}
+
+func (h *VolumesHandler) DetachVolume(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	volumeID := chi.URLParam(r, "volumeId")
+
+	if volumeID == "" {
+		WriteProblem(w, http.StatusBadRequest, "volumeId is required")
+		return
+	}
+
+	var request generated.DetachVolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		WriteProblem(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	force := derefBool(request.Force)
+
+	started := time.Now()
+	volume, err := ec2.DetachVolume(ctx, h.EC2Client, volumeID, force)
+	op := inventory.OperationRecord{Type: "detach-volume", Target: volumeID, Actor: requestActor(r)}
+	if force {
+		op.Params = map[string]string{"force": "true"}
+	}
+	recordOperation(ctx, h.Inventory, op, started, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	h.Instances.Invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(convertVolumeInfoToVolume(volume))
+}
+
+func convertVolumeInfoToVolume(volume ec2.VolumeInfo) generated.Volume {
+	response := generated.Volume{
+		Id:               volume.VolumeID,
+		Name:             stringPtrOrNil(volume.Name),
+		State:            volume.State,
+		AvailabilityZone: volume.AvailabilityZone,
+		SizeGiB:          int(volume.SizeGiB),
+		Type:             volume.Type,
+		Encrypted:        volume.Encrypted,
+		KmsKeyId:         stringPtrOrNil(volume.KMSKeyID),
+		Attachments:      make([]generated.VolumeAttachment, 0, len(volume.Attachments)),
+	}
+	if volume.IOPS != 0 {
+		iops := int(volume.IOPS)
+		response.Iops = &iops
+	}
+	if volume.Throughput != 0 {
+		throughput := int(volume.Throughput)
+		response.Throughput = &throughput
+	}
+	if !volume.CreatedAt.IsZero() {
+		createdAt := volume.CreatedAt
+		response.CreatedAt = &createdAt
+	}
+	for _, attachment := range volume.Attachments {
+		converted := generated.VolumeAttachment{
+			NodeId:              attachment.InstanceID,
+			Device:              attachment.DeviceName,
+			State:               attachment.State,
+			DeleteOnTermination: attachment.DeleteOnTermination,
+		}
+		if !attachment.AttachedAt.IsZero() {
+			attachedAt := attachment.AttachedAt
+			converted.AttachedAt = &attachedAt
+		}
+		response.Attachments = append(response.Attachments, converted)
+	}
+	return response
+}
@@ -0,0 +1,172 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/api/generated"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/go-chi/chi/v5"
+)
+
+func withVolumeID(req *http.Request, volumeID string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("volumeId", volumeID)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestVolumesHandler_CreateVolume(t *testing.T) {
+	mockClient := &ec2.MockEC2Client{
+		CreateVolumeFunc: func(ctx context.Context, params *awsec2.CreateVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateVolumeOutput, error) {
+			if params.VolumeType != types.VolumeTypeIo2 || aws.ToInt32(params.Iops) != 1000 {
+				t.Errorf("expected io2 with 1000 IOPS, got %s with %v", params.VolumeType, params.Iops)
+			}
+			return &awsec2.CreateVolumeOutput{
+				VolumeId:         aws.String("vol-0123456789abcdef0"),
+				State:            types.VolumeStateCreating,
+				AvailabilityZone: params.AvailabilityZone,
+				Size:             params.Size,
+				VolumeType:       params.VolumeType,
+				Iops:             params.Iops,
+				Encrypted:        params.Encrypted,
+			}, nil
+		},
+	}
+
+	handler := NewVolumesHandler(mockClient)
+
+	body := `{"name": "db", "availabilityZone": "eu-central-1a", "sizeGiB": 100, "type": "io2", "iops": 1000, "encrypted": true}`
+	req := httptest.NewRequest("POST", "/volumes", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.CreateVolume(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response generated.Volume
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Id != "vol-0123456789abcdef0" || response.SizeGiB != 100 || !response.Encrypted || response.Iops == nil || *response.Iops != 1000 {
+		t.Errorf("unexpected volume %+v", response)
+	}
+	if response.Name == nil || *response.Name != "db" {
+		t.Errorf("expected name db, got %v", response.Name)
+	}
+
+	ops, _ := handler.Inventory.ListOperations(context.Background(), "vol-0123456789abcdef0")
+	if len(ops) != 1 || ops[0].Type != "create-volume" {
+		t.Errorf("expected create-volume operation, got %+v", ops)
+	}
+}
+
+func TestVolumesHandler_CreateVolume_Invalid(t *testing.T) {
+	handler := NewVolumesHandler(&ec2.MockEC2Client{})
+
+	for _, body := range []string{
+		`{"sizeGiB": 20}`,
+		`{"availabilityZone": "eu-central-1a", "sizeGiB": 0}`,
+		`{"availabilityZone": "eu-central-1a", "sizeGiB": 20, "type": "gp2", "throughput": 250}`,
+		`not json`,
+	} {
+		req := httptest.NewRequest("POST", "/volumes", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.CreateVolume(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestVolumesHandler_AttachVolume(t *testing.T) {
+	var attachment *types.VolumeAttachment
+	mockClient := &ec2.MockEC2Client{
+		DescribeVolumesFunc: func(ctx context.Context, params *awsec2.DescribeVolumesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeVolumesOutput, error) {
+			volume := types.Volume{
+				VolumeId:         aws.String("vol-1"),
+				AvailabilityZone: aws.String("eu-central-1a"),
+				State:            types.VolumeStateAvailable,
+			}
+			if attachment != nil {
+				volume.Attachments = []types.VolumeAttachment{*attachment}
+			}
+			return &awsec2.DescribeVolumesOutput{Volumes: []types.Volume{volume}}, nil
+		},
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{{
+					Instances: []types.Instance{{
+						InstanceId: aws.String("i-1234567890abcdef0"),
+						Placement:  &types.Placement{AvailabilityZone: aws.String("eu-central-1a")},
+					}},
+				}},
+			}, nil
+		},
+		AttachVolumeFunc: func(ctx context.Context, params *awsec2.AttachVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.AttachVolumeOutput, error) {
+			attachment = &types.VolumeAttachment{
+				InstanceId: params.InstanceId,
+				Device:     params.Device,
+				State:      types.VolumeAttachmentStateAttaching,
+			}
+			return &awsec2.AttachVolumeOutput{}, nil
+		},
+	}
+
+	handler := NewVolumesHandler(mockClient)
+
+	req := httptest.NewRequest("POST", "/volumes/vol-1:attach", strings.NewReader(`{"nodeId": "i-1234567890abcdef0"}`))
+	req = withVolumeID(req, "vol-1")
+	w := httptest.NewRecorder()
+
+	handler.AttachVolume(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response generated.Volume
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Attachments) != 1 || response.Attachments[0].Device != "/dev/sdf" || response.Attachments[0].NodeId != "i-1234567890abcdef0" {
+		t.Errorf("expected attachment as /dev/sdf, got %+v", response.Attachments)
+	}
+
+	// Attaching again conflicts
+	req = withVolumeID(httptest.NewRequest("POST", "/volumes/vol-1:attach", strings.NewReader(`{"nodeId": "i-1234567890abcdef0"}`)), "vol-1")
+	w = httptest.NewRecorder()
+	handler.AttachVolume(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestVolumesHandler_DeleteVolume_NotFound(t *testing.T) {
+	mockClient := &ec2.MockEC2Client{
+		DescribeVolumesFunc: func(ctx context.Context, params *awsec2.DescribeVolumesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeVolumesOutput, error) {
+			return &awsec2.DescribeVolumesOutput{}, nil
+		},
+	}
+
+	handler := NewVolumesHandler(mockClient)
+
+	req := withVolumeID(httptest.NewRequest("DELETE", "/volumes/vol-1", nil), "vol-1")
+	w := httptest.NewRecorder()
+
+	handler.DeleteVolume(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -7,6 +7,59 @@ import (
 	"time"
 )
 
+// Defines values for BatchCreateNodesRequestLifecycle.
+const (
+	BatchCreateNodesRequestLifecycleOnDemand BatchCreateNodesRequestLifecycle = "on-demand"
+	BatchCreateNodesRequestLifecycleSpot     BatchCreateNodesRequestLifecycle = "spot"
+)
+
+// Defines values for CloudInitPartContentType.
+const (
+	TextCloudBoothook CloudInitPartContentType = "text/cloud-boothook"
+	TextCloudConfig   CloudInitPartContentType = "text/cloud-config"
+	TextXShellscript  CloudInitPartContentType = "text/x-shellscript"
+)
+
+// Defines values for CreateNodeRequestLifecycle.
+const (
+	CreateNodeRequestLifecycleOnDemand CreateNodeRequestLifecycle = "on-demand"
+	CreateNodeRequestLifecycleSpot     CreateNodeRequestLifecycle = "spot"
+)
+
+// Defines values for CreateVolumeRequestType.
+const (
+	Gp2      CreateVolumeRequestType = "gp2"
+	Gp3      CreateVolumeRequestType = "gp3"
+	Io1      CreateVolumeRequestType = "io1"
+	Io2      CreateVolumeRequestType = "io2"
+	Sc1      CreateVolumeRequestType = "sc1"
+	St1      CreateVolumeRequestType = "st1"
+	Standard CreateVolumeRequestType = "standard"
+)
+
+// Defines values for Drift.
+const (
+	Missing              Drift = "missing"
+	TerminatedExternally Drift = "terminated-externally"
+	Unrecorded           Drift = "unrecorded"
+)
+
+// Defines values for EventType.
+const (
+	EventTypeBuildStage           EventType = "build.stage"
+	EventTypeImageState           EventType = "image.state"
+	EventTypeNodeSpotInterruption EventType = "node.spot-interruption"
+	EventTypeNodeState            EventType = "node.state"
+)
+
+// Defines values for FirewallRuleProtocol.
+const (
+	All  FirewallRuleProtocol = "all"
+	Icmp FirewallRuleProtocol = "icmp"
+	Tcp  FirewallRuleProtocol = "tcp"
+	Udp  FirewallRuleProtocol = "udp"
+)
+
 // Defines values for ImageArchitecture.
 const (
 	Arm64 ImageArchitecture = "arm64"
@@ -27,6 +80,18 @@ const (
 	Paravirtual ImageVirtualizationType = "paravirtual"
 )
 
+// Defines values for KeyType.
+const (
+	Ed25519 KeyType = "ed25519"
+	Rsa     KeyType = "rsa"
+)
+
+// Defines values for NodeLifecycle.
+const (
+	NodeLifecycleOnDemand NodeLifecycle = "on-demand"
+	NodeLifecycleSpot     NodeLifecycle = "spot"
+)
+
 // Defines values for NodeState.
 const (
 	NodeStatePending      NodeState = "pending"
@@ -37,6 +102,412 @@ const (
 	NodeStateTerminated   NodeState = "terminated"
 )
 
+// Defines values for OperationStatus.
+const (
+	OperationStatusFailed    OperationStatus = "failed"
+	OperationStatusRunning   OperationStatus = "running"
+	OperationStatusSucceeded OperationStatus = "succeeded"
+)
+
+// Defines values for ProblemCode.
+const (
+	Conflict       ProblemCode = "conflict"
+	Internal       ProblemCode = "internal"
+	InvalidInput   ProblemCode = "invalid_input"
+	NotFound       ProblemCode = "not_found"
+	NotImplemented ProblemCode = "not_implemented"
+	QuotaExceeded  ProblemCode = "quota_exceeded"
+	Throttled      ProblemCode = "throttled"
+	Timeout        ProblemCode = "timeout"
+	Unavailable    ProblemCode = "unavailable"
+)
+
+// Defines values for SpotOptionsInterruptionBehavior.
+const (
+	Hibernate SpotOptionsInterruptionBehavior = "hibernate"
+	Stop      SpotOptionsInterruptionBehavior = "stop"
+	Terminate SpotOptionsInterruptionBehavior = "terminate"
+)
+
+// Address defines model for Address.
+type Address struct {
+	// Associated Whether the address is associated with a node
+	Associated bool `json:"associated"`
+
+	// AssociationId EC2 association ID while the address is associated
+	AssociationId *string `json:"associationId,omitempty"`
+
+	// Id Elastic IP allocation ID
+	Id string `json:"id"`
+
+	// Idle Whether the address is unassociated and billed while idle
+	Idle bool `json:"idle"`
+
+	// IdleSince Time the reconciler first saw the address idle (ISO 8601)
+	IdleSince *time.Time `json:"idleSince,omitempty"`
+
+	// Name Address name (EC2 Name tag)
+	Name *string `json:"name,omitempty"`
+
+	// NodeId Instance ID of the node the address is associated with or tied to
+	NodeId *string `json:"nodeId,omitempty"`
+
+	// PublicIp Public IPv4 address
+	PublicIp string `json:"publicIp"`
+
+	// ReleaseWithNode Whether the address is released when its node is deleted
+	ReleaseWithNode bool `json:"releaseWithNode"`
+}
+
+// AllocateAddressRequest defines model for AllocateAddressRequest.
+type AllocateAddressRequest struct {
+	// Name Address name, stored as the EC2 Name tag
+	Name *string `json:"name,omitempty"`
+
+	// NodeId Instance ID or name of a node to associate the address with
+	NodeId *string `json:"nodeId,omitempty"`
+
+	// ReleaseWithNode Release the address when the node is deleted; requires nodeId
+	ReleaseWithNode *bool `json:"releaseWithNode,omitempty"`
+}
+
+// AssociateAddressRequest defines model for AssociateAddressRequest.
+type AssociateAddressRequest struct {
+	// NodeId Instance ID or name of the node
+	NodeId string `json:"nodeId"`
+}
+
+// AttachVolumeRequest defines model for AttachVolumeRequest.
+type AttachVolumeRequest struct {
+	// DeleteOnTermination Delete the volume when the node is terminated
+	DeleteOnTermination *bool `json:"deleteOnTermination,omitempty"`
+
+	// Device Device name; the first free one from /dev/sdf to /dev/sdp when omitted
+	Device *string `json:"device,omitempty"`
+
+	// NodeId Instance ID or name of the node
+	NodeId string `json:"nodeId"`
+}
+
+// BatchCreateNodesRequest defines model for BatchCreateNodesRequest.
+type BatchCreateNodesRequest struct {
+	// Count Number of nodes to launch
+	Count int `json:"count"`
+
+	// Hibernation Enable hibernation for the nodes; their root volumes are encrypted to hold the memory
+	Hibernation *bool `json:"hibernation,omitempty"`
+
+	// KeyName Name of a managed SSH key to launch the nodes with
+	KeyName *string `json:"keyName,omitempty"`
+
+	// Lifecycle Purchasing option to launch the nodes with
+	Lifecycle *BatchCreateNodesRequestLifecycle `json:"lifecycle,omitempty"`
+
+	// NamePrefix Nodes are named <namePrefix>-1 to <namePrefix>-<count>, skipping names in use; names are generated when omitted
+	NamePrefix *string `json:"namePrefix,omitempty"`
+
+	// Region Region to launch the nodes in; the default region when omitted
+	Region *string `json:"region,omitempty"`
+
+	// Spot Spot options; only allowed with lifecycle spot
+	Spot *SpotOptions `json:"spot,omitempty"`
+
+	// Tags Tags applied to every node
+	Tags     *map[string]string `json:"tags,omitempty"`
+	UserData *NodeUserData      `json:"userData,omitempty"`
+}
+
+// BatchCreateNodesRequestLifecycle Purchasing option to launch the nodes with
+type BatchCreateNodesRequestLifecycle string
+
+// BatchDeleteNodesRequest Either nodes or selector is required
+type BatchDeleteNodesRequest struct {
+	// Nodes Instance IDs or names of the nodes to delete
+	Nodes *[]string `json:"nodes,omitempty"`
+
+	// Region Region of the nodes; the default region when omitted
+	Region *string `json:"region,omitempty"`
+
+	// Selector Delete every managed node carrying all of these tags
+	Selector *map[string]string `json:"selector,omitempty"`
+}
+
+// BatchNodeResult Outcome of a batch operation for a single node
+type BatchNodeResult struct {
+	// Error RFC 7807 problem details of an error response
+	Error *Problem `json:"error,omitempty"`
+
+	// Id Instance ID of the node, unless it was never launched or resolved
+	Id *string `json:"id,omitempty"`
+
+	// Name Node name, or the node reference as given
+	Name *string `json:"name,omitempty"`
+	Node *Node   `json:"node,omitempty"`
+
+	// Succeeded Whether the operation succeeded for this node
+	Succeeded bool `json:"succeeded"`
+}
+
+// BatchNodesResponse defines model for BatchNodesResponse.
+type BatchNodesResponse struct {
+	// BatchId Batch the created nodes are tagged with (tag Batch); only set by batch create
+	BatchId *string `json:"batchId,omitempty"`
+
+	// Requested Number of nodes the operation was requested for
+	Requested int               `json:"requested"`
+	Results   []BatchNodeResult `json:"results"`
+
+	// Succeeded Number of nodes the operation succeeded for
+	Succeeded int `json:"succeeded"`
+}
+
+// BuildStageChanged defines model for BuildStageChanged.
+type BuildStageChanged struct {
+	// AmiId AMI registered by a successful build
+	AmiId *string `json:"amiId,omitempty"`
+
+	// BuildId Build identifier
+	BuildId string `json:"buildId"`
+
+	// Error Failure reason of a failed build
+	Error *string `json:"error,omitempty"`
+
+	// Stage Current stage, e.g. upload
+	Stage  string          `json:"stage"`
+	Status OperationStatus `json:"status"`
+}
+
+// CloudConfig defines model for CloudConfig.
+type CloudConfig struct {
+	// Files Files written by cloud-init (write_files)
+	Files *[]CloudInitFile `json:"files,omitempty"`
+
+	// Packages Packages installed on first boot
+	Packages *[]string `json:"packages,omitempty"`
+
+	// Runcmd Commands run once on first boot
+	Runcmd *[]string `json:"runcmd,omitempty"`
+
+	// SshAuthorizedKeys Public keys authorized for the default user
+	SshAuthorizedKeys *[]string `json:"sshAuthorizedKeys,omitempty"`
+
+	// Users Users created in addition to the distribution's default user
+	Users *[]CloudInitUser `json:"users,omitempty"`
+}
+
+// CloudInitFile defines model for CloudInitFile.
+type CloudInitFile struct {
+	// Content File content
+	Content string `json:"content"`
+
+	// Owner Owner in user:group form
+	Owner *string `json:"owner,omitempty"`
+
+	// Path Absolute path of the file
+	Path string `json:"path"`
+
+	// Permissions Octal file mode
+	Permissions *string `json:"permissions,omitempty"`
+}
+
+// CloudInitPart defines model for CloudInitPart.
+type CloudInitPart struct {
+	// Content Part content
+	Content string `json:"content"`
+
+	// ContentType MIME type of the part
+	ContentType CloudInitPartContentType `json:"contentType"`
+
+	// Filename Filename of the part inside the MIME archive
+	Filename *string `json:"filename,omitempty"`
+}
+
+// CloudInitPartContentType MIME type of the part
+type CloudInitPartContentType string
+
+// CloudInitUser defines model for CloudInitUser.
+type CloudInitUser struct {
+	// Groups Supplementary groups
+	Groups *[]string `json:"groups,omitempty"`
+
+	// Name User name
+	Name string `json:"name"`
+
+	// Shell Login shell
+	Shell *string `json:"shell,omitempty"`
+
+	// SshAuthorizedKeys Public keys authorized for this user
+	SshAuthorizedKeys *[]string `json:"sshAuthorizedKeys,omitempty"`
+
+	// Sudo Sudo rule for the user
+	Sudo *string `json:"sudo,omitempty"`
+}
+
+// ConsoleOutput Serial console output of a node
+type ConsoleOutput struct {
+	// NodeId Instance ID of the node
+	NodeId string `json:"nodeId"`
+
+	// Output Decoded console output, at most the most recent 64 KiB
+	Output string `json:"output"`
+
+	// Timestamp Time the output was last updated (ISO 8601); omitted while there is none
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// CreateKeyRequest defines model for CreateKeyRequest.
+type CreateKeyRequest struct {
+	// Name Key name
+	Name string `json:"name"`
+
+	// PublicKey Public key in authorized_keys format
+	PublicKey string `json:"publicKey"`
+}
+
+// CreateNodePoolRequest defines model for CreateNodePoolRequest.
+type CreateNodePoolRequest struct {
+	// DesiredCount Number of members the reconciler keeps running
+	DesiredCount int `json:"desiredCount"`
+
+	// ImageChannel AMI name prefix to launch from, or "latest" for the newest AMI
+	ImageChannel *string `json:"imageChannel,omitempty"`
+
+	// InstanceType EC2 instance type of the members
+	InstanceType *string `json:"instanceType,omitempty"`
+
+	// KeyName Name of a managed SSH key to launch members with
+	KeyName *string `json:"keyName,omitempty"`
+
+	// Name Pool name, also the prefix of member names
+	Name string `json:"name"`
+
+	// Tags Tags applied to every member
+	Tags     *map[string]string `json:"tags,omitempty"`
+	UserData *NodeUserData      `json:"userData,omitempty"`
+}
+
+// CreateNodeRequest defines model for CreateNodeRequest.
+type CreateNodeRequest struct {
+	// Hibernation Enable hibernation for the node; its root volume is encrypted to hold the memory
+	Hibernation *bool `json:"hibernation,omitempty"`
+
+	// KeyName Name of a managed SSH key to launch the node with
+	KeyName *string `json:"keyName,omitempty"`
+
+	// Lifecycle Purchasing option to launch the node with
+	Lifecycle *CreateNodeRequestLifecycle `json:"lifecycle,omitempty"`
+
+	// Name Unique node name, stored as the EC2 Name tag. Must not start with "i-".
+	Name *string `json:"name,omitempty"`
+
+	// Region Region to launch the node in; the default region when omitted
+	Region *string `json:"region,omitempty"`
+
+	// Spot Spot options; only allowed with lifecycle spot
+	Spot *SpotOptions `json:"spot,omitempty"`
+
+	// StaticIp Allocate an Elastic IP for the node that is released with it
+	StaticIp *bool         `json:"staticIp,omitempty"`
+	UserData *NodeUserData `json:"userData,omitempty"`
+}
+
+// CreateNodeRequestLifecycle Purchasing option to launch the node with
+type CreateNodeRequestLifecycle string
+
+// CreateTemplateRequest defines model for CreateTemplateRequest.
+type CreateTemplateRequest struct {
+	Config CloudConfig `json:"config"`
+
+	// Description Template description
+	Description *string `json:"description,omitempty"`
+
+	// Name Template name
+	Name string `json:"name"`
+
+	// Parts Additional MIME parts, e.g. shell scripts. With parts, user data is rendered as multipart MIME.
+	Parts *[]CloudInitPart `json:"parts,omitempty"`
+}
+
+// CreateVolumeRequest defines model for CreateVolumeRequest.
+type CreateVolumeRequest struct {
+	// AvailabilityZone Availability zone; must match the nodes the volume is attached to
+	AvailabilityZone string `json:"availabilityZone"`
+
+	// Encrypted Encrypt the volume
+	Encrypted *bool `json:"encrypted,omitempty"`
+
+	// Iops Provisioned IOPS (gp3, io1 and io2 only; required for io1 and io2)
+	Iops *int `json:"iops,omitempty"`
+
+	// KmsKeyId KMS key to encrypt with; the account default when omitted
+	KmsKeyId *string `json:"kmsKeyId,omitempty"`
+
+	// Name Volume name, stored as the EC2 Name tag
+	Name *string `json:"name,omitempty"`
+
+	// SizeGiB Size in GiB
+	SizeGiB int `json:"sizeGiB"`
+
+	// Throughput Provisioned throughput in MiB/s (gp3 only)
+	Throughput *int `json:"throughput,omitempty"`
+
+	// Type EBS volume type
+	Type *CreateVolumeRequestType `json:"type,omitempty"`
+}
+
+// CreateVolumeRequestType EBS volume type
+type CreateVolumeRequestType string
+
+// DetachVolumeRequest defines model for DetachVolumeRequest.
+type DetachVolumeRequest struct {
+	// Force Force the detachment; the node may lose unflushed data
+	Force *bool `json:"force,omitempty"`
+}
+
+// Drift How a recorded resource differs from what EC2 reports
+type Drift string
+
+// Event defines model for Event.
+type Event struct {
+	// Data NodeStateChanged, BuildStageChanged or ImageStateChanged, depending on type
+	Data map[string]interface{} `json:"data"`
+
+	// Id Event ID, usable as Last-Event-ID
+	Id string `json:"id"`
+
+	// Subject Instance, build or AMI ID the event is about
+	Subject string    `json:"subject"`
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"type"`
+}
+
+// EventType defines model for EventType.
+type EventType string
+
+// FirewallRule defines model for FirewallRule.
+type FirewallRule struct {
+	// Cidr Source IPv4 or IPv6 CIDR. Mutually exclusive with sourceGroupId.
+	Cidr *string `json:"cidr,omitempty"`
+
+	// Description Rule description
+	Description *string `json:"description,omitempty"`
+
+	// FromPort First port of the range (ICMP type for icmp, ignored for all)
+	FromPort *int32 `json:"fromPort,omitempty"`
+
+	// Protocol IP protocol
+	Protocol FirewallRuleProtocol `json:"protocol"`
+
+	// SourceGroupId Source security group ID. Mutually exclusive with cidr.
+	SourceGroupId *string `json:"sourceGroupId,omitempty"`
+
+	// ToPort Last port of the range (ICMP code for icmp). Defaults to fromPort.
+	ToPort *int32 `json:"toPort,omitempty"`
+}
+
+// FirewallRuleProtocol IP protocol
+type FirewallRuleProtocol string
+
 // Health defines model for Health.
 type Health struct {
 	// Status Health status
@@ -63,6 +534,9 @@ type Image struct {
 	// Name AMI name
 	Name *string `json:"name,omitempty"`
 
+	// Region AWS region the AMI is registered in
+	Region *string `json:"region,omitempty"`
+
 	// SnapshotId Source snapshot ID (from SnapshotID tag)
 	SnapshotId *string `json:"snapshotId,omitempty"`
 
@@ -82,12 +556,187 @@ type ImageState string
 // ImageVirtualizationType Virtualization type
 type ImageVirtualizationType string
 
+// ImageStateChanged defines model for ImageStateChanged.
+type ImageStateChanged struct {
+	// AmiId AMI ID
+	AmiId string `json:"amiId"`
+
+	// Name AMI name
+	Name *string `json:"name,omitempty"`
+
+	// PreviousState State before the change
+	PreviousState *string `json:"previousState,omitempty"`
+
+	// State New AMI state
+	State string `json:"state"`
+}
+
+// InventoryBuild defines model for InventoryBuild.
+type InventoryBuild struct {
+	// AmiId AMI registered by the build
+	AmiId *string `json:"amiId,omitempty"`
+
+	// CreatedBy Who started the build
+	CreatedBy *string `json:"createdBy,omitempty"`
+
+	// Error Failure reason of a failed build
+	Error *string `json:"error,omitempty"`
+
+	// FinishedAt When the build finished
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+
+	// Id Build identifier
+	Id string `json:"id"`
+
+	// ImageId Content hash of the built disk image
+	ImageId *string `json:"imageId,omitempty"`
+
+	// SnapshotId EBS snapshot imported by the build
+	SnapshotId *string `json:"snapshotId,omitempty"`
+
+	// SourceUrl URL of the base image
+	SourceUrl *string `json:"sourceUrl,omitempty"`
+
+	// Stage Current or last stage of the build
+	Stage *string `json:"stage,omitempty"`
+
+	// StartedAt When the build started
+	StartedAt time.Time       `json:"startedAt"`
+	Status    OperationStatus `json:"status"`
+}
+
+// InventoryImage defines model for InventoryImage.
+type InventoryImage struct {
+	// AmiId AMI ID
+	AmiId string `json:"amiId"`
+
+	// BuildId Build that registered the image
+	BuildId *string `json:"buildId,omitempty"`
+
+	// CreatedAt When the image was registered
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	// Drift How a recorded resource differs from what EC2 reports
+	Drift *Drift `json:"drift,omitempty"`
+
+	// DriftDetail Human-readable explanation of the drift
+	DriftDetail *string `json:"driftDetail,omitempty"`
+
+	// ImageId Content hash of the disk image
+	ImageId *string `json:"imageId,omitempty"`
+
+	// LastSeenAt When the image was last seen in EC2
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+
+	// Name AMI name
+	Name *string `json:"name,omitempty"`
+
+	// RemovedAt When the image was first found missing
+	RemovedAt *time.Time `json:"removedAt,omitempty"`
+
+	// SnapshotId Backing EBS snapshot
+	SnapshotId *string `json:"snapshotId,omitempty"`
+
+	// State Last observed AMI state
+	State *string `json:"state,omitempty"`
+}
+
+// InventoryNode defines model for InventoryNode.
+type InventoryNode struct {
+	// CreatedAt When the node was created
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	// CreatedBy Who created the node; empty for nodes created outside the API
+	CreatedBy *string `json:"createdBy,omitempty"`
+
+	// DeletedAt When the node was deleted through the API
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+
+	// DeletedBy Who deleted the node
+	DeletedBy *string `json:"deletedBy,omitempty"`
+
+	// Drift How a recorded resource differs from what EC2 reports
+	Drift *Drift `json:"drift,omitempty"`
+
+	// DriftDetail Human-readable explanation of the drift
+	DriftDetail *string `json:"driftDetail,omitempty"`
+
+	// Id Instance ID
+	Id string `json:"id"`
+
+	// LastSeenAt When the node was last seen in EC2
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+
+	// Name Node name
+	Name *string `json:"name,omitempty"`
+
+	// Params Parameters the node was created with
+	Params *map[string]string `json:"params,omitempty"`
+
+	// Pool Pool the node belongs to
+	Pool *string `json:"pool,omitempty"`
+
+	// State Last observed instance state
+	State *string `json:"state,omitempty"`
+
+	// StateReason Last observed reason for the state
+	StateReason *string `json:"stateReason,omitempty"`
+}
+
+// Key defines model for Key.
+type Key struct {
+	// CreatedAt Time the key was imported (ISO 8601)
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	// Fingerprint SHA256 fingerprint as printed by ssh-keygen -l
+	Fingerprint string `json:"fingerprint"`
+
+	// Id EC2 key pair ID
+	Id *string `json:"id,omitempty"`
+
+	// Name Key name
+	Name string `json:"name"`
+
+	// PublicKey Public key in authorized_keys format
+	PublicKey *string `json:"publicKey,omitempty"`
+
+	// Type Key algorithm
+	Type *KeyType `json:"type,omitempty"`
+}
+
+// KeyType Key algorithm
+type KeyType string
+
 // Node defines model for Node.
 type Node struct {
+	// AmiId AMI the instance was launched from
+	AmiId *string `json:"amiId,omitempty"`
+
+	// Architecture Instance architecture
+	Architecture *string `json:"architecture,omitempty"`
+
+	// AvailabilityZone Availability zone the instance runs in
+	AvailabilityZone *string `json:"availabilityZone,omitempty"`
+
+	// Id EC2 instance ID
+	Id string `json:"id"`
+
+	// ImageId Content-based image identifier of the AMI (from ImageID tag)
+	ImageId *string `json:"imageId,omitempty"`
+
 	// InstanceType EC2 instance type
 	InstanceType *string `json:"instanceType,omitempty"`
 
-	// Name Node name (EC2 instance ID)
+	// KeyName Name of the key pair the instance was launched with
+	KeyName *string `json:"keyName,omitempty"`
+
+	// LaunchTime Time the instance was launched (ISO 8601)
+	LaunchTime *time.Time `json:"launchTime,omitempty"`
+
+	// Lifecycle Purchasing option of the instance
+	Lifecycle *NodeLifecycle `json:"lifecycle,omitempty"`
+
+	// Name Node name (EC2 Name tag, falls back to the instance ID)
 	Name string `json:"name"`
 
 	// PrivateIp Private IP address
@@ -96,9 +745,556 @@ type Node struct {
 	// PublicIp Public IP address
 	PublicIp *string `json:"publicIp"`
 
+	// Region AWS region the node runs in
+	Region     *string         `json:"region,omitempty"`
+	RootVolume *NodeRootVolume `json:"rootVolume,omitempty"`
+
+	// SecurityGroups Security groups attached to the instance
+	SecurityGroups *[]NodeSecurityGroup `json:"securityGroups,omitempty"`
+
+	// Spot Status of the spot request behind a spot node
+	Spot *NodeSpotStatus `json:"spot,omitempty"`
+
 	// State Current node state
 	State *NodeState `json:"state,omitempty"`
+
+	// StateReason Reason for the most recent state transition
+	StateReason *string `json:"stateReason,omitempty"`
+
+	// SubnetId Subnet ID
+	SubnetId *string `json:"subnetId,omitempty"`
+
+	// Tags Instance tags
+	Tags *map[string]string `json:"tags,omitempty"`
+
+	// VpcId VPC ID
+	VpcId *string `json:"vpcId,omitempty"`
 }
 
+// NodeLifecycle Purchasing option of the instance
+type NodeLifecycle string
+
 // NodeState Current node state
 type NodeState string
+
+// NodeFirewall defines model for NodeFirewall.
+type NodeFirewall struct {
+	// GroupId Managed security group ID, absent until rules are first set
+	GroupId *string        `json:"groupId,omitempty"`
+	Rules   []FirewallRule `json:"rules"`
+}
+
+// NodePool defines model for NodePool.
+type NodePool struct {
+	// CreatedAt Time the pool was created (ISO 8601)
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	// DesiredCount Number of members the reconciler keeps running
+	DesiredCount int `json:"desiredCount"`
+
+	// ImageChannel AMI name prefix to launch from, or "latest" for the newest AMI
+	ImageChannel string `json:"imageChannel"`
+
+	// InstanceType EC2 instance type of the members
+	InstanceType string `json:"instanceType"`
+
+	// KeyName Name of a managed SSH key to launch members with
+	KeyName *string `json:"keyName,omitempty"`
+
+	// Name Pool name, also the prefix of member names
+	Name   string         `json:"name"`
+	Status NodePoolStatus `json:"status"`
+
+	// Tags Tags applied to every member
+	Tags *map[string]string `json:"tags,omitempty"`
+
+	// UpdatedAt Time the pool was last updated (ISO 8601)
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// NodePoolStatus defines model for NodePoolStatus.
+type NodePoolStatus struct {
+	// LastError Error of the last reconcile pass, if any
+	LastError *string `json:"lastError,omitempty"`
+
+	// LastReconciledAt Time of the last reconcile pass (ISO 8601)
+	LastReconciledAt *time.Time `json:"lastReconciledAt,omitempty"`
+
+	// Members Instance IDs of the healthy members
+	Members []string `json:"members"`
+
+	// Pending Members still starting
+	Pending int `json:"pending"`
+
+	// Running Members running
+	Running int `json:"running"`
+
+	// Unhealthy Stopped or impaired members replaced in the last pass
+	Unhealthy int `json:"unhealthy"`
+}
+
+// NodeRootVolume defines model for NodeRootVolume.
+type NodeRootVolume struct {
+	// DeviceName Root device name
+	DeviceName string `json:"deviceName"`
+
+	// VolumeId EBS volume ID
+	VolumeId *string `json:"volumeId,omitempty"`
+}
+
+// NodeSecurityGroup defines model for NodeSecurityGroup.
+type NodeSecurityGroup struct {
+	// Id Security group ID
+	Id string `json:"id"`
+
+	// Name Security group name
+	Name *string `json:"name,omitempty"`
+}
+
+// NodeSpotStatus Status of the spot request behind a spot node
+type NodeSpotStatus struct {
+	// InterruptionBehavior What EC2 does with the node when it reclaims the capacity
+	InterruptionBehavior *string `json:"interruptionBehavior,omitempty"`
+
+	// Interrupted Whether EC2 has reclaimed the node or is about to
+	Interrupted bool `json:"interrupted"`
+
+	// MaxPrice Maximum hourly price in USD
+	MaxPrice *string `json:"maxPrice,omitempty"`
+
+	// RequestId Spot instance request ID
+	RequestId string `json:"requestId"`
+
+	// State State of the spot request
+	State *string `json:"state,omitempty"`
+
+	// StatusCode Spot request status code
+	StatusCode *string `json:"statusCode,omitempty"`
+
+	// StatusMessage Spot request status message
+	StatusMessage *string `json:"statusMessage,omitempty"`
+}
+
+// NodeStateChanged defines model for NodeStateChanged.
+type NodeStateChanged struct {
+	// InstanceId Instance ID
+	InstanceId string `json:"instanceId"`
+
+	// Name Node name
+	Name *string `json:"name,omitempty"`
+
+	// Pool Pool the node belongs to
+	Pool *string `json:"pool,omitempty"`
+
+	// PreviousState State before the transition
+	PreviousState *string `json:"previousState,omitempty"`
+
+	// Reason EC2 state reason, or why the control plane changed the node
+	Reason *string `json:"reason,omitempty"`
+
+	// State New instance state
+	State string `json:"state"`
+}
+
+// NodeUserData defines model for NodeUserData.
+type NodeUserData struct {
+	// Template Name of the template to render. Without a template only the variables are rendered.
+	Template  *string            `json:"template,omitempty"`
+	Variables *UserDataVariables `json:"variables,omitempty"`
+}
+
+// Operation defines model for Operation.
+type Operation struct {
+	// Actor Who requested the operation
+	Actor *string `json:"actor,omitempty"`
+
+	// Error Failure reason of a failed operation
+	Error *string `json:"error,omitempty"`
+
+	// FinishedAt When the operation finished
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+
+	// Id Operation identifier
+	Id string `json:"id"`
+
+	// Params Operation parameters
+	Params *map[string]string `json:"params,omitempty"`
+
+	// StartedAt When the operation started
+	StartedAt time.Time       `json:"startedAt"`
+	Status    OperationStatus `json:"status"`
+
+	// Target Instance ID or resource name the operation acted on
+	Target *string `json:"target,omitempty"`
+
+	// Type Operation type, e.g. create-node
+	Type string `json:"type"`
+}
+
+// OperationStatus defines model for OperationStatus.
+type OperationStatus string
+
+// Problem RFC 7807 problem details of an error response
+type Problem struct {
+	// Code Stable error code clients can act on
+	Code ProblemCode `json:"code"`
+
+	// Detail Human-readable explanation of this occurrence of the problem
+	Detail *string `json:"detail,omitempty"`
+
+	// Status HTTP status code
+	Status int `json:"status"`
+
+	// Title Reason phrase of the status code
+	Title string `json:"title"`
+
+	// Type Problem type URI, about:blank as the code identifies the problem
+	Type string `json:"type"`
+}
+
+// ProblemCode Stable error code clients can act on
+type ProblemCode string
+
+// RenderedUserData defines model for RenderedUserData.
+type RenderedUserData struct {
+	// Content Rendered user data, before base64 encoding
+	Content string `json:"content"`
+
+	// ContentType text/cloud-config or multipart/mixed
+	ContentType string `json:"contentType"`
+
+	// Size Size in bytes; EC2 accepts at most 16384
+	Size int `json:"size"`
+}
+
+// ScaleNodePoolRequest defines model for ScaleNodePoolRequest.
+type ScaleNodePoolRequest struct {
+	// DesiredCount New number of members
+	DesiredCount int `json:"desiredCount"`
+}
+
+// SpotInterrupted defines model for SpotInterrupted.
+type SpotInterrupted struct {
+	// InstanceId Instance ID of the interrupted spot node
+	InstanceId string `json:"instanceId"`
+
+	// Message Spot request status message
+	Message *string `json:"message,omitempty"`
+
+	// Name Node name
+	Name *string `json:"name,omitempty"`
+
+	// ReplacementId Instance ID of the node launched in its place
+	ReplacementId *string `json:"replacementId,omitempty"`
+
+	// StatusCode Spot request status code, e.g. instance-terminated-no-capacity
+	StatusCode string `json:"statusCode"`
+}
+
+// SpotOptions Spot options; only allowed with lifecycle spot
+type SpotOptions struct {
+	// InterruptionBehavior What EC2 does with the node when it reclaims the capacity
+	InterruptionBehavior *SpotOptionsInterruptionBehavior `json:"interruptionBehavior,omitempty"`
+
+	// MaxPrice Maximum hourly price in USD. Defaults to the on-demand price.
+	MaxPrice *string `json:"maxPrice,omitempty"`
+
+	// ReplaceOnInterruption Launch a replacement spot node when this one is terminated by an interruption
+	ReplaceOnInterruption *bool `json:"replaceOnInterruption,omitempty"`
+}
+
+// SpotOptionsInterruptionBehavior What EC2 does with the node when it reclaims the capacity
+type SpotOptionsInterruptionBehavior string
+
+// StopNodeRequest defines model for StopNodeRequest.
+type StopNodeRequest struct {
+	// Hibernate Hibernate the node instead of stopping it; the node must have been created with hibernation enabled
+	Hibernate *bool `json:"hibernate,omitempty"`
+}
+
+// Template defines model for Template.
+type Template struct {
+	Config CloudConfig `json:"config"`
+
+	// CreatedAt Time the template was created (ISO 8601)
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	// Description Template description
+	Description *string `json:"description,omitempty"`
+
+	// Name Template name
+	Name string `json:"name"`
+
+	// Parts Additional MIME parts, e.g. shell scripts. With parts, user data is rendered as multipart MIME.
+	Parts *[]CloudInitPart `json:"parts,omitempty"`
+
+	// UpdatedAt Time the template was last updated (ISO 8601)
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// UpdateNodeFirewallRequest defines model for UpdateNodeFirewallRequest.
+type UpdateNodeFirewallRequest struct {
+	Rules []FirewallRule `json:"rules"`
+}
+
+// UpdateTemplateRequest defines model for UpdateTemplateRequest.
+type UpdateTemplateRequest struct {
+	Config CloudConfig `json:"config"`
+
+	// Description Template description
+	Description *string `json:"description,omitempty"`
+
+	// Parts Additional MIME parts, e.g. shell scripts. With parts, user data is rendered as multipart MIME.
+	Parts *[]CloudInitPart `json:"parts,omitempty"`
+}
+
+// UserDataVariables defines model for UserDataVariables.
+type UserDataVariables struct {
+	// Files Files appended to the template's files
+	Files *[]CloudInitFile `json:"files,omitempty"`
+
+	// Hostname Hostname of the node. Defaults to the node name on creation.
+	Hostname *string `json:"hostname,omitempty"`
+
+	// Packages Packages appended to the template's packages
+	Packages *[]string `json:"packages,omitempty"`
+
+	// Runcmd Commands appended to the template's runcmd
+	Runcmd *[]string `json:"runcmd,omitempty"`
+
+	// SshAuthorizedKeys Raw public keys to authorize for the default user
+	SshAuthorizedKeys *[]string `json:"sshAuthorizedKeys,omitempty"`
+
+	// SshKeyNames Names of managed SSH keys to authorize for the default user
+	SshKeyNames *[]string `json:"sshKeyNames,omitempty"`
+
+	// Users Users appended to the template's users
+	Users *[]CloudInitUser `json:"users,omitempty"`
+
+	// Vars Values available to the template as {{.Vars.name}}
+	Vars *map[string]string `json:"vars,omitempty"`
+}
+
+// Volume defines model for Volume.
+type Volume struct {
+	Attachments []VolumeAttachment `json:"attachments"`
+
+	// AvailabilityZone Availability zone of the volume
+	AvailabilityZone string `json:"availabilityZone"`
+
+	// CreatedAt Time the volume was created (ISO 8601)
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	// Encrypted Whether the volume is encrypted
+	Encrypted bool `json:"encrypted"`
+
+	// Id EBS volume ID
+	Id string `json:"id"`
+
+	// Iops Provisioned IOPS
+	Iops *int `json:"iops,omitempty"`
+
+	// KmsKeyId KMS key used for encryption
+	KmsKeyId *string `json:"kmsKeyId,omitempty"`
+
+	// Name Volume name (EC2 Name tag)
+	Name *string `json:"name,omitempty"`
+
+	// SizeGiB Size in GiB
+	SizeGiB int `json:"sizeGiB"`
+
+	// State Volume state
+	State string `json:"state"`
+
+	// Throughput Provisioned throughput in MiB/s
+	Throughput *int `json:"throughput,omitempty"`
+
+	// Type EBS volume type
+	Type string `json:"type"`
+}
+
+// VolumeAttachment defines model for VolumeAttachment.
+type VolumeAttachment struct {
+	// AttachedAt Time the volume was attached (ISO 8601)
+	AttachedAt *time.Time `json:"attachedAt,omitempty"`
+
+	// DeleteOnTermination Whether the volume is deleted together with the node
+	DeleteOnTermination bool `json:"deleteOnTermination"`
+
+	// Device Device name on the node
+	Device string `json:"device"`
+
+	// NodeId Instance ID of the node
+	NodeId string `json:"nodeId"`
+
+	// State Attachment state
+	State string `json:"state"`
+}
+
+// BatchCreateNodesParams defines parameters for BatchCreateNodes.
+type BatchCreateNodesParams struct {
+	// IdempotencyKey Makes the request safe to retry; a retry with the same key gets the original response and never launches the nodes twice
+	IdempotencyKey *string `json:"Idempotency-Key,omitempty"`
+}
+
+// CreateNodeParams defines parameters for CreateNode.
+type CreateNodeParams struct {
+	// Wait Wait until the node is running before responding
+	Wait *bool `form:"wait,omitempty" json:"wait,omitempty"`
+
+	// StatusChecks With wait=true, also wait until the EC2 instance and system status checks pass
+	StatusChecks *bool `form:"statusChecks,omitempty" json:"statusChecks,omitempty"`
+
+	// IdempotencyKey Makes the request safe to retry; a retry with the same key gets the original response and never launches a second instance
+	IdempotencyKey *string `json:"Idempotency-Key,omitempty"`
+}
+
+// DeleteNodeParams defines parameters for DeleteNode.
+type DeleteNodeParams struct {
+	// Wait Wait until the node is terminated before responding
+	Wait *bool `form:"wait,omitempty" json:"wait,omitempty"`
+
+	// Region Region of the node; looked up when omitted
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+}
+
+// ForceStopNodeParams defines parameters for ForceStopNode.
+type ForceStopNodeParams struct {
+	// Wait Wait until the node has settled in its target state before responding
+	Wait *bool `form:"wait,omitempty" json:"wait,omitempty"`
+
+	// Region Region of the node; looked up when omitted
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+}
+
+// GetNodeConsoleParams defines parameters for GetNodeConsole.
+type GetNodeConsoleParams struct {
+	// Latest Fetch the most recent output instead of the buffered one; only supported by Nitro instances on EC2
+	Latest *bool `form:"latest,omitempty" json:"latest,omitempty"`
+
+	// Region Region of the node; looked up when omitted
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+}
+
+// GetNodeParams defines parameters for GetNode.
+type GetNodeParams struct {
+	// Region Region of the node; looked up when omitted
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+}
+
+// GetNodeScreenshotParams defines parameters for GetNodeScreenshot.
+type GetNodeScreenshotParams struct {
+	// Region Region of the node; looked up when omitted
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+}
+
+// ListImagesParams defines parameters for ListImages.
+type ListImagesParams struct {
+	// Region Only return images of this region
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+
+	// CacheControl Send no-cache to bypass the cache and reload from EC2
+	CacheControl *string `json:"Cache-Control,omitempty"`
+}
+
+// ListNodesParams defines parameters for ListNodes.
+type ListNodesParams struct {
+	// Region Only return nodes of this region
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+
+	// CacheControl Send no-cache to bypass the cache and reload from EC2
+	CacheControl *string `json:"Cache-Control,omitempty"`
+}
+
+// ListOperationsParams defines parameters for ListOperations.
+type ListOperationsParams struct {
+	// Target Only return operations for this target
+	Target *string `form:"target,omitempty" json:"target,omitempty"`
+}
+
+// RebootNodeParams defines parameters for RebootNode.
+type RebootNodeParams struct {
+	// Wait Not supported; a rebooting node stays running, so there is no state to wait for and wait=true is rejected
+	Wait *bool `form:"wait,omitempty" json:"wait,omitempty"`
+
+	// Region Region of the node; looked up when omitted
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+}
+
+// StartNodeParams defines parameters for StartNode.
+type StartNodeParams struct {
+	// Wait Wait until the node has settled in its target state before responding
+	Wait *bool `form:"wait,omitempty" json:"wait,omitempty"`
+
+	// Region Region of the node; looked up when omitted
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+}
+
+// StopNodeParams defines parameters for StopNode.
+type StopNodeParams struct {
+	// Wait Wait until the node has settled in its target state before responding
+	Wait *bool `form:"wait,omitempty" json:"wait,omitempty"`
+
+	// Region Region of the node; looked up when omitted
+	Region *string `form:"region,omitempty" json:"region,omitempty"`
+}
+
+// StreamEventsParams defines parameters for StreamEvents.
+type StreamEventsParams struct {
+	// Types Comma-separated event types to receive; all types when omitted
+	Types *string `form:"types,omitempty" json:"types,omitempty"`
+
+	// LastEventId Resume after this event ID, for clients that cannot set headers
+	LastEventId *string `form:"lastEventId,omitempty" json:"lastEventId,omitempty"`
+
+	// LastEventID Resume after this event ID; sent by EventSource on reconnect
+	LastEventID *string `json:"Last-Event-ID,omitempty"`
+}
+
+// AllocateAddressJSONRequestBody defines body for AllocateAddress for application/json ContentType.
+type AllocateAddressJSONRequestBody = AllocateAddressRequest
+
+// AssociateAddressJSONRequestBody defines body for AssociateAddress for application/json ContentType.
+type AssociateAddressJSONRequestBody = AssociateAddressRequest
+
+// AttachVolumeJSONRequestBody defines body for AttachVolume for application/json ContentType.
+type AttachVolumeJSONRequestBody = AttachVolumeRequest
+
+// BatchCreateNodesJSONRequestBody defines body for BatchCreateNodes for application/json ContentType.
+type BatchCreateNodesJSONRequestBody = BatchCreateNodesRequest
+
+// BatchDeleteNodesJSONRequestBody defines body for BatchDeleteNodes for application/json ContentType.
+type BatchDeleteNodesJSONRequestBody = BatchDeleteNodesRequest
+
+// CreateKeyJSONRequestBody defines body for CreateKey for application/json ContentType.
+type CreateKeyJSONRequestBody = CreateKeyRequest
+
+// CreateNodeJSONRequestBody defines body for CreateNode for application/json ContentType.
+type CreateNodeJSONRequestBody = CreateNodeRequest
+
+// CreatePoolJSONRequestBody defines body for CreatePool for application/json ContentType.
+type CreatePoolJSONRequestBody = CreateNodePoolRequest
+
+// CreateTemplateJSONRequestBody defines body for CreateTemplate for application/json ContentType.
+type CreateTemplateJSONRequestBody = CreateTemplateRequest
+
+// CreateVolumeJSONRequestBody defines body for CreateVolume for application/json ContentType.
+type CreateVolumeJSONRequestBody = CreateVolumeRequest
+
+// DetachVolumeJSONRequestBody defines body for DetachVolume for application/json ContentType.
+type DetachVolumeJSONRequestBody = DetachVolumeRequest
+
+// RenderTemplateJSONRequestBody defines body for RenderTemplate for application/json ContentType.
+type RenderTemplateJSONRequestBody = UserDataVariables
+
+// ScalePoolJSONRequestBody defines body for ScalePool for application/json ContentType.
+type ScalePoolJSONRequestBody = ScaleNodePoolRequest
+
+// StopNodeJSONRequestBody defines body for StopNode for application/json ContentType.
+type StopNodeJSONRequestBody = StopNodeRequest
+
+// UpdateNodeFirewallJSONRequestBody defines body for UpdateNodeFirewall for application/json ContentType.
+type UpdateNodeFirewallJSONRequestBody = UpdateNodeFirewallRequest
+
+// UpdateTemplateJSONRequestBody defines body for UpdateTemplate for application/json ContentType.
+type UpdateTemplateJSONRequestBody = UpdateTemplateRequest
@@ -0,0 +1,189 @@
+// Package awsconfig builds the aws.Config shared by every AWS service client,
+// so region, profile, role and endpoint are configured in one place.
+package awsconfig
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const DefaultRegion = "eu-central-1"
+
+// Environment variables read by FromEnv. AWS_REGION, AWS_PROFILE and
+// AWS_ENDPOINT_URL are the ones the AWS CLI and SDKs use.
+const (
+	EnvRegion        = "AWS_REGION"
+	EnvProfile       = "AWS_PROFILE"
+	EnvEndpoint      = "AWS_ENDPOINT_URL"
+	EnvAssumeRoleARN = "TILMAN_ASSUME_ROLE_ARN"
+	EnvRegions       = "TILMAN_REGIONS"
+	EnvS3PathStyle   = "TILMAN_S3_PATH_STYLE"
+)
+
+type Config struct {
+	// Region defaults to DefaultRegion
+	Region string
+	// Profile selects a profile from the shared config and credentials
+	// files; the SDK default chain is used when empty
+	Profile string
+	// AssumeRoleARN is assumed with the loaded credentials, e.g. to manage
+	// another account
+	AssumeRoleARN string
+	// Endpoint overrides the endpoint of every service client, e.g. for a
+	// local emulator
+	Endpoint string
+	// S3PathStyle addresses buckets in the path instead of the host name,
+	// which emulators such as LocalStack and moto expect
+	S3PathStyle bool
+	// AccessKeyID and SecretAccessKey replace the default credential chain
+	// with static credentials when both are set
+	AccessKeyID     string
+	SecretAccessKey string
+	// Regions are the regions served besides Region
+	Regions []string
+}
+
+// FromEnv reads the configuration from the environment. TILMAN_REGIONS is a
+// comma-separated list of additional regions. S3 uses path-style addressing
+// whenever an endpoint is set, unless TILMAN_S3_PATH_STYLE says otherwise.
+func FromEnv() Config {
+	c := Config{
+		Region:        os.Getenv(EnvRegion),
+		Profile:       os.Getenv(EnvProfile),
+		AssumeRoleARN: os.Getenv(EnvAssumeRoleARN),
+		Endpoint:      os.Getenv(EnvEndpoint),
+		Regions:       ParseRegions(os.Getenv(EnvRegions)),
+	}
+	c.S3PathStyle = c.Endpoint != ""
+	if pathStyle, err := strconv.ParseBool(os.Getenv(EnvS3PathStyle)); err == nil {
+		c.S3PathStyle = pathStyle
+	}
+	return c
+}
+
+// RegisterFlags registers -endpoint-url and -s3-path-style, which override
+// the corresponding fields of c. Setting -endpoint-url turns on path-style
+// addressing unless -s3-path-style is given as well.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.Func("endpoint-url", "endpoint of every AWS service client, e.g. a local emulator (env "+EnvEndpoint+")", func(value string) error {
+		c.Endpoint = value
+		if !flagSet(fs, "s3-path-style") {
+			c.S3PathStyle = value != ""
+		}
+		return nil
+	})
+	fs.BoolVar(&c.S3PathStyle, "s3-path-style", c.S3PathStyle, "address S3 buckets in the path (env "+EnvS3PathStyle+")")
+}
+
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// ParseRegions splits a comma-separated region list, dropping blanks.
+func ParseRegions(value string) []string {
+	var regions []string
+	for _, region := range strings.Split(value, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// AllRegions returns Region followed by the other served regions, without
+// duplicates.
+func (c Config) AllRegions() []string {
+	regions := []string{c.region()}
+	for _, region := range c.Regions {
+		duplicate := false
+		for _, seen := range regions {
+			duplicate = duplicate || seen == region
+		}
+		if !duplicate {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// ForRegion returns a copy of the configuration for another region.
+func (c Config) ForRegion(region string) Config {
+	c.Region = region
+	return c
+}
+
+// Load builds the aws.Config for Region. Service clients built from it share
+// credentials, retries and the endpoint override.
+func Load(ctx context.Context, c Config) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(c.region()),
+	}
+	if c.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(c.Profile))
+	}
+	if c.Endpoint != "" {
+		opts = append(opts, config.WithBaseEndpoint(c.Endpoint))
+	}
+	if c.AccessKeyID != "" && c.SecretAccessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, "")))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	if c.AssumeRoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), c.AssumeRoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "tilmancloud"
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
+
+// S3Options returns the options S3 clients need on top of the aws.Config
+// built by Load, which has no room for path-style addressing.
+func (c Config) S3Options() []func(*s3.Options) {
+	if !c.S3PathStyle {
+		return nil
+	}
+	return []func(*s3.Options){func(o *s3.Options) {
+		o.UsePathStyle = true
+	}}
+}
+
+// LoadAll builds one aws.Config per served region, keyed by region.
+func LoadAll(ctx context.Context, c Config) (map[string]aws.Config, error) {
+	configs := make(map[string]aws.Config)
+	for _, region := range c.AllRegions() {
+		cfg, err := Load(ctx, c.ForRegion(region))
+		if err != nil {
+			return nil, fmt.Errorf("region %s: %w", region, err)
+		}
+		configs[region] = cfg
+	}
+	return configs, nil
+}
+
+func (c Config) region() string {
+	if c.Region == "" {
+		return DefaultRegion
+	}
+	return c.Region
+}
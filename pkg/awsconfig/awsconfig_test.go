@@ -0,0 +1,130 @@
+package awsconfig
+
+import (
+	"context"
+	"flag"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestParseRegions(t *testing.T) {
+	regions := ParseRegions(" us-east-1, ,eu-west-1,")
+	if !slices.Equal(regions, []string{"us-east-1", "eu-west-1"}) {
+		t.Errorf("unexpected regions %v", regions)
+	}
+	if regions := ParseRegions(""); len(regions) != 0 {
+		t.Errorf("expected no regions, got %v", regions)
+	}
+}
+
+func TestConfig_AllRegions(t *testing.T) {
+	regions := Config{Regions: []string{"us-east-1", DefaultRegion, "us-east-1"}}.AllRegions()
+	if !slices.Equal(regions, []string{DefaultRegion, "us-east-1"}) {
+		t.Errorf("expected the default region first without duplicates, got %v", regions)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+
+	cfg, err := Load(context.Background(), Config{Region: "us-east-1", Endpoint: "http://localhost:4566"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.Region != "us-east-1" {
+		t.Errorf("expected region us-east-1, got %s", cfg.Region)
+	}
+	if aws.ToString(cfg.BaseEndpoint) != "http://localhost:4566" {
+		t.Errorf("expected the custom endpoint, got %v", cfg.BaseEndpoint)
+	}
+
+	cfg, err = Load(context.Background(), Config{AssumeRoleARN: "arn:aws:iam::123456789012:role/tilman"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.Region != DefaultRegion {
+		t.Errorf("expected default region, got %s", cfg.Region)
+	}
+	if _, ok := cfg.Credentials.(*aws.CredentialsCache); !ok {
+		t.Errorf("expected cached assume-role credentials, got %T", cfg.Credentials)
+	}
+}
+
+func TestFromEnv_PathStyle(t *testing.T) {
+	t.Setenv(EnvEndpoint, "http://localhost:4566")
+	if c := FromEnv(); !c.S3PathStyle {
+		t.Errorf("expected path-style addressing with a custom endpoint")
+	}
+	t.Setenv(EnvS3PathStyle, "false")
+	if c := FromEnv(); c.S3PathStyle {
+		t.Errorf("expected %s to turn path-style addressing off", EnvS3PathStyle)
+	}
+}
+
+func TestConfig_RegisterFlags(t *testing.T) {
+	var c Config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-endpoint-url", "http://localhost:5000"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if c.Endpoint != "http://localhost:5000" || !c.S3PathStyle {
+		t.Errorf("expected the endpoint with path-style addressing, got %+v", c)
+	}
+
+	c = Config{}
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	c.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-s3-path-style=false", "-endpoint-url", "http://localhost:5000"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if c.S3PathStyle {
+		t.Errorf("expected -s3-path-style to win over the endpoint default")
+	}
+}
+
+func TestLoad_StaticCredentials(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+
+	cfg, err := Load(context.Background(), Config{AccessKeyID: "test", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if creds.AccessKeyID != "test" || creds.SecretAccessKey != "secret" {
+		t.Errorf("expected the static credentials, got %s", creds.AccessKeyID)
+	}
+}
+
+func TestConfig_S3Options(t *testing.T) {
+	if opts := (Config{}).S3Options(); len(opts) != 0 {
+		t.Errorf("expected no options, got %d", len(opts))
+	}
+	var o s3.Options
+	for _, opt := range (Config{S3PathStyle: true}).S3Options() {
+		opt(&o)
+	}
+	if !o.UsePathStyle {
+		t.Errorf("expected path-style addressing")
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+
+	configs, err := LoadAll(context.Background(), Config{Region: "us-east-1", Regions: []string{"eu-west-1"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(configs) != 2 || configs["us-east-1"].Region != "us-east-1" || configs["eu-west-1"].Region != "eu-west-1" {
+		t.Errorf("expected one config per region, got %v", configs)
+	}
+}
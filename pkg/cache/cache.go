@@ -0,0 +1,128 @@
+// Package cache provides a single-value read-through cache used in front of
+// EC2 list calls, which are rate limited per account.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTTL = 5 * time.Second
+	// DefaultMinRefreshInterval bounds how often forced refreshes reach the
+	// backend; a forced refresh within it is served from the cache
+	DefaultMinRefreshInterval = time.Second
+)
+
+type LoadFunc[T any] func(ctx context.Context) (T, error)
+
+// Entry is a cached value and when it was loaded.
+type Entry[T any] struct {
+	Value     T
+	FetchedAt time.Time
+}
+
+// Age returns how old the entry is at now.
+func (e Entry[T]) Age(now time.Time) time.Duration {
+	return now.Sub(e.FetchedAt)
+}
+
+type GetOptions struct {
+	// Refresh bypasses a fresh cached value, e.g. for Cache-Control: no-cache
+	Refresh bool
+}
+
+// Cache holds the result of a load for TTL. Concurrent misses share a single
+// load, and Invalidate drops the value as well as any load already in flight,
+// so callers never see data that predates their own mutation.
+type Cache[T any] struct {
+	TTL                time.Duration
+	MinRefreshInterval time.Duration
+
+	load LoadFunc[T]
+	now  func() time.Time
+
+	mu         sync.Mutex
+	entry      Entry[T]
+	valid      bool
+	generation uint64
+	inflight   *call[T]
+}
+
+type call[T any] struct {
+	done       chan struct{}
+	generation uint64
+	entry      Entry[T]
+	err        error
+}
+
+func New[T any](load LoadFunc[T]) *Cache[T] {
+	return &Cache[T]{
+		TTL:                DefaultTTL,
+		MinRefreshInterval: DefaultMinRefreshInterval,
+		load:               load,
+		now:                time.Now,
+	}
+}
+
+// Get returns the cached value if it is fresh and loads it otherwise.
+func (c *Cache[T]) Get(ctx context.Context, opts GetOptions) (Entry[T], error) {
+	c.mu.Lock()
+	if c.valid {
+		age := c.entry.Age(c.now())
+		if age < c.TTL && (!opts.Refresh || age < c.MinRefreshInterval) {
+			entry := c.entry
+			c.mu.Unlock()
+			return entry, nil
+		}
+	}
+
+	inflight := c.inflight
+	if inflight == nil || inflight.generation != c.generation {
+		inflight = &call[T]{done: make(chan struct{}), generation: c.generation}
+		c.inflight = inflight
+		// The load outlives the caller that started it, since other callers
+		// may be waiting for it
+		go c.run(context.WithoutCancel(ctx), inflight)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return Entry[T]{}, ctx.Err()
+	case <-inflight.done:
+		return inflight.entry, inflight.err
+	}
+}
+
+// Invalidate drops the cached value. A nil cache is a no-op, so handlers can
+// invalidate optional caches unconditionally.
+func (c *Cache[T]) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+	c.generation++
+}
+
+func (c *Cache[T]) run(ctx context.Context, inflight *call[T]) {
+	value, err := c.load(ctx)
+	entry := Entry[T]{Value: value, FetchedAt: c.now()}
+
+	c.mu.Lock()
+	if err == nil && inflight.generation == c.generation {
+		c.entry = entry
+		c.valid = true
+	}
+	if c.inflight == inflight {
+		c.inflight = nil
+	}
+	c.mu.Unlock()
+
+	inflight.entry = entry
+	inflight.err = err
+	close(inflight.done)
+}
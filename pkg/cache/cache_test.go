@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestCache(load LoadFunc[int]) (*Cache[int], *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := New(load)
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestCache_Get_TTL(t *testing.T) {
+	var loads atomic.Int32
+	c, clock := newTestCache(func(ctx context.Context) (int, error) {
+		return int(loads.Add(1)), nil
+	})
+	ctx := context.Background()
+
+	entry, err := c.Get(ctx, GetOptions{})
+	if err != nil || entry.Value != 1 {
+		t.Fatalf("expected first load, got %v, %v", entry.Value, err)
+	}
+
+	clock.Advance(DefaultTTL / 2)
+	entry, _ = c.Get(ctx, GetOptions{})
+	if entry.Value != 1 || entry.Age(clock.Now()) != DefaultTTL/2 {
+		t.Errorf("expected cached value with age %v, got %v aged %v", DefaultTTL/2, entry.Value, entry.Age(clock.Now()))
+	}
+
+	clock.Advance(DefaultTTL)
+	entry, _ = c.Get(ctx, GetOptions{})
+	if entry.Value != 2 {
+		t.Errorf("expected reload after TTL, got %v", entry.Value)
+	}
+}
+
+func TestCache_Get_Refresh(t *testing.T) {
+	var loads atomic.Int32
+	c, clock := newTestCache(func(ctx context.Context) (int, error) {
+		return int(loads.Add(1)), nil
+	})
+	ctx := context.Background()
+
+	c.Get(ctx, GetOptions{})
+
+	// Forced refreshes are rate limited
+	entry, _ := c.Get(ctx, GetOptions{Refresh: true})
+	if entry.Value != 1 {
+		t.Errorf("expected refresh within MinRefreshInterval to be served from cache, got %v", entry.Value)
+	}
+
+	clock.Advance(DefaultMinRefreshInterval)
+	entry, _ = c.Get(ctx, GetOptions{Refresh: true})
+	if entry.Value != 2 {
+		t.Errorf("expected forced reload, got %v", entry.Value)
+	}
+}
+
+func TestCache_Get_Coalesces(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	c, _ := newTestCache(func(ctx context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, _ := c.Get(context.Background(), GetOptions{})
+			results[i] = entry.Value
+		}()
+	}
+
+	// Wait until the first load has started before releasing it
+	for loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads.Load() != 1 {
+		t.Errorf("expected a single load, got %d", loads.Load())
+	}
+	for _, result := range results {
+		if result != 42 {
+			t.Errorf("expected every caller to get 42, got %v", results)
+			break
+		}
+	}
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	var loads atomic.Int32
+	c, _ := newTestCache(func(ctx context.Context) (int, error) {
+		return int(loads.Add(1)), nil
+	})
+	ctx := context.Background()
+
+	c.Get(ctx, GetOptions{})
+	c.Invalidate()
+	entry, _ := c.Get(ctx, GetOptions{})
+	if entry.Value != 2 {
+		t.Errorf("expected reload after Invalidate, got %v", entry.Value)
+	}
+
+	var nilCache *Cache[int]
+	nilCache.Invalidate()
+}
+
+func TestCache_Invalidate_DuringLoad(t *testing.T) {
+	var loads atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c, _ := newTestCache(func(ctx context.Context) (int, error) {
+		n := int(loads.Add(1))
+		if n == 1 {
+			close(started)
+			<-release
+		}
+		return n, nil
+	})
+	ctx := context.Background()
+
+	done := make(chan int)
+	go func() {
+		entry, _ := c.Get(ctx, GetOptions{})
+		done <- entry.Value
+	}()
+	<-started
+
+	// A mutation while the first load is running must not be masked by it
+	c.Invalidate()
+	entry, _ := c.Get(ctx, GetOptions{})
+	if entry.Value != 2 {
+		t.Errorf("expected a new load after Invalidate, got %v", entry.Value)
+	}
+
+	close(release)
+	if stale := <-done; stale != 1 {
+		t.Errorf("expected the first caller to get its own load, got %v", stale)
+	}
+	entry, _ = c.Get(ctx, GetOptions{})
+	if entry.Value != 2 {
+		t.Errorf("expected the stale load not to be cached, got %v", entry.Value)
+	}
+}
+
+func TestCache_Get_Error(t *testing.T) {
+	var loads atomic.Int32
+	c, _ := newTestCache(func(ctx context.Context) (int, error) {
+		if loads.Add(1) == 1 {
+			return 0, errors.New("throttled")
+		}
+		return 7, nil
+	})
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, GetOptions{}); err == nil {
+		t.Fatal("expected error")
+	}
+	entry, err := c.Get(ctx, GetOptions{})
+	if err != nil || entry.Value != 7 {
+		t.Errorf("expected errors not to be cached, got %v, %v", entry.Value, err)
+	}
+}
+
+func TestCache_Get_ContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c, _ := newTestCache(func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, GetOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Recorder records every call of the clients it is registered with:
+//
+//	cfg.APIOptions = append(cfg.APIOptions, recorder.Register)
+type Recorder struct {
+	// Sanitize masks secrets in every recorded string, Sanitize when nil
+	Sanitize func(string) string
+
+	mu       sync.Mutex
+	cassette Cassette
+	err      error
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{Sanitize: Sanitize}
+}
+
+// Register adds the recording middleware to a client's stack. It runs
+// after the service metadata is known and outside the retry loop, so every
+// operation is recorded once with its final outcome.
+func (r *Recorder) Register(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CassetteRecorder", r.handleInitialize), middleware.After)
+}
+
+func (r *Recorder) handleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	r.record(awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx), in.Parameters, out.Result, err)
+	return out, metadata, err
+}
+
+func (r *Recorder) record(service, operation string, params, result any, callErr error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sanitize := r.Sanitize
+	if sanitize == nil {
+		sanitize = Sanitize
+	}
+	interaction := Interaction{Service: service, Operation: operation}
+	request, err := normalize(params, sanitize)
+	if err != nil {
+		r.err = errors.Join(r.err, fmt.Errorf("encode %s request: %w", operation, err))
+		return
+	}
+	interaction.Request = request
+
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(callErr, &apiErr):
+		interaction.Error = &APIError{Code: apiErr.ErrorCode(), Message: sanitize(apiErr.ErrorMessage())}
+	case callErr != nil:
+		// Network and context errors say nothing about the API
+		return
+	default:
+		response, err := normalize(result, sanitize)
+		if err != nil {
+			r.err = errors.Join(r.err, fmt.Errorf("encode %s response: %w", operation, err))
+			return
+		}
+		interaction.Response = response
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+}
+
+// Cassette returns a copy of what has been recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Save writes the recording to path, reporting calls that could not be
+// encoded.
+func (r *Recorder) Save(path string) error {
+	r.mu.Lock()
+	err := r.err
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.Cassette().Save(path)
+}
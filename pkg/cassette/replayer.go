@@ -0,0 +1,333 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/awsconfig"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/smithy-go"
+)
+
+// EnvRecord switches EC2 from replaying cassettes to recording them against
+// the AWS account configured through awsconfig.
+const EnvRecord = "TILMAN_RECORD_CASSETTES"
+
+var ErrUnexpectedRequest = errors.New("unexpected request")
+
+// EC2API is every EC2 operation the node and image code calls. It is
+// satisfied by *ec2.Client and by Replayer, and satisfies ec2.EC2Client,
+// image.ImporterClient and image.AMIRegistrarClient.
+type EC2API interface {
+	RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error)
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error)
+	DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+	StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error)
+	StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error)
+	RebootInstances(ctx context.Context, params *ec2.RebootInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RebootInstancesOutput, error)
+	ImportKeyPair(ctx context.Context, params *ec2.ImportKeyPairInput, optFns ...func(*ec2.Options)) (*ec2.ImportKeyPairOutput, error)
+	DescribeKeyPairs(ctx context.Context, params *ec2.DescribeKeyPairsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error)
+	DeleteKeyPair(ctx context.Context, params *ec2.DeleteKeyPairInput, optFns ...func(*ec2.Options)) (*ec2.DeleteKeyPairOutput, error)
+	CreateSecurityGroup(ctx context.Context, params *ec2.CreateSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error)
+	DeleteSecurityGroup(ctx context.Context, params *ec2.DeleteSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error)
+	DescribeSecurityGroups(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error)
+	AuthorizeSecurityGroupIngress(ctx context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error)
+	RevokeSecurityGroupIngress(ctx context.Context, params *ec2.RevokeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupIngressOutput, error)
+	ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error)
+	DescribeInstanceStatus(ctx context.Context, params *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error)
+	DescribeSpotInstanceRequests(ctx context.Context, params *ec2.DescribeSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotInstanceRequestsOutput, error)
+	CancelSpotInstanceRequests(ctx context.Context, params *ec2.CancelSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error)
+	DescribeInstanceAttribute(ctx context.Context, params *ec2.DescribeInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceAttributeOutput, error)
+	CreateVolume(ctx context.Context, params *ec2.CreateVolumeInput, optFns ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error)
+	DescribeVolumes(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error)
+	DeleteVolume(ctx context.Context, params *ec2.DeleteVolumeInput, optFns ...func(*ec2.Options)) (*ec2.DeleteVolumeOutput, error)
+	AttachVolume(ctx context.Context, params *ec2.AttachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error)
+	DetachVolume(ctx context.Context, params *ec2.DetachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.DetachVolumeOutput, error)
+	AllocateAddress(ctx context.Context, params *ec2.AllocateAddressInput, optFns ...func(*ec2.Options)) (*ec2.AllocateAddressOutput, error)
+	AssociateAddress(ctx context.Context, params *ec2.AssociateAddressInput, optFns ...func(*ec2.Options)) (*ec2.AssociateAddressOutput, error)
+	DisassociateAddress(ctx context.Context, params *ec2.DisassociateAddressInput, optFns ...func(*ec2.Options)) (*ec2.DisassociateAddressOutput, error)
+	ReleaseAddress(ctx context.Context, params *ec2.ReleaseAddressInput, optFns ...func(*ec2.Options)) (*ec2.ReleaseAddressOutput, error)
+	DescribeAddresses(ctx context.Context, params *ec2.DescribeAddressesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error)
+	CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error)
+	DeleteTags(ctx context.Context, params *ec2.DeleteTagsInput, optFns ...func(*ec2.Options)) (*ec2.DeleteTagsOutput, error)
+	GetConsoleOutput(ctx context.Context, params *ec2.GetConsoleOutputInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error)
+	GetConsoleScreenshot(ctx context.Context, params *ec2.GetConsoleScreenshotInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleScreenshotOutput, error)
+	UpdateSecurityGroupRuleDescriptionsIngress(ctx context.Context, params *ec2.UpdateSecurityGroupRuleDescriptionsIngressInput, optFns ...func(*ec2.Options)) (*ec2.UpdateSecurityGroupRuleDescriptionsIngressOutput, error)
+	DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error)
+	ImportSnapshot(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error)
+	DescribeImportSnapshotTasks(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error)
+	RegisterImage(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error)
+}
+
+// EC2 returns the EC2 API for a test backed by the cassette at path. The
+// calls are replayed from the cassette, or, with TILMAN_RECORD_CASSETTES
+// set, sent to AWS and recorded into the cassette when the test ends.
+func EC2(t testing.TB, path string) EC2API {
+	t.Helper()
+	if os.Getenv(EnvRecord) == "" {
+		return Replay(t, path)
+	}
+
+	cfg, err := awsconfig.Load(context.Background(), awsconfig.FromEnv())
+	if err != nil {
+		t.Fatalf("load AWS config for recording: %v", err)
+	}
+	recorder := NewRecorder()
+	cfg.APIOptions = append(cfg.APIOptions, recorder.Register)
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("test failed, not saving cassette %s", path)
+			return
+		}
+		if err := recorder.Save(path); err != nil {
+			t.Errorf("save cassette: %v", err)
+		}
+	})
+	return ec2.NewFromConfig(cfg)
+}
+
+// Replayer serves the interactions of a cassette in order. A call that
+// does not match the next interaction fails with ErrUnexpectedRequest.
+type Replayer struct {
+	cassette *Cassette
+	// Fail is called on every unexpected request, e.g. with t.Errorf
+	Fail func(format string, args ...any)
+
+	mu   sync.Mutex
+	next int
+}
+
+func NewReplayer(c *Cassette) *Replayer {
+	return &Replayer{cassette: c}
+}
+
+// Replay loads the cassette at path and fails the test on unexpected
+// requests and on interactions left unplayed when it ends.
+func Replay(t testing.TB, path string) *Replayer {
+	t.Helper()
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("%v (record it with %s=1)", err, EnvRecord)
+	}
+	r := NewReplayer(c)
+	r.Fail = t.Errorf
+	t.Cleanup(func() {
+		if remaining := r.Remaining(); len(remaining) > 0 {
+			t.Errorf("cassette %s: %d interactions not replayed, next is %s", path, len(remaining), remaining[0].Operation)
+		}
+	})
+	return r
+}
+
+// Remaining returns the interactions not replayed yet.
+func (r *Replayer) Remaining() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Interactions[r.next:]
+}
+
+func replay[Out any](r *Replayer, operation string, params any) (*Out, error) {
+	out := new(Out)
+	if err := r.play(operation, params, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Replayer) play(operation string, params, out any) error {
+	request, err := normalize(params, Sanitize)
+	if err != nil {
+		return fmt.Errorf("encode %s request: %w", operation, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next >= len(r.cassette.Interactions) {
+		return r.unexpected(fmt.Errorf("%w: %s %s, cassette is exhausted", ErrUnexpectedRequest, operation, request))
+	}
+	interaction := r.cassette.Interactions[r.next]
+	if interaction.Operation != operation || !sameRequest(interaction.Request, request) {
+		return r.unexpected(fmt.Errorf("%w: %s %s, expected %s %s", ErrUnexpectedRequest, operation, request, interaction.Operation, interaction.Request))
+	}
+	r.next++
+
+	if interaction.Error != nil {
+		return &smithy.GenericAPIError{Code: interaction.Error.Code, Message: interaction.Error.Message}
+	}
+	if len(interaction.Response) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(interaction.Response, out); err != nil {
+		return fmt.Errorf("decode %s response: %w", operation, err)
+	}
+	return nil
+}
+
+func (r *Replayer) unexpected(err error) error {
+	if r.Fail != nil {
+		r.Fail("%v", err)
+	}
+	return err
+}
+
+func (r *Replayer) RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	return replay[ec2.RunInstancesOutput](r, "RunInstances", params)
+}
+
+func (r *Replayer) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return replay[ec2.DescribeInstancesOutput](r, "DescribeInstances", params)
+}
+
+func (r *Replayer) TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	return replay[ec2.TerminateInstancesOutput](r, "TerminateInstances", params)
+}
+
+func (r *Replayer) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	return replay[ec2.DescribeImagesOutput](r, "DescribeImages", params)
+}
+
+func (r *Replayer) StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	return replay[ec2.StartInstancesOutput](r, "StartInstances", params)
+}
+
+func (r *Replayer) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	return replay[ec2.StopInstancesOutput](r, "StopInstances", params)
+}
+
+func (r *Replayer) RebootInstances(ctx context.Context, params *ec2.RebootInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RebootInstancesOutput, error) {
+	return replay[ec2.RebootInstancesOutput](r, "RebootInstances", params)
+}
+
+func (r *Replayer) ImportKeyPair(ctx context.Context, params *ec2.ImportKeyPairInput, optFns ...func(*ec2.Options)) (*ec2.ImportKeyPairOutput, error) {
+	return replay[ec2.ImportKeyPairOutput](r, "ImportKeyPair", params)
+}
+
+func (r *Replayer) DescribeKeyPairs(ctx context.Context, params *ec2.DescribeKeyPairsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error) {
+	return replay[ec2.DescribeKeyPairsOutput](r, "DescribeKeyPairs", params)
+}
+
+func (r *Replayer) DeleteKeyPair(ctx context.Context, params *ec2.DeleteKeyPairInput, optFns ...func(*ec2.Options)) (*ec2.DeleteKeyPairOutput, error) {
+	return replay[ec2.DeleteKeyPairOutput](r, "DeleteKeyPair", params)
+}
+
+func (r *Replayer) CreateSecurityGroup(ctx context.Context, params *ec2.CreateSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error) {
+	return replay[ec2.CreateSecurityGroupOutput](r, "CreateSecurityGroup", params)
+}
+
+func (r *Replayer) DeleteSecurityGroup(ctx context.Context, params *ec2.DeleteSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error) {
+	return replay[ec2.DeleteSecurityGroupOutput](r, "DeleteSecurityGroup", params)
+}
+
+func (r *Replayer) DescribeSecurityGroups(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return replay[ec2.DescribeSecurityGroupsOutput](r, "DescribeSecurityGroups", params)
+}
+
+func (r *Replayer) AuthorizeSecurityGroupIngress(ctx context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	return replay[ec2.AuthorizeSecurityGroupIngressOutput](r, "AuthorizeSecurityGroupIngress", params)
+}
+
+func (r *Replayer) RevokeSecurityGroupIngress(ctx context.Context, params *ec2.RevokeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	return replay[ec2.RevokeSecurityGroupIngressOutput](r, "RevokeSecurityGroupIngress", params)
+}
+
+func (r *Replayer) ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	return replay[ec2.ModifyInstanceAttributeOutput](r, "ModifyInstanceAttribute", params)
+}
+
+func (r *Replayer) DescribeInstanceStatus(ctx context.Context, params *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+	return replay[ec2.DescribeInstanceStatusOutput](r, "DescribeInstanceStatus", params)
+}
+
+func (r *Replayer) DescribeSpotInstanceRequests(ctx context.Context, params *ec2.DescribeSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotInstanceRequestsOutput, error) {
+	return replay[ec2.DescribeSpotInstanceRequestsOutput](r, "DescribeSpotInstanceRequests", params)
+}
+
+func (r *Replayer) CancelSpotInstanceRequests(ctx context.Context, params *ec2.CancelSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error) {
+	return replay[ec2.CancelSpotInstanceRequestsOutput](r, "CancelSpotInstanceRequests", params)
+}
+
+func (r *Replayer) DescribeInstanceAttribute(ctx context.Context, params *ec2.DescribeInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceAttributeOutput, error) {
+	return replay[ec2.DescribeInstanceAttributeOutput](r, "DescribeInstanceAttribute", params)
+}
+
+func (r *Replayer) CreateVolume(ctx context.Context, params *ec2.CreateVolumeInput, optFns ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error) {
+	return replay[ec2.CreateVolumeOutput](r, "CreateVolume", params)
+}
+
+func (r *Replayer) DescribeVolumes(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	return replay[ec2.DescribeVolumesOutput](r, "DescribeVolumes", params)
+}
+
+func (r *Replayer) DeleteVolume(ctx context.Context, params *ec2.DeleteVolumeInput, optFns ...func(*ec2.Options)) (*ec2.DeleteVolumeOutput, error) {
+	return replay[ec2.DeleteVolumeOutput](r, "DeleteVolume", params)
+}
+
+func (r *Replayer) AttachVolume(ctx context.Context, params *ec2.AttachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error) {
+	return replay[ec2.AttachVolumeOutput](r, "AttachVolume", params)
+}
+
+func (r *Replayer) DetachVolume(ctx context.Context, params *ec2.DetachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.DetachVolumeOutput, error) {
+	return replay[ec2.DetachVolumeOutput](r, "DetachVolume", params)
+}
+
+func (r *Replayer) AllocateAddress(ctx context.Context, params *ec2.AllocateAddressInput, optFns ...func(*ec2.Options)) (*ec2.AllocateAddressOutput, error) {
+	return replay[ec2.AllocateAddressOutput](r, "AllocateAddress", params)
+}
+
+func (r *Replayer) AssociateAddress(ctx context.Context, params *ec2.AssociateAddressInput, optFns ...func(*ec2.Options)) (*ec2.AssociateAddressOutput, error) {
+	return replay[ec2.AssociateAddressOutput](r, "AssociateAddress", params)
+}
+
+func (r *Replayer) DisassociateAddress(ctx context.Context, params *ec2.DisassociateAddressInput, optFns ...func(*ec2.Options)) (*ec2.DisassociateAddressOutput, error) {
+	return replay[ec2.DisassociateAddressOutput](r, "DisassociateAddress", params)
+}
+
+func (r *Replayer) ReleaseAddress(ctx context.Context, params *ec2.ReleaseAddressInput, optFns ...func(*ec2.Options)) (*ec2.ReleaseAddressOutput, error) {
+	return replay[ec2.ReleaseAddressOutput](r, "ReleaseAddress", params)
+}
+
+func (r *Replayer) DescribeAddresses(ctx context.Context, params *ec2.DescribeAddressesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error) {
+	return replay[ec2.DescribeAddressesOutput](r, "DescribeAddresses", params)
+}
+
+func (r *Replayer) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	return replay[ec2.CreateTagsOutput](r, "CreateTags", params)
+}
+
+func (r *Replayer) DeleteTags(ctx context.Context, params *ec2.DeleteTagsInput, optFns ...func(*ec2.Options)) (*ec2.DeleteTagsOutput, error) {
+	return replay[ec2.DeleteTagsOutput](r, "DeleteTags", params)
+}
+
+func (r *Replayer) GetConsoleOutput(ctx context.Context, params *ec2.GetConsoleOutputInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error) {
+	return replay[ec2.GetConsoleOutputOutput](r, "GetConsoleOutput", params)
+}
+
+func (r *Replayer) GetConsoleScreenshot(ctx context.Context, params *ec2.GetConsoleScreenshotInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleScreenshotOutput, error) {
+	return replay[ec2.GetConsoleScreenshotOutput](r, "GetConsoleScreenshot", params)
+}
+
+func (r *Replayer) UpdateSecurityGroupRuleDescriptionsIngress(ctx context.Context, params *ec2.UpdateSecurityGroupRuleDescriptionsIngressInput, optFns ...func(*ec2.Options)) (*ec2.UpdateSecurityGroupRuleDescriptionsIngressOutput, error) {
+	return replay[ec2.UpdateSecurityGroupRuleDescriptionsIngressOutput](r, "UpdateSecurityGroupRuleDescriptionsIngress", params)
+}
+
+func (r *Replayer) DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	return replay[ec2.DescribeSnapshotsOutput](r, "DescribeSnapshots", params)
+}
+
+func (r *Replayer) ImportSnapshot(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error) {
+	return replay[ec2.ImportSnapshotOutput](r, "ImportSnapshot", params)
+}
+
+func (r *Replayer) DescribeImportSnapshotTasks(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error) {
+	return replay[ec2.DescribeImportSnapshotTasksOutput](r, "DescribeImportSnapshotTasks", params)
+}
+
+func (r *Replayer) RegisterImage(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error) {
+	return replay[ec2.RegisterImageOutput](r, "RegisterImage", params)
+}
@@ -0,0 +1,297 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"slices"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+)
+
+// MaxUserDataSize is the EC2 limit for user data before base64 encoding.
+const MaxUserDataSize = 16 * 1024
+
+const (
+	ContentTypeCloudConfig = "text/cloud-config"
+	ContentTypeShellScript = "text/x-shellscript"
+	ContentTypeBoothook    = "text/cloud-boothook"
+	ContentTypeMultipart   = "multipart/mixed"
+)
+
+var (
+	ErrUserDataTooLarge = errkind.New(errkind.InvalidInput, "user data exceeds size limit")
+	ErrInvalidTemplate  = errkind.New(errkind.InvalidInput, "invalid template")
+)
+
+var allowedPartTypes = []string{ContentTypeCloudConfig, ContentTypeShellScript, ContentTypeBoothook}
+
+type User struct {
+	Name              string
+	Groups            []string
+	Sudo              string
+	Shell             string
+	SSHAuthorizedKeys []string
+}
+
+type File struct {
+	Path        string
+	Content     string
+	Permissions string
+	Owner       string
+}
+
+// Part is an additional MIME part sent next to the cloud-config document,
+// e.g. a shell script.
+type Part struct {
+	ContentType string
+	Filename    string
+	Content     string
+}
+
+type CloudConfig struct {
+	Users             []User
+	SSHAuthorizedKeys []string
+	Packages          []string
+	Files             []File
+	RunCmd            []string
+}
+
+// Variables are the per-request inputs merged into a template. String
+// fields of the template may reference {{.Hostname}} and {{.Vars.key}}.
+type Variables struct {
+	Hostname          string
+	SSHAuthorizedKeys []string
+	Users             []User
+	Packages          []string
+	Files             []File
+	RunCmd            []string
+	Vars              map[string]string
+}
+
+type UserData struct {
+	Content     string
+	ContentType string
+}
+
+func (u UserData) Size() int {
+	return len(u.Content)
+}
+
+// Render merges the variables into the template and produces the user data
+// document. With no extra parts the result is a plain #cloud-config
+// document, otherwise a multipart MIME archive. tmpl may be nil to render
+// from the variables alone.
+func Render(tmpl *Template, vars Variables) (UserData, error) {
+	config := CloudConfig{}
+	var parts []Part
+	if tmpl != nil {
+		config = tmpl.Config
+		parts = tmpl.Parts
+	}
+
+	data := templateData{Hostname: vars.Hostname, Vars: vars.Vars}
+	if data.Vars == nil {
+		data.Vars = map[string]string{}
+	}
+
+	expanded, err := expandConfig(config, data)
+	if err != nil {
+		return UserData{}, err
+	}
+
+	expanded.Users = append(expanded.Users, vars.Users...)
+	expanded.SSHAuthorizedKeys = append(expanded.SSHAuthorizedKeys, vars.SSHAuthorizedKeys...)
+	expanded.Packages = append(expanded.Packages, vars.Packages...)
+	expanded.Files = append(expanded.Files, vars.Files...)
+	expanded.RunCmd = append(expanded.RunCmd, vars.RunCmd...)
+
+	document := marshalCloudConfig(vars.Hostname, expanded)
+
+	userData := UserData{Content: document, ContentType: ContentTypeCloudConfig}
+	if len(parts) > 0 {
+		expandedParts := make([]Part, 0, len(parts))
+		for _, part := range parts {
+			content, err := expand(part.Content, data)
+			if err != nil {
+				return UserData{}, err
+			}
+			part.Content = content
+			expandedParts = append(expandedParts, part)
+		}
+
+		userData, err = buildMultipart(document, expandedParts)
+		if err != nil {
+			return UserData{}, err
+		}
+	}
+
+	if userData.Size() > MaxUserDataSize {
+		return UserData{}, fmt.Errorf("%w: %d bytes, limit is %d", ErrUserDataTooLarge, userData.Size(), MaxUserDataSize)
+	}
+	return userData, nil
+}
+
+// ValidateTemplate checks that every templated string parses and that the
+// extra parts use content types cloud-init understands.
+func ValidateTemplate(tmpl *Template) error {
+	if !templateNamePattern.MatchString(tmpl.Name) {
+		return fmt.Errorf("%w: name %q must be 1-63 lowercase letters, digits or hyphens", ErrInvalidTemplate, tmpl.Name)
+	}
+
+	for _, part := range tmpl.Parts {
+		if !slices.Contains(allowedPartTypes, part.ContentType) {
+			return fmt.Errorf("%w: unsupported part content type %q", ErrInvalidTemplate, part.ContentType)
+		}
+	}
+
+	// A dry run with placeholder data catches syntax errors and unknown
+	// fields; vars are only known at render time, so missing ones are fine
+	data := templateData{Hostname: "validate", Vars: map[string]string{}, missingKey: "zero"}
+	if _, err := expandConfig(tmpl.Config, data); err != nil {
+		return err
+	}
+	for _, part := range tmpl.Parts {
+		if _, err := expand(part.Content, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type templateData struct {
+	Hostname string
+	Vars     map[string]string
+
+	missingKey string
+}
+
+func expand(text string, data templateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	missingKey := data.missingKey
+	if missingKey == "" {
+		missingKey = "error"
+	}
+
+	t, err := template.New("").Option("missingkey=" + missingKey).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return buf.String(), nil
+}
+
+func expandAll(texts []string, data templateData) ([]string, error) {
+	expanded := make([]string, 0, len(texts))
+	for _, text := range texts {
+		value, err := expand(text, data)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, value)
+	}
+	return expanded, nil
+}
+
+func expandConfig(config CloudConfig, data templateData) (CloudConfig, error) {
+	var expanded CloudConfig
+	var err error
+
+	if expanded.Packages, err = expandAll(config.Packages, data); err != nil {
+		return CloudConfig{}, err
+	}
+	if expanded.RunCmd, err = expandAll(config.RunCmd, data); err != nil {
+		return CloudConfig{}, err
+	}
+	if expanded.SSHAuthorizedKeys, err = expandAll(config.SSHAuthorizedKeys, data); err != nil {
+		return CloudConfig{}, err
+	}
+
+	for _, file := range config.Files {
+		if file.Path, err = expand(file.Path, data); err != nil {
+			return CloudConfig{}, err
+		}
+		if file.Content, err = expand(file.Content, data); err != nil {
+			return CloudConfig{}, err
+		}
+		expanded.Files = append(expanded.Files, file)
+	}
+
+	expanded.Users = append(expanded.Users, config.Users...)
+	return expanded, nil
+}
+
+func buildMultipart(cloudConfig string, parts []Part) (UserData, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	allParts := append([]Part{{ContentType: ContentTypeCloudConfig, Filename: "cloud-config.yaml", Content: cloudConfig}}, parts...)
+	for i, part := range allParts {
+		filename := part.Filename
+		if filename == "" {
+			filename = fmt.Sprintf("part-%03d", i)
+		}
+
+		// Parts that are not plain ASCII, e.g. with UTF-8 comments, are
+		// base64 encoded, as 7bit only allows ASCII
+		charset, encoding, content := "us-ascii", "7bit", part.Content
+		if !isASCII(content) {
+			charset, encoding, content = "utf-8", "base64", encodeBase64Lines(content)
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", fmt.Sprintf(`%s; charset="%s"`, part.ContentType, charset))
+		header.Set("MIME-Version", "1.0")
+		header.Set("Content-Transfer-Encoding", encoding)
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return UserData{}, fmt.Errorf("create MIME part: %w", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			return UserData{}, fmt.Errorf("write MIME part: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return UserData{}, fmt.Errorf("close MIME archive: %w", err)
+	}
+
+	contentType := fmt.Sprintf(`%s; boundary="%s"`, ContentTypeMultipart, writer.Boundary())
+	content := "Content-Type: " + contentType + "\nMIME-Version: 1.0\n\n" + body.String()
+	return UserData{Content: content, ContentType: ContentTypeMultipart}, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeBase64Lines encodes s as base64 in lines of 76 characters, the
+// MIME limit.
+func encodeBase64Lines(s string) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(s))
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	return b.String()
+}
@@ -0,0 +1,191 @@
+package cloudinit
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tmpl := &Template{
+		Name: "web-server",
+		Config: CloudConfig{
+			Users:    []User{{Name: "deploy", Groups: []string{"wheel"}, Sudo: "ALL=(ALL) NOPASSWD:ALL"}},
+			Packages: []string{"nginx"},
+			Files:    []File{{Path: "/etc/motd", Content: "Welcome to {{.Hostname}}\n", Permissions: "0644"}},
+			RunCmd:   []string{"echo {{.Vars.domain}} > /etc/domain"},
+		},
+	}
+
+	userData, err := Render(tmpl, Variables{
+		Hostname:          "brave-otter",
+		SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA alice@laptop"},
+		Packages:          []string{"git"},
+		Vars:              map[string]string{"domain": "example.com"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if userData.ContentType != ContentTypeCloudConfig {
+		t.Errorf("expected content type %s, got %s", ContentTypeCloudConfig, userData.ContentType)
+	}
+
+	expected := `#cloud-config
+hostname: "brave-otter"
+preserve_hostname: false
+users:
+  - default
+  - name: "deploy"
+    groups: "wheel"
+    sudo: "ALL=(ALL) NOPASSWD:ALL"
+ssh_authorized_keys:
+  - "ssh-ed25519 AAAA alice@laptop"
+packages:
+  - "nginx"
+  - "git"
+write_files:
+  - path: "/etc/motd"
+    content: "Welcome to brave-otter\n"
+    permissions: "0644"
+runcmd:
+  - "echo example.com > /etc/domain"
+`
+	if userData.Content != expected {
+		t.Errorf("unexpected document:\n%s\nexpected:\n%s", userData.Content, expected)
+	}
+}
+
+func TestRender_WithoutTemplate(t *testing.T) {
+	userData, err := Render(nil, Variables{Hostname: "brave-otter", RunCmd: []string{"uptime"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "#cloud-config\nhostname: \"brave-otter\"\npreserve_hostname: false\nruncmd:\n  - \"uptime\"\n"
+	if userData.Content != expected {
+		t.Errorf("expected %q, got %q", expected, userData.Content)
+	}
+}
+
+func TestRender_MissingVariable(t *testing.T) {
+	tmpl := &Template{Name: "web-server", Config: CloudConfig{RunCmd: []string{"echo {{.Vars.domain}}"}}}
+
+	_, err := Render(tmpl, Variables{Hostname: "brave-otter"})
+	if !errors.Is(err, ErrInvalidTemplate) {
+		t.Errorf("expected ErrInvalidTemplate, got %v", err)
+	}
+}
+
+func TestRender_Multipart(t *testing.T) {
+	tmpl := &Template{
+		Name:   "bootstrap",
+		Config: CloudConfig{Packages: []string{"nginx"}},
+		Parts:  []Part{{ContentType: ContentTypeShellScript, Filename: "bootstrap.sh", Content: "#!/bin/sh\necho {{.Hostname}}\n"}},
+	}
+
+	userData, err := Render(tmpl, Variables{Hostname: "brave-otter"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if userData.ContentType != ContentTypeMultipart {
+		t.Errorf("expected content type %s, got %s", ContentTypeMultipart, userData.ContentType)
+	}
+	if !strings.HasPrefix(userData.Content, "Content-Type: multipart/mixed; boundary=") {
+		t.Errorf("expected MIME header, got %q", userData.Content[:40])
+	}
+	for _, expected := range []string{
+		"Content-Type: text/cloud-config",
+		"Content-Type: text/x-shellscript",
+		`filename="bootstrap.sh"`,
+		"echo brave-otter",
+		"#cloud-config",
+	} {
+		if !strings.Contains(userData.Content, expected) {
+			t.Errorf("expected multipart document to contain %q", expected)
+		}
+	}
+}
+
+func TestRender_MultipartUTF8(t *testing.T) {
+	script := "#!/bin/sh\n# Grüße aus München\necho ok\n"
+	tmpl := &Template{
+		Name:  "bootstrap",
+		Parts: []Part{{ContentType: ContentTypeShellScript, Filename: "bootstrap.sh", Content: script}},
+	}
+
+	userData, err := Render(tmpl, Variables{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(userData.Content))
+	if err != nil {
+		t.Fatalf("failed to parse user data: %v", err)
+	}
+	_, params, _ := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			t.Fatal("expected the shell script part")
+		}
+		if !strings.HasPrefix(part.Header.Get("Content-Type"), ContentTypeShellScript) {
+			if part.Header.Get("Content-Transfer-Encoding") != "7bit" {
+				t.Errorf("expected ASCII parts to stay 7bit, got %v", part.Header)
+			}
+			continue
+		}
+		if part.Header.Get("Content-Type") != ContentTypeShellScript+`; charset="utf-8"` || part.Header.Get("Content-Transfer-Encoding") != "base64" {
+			t.Errorf("expected a base64 encoded utf-8 part, got %v", part.Header)
+		}
+		raw, _ := io.ReadAll(part)
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+		if err != nil || string(decoded) != script {
+			t.Errorf("expected the script to round-trip, got %q (%v)", decoded, err)
+		}
+		return
+	}
+}
+
+func TestRender_TooLarge(t *testing.T) {
+	tmpl := &Template{
+		Name:   "large",
+		Config: CloudConfig{Files: []File{{Path: "/var/lib/blob", Content: strings.Repeat("x", MaxUserDataSize)}}},
+	}
+
+	_, err := Render(tmpl, Variables{})
+	if !errors.Is(err, ErrUserDataTooLarge) {
+		t.Errorf("expected ErrUserDataTooLarge, got %v", err)
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    Template
+		wantErr bool
+	}{
+		{"valid", Template{Name: "web-server", Config: CloudConfig{RunCmd: []string{"echo {{.Hostname}}"}}}, false},
+		{"vars are resolved at render time", Template{Name: "web-server", Config: CloudConfig{RunCmd: []string{"echo {{.Vars.domain}}"}}}, false},
+		{"invalid name", Template{Name: "Web Server"}, true},
+		{"syntax error", Template{Name: "web-server", Config: CloudConfig{RunCmd: []string{"echo {{.Hostname"}}}, true},
+		{"unknown field", Template{Name: "web-server", Config: CloudConfig{RunCmd: []string{"echo {{.Region}}"}}}, true},
+		{"unsupported part", Template{Name: "web-server", Parts: []Part{{ContentType: "text/html", Content: "x"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplate(&tt.tmpl)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
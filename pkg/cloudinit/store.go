@@ -0,0 +1,115 @@
+package cloudinit
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+)
+
+var (
+	ErrTemplateNotFound = errkind.New(errkind.NotFound, "template not found")
+	ErrTemplateExists   = errkind.New(errkind.Conflict, "template already exists")
+)
+
+var templateNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+type Template struct {
+	Name        string
+	Description string
+	Config      CloudConfig
+	Parts       []Part
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// TemplateStore keeps templates in memory. Templates are small, owned by the
+// admin API and recreated on deploy, so there is no persistence yet.
+type TemplateStore struct {
+	mu        sync.RWMutex
+	templates map[string]Template
+}
+
+func NewTemplateStore() *TemplateStore {
+	return &TemplateStore{templates: make(map[string]Template)}
+}
+
+func (s *TemplateStore) List() []Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]Template, 0, len(s.templates))
+	for _, tmpl := range s.templates {
+		templates = append(templates, tmpl)
+	}
+	slices.SortFunc(templates, func(a, b Template) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return templates
+}
+
+func (s *TemplateStore) Get(name string) (Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tmpl, ok := s.templates[name]
+	if !ok {
+		return Template{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return tmpl, nil
+}
+
+func (s *TemplateStore) Create(tmpl Template) (Template, error) {
+	if err := ValidateTemplate(&tmpl); err != nil {
+		return Template{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[tmpl.Name]; ok {
+		return Template{}, fmt.Errorf("%w: %s", ErrTemplateExists, tmpl.Name)
+	}
+
+	now := time.Now().UTC()
+	tmpl.CreatedAt = now
+	tmpl.UpdatedAt = now
+	s.templates[tmpl.Name] = tmpl
+	return tmpl, nil
+}
+
+// Update replaces the content of an existing template, keeping its
+// creation time.
+func (s *TemplateStore) Update(tmpl Template) (Template, error) {
+	if err := ValidateTemplate(&tmpl); err != nil {
+		return Template{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.templates[tmpl.Name]
+	if !ok {
+		return Template{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, tmpl.Name)
+	}
+
+	tmpl.CreatedAt = existing.CreatedAt
+	tmpl.UpdatedAt = time.Now().UTC()
+	s.templates[tmpl.Name] = tmpl
+	return tmpl, nil
+}
+
+func (s *TemplateStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	delete(s.templates, name)
+	return nil
+}
@@ -0,0 +1,52 @@
+package cloudinit
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTemplateStore(t *testing.T) {
+	store := NewTemplateStore()
+
+	created, err := store.Create(Template{Name: "web-server", Config: CloudConfig{Packages: []string{"nginx"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.CreatedAt.IsZero() {
+		t.Error("expected CreatedAt to be set")
+	}
+
+	if _, err := store.Create(Template{Name: "web-server"}); !errors.Is(err, ErrTemplateExists) {
+		t.Errorf("expected ErrTemplateExists, got %v", err)
+	}
+
+	updated, err := store.Update(Template{Name: "web-server", Description: "nginx"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("expected CreatedAt to be kept, got %s", updated.CreatedAt)
+	}
+
+	got, err := store.Get("web-server")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Description != "nginx" || len(got.Config.Packages) != 0 {
+		t.Errorf("expected template to be replaced, got %+v", got)
+	}
+
+	if len(store.List()) != 1 {
+		t.Errorf("expected 1 template, got %d", len(store.List()))
+	}
+
+	if err := store.Delete("web-server"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Get("web-server"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+	if _, err := store.Update(Template{Name: "web-server"}); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// marshalCloudConfig writes the #cloud-config document. The structure is
+// fixed and small, so it is emitted by hand instead of pulling in a YAML
+// library. All scalars are written as double-quoted strings, whose escapes
+// are a superset of JSON's, which makes the JSON encoder a safe quoter.
+func marshalCloudConfig(hostname string, config CloudConfig) string {
+	var b strings.Builder
+	b.WriteString("#cloud-config\n")
+
+	if hostname != "" {
+		b.WriteString("hostname: " + quote(hostname) + "\n")
+		b.WriteString("preserve_hostname: false\n")
+	}
+
+	if len(config.Users) > 0 {
+		b.WriteString("users:\n")
+		// Keep the distribution's default user next to the declared ones
+		b.WriteString("  - default\n")
+		for _, user := range config.Users {
+			b.WriteString("  - name: " + quote(user.Name) + "\n")
+			if len(user.Groups) > 0 {
+				b.WriteString("    groups: " + quote(strings.Join(user.Groups, ", ")) + "\n")
+			}
+			if user.Sudo != "" {
+				b.WriteString("    sudo: " + quote(user.Sudo) + "\n")
+			}
+			if user.Shell != "" {
+				b.WriteString("    shell: " + quote(user.Shell) + "\n")
+			}
+			writeList(&b, "    ", "ssh_authorized_keys", user.SSHAuthorizedKeys)
+		}
+	}
+
+	writeList(&b, "", "ssh_authorized_keys", config.SSHAuthorizedKeys)
+	writeList(&b, "", "packages", config.Packages)
+
+	if len(config.Files) > 0 {
+		b.WriteString("write_files:\n")
+		for _, file := range config.Files {
+			b.WriteString("  - path: " + quote(file.Path) + "\n")
+			b.WriteString("    content: " + quote(file.Content) + "\n")
+			if file.Permissions != "" {
+				b.WriteString("    permissions: " + quote(file.Permissions) + "\n")
+			}
+			if file.Owner != "" {
+				b.WriteString("    owner: " + quote(file.Owner) + "\n")
+			}
+		}
+	}
+
+	writeList(&b, "", "runcmd", config.RunCmd)
+	return b.String()
+}
+
+func writeList(b *strings.Builder, indent, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	b.WriteString(indent + key + ":\n")
+	for _, value := range values {
+		b.WriteString(indent + "  - " + quote(value) + "\n")
+	}
+}
+
+func quote(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
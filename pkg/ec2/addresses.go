@@ -0,0 +1,330 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// TagReleaseWithNode marks Elastic IPs that are released when the node in
+// their NodeID tag is deleted.
+const TagReleaseWithNode = "ReleaseWithNode"
+
+var (
+	ErrAddressNotFound      = errkind.New(errkind.NotFound, "elastic IP not found")
+	ErrAddressInUse         = errkind.New(errkind.Conflict, "elastic IP is associated")
+	ErrAddressNotAssociated = errkind.New(errkind.Conflict, "elastic IP is not associated")
+)
+
+// AddressInfo is an Elastic IP. NodeID is the node the address is tied to,
+// which is set before the association exists for nodes that are still
+// pending; InstanceID is the node it is associated with right now.
+type AddressInfo struct {
+	AllocationID    string
+	PublicIP        string
+	Name            string
+	AssociationID   string
+	InstanceID      string
+	NodeID          string
+	ReleaseWithNode bool
+	Tags            map[string]string
+}
+
+func (a AddressInfo) Associated() bool {
+	return a.AssociationID != ""
+}
+
+type AllocateAddressConfig struct {
+	Name string
+	// NodeID ties the address to a node; it is associated by the caller
+	NodeID string
+	// ReleaseWithNode releases the address when NodeID is deleted
+	ReleaseWithNode bool
+}
+
+func AllocateAddress(ctx context.Context, client EC2Client, config AllocateAddressConfig) (AddressInfo, error) {
+	slog.Info("Allocating Elastic IP", "name", config.Name, "node_id", config.NodeID)
+
+	tags := []types.Tag{
+		{Key: aws.String(TagManagedBy), Value: aws.String(ManagedByValue)},
+	}
+	if config.Name != "" {
+		tags = append(tags, types.Tag{Key: aws.String(TagName), Value: aws.String(config.Name)})
+	}
+	if config.NodeID != "" {
+		tags = append(tags, types.Tag{Key: aws.String(TagNodeID), Value: aws.String(config.NodeID)})
+	}
+	if config.ReleaseWithNode {
+		tags = append(tags, types.Tag{Key: aws.String(TagReleaseWithNode), Value: aws.String("true")})
+	}
+
+	result, err := client.AllocateAddress(ctx, &awsec2.AllocateAddressInput{
+		Domain: types.DomainTypeVpc,
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeElasticIp,
+				Tags:         tags,
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to allocate Elastic IP", "error", err)
+		return AddressInfo{}, fmt.Errorf("failed to allocate elastic IP: %w", err)
+	}
+
+	info := AddressInfo{
+		AllocationID:    getPtrStringValue(result.AllocationId),
+		PublicIP:        getPtrStringValue(result.PublicIp),
+		Name:            config.Name,
+		NodeID:          config.NodeID,
+		ReleaseWithNode: config.ReleaseWithNode,
+		Tags:            map[string]string{},
+	}
+	for _, tag := range tags {
+		info.Tags[*tag.Key] = *tag.Value
+	}
+
+	slog.Info("Elastic IP allocated", "allocation_id", info.AllocationID, "public_ip", info.PublicIP)
+	return info, nil
+}
+
+func ListAddresses(ctx context.Context, client EC2Client) ([]AddressInfo, error) {
+	return describeManagedAddresses(ctx, client, nil)
+}
+
+// ListNodeAddresses returns the managed addresses tied to a node.
+func ListNodeAddresses(ctx context.Context, client EC2Client, instanceID string) ([]AddressInfo, error) {
+	return describeManagedAddresses(ctx, client, []types.Filter{
+		{
+			Name:   aws.String("tag:" + TagNodeID),
+			Values: []string{instanceID},
+		},
+	})
+}
+
+func GetAddress(ctx context.Context, client EC2Client, allocationID string) (AddressInfo, error) {
+	addresses, err := describeManagedAddresses(ctx, client, []types.Filter{
+		{
+			Name:   aws.String("allocation-id"),
+			Values: []string{allocationID},
+		},
+	})
+	if err != nil {
+		return AddressInfo{}, err
+	}
+	if len(addresses) == 0 {
+		return AddressInfo{}, fmt.Errorf("%w: %s", ErrAddressNotFound, allocationID)
+	}
+	return addresses[0], nil
+}
+
+// AssociateAddress associates the address with a node and ties it to the
+// node, moving it away from any node it was associated with before.
+func AssociateAddress(ctx context.Context, client EC2Client, allocationID, instanceID string) (AddressInfo, error) {
+	address, err := GetAddress(ctx, client, allocationID)
+	if err != nil {
+		return AddressInfo{}, err
+	}
+
+	slog.Info("Associating Elastic IP", "allocation_id", allocationID, "public_ip", address.PublicIP, "instance_id", instanceID)
+	result, err := client.AssociateAddress(ctx, &awsec2.AssociateAddressInput{
+		AllocationId:       aws.String(allocationID),
+		InstanceId:         aws.String(instanceID),
+		AllowReassociation: aws.Bool(true),
+	})
+	if err != nil {
+		if isInstanceNotFoundError(err) {
+			return AddressInfo{}, fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+		}
+		if hasErrorCode(err, "IncorrectInstanceState") {
+			return AddressInfo{}, fmt.Errorf("%w: %s cannot be associated with an address in its current state", ErrInvalidStateTransition, instanceID)
+		}
+		slog.Error("Failed to associate Elastic IP", "allocation_id", allocationID, "instance_id", instanceID, "error", err)
+		return AddressInfo{}, fmt.Errorf("failed to associate elastic IP: %w", err)
+	}
+
+	if address.NodeID != instanceID {
+		if err := tagAddress(ctx, client, allocationID, TagNodeID, instanceID); err != nil {
+			return AddressInfo{}, err
+		}
+		// The address belonged to another node, so it must not be released
+		// with this one unless asked again
+		if address.ReleaseWithNode {
+			if err := untagAddress(ctx, client, allocationID, TagReleaseWithNode); err != nil {
+				return AddressInfo{}, err
+			}
+			address.ReleaseWithNode = false
+		}
+	}
+
+	address.AssociationID = getPtrStringValue(result.AssociationId)
+	address.InstanceID = instanceID
+	address.NodeID = instanceID
+	return address, nil
+}
+
+// DisassociateAddress removes the address from its node and unties it, so
+// it is neither associated again nor released with the node.
+func DisassociateAddress(ctx context.Context, client EC2Client, allocationID string) (AddressInfo, error) {
+	address, err := GetAddress(ctx, client, allocationID)
+	if err != nil {
+		return AddressInfo{}, err
+	}
+	if !address.Associated() {
+		return AddressInfo{}, fmt.Errorf("%w: %s", ErrAddressNotAssociated, allocationID)
+	}
+
+	slog.Info("Disassociating Elastic IP", "allocation_id", allocationID, "instance_id", address.InstanceID)
+	if err := disassociate(ctx, client, address); err != nil {
+		return AddressInfo{}, err
+	}
+	if err := untagAddress(ctx, client, allocationID, TagNodeID, TagReleaseWithNode); err != nil {
+		return AddressInfo{}, err
+	}
+
+	address.AssociationID = ""
+	address.InstanceID = ""
+	address.NodeID = ""
+	address.ReleaseWithNode = false
+	return address, nil
+}
+
+// ReleaseAddress releases an address that is not associated.
+func ReleaseAddress(ctx context.Context, client EC2Client, allocationID string) error {
+	address, err := GetAddress(ctx, client, allocationID)
+	if err != nil {
+		return err
+	}
+	if address.Associated() {
+		return fmt.Errorf("%w: %s is associated with %s", ErrAddressInUse, allocationID, address.InstanceID)
+	}
+	return release(ctx, client, address)
+}
+
+// ReleaseNodeAddresses releases the addresses that are released with the
+// node, disassociating them first. Other addresses tied to the node are
+// left alone.
+func ReleaseNodeAddresses(ctx context.Context, client EC2Client, instanceID string) ([]AddressInfo, error) {
+	addresses, err := ListNodeAddresses(ctx, client, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var released []AddressInfo
+	var errs []error
+	for _, address := range addresses {
+		if !address.ReleaseWithNode {
+			continue
+		}
+		if address.Associated() {
+			if err := disassociate(ctx, client, address); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if err := release(ctx, client, address); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		released = append(released, address)
+	}
+	return released, errors.Join(errs...)
+}
+
+func disassociate(ctx context.Context, client EC2Client, address AddressInfo) error {
+	_, err := client.DisassociateAddress(ctx, &awsec2.DisassociateAddressInput{
+		AssociationId: aws.String(address.AssociationID),
+	})
+	if err != nil && !hasErrorCode(err, "InvalidAssociationID.NotFound") {
+		slog.Error("Failed to disassociate Elastic IP", "allocation_id", address.AllocationID, "error", err)
+		return fmt.Errorf("failed to disassociate elastic IP %s: %w", address.AllocationID, err)
+	}
+	return nil
+}
+
+func release(ctx context.Context, client EC2Client, address AddressInfo) error {
+	slog.Info("Releasing Elastic IP", "allocation_id", address.AllocationID, "public_ip", address.PublicIP)
+	_, err := client.ReleaseAddress(ctx, &awsec2.ReleaseAddressInput{
+		AllocationId: aws.String(address.AllocationID),
+	})
+	if err != nil {
+		if hasErrorCode(err, "InvalidIPAddress.InUse") {
+			return fmt.Errorf("%w: %s", ErrAddressInUse, address.AllocationID)
+		}
+		slog.Error("Failed to release Elastic IP", "allocation_id", address.AllocationID, "error", err)
+		return fmt.Errorf("failed to release elastic IP %s: %w", address.AllocationID, err)
+	}
+	return nil
+}
+
+func tagAddress(ctx context.Context, client EC2Client, allocationID, key, value string) error {
+	_, err := client.CreateTags(ctx, &awsec2.CreateTagsInput{
+		Resources: []string{allocationID},
+		Tags:      []types.Tag{{Key: aws.String(key), Value: aws.String(value)}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag elastic IP %s: %w", allocationID, err)
+	}
+	return nil
+}
+
+func untagAddress(ctx context.Context, client EC2Client, allocationID string, keys ...string) error {
+	tags := make([]types.Tag, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(key)})
+	}
+	_, err := client.DeleteTags(ctx, &awsec2.DeleteTagsInput{
+		Resources: []string{allocationID},
+		Tags:      tags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to untag elastic IP %s: %w", allocationID, err)
+	}
+	return nil
+}
+
+func describeManagedAddresses(ctx context.Context, client EC2Client, filters []types.Filter) ([]AddressInfo, error) {
+	filters = append(filters, types.Filter{
+		Name:   aws.String("tag:" + TagManagedBy),
+		Values: []string{ManagedByValue},
+	})
+	result, err := client.DescribeAddresses(ctx, &awsec2.DescribeAddressesInput{
+		Filters: filters,
+	})
+	if err != nil {
+		slog.Error("Failed to describe Elastic IPs", "error", err)
+		return nil, fmt.Errorf("failed to describe elastic IPs: %w", err)
+	}
+
+	addresses := make([]AddressInfo, 0, len(result.Addresses))
+	for _, address := range result.Addresses {
+		addresses = append(addresses, newAddressInfo(address))
+	}
+	return addresses, nil
+}
+
+func newAddressInfo(address types.Address) AddressInfo {
+	info := AddressInfo{
+		AllocationID:  getPtrStringValue(address.AllocationId),
+		PublicIP:      getPtrStringValue(address.PublicIp),
+		AssociationID: getPtrStringValue(address.AssociationId),
+		InstanceID:    getPtrStringValue(address.InstanceId),
+		Tags:          map[string]string{},
+	}
+	for _, tag := range address.Tags {
+		if tag.Key == nil {
+			continue
+		}
+		info.Tags[*tag.Key] = getPtrStringValue(tag.Value)
+	}
+	info.Name = info.Tags[TagName]
+	info.NodeID = info.Tags[TagNodeID]
+	info.ReleaseWithNode = info.Tags[TagReleaseWithNode] == "true"
+	return info
+}
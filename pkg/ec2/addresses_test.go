@@ -0,0 +1,164 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// newAddressMock serves a single managed address with the given tags and
+// keeps its association and tags up to date.
+func newAddressMock(t *testing.T, tags map[string]string) (*MockEC2Client, *types.Address, *[]string) {
+	t.Helper()
+	address := &types.Address{
+		AllocationId: aws.String("eipalloc-1"),
+		PublicIp:     aws.String("3.120.0.10"),
+		Tags:         []types.Tag{{Key: aws.String(TagManagedBy), Value: aws.String(ManagedByValue)}},
+	}
+	for key, value := range tags {
+		address.Tags = append(address.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	var released []string
+
+	client := &MockEC2Client{
+		DescribeAddressesFunc: func(ctx context.Context, params *awsec2.DescribeAddressesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeAddressesOutput, error) {
+			if len(released) > 0 {
+				return &awsec2.DescribeAddressesOutput{}, nil
+			}
+			return &awsec2.DescribeAddressesOutput{Addresses: []types.Address{*address}}, nil
+		},
+		AssociateAddressFunc: func(ctx context.Context, params *awsec2.AssociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AssociateAddressOutput, error) {
+			address.AssociationId = aws.String("eipassoc-1")
+			address.InstanceId = params.InstanceId
+			return &awsec2.AssociateAddressOutput{AssociationId: address.AssociationId}, nil
+		},
+		DisassociateAddressFunc: func(ctx context.Context, params *awsec2.DisassociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.DisassociateAddressOutput, error) {
+			address.AssociationId = nil
+			address.InstanceId = nil
+			return &awsec2.DisassociateAddressOutput{}, nil
+		},
+		ReleaseAddressFunc: func(ctx context.Context, params *awsec2.ReleaseAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.ReleaseAddressOutput, error) {
+			released = append(released, aws.ToString(params.AllocationId))
+			return &awsec2.ReleaseAddressOutput{}, nil
+		},
+		CreateTagsFunc: func(ctx context.Context, params *awsec2.CreateTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateTagsOutput, error) {
+			address.Tags = append(address.Tags, params.Tags...)
+			return &awsec2.CreateTagsOutput{}, nil
+		},
+		DeleteTagsFunc: func(ctx context.Context, params *awsec2.DeleteTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteTagsOutput, error) {
+			var kept []types.Tag
+			for _, tag := range address.Tags {
+				remove := false
+				for _, deleted := range params.Tags {
+					remove = remove || aws.ToString(tag.Key) == aws.ToString(deleted.Key)
+				}
+				if !remove {
+					kept = append(kept, tag)
+				}
+			}
+			address.Tags = kept
+			return &awsec2.DeleteTagsOutput{}, nil
+		},
+	}
+	return client, address, &released
+}
+
+func TestAllocateAddress(t *testing.T) {
+	mockClient := &MockEC2Client{
+		AllocateAddressFunc: func(ctx context.Context, params *awsec2.AllocateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AllocateAddressOutput, error) {
+			if params.Domain != types.DomainTypeVpc {
+				t.Errorf("expected VPC domain, got %s", params.Domain)
+			}
+			tags := map[string]string{}
+			for _, tag := range params.TagSpecifications[0].Tags {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			if tags[TagManagedBy] != ManagedByValue || tags[TagNodeID] != "i-1" || tags[TagReleaseWithNode] != "true" {
+				t.Errorf("unexpected tags %v", tags)
+			}
+			return &awsec2.AllocateAddressOutput{
+				AllocationId: aws.String("eipalloc-1"),
+				PublicIp:     aws.String("3.120.0.10"),
+			}, nil
+		},
+	}
+
+	info, err := AllocateAddress(context.Background(), mockClient, AllocateAddressConfig{Name: "brave-otter", NodeID: "i-1", ReleaseWithNode: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.AllocationID != "eipalloc-1" || info.PublicIP != "3.120.0.10" || info.Associated() {
+		t.Errorf("unexpected address %+v", info)
+	}
+}
+
+func TestAssociateAddress_MovesAddress(t *testing.T) {
+	client, address, _ := newAddressMock(t, map[string]string{TagNodeID: "i-1", TagReleaseWithNode: "true"})
+
+	info, err := AssociateAddress(context.Background(), client, "eipalloc-1", "i-2")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.InstanceID != "i-2" || info.NodeID != "i-2" || info.ReleaseWithNode {
+		t.Errorf("expected the address to move to i-2 without ReleaseWithNode, got %+v", info)
+	}
+
+	stored := newAddressInfo(*address)
+	if stored.NodeID != "i-2" || stored.ReleaseWithNode {
+		t.Errorf("expected tags to follow the address, got %v", stored.Tags)
+	}
+}
+
+func TestReleaseAddress_Associated(t *testing.T) {
+	client, _, released := newAddressMock(t, nil)
+
+	if _, err := AssociateAddress(context.Background(), client, "eipalloc-1", "i-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := ReleaseAddress(context.Background(), client, "eipalloc-1"); !errors.Is(err, ErrAddressInUse) {
+		t.Errorf("expected ErrAddressInUse, got %v", err)
+	}
+
+	if _, err := DisassociateAddress(context.Background(), client, "eipalloc-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := DisassociateAddress(context.Background(), client, "eipalloc-1"); !errors.Is(err, ErrAddressNotAssociated) {
+		t.Errorf("expected ErrAddressNotAssociated, got %v", err)
+	}
+	if err := ReleaseAddress(context.Background(), client, "eipalloc-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(*released) != 1 {
+		t.Errorf("expected the address to be released, got %v", *released)
+	}
+}
+
+func TestReleaseNodeAddresses(t *testing.T) {
+	client, address, released := newAddressMock(t, map[string]string{TagNodeID: "i-1", TagReleaseWithNode: "true"})
+	address.AssociationId = aws.String("eipassoc-1")
+	address.InstanceId = aws.String("i-1")
+
+	addresses, err := ReleaseNodeAddresses(context.Background(), client, "i-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(addresses) != 1 || len(*released) != 1 {
+		t.Errorf("expected one released address, got %+v", addresses)
+	}
+	if address.AssociationId != nil {
+		t.Error("expected the address to be disassociated before release")
+	}
+
+	// Addresses not released with the node are kept
+	client, _, released = newAddressMock(t, map[string]string{TagNodeID: "i-1"})
+	if _, err := ReleaseNodeAddresses(context.Background(), client, "i-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(*released) != 0 {
+		t.Errorf("expected no released address, got %v", *released)
+	}
+}
@@ -0,0 +1,68 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/cassette"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// TestNodeLifecycle_Cassette replays a create, wait, list, get and delete of
+// a node. The cassette is synthetic; record it with TILMAN_RECORD_CASSETTES=1
+// to replace it, and again after changing the calls. The AMI has to exist
+// in the recording account.
+func TestNodeLifecycle_Cassette(t *testing.T) {
+	client := cassette.EC2(t, "testdata/cassettes/nodes.json")
+	ctx := context.Background()
+	const amiID = "ami-0c1d2e3f4a5b6c7d8"
+
+	created, err := CreateInstance(ctx, client, CreateInstanceConfig{
+		Name:         "web",
+		ImageID:      amiID,
+		InstanceType: types.InstanceTypeT4gMicro,
+		UserData:     "#cloud-config\npackages:\n  - nginx\n",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if created.State != "pending" || created.Name != "web" {
+		t.Errorf("expected a pending node named web, got %+v", created)
+	}
+
+	running, err := WaitForInstance(ctx, client, created.InstanceID, WaitOptions{
+		TargetStates:    []types.InstanceStateName{types.InstanceStateNameRunning},
+		InitialInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if running.PublicIP != "3.120.45.67" {
+		t.Errorf("expected the public IP of the running node, got %q", running.PublicIP)
+	}
+
+	instances, err := ListInstances(ctx, client)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(instances) != 2 || instances[1].Name != "db" || instances[1].StateReasonCode != "Client.UserInitiatedShutdown" {
+		t.Errorf("expected web and the stopped db node, got %+v", instances)
+	}
+
+	info, err := GetInstance(ctx, client, created.InstanceID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.ImageID != "3f9c2a71d4e8b605" || info.AvailabilityZone != "eu-central-1a" {
+		t.Errorf("expected the ImageID of the AMI and the zone, got %+v", info)
+	}
+
+	if err := DeleteInstance(ctx, client, created.InstanceID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := GetInstance(ctx, client, "i-0ffffffffffffffff"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package ec2
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// MaxConsoleOutput is how much serial console output EC2 keeps per
+// instance; older output is dropped.
+const MaxConsoleOutput = 64 << 10
+
+// ConsoleOutput is the serial console output of an instance.
+type ConsoleOutput struct {
+	InstanceID string
+	Output     string
+	// Timestamp is when the output was last updated; zero while the
+	// instance has not written any
+	Timestamp time.Time
+}
+
+// GetConsoleOutput returns the decoded serial console output of an
+// instance. EC2 buffers the output, which lags behind by a few minutes;
+// latest asks for the most recent output instead, which only Nitro
+// instances support.
+func GetConsoleOutput(ctx context.Context, client EC2Client, instanceID string, latest bool) (ConsoleOutput, error) {
+	input := &awsec2.GetConsoleOutputInput{InstanceId: aws.String(instanceID)}
+	if latest {
+		input.Latest = aws.Bool(true)
+	}
+	result, err := client.GetConsoleOutput(ctx, input)
+	if err != nil {
+		if isInstanceNotFoundError(err) {
+			return ConsoleOutput{}, fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+		}
+		slog.Error("Failed to get console output", "instance_id", instanceID, "error", err)
+		return ConsoleOutput{}, fmt.Errorf("failed to get console output: %w", err)
+	}
+
+	output, err := base64.StdEncoding.DecodeString(aws.ToString(result.Output))
+	if err != nil {
+		return ConsoleOutput{}, fmt.Errorf("failed to decode console output: %w", err)
+	}
+	return ConsoleOutput{
+		InstanceID: instanceID,
+		Output:     string(output),
+		Timestamp:  aws.ToTime(result.Timestamp),
+	}, nil
+}
+
+// GetConsoleScreenshot returns a screenshot of an instance's display as a
+// PNG. EC2 captures it as a JPEG.
+func GetConsoleScreenshot(ctx context.Context, client EC2Client, instanceID string) ([]byte, error) {
+	result, err := client.GetConsoleScreenshot(ctx, &awsec2.GetConsoleScreenshotInput{
+		InstanceId: aws.String(instanceID),
+		// Wake up a display that went to sleep, rather than capture it blank
+		WakeUp: aws.Bool(true),
+	})
+	if err != nil {
+		if isInstanceNotFoundError(err) {
+			return nil, fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+		}
+		slog.Error("Failed to get console screenshot", "instance_id", instanceID, "error", err)
+		return nil, fmt.Errorf("failed to get console screenshot: %w", err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(aws.ToString(result.ImageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode console screenshot: %w", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode console screenshot: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode console screenshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ConsoleFollower picks the new lines out of successive console outputs of
+// an instance, e.g. to follow them while polling. The output only holds the
+// most recent MaxConsoleOutput bytes, so the lines seen before are found by
+// the last of them rather than as a prefix.
+type ConsoleFollower struct {
+	seen string
+}
+
+// followAnchorLines is how many of the last seen lines are looked for to
+// find where the output continues; fewer are tried when the oldest of them
+// were dropped.
+const followAnchorLines = 3
+
+// Next returns the complete lines of output that were not returned before.
+// A trailing partial line is held back until it is complete.
+func (f *ConsoleFollower) Next(output string) string {
+	output = output[:strings.LastIndex(output, "\n")+1]
+	if output == "" {
+		return ""
+	}
+
+	seen := f.seen
+	f.seen = output
+	if strings.HasPrefix(output, seen) {
+		return output[len(seen):]
+	}
+
+	// The last element is the empty string after the final newline
+	lines := strings.SplitAfter(seen, "\n")
+	lines = lines[:len(lines)-1]
+	for n := min(followAnchorLines, len(lines)); n > 0; n-- {
+		// Anchors match whole lines only
+		anchor := "\n" + strings.Join(lines[len(lines)-n:], "")
+		if i := strings.LastIndex("\n"+output, anchor); i >= 0 {
+			return output[i+len(anchor)-1:]
+		}
+	}
+	// Everything seen before has been dropped
+	return output
+}
@@ -0,0 +1,96 @@
+package ec2
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/smithy-go"
+)
+
+func TestGetConsoleOutput(t *testing.T) {
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockClient := &MockEC2Client{
+		GetConsoleOutputFunc: func(ctx context.Context, params *awsec2.GetConsoleOutputInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleOutputOutput, error) {
+			if !aws.ToBool(params.Latest) {
+				t.Error("expected the latest output to be requested")
+			}
+			return &awsec2.GetConsoleOutputOutput{
+				InstanceId: params.InstanceId,
+				Output:     aws.String(base64.StdEncoding.EncodeToString([]byte("web login: \n"))),
+				Timestamp:  aws.Time(timestamp),
+			}, nil
+		},
+	}
+
+	output, err := GetConsoleOutput(context.Background(), mockClient, "i-1", true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if output.Output != "web login: \n" || !output.Timestamp.Equal(timestamp) {
+		t.Errorf("expected the decoded output, got %+v", output)
+	}
+}
+
+func TestGetConsoleOutput_NotFound(t *testing.T) {
+	mockClient := &MockEC2Client{
+		GetConsoleOutputFunc: func(ctx context.Context, params *awsec2.GetConsoleOutputInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleOutputOutput, error) {
+			return nil, &smithy.GenericAPIError{Code: "InvalidInstanceID.NotFound"}
+		},
+	}
+
+	if _, err := GetConsoleOutput(context.Background(), mockClient, "i-1", false); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+}
+
+func TestGetConsoleScreenshot(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatalf("failed to encode JPEG: %v", err)
+	}
+	mockClient := &MockEC2Client{
+		GetConsoleScreenshotFunc: func(ctx context.Context, params *awsec2.GetConsoleScreenshotInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleScreenshotOutput, error) {
+			return &awsec2.GetConsoleScreenshotOutput{
+				InstanceId: params.InstanceId,
+				ImageData:  aws.String(base64.StdEncoding.EncodeToString(jpg.Bytes())),
+			}, nil
+		},
+	}
+
+	screenshot, err := GetConsoleScreenshot(context.Background(), mockClient, "i-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.HasPrefix(screenshot, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Errorf("expected a PNG, got %q", screenshot[:min(8, len(screenshot))])
+	}
+}
+
+func TestConsoleFollower_Next(t *testing.T) {
+	var follower ConsoleFollower
+	steps := []struct {
+		output   string
+		expected string
+	}{
+		{"one\ntwo\nthr", "one\ntwo\n"},
+		{"one\ntwo\nthree\n", "three\n"},
+		{"one\ntwo\nthree\n", ""},
+		// The oldest lines were dropped
+		{"two\nthree\nfour\n", "four\n"},
+		// Nothing seen before is left
+		{"seven\neight\n", "seven\neight\n"},
+	}
+	for i, step := range steps {
+		if got := follower.Next(step.output); got != step.expected {
+			t.Errorf("step %d: expected %q, got %q", i, step.expected, got)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	mathrand "math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// Error codes EC2 answers with when throttling, out of capacity or asked
+// for an instance it does not know (yet).
+const (
+	ErrorCodeRequestLimitExceeded         = "RequestLimitExceeded"
+	ErrorCodeInsufficientInstanceCapacity = "InsufficientInstanceCapacity"
+	ErrorCodeInstanceNotFound             = "InvalidInstanceID.NotFound"
+)
+
+// faultMessages are the messages EC2 sends with the injected error codes.
+var faultMessages = map[string]string{
+	ErrorCodeRequestLimitExceeded:         "Request limit exceeded.",
+	ErrorCodeInsufficientInstanceCapacity: "We currently do not have sufficient capacity in the Availability Zone you requested.",
+	ErrorCodeInstanceNotFound:             "The instance ID does not exist",
+}
+
+// Fault fails matching calls with an AWS API error.
+type Fault struct {
+	// Code is the AWS error code, e.g. ErrorCodeRequestLimitExceeded
+	Code string
+	// Message defaults to the message EC2 sends with Code
+	Message string
+	// Operations limits the fault to these operations, e.g. RunInstances;
+	// every operation matches when empty
+	Operations []string
+	// Rate is the probability of a matching call failing; 0 fails every
+	// matching call
+	Rate float64
+	// Times limits how many calls fail; 0 is unlimited
+	Times int
+}
+
+// FaultConfig describes the faults a FaultClient injects.
+type FaultConfig struct {
+	Faults []Fault
+	// Latency delays every call, plus up to Jitter more
+	Latency time.Duration
+	Jitter  time.Duration
+	// Visibility hides new instances from DescribeInstances for a while
+	// after RunInstances, like EC2's eventual consistency does
+	Visibility time.Duration
+}
+
+// FaultClient wraps an EC2Client and injects AWS-shaped errors, latency
+// and eventual consistency, to test how callers cope with them.
+type FaultClient struct {
+	Client EC2Client
+	Config FaultConfig
+
+	mu       sync.Mutex
+	injected []int
+	hidden   map[string]time.Time
+	now      func() time.Time
+}
+
+func NewFaultClient(client EC2Client, config FaultConfig) *FaultClient {
+	return &FaultClient{
+		Client:   client,
+		Config:   config,
+		injected: make([]int, len(config.Faults)),
+		hidden:   make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// inject delays the call and returns the first fault that fires for it.
+func (c *FaultClient) inject(ctx context.Context, operation string) error {
+	if delay := c.delay(); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, fault := range c.Config.Faults {
+		if len(fault.Operations) > 0 && !slices.Contains(fault.Operations, operation) {
+			continue
+		}
+		if fault.Times > 0 && c.injected[i] >= fault.Times {
+			continue
+		}
+		if fault.Rate > 0 && mathrand.Float64() >= fault.Rate {
+			continue
+		}
+		c.injected[i]++
+		return faultError(fault.Code, fault.Message)
+	}
+	return nil
+}
+
+func (c *FaultClient) delay() time.Duration {
+	delay := c.Config.Latency
+	if c.Config.Jitter > 0 {
+		delay += mathrand.N(c.Config.Jitter)
+	}
+	return delay
+}
+
+func faultError(code, message string) error {
+	if message == "" {
+		message = faultMessages[code]
+	}
+	fault := smithy.FaultClient
+	if code == ErrorCodeInsufficientInstanceCapacity {
+		fault = smithy.FaultServer
+	}
+	return &smithy.GenericAPIError{Code: code, Message: message, Fault: fault}
+}
+
+// Injected returns how often each fault of the configuration fired.
+func (c *FaultClient) Injected() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.injected)
+}
+
+func (c *FaultClient) RunInstances(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+	if err := c.inject(ctx, "RunInstances"); err != nil {
+		return nil, err
+	}
+	out, err := c.Client.RunInstances(ctx, params, optFns...)
+	if err != nil || c.Config.Visibility <= 0 {
+		return out, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	visible := c.now().Add(c.Config.Visibility)
+	for _, instance := range out.Instances {
+		c.hidden[aws.ToString(instance.InstanceId)] = visible
+	}
+	return out, nil
+}
+
+// DescribeInstances answers like EC2 right after a launch: asking for a
+// hidden instance by ID fails with InvalidInstanceID.NotFound, listing
+// leaves it out.
+func (c *FaultClient) DescribeInstances(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+	if err := c.inject(ctx, "DescribeInstances"); err != nil {
+		return nil, err
+	}
+	hidden := c.hiddenInstances()
+	for _, id := range params.InstanceIds {
+		if hidden[id] {
+			return nil, faultError(ErrorCodeInstanceNotFound, fmt.Sprintf("The instance ID '%s' does not exist", id))
+		}
+	}
+
+	out, err := c.Client.DescribeInstances(ctx, params, optFns...)
+	if err != nil || len(hidden) == 0 {
+		return out, err
+	}
+	var reservations []types.Reservation
+	for _, reservation := range out.Reservations {
+		reservation.Instances = slices.DeleteFunc(slices.Clone(reservation.Instances), func(instance types.Instance) bool {
+			return hidden[aws.ToString(instance.InstanceId)]
+		})
+		if len(reservation.Instances) > 0 {
+			reservations = append(reservations, reservation)
+		}
+	}
+	filtered := *out
+	filtered.Reservations = reservations
+	return &filtered, nil
+}
+
+// hiddenInstances returns the instances not visible yet and forgets the
+// ones that became visible.
+func (c *FaultClient) hiddenInstances() map[string]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	hidden := make(map[string]bool)
+	for id, visible := range c.hidden {
+		if now.Before(visible) {
+			hidden[id] = true
+		} else {
+			delete(c.hidden, id)
+		}
+	}
+	return hidden
+}
+
+// ParseFaultConfig reads a chaos specification: comma-separated settings
+// latency=DURATION, jitter=DURATION and visibility=DURATION, and faults
+// CODE=RATE, optionally limited to operations with CODE=RATE@Op1|Op2.
+// For example:
+//
+//	RequestLimitExceeded=0.1,InsufficientInstanceCapacity=0.2@RunInstances,latency=200ms,visibility=5s
+func ParseFaultConfig(spec string) (FaultConfig, error) {
+	var config FaultConfig
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return FaultConfig{}, fmt.Errorf("invalid fault setting %q, expected key=value", item)
+		}
+
+		switch key {
+		case "latency", "jitter", "visibility":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return FaultConfig{}, fmt.Errorf("invalid %s %q", key, value)
+			}
+			switch key {
+			case "latency":
+				config.Latency = d
+			case "jitter":
+				config.Jitter = d
+			default:
+				config.Visibility = d
+			}
+		default:
+			rate, operations, _ := strings.Cut(value, "@")
+			fault := Fault{Code: key}
+			r, err := strconv.ParseFloat(rate, 64)
+			if err != nil || r <= 0 || r > 1 {
+				return FaultConfig{}, fmt.Errorf("invalid rate %q for %s, expected a probability in (0, 1]", rate, key)
+			}
+			fault.Rate = r
+			if operations != "" {
+				fault.Operations = strings.Split(operations, "|")
+			}
+			config.Faults = append(config.Faults, fault)
+		}
+	}
+	return config, nil
+}
+
+func (c *FaultClient) TerminateInstances(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+	if err := c.inject(ctx, "TerminateInstances"); err != nil {
+		return nil, err
+	}
+	return c.Client.TerminateInstances(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DescribeImages(ctx context.Context, params *awsec2.DescribeImagesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeImagesOutput, error) {
+	if err := c.inject(ctx, "DescribeImages"); err != nil {
+		return nil, err
+	}
+	return c.Client.DescribeImages(ctx, params, optFns...)
+}
+
+func (c *FaultClient) StartInstances(ctx context.Context, params *awsec2.StartInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StartInstancesOutput, error) {
+	if err := c.inject(ctx, "StartInstances"); err != nil {
+		return nil, err
+	}
+	return c.Client.StartInstances(ctx, params, optFns...)
+}
+
+func (c *FaultClient) StopInstances(ctx context.Context, params *awsec2.StopInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StopInstancesOutput, error) {
+	if err := c.inject(ctx, "StopInstances"); err != nil {
+		return nil, err
+	}
+	return c.Client.StopInstances(ctx, params, optFns...)
+}
+
+func (c *FaultClient) RebootInstances(ctx context.Context, params *awsec2.RebootInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RebootInstancesOutput, error) {
+	if err := c.inject(ctx, "RebootInstances"); err != nil {
+		return nil, err
+	}
+	return c.Client.RebootInstances(ctx, params, optFns...)
+}
+
+func (c *FaultClient) ImportKeyPair(ctx context.Context, params *awsec2.ImportKeyPairInput, optFns ...func(*awsec2.Options)) (*awsec2.ImportKeyPairOutput, error) {
+	if err := c.inject(ctx, "ImportKeyPair"); err != nil {
+		return nil, err
+	}
+	return c.Client.ImportKeyPair(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DescribeKeyPairs(ctx context.Context, params *awsec2.DescribeKeyPairsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeKeyPairsOutput, error) {
+	if err := c.inject(ctx, "DescribeKeyPairs"); err != nil {
+		return nil, err
+	}
+	return c.Client.DescribeKeyPairs(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DeleteKeyPair(ctx context.Context, params *awsec2.DeleteKeyPairInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteKeyPairOutput, error) {
+	if err := c.inject(ctx, "DeleteKeyPair"); err != nil {
+		return nil, err
+	}
+	return c.Client.DeleteKeyPair(ctx, params, optFns...)
+}
+
+func (c *FaultClient) CreateSecurityGroup(ctx context.Context, params *awsec2.CreateSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateSecurityGroupOutput, error) {
+	if err := c.inject(ctx, "CreateSecurityGroup"); err != nil {
+		return nil, err
+	}
+	return c.Client.CreateSecurityGroup(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DeleteSecurityGroup(ctx context.Context, params *awsec2.DeleteSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteSecurityGroupOutput, error) {
+	if err := c.inject(ctx, "DeleteSecurityGroup"); err != nil {
+		return nil, err
+	}
+	return c.Client.DeleteSecurityGroup(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DescribeSecurityGroups(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+	if err := c.inject(ctx, "DescribeSecurityGroups"); err != nil {
+		return nil, err
+	}
+	return c.Client.DescribeSecurityGroups(ctx, params, optFns...)
+}
+
+func (c *FaultClient) AuthorizeSecurityGroupIngress(ctx context.Context, params *awsec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.AuthorizeSecurityGroupIngressOutput, error) {
+	if err := c.inject(ctx, "AuthorizeSecurityGroupIngress"); err != nil {
+		return nil, err
+	}
+	return c.Client.AuthorizeSecurityGroupIngress(ctx, params, optFns...)
+}
+
+func (c *FaultClient) RevokeSecurityGroupIngress(ctx context.Context, params *awsec2.RevokeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.RevokeSecurityGroupIngressOutput, error) {
+	if err := c.inject(ctx, "RevokeSecurityGroupIngress"); err != nil {
+		return nil, err
+	}
+	return c.Client.RevokeSecurityGroupIngress(ctx, params, optFns...)
+}
+
+func (c *FaultClient) ModifyInstanceAttribute(ctx context.Context, params *awsec2.ModifyInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.ModifyInstanceAttributeOutput, error) {
+	if err := c.inject(ctx, "ModifyInstanceAttribute"); err != nil {
+		return nil, err
+	}
+	return c.Client.ModifyInstanceAttribute(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DescribeInstanceStatus(ctx context.Context, params *awsec2.DescribeInstanceStatusInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceStatusOutput, error) {
+	if err := c.inject(ctx, "DescribeInstanceStatus"); err != nil {
+		return nil, err
+	}
+	return c.Client.DescribeInstanceStatus(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DescribeSpotInstanceRequests(ctx context.Context, params *awsec2.DescribeSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSpotInstanceRequestsOutput, error) {
+	if err := c.inject(ctx, "DescribeSpotInstanceRequests"); err != nil {
+		return nil, err
+	}
+	return c.Client.DescribeSpotInstanceRequests(ctx, params, optFns...)
+}
+
+func (c *FaultClient) CancelSpotInstanceRequests(ctx context.Context, params *awsec2.CancelSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.CancelSpotInstanceRequestsOutput, error) {
+	if err := c.inject(ctx, "CancelSpotInstanceRequests"); err != nil {
+		return nil, err
+	}
+	return c.Client.CancelSpotInstanceRequests(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DescribeInstanceAttribute(ctx context.Context, params *awsec2.DescribeInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceAttributeOutput, error) {
+	if err := c.inject(ctx, "DescribeInstanceAttribute"); err != nil {
+		return nil, err
+	}
+	return c.Client.DescribeInstanceAttribute(ctx, params, optFns...)
+}
+
+func (c *FaultClient) CreateVolume(ctx context.Context, params *awsec2.CreateVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateVolumeOutput, error) {
+	if err := c.inject(ctx, "CreateVolume"); err != nil {
+		return nil, err
+	}
+	return c.Client.CreateVolume(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DescribeVolumes(ctx context.Context, params *awsec2.DescribeVolumesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeVolumesOutput, error) {
+	if err := c.inject(ctx, "DescribeVolumes"); err != nil {
+		return nil, err
+	}
+	return c.Client.DescribeVolumes(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DeleteVolume(ctx context.Context, params *awsec2.DeleteVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteVolumeOutput, error) {
+	if err := c.inject(ctx, "DeleteVolume"); err != nil {
+		return nil, err
+	}
+	return c.Client.DeleteVolume(ctx, params, optFns...)
+}
+
+func (c *FaultClient) AttachVolume(ctx context.Context, params *awsec2.AttachVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.AttachVolumeOutput, error) {
+	if err := c.inject(ctx, "AttachVolume"); err != nil {
+		return nil, err
+	}
+	return c.Client.AttachVolume(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DetachVolume(ctx context.Context, params *awsec2.DetachVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.DetachVolumeOutput, error) {
+	if err := c.inject(ctx, "DetachVolume"); err != nil {
+		return nil, err
+	}
+	return c.Client.DetachVolume(ctx, params, optFns...)
+}
+
+func (c *FaultClient) AllocateAddress(ctx context.Context, params *awsec2.AllocateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AllocateAddressOutput, error) {
+	if err := c.inject(ctx, "AllocateAddress"); err != nil {
+		return nil, err
+	}
+	return c.Client.AllocateAddress(ctx, params, optFns...)
+}
+
+func (c *FaultClient) AssociateAddress(ctx context.Context, params *awsec2.AssociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AssociateAddressOutput, error) {
+	if err := c.inject(ctx, "AssociateAddress"); err != nil {
+		return nil, err
+	}
+	return c.Client.AssociateAddress(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DisassociateAddress(ctx context.Context, params *awsec2.DisassociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.DisassociateAddressOutput, error) {
+	if err := c.inject(ctx, "DisassociateAddress"); err != nil {
+		return nil, err
+	}
+	return c.Client.DisassociateAddress(ctx, params, optFns...)
+}
+
+func (c *FaultClient) ReleaseAddress(ctx context.Context, params *awsec2.ReleaseAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.ReleaseAddressOutput, error) {
+	if err := c.inject(ctx, "ReleaseAddress"); err != nil {
+		return nil, err
+	}
+	return c.Client.ReleaseAddress(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DescribeAddresses(ctx context.Context, params *awsec2.DescribeAddressesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeAddressesOutput, error) {
+	if err := c.inject(ctx, "DescribeAddresses"); err != nil {
+		return nil, err
+	}
+	return c.Client.DescribeAddresses(ctx, params, optFns...)
+}
+
+func (c *FaultClient) CreateTags(ctx context.Context, params *awsec2.CreateTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateTagsOutput, error) {
+	if err := c.inject(ctx, "CreateTags"); err != nil {
+		return nil, err
+	}
+	return c.Client.CreateTags(ctx, params, optFns...)
+}
+
+func (c *FaultClient) DeleteTags(ctx context.Context, params *awsec2.DeleteTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteTagsOutput, error) {
+	if err := c.inject(ctx, "DeleteTags"); err != nil {
+		return nil, err
+	}
+	return c.Client.DeleteTags(ctx, params, optFns...)
+}
+
+func (c *FaultClient) GetConsoleOutput(ctx context.Context, params *awsec2.GetConsoleOutputInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleOutputOutput, error) {
+	if err := c.inject(ctx, "GetConsoleOutput"); err != nil {
+		return nil, err
+	}
+	return c.Client.GetConsoleOutput(ctx, params, optFns...)
+}
+
+func (c *FaultClient) GetConsoleScreenshot(ctx context.Context, params *awsec2.GetConsoleScreenshotInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleScreenshotOutput, error) {
+	if err := c.inject(ctx, "GetConsoleScreenshot"); err != nil {
+		return nil, err
+	}
+	return c.Client.GetConsoleScreenshot(ctx, params, optFns...)
+}
+
+func (c *FaultClient) UpdateSecurityGroupRuleDescriptionsIngress(ctx context.Context, params *awsec2.UpdateSecurityGroupRuleDescriptionsIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.UpdateSecurityGroupRuleDescriptionsIngressOutput, error) {
+	if err := c.inject(ctx, "UpdateSecurityGroupRuleDescriptionsIngress"); err != nil {
+		return nil, err
+	}
+	return c.Client.UpdateSecurityGroupRuleDescriptionsIngress(ctx, params, optFns...)
+}
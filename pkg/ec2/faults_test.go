@@ -0,0 +1,155 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func describeRunning(ids ...string) func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+	return func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+		var instances []types.Instance
+		for _, id := range ids {
+			if len(params.InstanceIds) == 0 || params.InstanceIds[0] == id {
+				instances = append(instances, types.Instance{
+					InstanceId: aws.String(id),
+					State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+				})
+			}
+		}
+		return &awsec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: instances}}}, nil
+	}
+}
+
+func TestFaultClient_Faults(t *testing.T) {
+	mock := &MockEC2Client{
+		DescribeInstancesFunc: describeRunning("i-1"),
+		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+			return &awsec2.TerminateInstancesOutput{TerminatingInstances: []types.InstanceStateChange{{
+				InstanceId:    aws.String("i-1"),
+				PreviousState: &types.InstanceState{Name: types.InstanceStateNameRunning},
+				CurrentState:  &types.InstanceState{Name: types.InstanceStateNameShuttingDown},
+			}}}, nil
+		},
+	}
+	client := NewFaultClient(mock, FaultConfig{Faults: []Fault{
+		{Code: ErrorCodeRequestLimitExceeded, Operations: []string{"DescribeInstances"}, Times: 2},
+	}})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := ListInstances(ctx, client); !hasErrorCode(err, ErrorCodeRequestLimitExceeded) {
+			t.Errorf("call %d: expected RequestLimitExceeded, got %v", i+1, err)
+		}
+	}
+	if _, err := ListInstances(ctx, client); err != nil {
+		t.Errorf("expected the third call to pass, got %v", err)
+	}
+	if err := DeleteInstance(ctx, client, "i-1"); err != nil {
+		t.Errorf("expected other operations to pass, got %v", err)
+	}
+	if injected := client.Injected(); injected[0] != 2 {
+		t.Errorf("expected 2 injected faults, got %v", injected)
+	}
+}
+
+func TestFaultClient_InsufficientCapacity(t *testing.T) {
+	client := NewFaultClient(&MockEC2Client{}, FaultConfig{Faults: []Fault{
+		{Code: ErrorCodeInsufficientInstanceCapacity, Operations: []string{"RunInstances"}, Rate: 1},
+	}})
+
+	_, err := CreateInstance(context.Background(), client, CreateInstanceConfig{ImageID: "ami-1", InstanceType: types.InstanceTypeT4gMicro})
+	if !hasErrorCode(err, ErrorCodeInsufficientInstanceCapacity) {
+		t.Errorf("expected InsufficientInstanceCapacity, got %v", err)
+	}
+}
+
+func TestFaultClient_Visibility(t *testing.T) {
+	mock := &MockEC2Client{
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			return &awsec2.RunInstancesOutput{Instances: []types.Instance{{
+				InstanceId: aws.String("i-new"),
+				State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+			}}}, nil
+		},
+		DescribeInstancesFunc: describeRunning("i-old", "i-new"),
+	}
+	client := NewFaultClient(mock, FaultConfig{Visibility: time.Minute})
+	now := time.Now()
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := CreateInstance(ctx, client, CreateInstanceConfig{ImageID: "ami-1"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := GetInstance(ctx, client, "i-new"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("expected the new instance to be invisible, got %v", err)
+	}
+	instances, err := ListInstances(ctx, client)
+	if err != nil || len(instances) != 1 || instances[0].InstanceID != "i-old" {
+		t.Errorf("expected only i-old to be listed, got %+v, %v", instances, err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := GetInstance(ctx, client, "i-new"); err != nil {
+		t.Errorf("expected the new instance to be visible, got %v", err)
+	}
+}
+
+func TestFaultClient_WaitThroughVisibility(t *testing.T) {
+	mock := &MockEC2Client{
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			return &awsec2.RunInstancesOutput{Instances: []types.Instance{{InstanceId: aws.String("i-new")}}}, nil
+		},
+		DescribeInstancesFunc: describeRunning("i-new"),
+	}
+	client := NewFaultClient(mock, FaultConfig{Visibility: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	info, err := CreateInstance(ctx, client, CreateInstanceConfig{ImageID: "ami-1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	info, err = WaitForInstance(ctx, client, info.InstanceID, WaitOptions{
+		TargetStates:    []types.InstanceStateName{types.InstanceStateNameRunning},
+		Timeout:         time.Second,
+		InitialInterval: 5 * time.Millisecond,
+	})
+	if err != nil || info.State != "running" {
+		t.Errorf("expected the wait to ride out eventual consistency, got %+v, %v", info, err)
+	}
+}
+
+func TestFaultClient_Latency(t *testing.T) {
+	client := NewFaultClient(&MockEC2Client{DescribeInstancesFunc: describeRunning("i-1")}, FaultConfig{Latency: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := ListInstances(ctx, client); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the slow call to hit the deadline, got %v", err)
+	}
+}
+
+func TestParseFaultConfig(t *testing.T) {
+	config, err := ParseFaultConfig("RequestLimitExceeded=0.1, InsufficientInstanceCapacity=0.5@RunInstances|StartInstances,latency=200ms,jitter=50ms,visibility=5s")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(config.Faults) != 2 || config.Faults[0].Rate != 0.1 || len(config.Faults[1].Operations) != 2 {
+		t.Errorf("unexpected faults %+v", config.Faults)
+	}
+	if config.Latency != 200*time.Millisecond || config.Jitter != 50*time.Millisecond || config.Visibility != 5*time.Second {
+		t.Errorf("unexpected delays %+v", config)
+	}
+
+	for _, spec := range []string{"latency", "latency=fast", "RequestLimitExceeded=2", "RequestLimitExceeded=0"} {
+		if _, err := ParseFaultConfig(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
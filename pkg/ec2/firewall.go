@@ -0,0 +1,427 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const TagNodeID = "NodeID"
+
+var ErrInvalidFirewallRule = errkind.New(errkind.InvalidInput, "invalid firewall rule")
+
+const (
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolICMP = "icmp"
+	ProtocolAll  = "all"
+)
+
+// FirewallRule is a single ingress rule. Exactly one of CIDR and
+// SourceGroupID is set. For ICMP, FromPort and ToPort carry the ICMP type
+// and code; for "all" they are ignored.
+type FirewallRule struct {
+	Protocol      string
+	FromPort      int32
+	ToPort        int32
+	CIDR          string
+	SourceGroupID string
+	Description   string
+}
+
+// key identifies the traffic a rule allows, which is what EC2 matches rules
+// by; the description is not part of it.
+func (r FirewallRule) key() string {
+	fromPort, toPort := r.FromPort, r.ToPort
+	if r.Protocol == ProtocolAll {
+		fromPort, toPort = 0, 0
+	}
+	return fmt.Sprintf("%s|%d|%d|%s|%s", r.Protocol, fromPort, toPort, r.CIDR, r.SourceGroupID)
+}
+
+func ValidateFirewallRules(rules []FirewallRule) error {
+	for i, rule := range rules {
+		if err := validateFirewallRule(rule); err != nil {
+			return fmt.Errorf("%w: rule %d: %v", ErrInvalidFirewallRule, i, err)
+		}
+	}
+	return nil
+}
+
+func validateFirewallRule(rule FirewallRule) error {
+	switch rule.Protocol {
+	case ProtocolTCP, ProtocolUDP:
+		if rule.FromPort < 0 || rule.ToPort > 65535 || rule.FromPort > rule.ToPort {
+			return fmt.Errorf("port range %d-%d must be within 0-65535 and ascending", rule.FromPort, rule.ToPort)
+		}
+	case ProtocolICMP:
+		if rule.FromPort < -1 || rule.FromPort > 255 || rule.ToPort < -1 || rule.ToPort > 255 {
+			return fmt.Errorf("ICMP type and code must be between -1 and 255")
+		}
+	case ProtocolAll:
+	default:
+		return fmt.Errorf("unsupported protocol %q", rule.Protocol)
+	}
+
+	if (rule.CIDR == "") == (rule.SourceGroupID == "") {
+		return fmt.Errorf("exactly one of cidr and sourceGroupId must be set")
+	}
+	if rule.CIDR != "" {
+		if _, err := netip.ParsePrefix(rule.CIDR); err != nil {
+			return fmt.Errorf("invalid CIDR %q: %v", rule.CIDR, err)
+		}
+	}
+	if rule.SourceGroupID != "" && !strings.HasPrefix(rule.SourceGroupID, "sg-") {
+		return fmt.Errorf("invalid security group ID %q", rule.SourceGroupID)
+	}
+	return nil
+}
+
+// FindNodeSecurityGroup returns the ID of the managed security group of a
+// node, or an empty string if the node has none yet.
+func FindNodeSecurityGroup(ctx context.Context, client EC2Client, instanceID string) (string, error) {
+	groups, err := describeManagedSecurityGroups(ctx, client, instanceID)
+	if err != nil {
+		return "", err
+	}
+	if len(groups) == 0 {
+		return "", nil
+	}
+	return getPtrStringValue(groups[0].GroupId), nil
+}
+
+// EnsureNodeSecurityGroup returns the managed security group of a node,
+// creating it and attaching it to the instance on first use. The managed
+// group replaces whatever groups the instance was launched with, so the
+// rules on it are the complete ingress policy of the node.
+func EnsureNodeSecurityGroup(ctx context.Context, client EC2Client, instanceID string) (string, error) {
+	groupID, err := FindNodeSecurityGroup(ctx, client, instanceID)
+	if err != nil {
+		return "", err
+	}
+	if groupID != "" {
+		return groupID, nil
+	}
+
+	info, err := GetInstance(ctx, client, instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("Creating node security group", "instance_id", instanceID, "vpc_id", info.VpcID)
+	createInput := &awsec2.CreateSecurityGroupInput{
+		GroupName:   aws.String("tilmancloud-node-" + instanceID),
+		Description: aws.String("Managed firewall for node " + instanceID),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeSecurityGroup,
+				Tags: []types.Tag{
+					{Key: aws.String(TagManagedBy), Value: aws.String(ManagedByValue)},
+					{Key: aws.String(TagNodeID), Value: aws.String(instanceID)},
+				},
+			},
+		},
+	}
+	if info.VpcID != "" {
+		createInput.VpcId = aws.String(info.VpcID)
+	}
+
+	createResult, err := client.CreateSecurityGroup(ctx, createInput)
+	if err != nil {
+		slog.Error("Failed to create security group", "instance_id", instanceID, "error", err)
+		return "", fmt.Errorf("failed to create security group: %w", err)
+	}
+	groupID = getPtrStringValue(createResult.GroupId)
+
+	_, err = client.ModifyInstanceAttribute(ctx, &awsec2.ModifyInstanceAttributeInput{
+		InstanceId: aws.String(instanceID),
+		Groups:     []string{groupID},
+	})
+	if err != nil {
+		slog.Error("Failed to attach security group", "instance_id", instanceID, "group_id", groupID, "error", err)
+		return "", fmt.Errorf("failed to attach security group: %w", err)
+	}
+
+	slog.Info("Node security group attached", "instance_id", instanceID, "group_id", groupID)
+	return groupID, nil
+}
+
+// GetFirewallRules returns the ingress rules of a node's managed security
+// group. A node without a managed group has no rules; ErrInstanceNotFound
+// is returned when there is no such node either.
+func GetFirewallRules(ctx context.Context, client EC2Client, instanceID string) (string, []FirewallRule, error) {
+	groups, err := describeManagedSecurityGroups(ctx, client, instanceID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(groups) == 0 {
+		if _, err := GetInstance(ctx, client, instanceID); err != nil {
+			return "", nil, err
+		}
+		return "", []FirewallRule{}, nil
+	}
+	return getPtrStringValue(groups[0].GroupId), flattenIpPermissions(groups[0].IpPermissions), nil
+}
+
+// SetFirewallRules reconciles the node's managed security group so that
+// its ingress rules match exactly the given set. Only the difference is
+// revoked and authorized, so unchanged rules never drop traffic; rules
+// whose description changed are updated in place.
+func SetFirewallRules(ctx context.Context, client EC2Client, instanceID string, rules []FirewallRule) (string, []FirewallRule, error) {
+	if err := ValidateFirewallRules(rules); err != nil {
+		return "", nil, err
+	}
+
+	groupID, err := EnsureNodeSecurityGroup(ctx, client, instanceID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, current, err := GetFirewallRules(ctx, client, instanceID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	desired := make(map[string]FirewallRule, len(rules))
+	for _, rule := range rules {
+		desired[rule.key()] = rule
+	}
+	existing := make(map[string]FirewallRule, len(current))
+	for _, rule := range current {
+		existing[rule.key()] = rule
+	}
+
+	var toRevoke, toAuthorize, toDescribe []FirewallRule
+	for key, rule := range existing {
+		want, ok := desired[key]
+		switch {
+		case !ok:
+			toRevoke = append(toRevoke, rule)
+		case want.Description != rule.Description:
+			toDescribe = append(toDescribe, want)
+		}
+	}
+	for key, rule := range desired {
+		if _, ok := existing[key]; !ok {
+			toAuthorize = append(toAuthorize, rule)
+		}
+	}
+
+	slog.Info("Reconciling firewall rules",
+		"instance_id", instanceID,
+		"group_id", groupID,
+		"revoke", len(toRevoke),
+		"authorize", len(toAuthorize),
+		"describe", len(toDescribe))
+
+	if len(toRevoke) > 0 {
+		_, err := client.RevokeSecurityGroupIngress(ctx, &awsec2.RevokeSecurityGroupIngressInput{
+			GroupId:       aws.String(groupID),
+			IpPermissions: toIpPermissions(toRevoke),
+		})
+		if err != nil {
+			slog.Error("Failed to revoke firewall rules", "group_id", groupID, "error", err)
+			return "", nil, fmt.Errorf("failed to revoke firewall rules: %w", err)
+		}
+	}
+
+	if len(toAuthorize) > 0 {
+		_, err := client.AuthorizeSecurityGroupIngress(ctx, &awsec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(groupID),
+			IpPermissions: toIpPermissions(toAuthorize),
+		})
+		if err != nil {
+			slog.Error("Failed to authorize firewall rules", "group_id", groupID, "error", err)
+			return "", nil, fmt.Errorf("failed to authorize firewall rules: %w", err)
+		}
+	}
+
+	if len(toDescribe) > 0 {
+		// Rules without a description have theirs removed
+		_, err := client.UpdateSecurityGroupRuleDescriptionsIngress(ctx, &awsec2.UpdateSecurityGroupRuleDescriptionsIngressInput{
+			GroupId:       aws.String(groupID),
+			IpPermissions: toIpPermissions(toDescribe),
+		})
+		if err != nil {
+			slog.Error("Failed to update firewall rule descriptions", "group_id", groupID, "error", err)
+			return "", nil, fmt.Errorf("failed to update firewall rule descriptions: %w", err)
+		}
+	}
+
+	return groupID, rules, nil
+}
+
+// DeleteNodeSecurityGroup deletes the managed security group of a node
+// that is being terminated. EC2 refuses to delete a group while an
+// instance still uses it, so this first waits for the instance to be
+// terminated, as bounded by opts.
+func DeleteNodeSecurityGroup(ctx context.Context, client EC2Client, instanceID, groupID string, opts WaitOptions) error {
+	opts.TargetStates = []types.InstanceStateName{types.InstanceStateNameTerminated}
+	if _, err := WaitForInstance(ctx, client, instanceID, opts); err != nil {
+		return err
+	}
+
+	slog.Info("Deleting node security group", "group_id", groupID, "instance_id", instanceID)
+	_, err := client.DeleteSecurityGroup(ctx, &awsec2.DeleteSecurityGroupInput{
+		GroupId: aws.String(groupID),
+	})
+	if err != nil {
+		slog.Error("Failed to delete security group", "group_id", groupID, "error", err)
+		return fmt.Errorf("failed to delete security group: %w", err)
+	}
+	return nil
+}
+
+// CleanupOrphanedSecurityGroups deletes managed node security groups whose
+// instance has been terminated. A group cannot be deleted while the
+// instance is still shutting down, so this is meant to be run periodically.
+func CleanupOrphanedSecurityGroups(ctx context.Context, client EC2Client) error {
+	groups, err := describeManagedSecurityGroups(ctx, client, "")
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		groupID := getPtrStringValue(group.GroupId)
+		instanceID := ""
+		for _, tag := range group.Tags {
+			if getPtrStringValue(tag.Key) == TagNodeID {
+				instanceID = getPtrStringValue(tag.Value)
+			}
+		}
+		if instanceID == "" {
+			continue
+		}
+
+		info, err := GetInstance(ctx, client, instanceID)
+		if err != nil && !errors.Is(err, ErrInstanceNotFound) {
+			slog.Warn("Failed to check node of security group", "group_id", groupID, "instance_id", instanceID, "error", err)
+			continue
+		}
+		if err == nil && info.State != string(types.InstanceStateNameTerminated) {
+			continue
+		}
+
+		slog.Info("Deleting orphaned node security group", "group_id", groupID, "instance_id", instanceID)
+		_, err = client.DeleteSecurityGroup(ctx, &awsec2.DeleteSecurityGroupInput{
+			GroupId: aws.String(groupID),
+		})
+		if err != nil {
+			slog.Warn("Failed to delete security group", "group_id", groupID, "error", err)
+		}
+	}
+	return nil
+}
+
+func describeManagedSecurityGroups(ctx context.Context, client EC2Client, instanceID string) ([]types.SecurityGroup, error) {
+	filters := []types.Filter{
+		{
+			Name:   aws.String("tag:" + TagManagedBy),
+			Values: []string{ManagedByValue},
+		},
+	}
+	if instanceID != "" {
+		filters = append(filters, types.Filter{
+			Name:   aws.String("tag:" + TagNodeID),
+			Values: []string{instanceID},
+		})
+	}
+
+	result, err := client.DescribeSecurityGroups(ctx, &awsec2.DescribeSecurityGroupsInput{
+		Filters: filters,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe security groups: %w", err)
+	}
+	return result.SecurityGroups, nil
+}
+
+func flattenIpPermissions(permissions []types.IpPermission) []FirewallRule {
+	rules := []FirewallRule{}
+	for _, permission := range permissions {
+		base := FirewallRule{
+			Protocol: fromIpProtocol(getPtrStringValue(permission.IpProtocol)),
+		}
+		if base.Protocol != ProtocolAll {
+			base.FromPort = aws.ToInt32(permission.FromPort)
+			base.ToPort = aws.ToInt32(permission.ToPort)
+		}
+
+		for _, ipRange := range permission.IpRanges {
+			rule := base
+			rule.CIDR = getPtrStringValue(ipRange.CidrIp)
+			rule.Description = getPtrStringValue(ipRange.Description)
+			rules = append(rules, rule)
+		}
+		for _, ipRange := range permission.Ipv6Ranges {
+			rule := base
+			rule.CIDR = getPtrStringValue(ipRange.CidrIpv6)
+			rule.Description = getPtrStringValue(ipRange.Description)
+			rules = append(rules, rule)
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			rule := base
+			rule.SourceGroupID = getPtrStringValue(pair.GroupId)
+			rule.Description = getPtrStringValue(pair.Description)
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func toIpPermissions(rules []FirewallRule) []types.IpPermission {
+	permissions := make([]types.IpPermission, 0, len(rules))
+	for _, rule := range rules {
+		permission := types.IpPermission{
+			IpProtocol: aws.String(toIpProtocol(rule.Protocol)),
+		}
+		if rule.Protocol != ProtocolAll {
+			permission.FromPort = aws.Int32(rule.FromPort)
+			permission.ToPort = aws.Int32(rule.ToPort)
+		}
+
+		var description *string
+		if rule.Description != "" {
+			description = aws.String(rule.Description)
+		}
+
+		switch {
+		case rule.SourceGroupID != "":
+			permission.UserIdGroupPairs = []types.UserIdGroupPair{
+				{GroupId: aws.String(rule.SourceGroupID), Description: description},
+			}
+		case strings.Contains(rule.CIDR, ":"):
+			permission.Ipv6Ranges = []types.Ipv6Range{
+				{CidrIpv6: aws.String(rule.CIDR), Description: description},
+			}
+		default:
+			permission.IpRanges = []types.IpRange{
+				{CidrIp: aws.String(rule.CIDR), Description: description},
+			}
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions
+}
+
+func toIpProtocol(protocol string) string {
+	if protocol == ProtocolAll {
+		return "-1"
+	}
+	return protocol
+}
+
+func fromIpProtocol(ipProtocol string) string {
+	if ipProtocol == "-1" {
+		return ProtocolAll
+	}
+	return ipProtocol
+}
@@ -0,0 +1,269 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestValidateFirewallRules(t *testing.T) {
+	valid := []FirewallRule{
+		{Protocol: ProtocolTCP, FromPort: 22, ToPort: 22, CIDR: "203.0.113.0/24"},
+		{Protocol: ProtocolUDP, FromPort: 60000, ToPort: 61000, CIDR: "::/0"},
+		{Protocol: ProtocolICMP, FromPort: -1, ToPort: -1, CIDR: "10.0.0.0/8"},
+		{Protocol: ProtocolAll, SourceGroupID: "sg-0123456789abcdef0"},
+	}
+	if err := ValidateFirewallRules(valid); err != nil {
+		t.Errorf("expected rules to be valid, got %v", err)
+	}
+
+	invalid := []FirewallRule{
+		{Protocol: "sctp", FromPort: 22, ToPort: 22, CIDR: "0.0.0.0/0"},
+		{Protocol: ProtocolTCP, FromPort: 443, ToPort: 80, CIDR: "0.0.0.0/0"},
+		{Protocol: ProtocolTCP, FromPort: 22, ToPort: 22},
+		{Protocol: ProtocolTCP, FromPort: 22, ToPort: 22, CIDR: "0.0.0.0/0", SourceGroupID: "sg-0123456789abcdef0"},
+		{Protocol: ProtocolTCP, FromPort: 22, ToPort: 22, CIDR: "not-a-cidr"},
+	}
+	for _, rule := range invalid {
+		if err := ValidateFirewallRules([]FirewallRule{rule}); !errors.Is(err, ErrInvalidFirewallRule) {
+			t.Errorf("expected %+v to be invalid, got %v", rule, err)
+		}
+	}
+}
+
+func TestSetFirewallRules_ReconcilesDifference(t *testing.T) {
+	ctx := context.Background()
+	instanceID := "i-1234567890abcdef0"
+	groupID := "sg-0123456789abcdef0"
+
+	var revoked, authorized []types.IpPermission
+	mockClient := &MockEC2Client{
+		DescribeSecurityGroupsFunc: func(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+			return &awsec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []types.SecurityGroup{
+					{
+						GroupId: aws.String(groupID),
+						IpPermissions: []types.IpPermission{
+							{
+								IpProtocol: aws.String("tcp"),
+								FromPort:   aws.Int32(22),
+								ToPort:     aws.Int32(22),
+								IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+							},
+							{
+								IpProtocol: aws.String("tcp"),
+								FromPort:   aws.Int32(443),
+								ToPort:     aws.Int32(443),
+								IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		RevokeSecurityGroupIngressFunc: func(ctx context.Context, params *awsec2.RevokeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.RevokeSecurityGroupIngressOutput, error) {
+			revoked = append(revoked, params.IpPermissions...)
+			return &awsec2.RevokeSecurityGroupIngressOutput{}, nil
+		},
+		AuthorizeSecurityGroupIngressFunc: func(ctx context.Context, params *awsec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.AuthorizeSecurityGroupIngressOutput, error) {
+			authorized = append(authorized, params.IpPermissions...)
+			return &awsec2.AuthorizeSecurityGroupIngressOutput{}, nil
+		},
+	}
+
+	rules := []FirewallRule{
+		{Protocol: ProtocolTCP, FromPort: 443, ToPort: 443, CIDR: "0.0.0.0/0"},
+		{Protocol: ProtocolTCP, FromPort: 22, ToPort: 22, CIDR: "203.0.113.0/24"},
+	}
+
+	gotGroupID, _, err := SetFirewallRules(ctx, mockClient, instanceID, rules)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotGroupID != groupID {
+		t.Errorf("expected group ID %s, got %s", groupID, gotGroupID)
+	}
+
+	if len(revoked) != 1 || *revoked[0].IpRanges[0].CidrIp != "0.0.0.0/0" || *revoked[0].FromPort != 22 {
+		t.Errorf("expected only SSH from anywhere to be revoked, got %+v", revoked)
+	}
+	if len(authorized) != 1 || *authorized[0].IpRanges[0].CidrIp != "203.0.113.0/24" {
+		t.Errorf("expected only SSH from office to be authorized, got %+v", authorized)
+	}
+}
+
+func TestSetFirewallRules_UpdatesDescriptions(t *testing.T) {
+	ctx := context.Background()
+	groupID := "sg-0123456789abcdef0"
+
+	var described []types.IpPermission
+	mockClient := &MockEC2Client{
+		DescribeSecurityGroupsFunc: func(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+			return &awsec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []types.SecurityGroup{
+					{
+						GroupId: aws.String(groupID),
+						IpPermissions: []types.IpPermission{
+							{
+								IpProtocol: aws.String("tcp"),
+								FromPort:   aws.Int32(443),
+								ToPort:     aws.Int32(443),
+								IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0"), Description: aws.String("old")}},
+							},
+							{
+								IpProtocol:       aws.String("-1"),
+								UserIdGroupPairs: []types.UserIdGroupPair{{GroupId: aws.String("sg-peer")}},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		RevokeSecurityGroupIngressFunc: func(ctx context.Context, params *awsec2.RevokeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.RevokeSecurityGroupIngressOutput, error) {
+			t.Errorf("expected no rules to be revoked, got %+v", params.IpPermissions)
+			return &awsec2.RevokeSecurityGroupIngressOutput{}, nil
+		},
+		AuthorizeSecurityGroupIngressFunc: func(ctx context.Context, params *awsec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.AuthorizeSecurityGroupIngressOutput, error) {
+			t.Errorf("expected no rules to be authorized, got %+v", params.IpPermissions)
+			return &awsec2.AuthorizeSecurityGroupIngressOutput{}, nil
+		},
+		UpdateSecurityGroupRuleDescriptionsIngressFunc: func(ctx context.Context, params *awsec2.UpdateSecurityGroupRuleDescriptionsIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.UpdateSecurityGroupRuleDescriptionsIngressOutput, error) {
+			described = append(described, params.IpPermissions...)
+			return &awsec2.UpdateSecurityGroupRuleDescriptionsIngressOutput{}, nil
+		},
+	}
+
+	// Ports given for all protocols are ignored, as EC2 does
+	rules := []FirewallRule{
+		{Protocol: ProtocolTCP, FromPort: 443, ToPort: 443, CIDR: "0.0.0.0/0", Description: "web"},
+		{Protocol: ProtocolAll, FromPort: 22, ToPort: 22, SourceGroupID: "sg-peer"},
+	}
+
+	if _, _, err := SetFirewallRules(ctx, mockClient, "i-1234567890abcdef0", rules); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(described) != 1 || aws.ToString(described[0].IpRanges[0].Description) != "web" {
+		t.Errorf("expected the HTTPS rule description to be updated, got %+v", described)
+	}
+}
+
+func TestGetFirewallRules_NodeNotFound(t *testing.T) {
+	mockClient := &MockEC2Client{
+		DescribeSecurityGroupsFunc: func(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+			return &awsec2.DescribeSecurityGroupsOutput{}, nil
+		},
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{}, nil
+		},
+	}
+
+	if _, _, err := GetFirewallRules(context.Background(), mockClient, "i-1234567890abcdef0"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+}
+
+func TestDeleteNodeSecurityGroup_WaitsForTermination(t *testing.T) {
+	instanceID := "i-1234567890abcdef0"
+	polls := 0
+	deleted := ""
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			polls++
+			state := types.InstanceStateNameShuttingDown
+			if polls > 1 {
+				state = types.InstanceStateNameTerminated
+			}
+			return newDescribeInstancesFunc(instanceID, state)(ctx, params)
+		},
+		DeleteSecurityGroupFunc: func(ctx context.Context, params *awsec2.DeleteSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteSecurityGroupOutput, error) {
+			if polls < 2 {
+				t.Error("expected the group to be deleted only once the instance is terminated")
+			}
+			deleted = aws.ToString(params.GroupId)
+			return &awsec2.DeleteSecurityGroupOutput{}, nil
+		},
+	}
+
+	opts := WaitOptions{Timeout: time.Second, InitialInterval: time.Millisecond}
+	if err := DeleteNodeSecurityGroup(context.Background(), mockClient, instanceID, "sg-0123456789abcdef0", opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if deleted != "sg-0123456789abcdef0" {
+		t.Errorf("expected the node security group to be deleted, got %q", deleted)
+	}
+}
+
+func TestEnsureNodeSecurityGroup_CreatesAndAttaches(t *testing.T) {
+	ctx := context.Background()
+	instanceID := "i-1234567890abcdef0"
+	groupID := "sg-0123456789abcdef0"
+	attached := false
+
+	mockClient := &MockEC2Client{
+		DescribeSecurityGroupsFunc: func(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+			return &awsec2.DescribeSecurityGroupsOutput{}, nil
+		},
+		DescribeInstancesFunc: newDescribeInstancesFunc(instanceID, types.InstanceStateNameRunning),
+		CreateSecurityGroupFunc: func(ctx context.Context, params *awsec2.CreateSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateSecurityGroupOutput, error) {
+			return &awsec2.CreateSecurityGroupOutput{GroupId: aws.String(groupID)}, nil
+		},
+		ModifyInstanceAttributeFunc: func(ctx context.Context, params *awsec2.ModifyInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.ModifyInstanceAttributeOutput, error) {
+			if len(params.Groups) != 1 || params.Groups[0] != groupID {
+				t.Errorf("expected groups [%s], got %v", groupID, params.Groups)
+			}
+			attached = true
+			return &awsec2.ModifyInstanceAttributeOutput{}, nil
+		},
+	}
+
+	gotGroupID, err := EnsureNodeSecurityGroup(ctx, mockClient, instanceID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotGroupID != groupID {
+		t.Errorf("expected group ID %s, got %s", groupID, gotGroupID)
+	}
+	if !attached {
+		t.Error("expected security group to be attached to the instance")
+	}
+}
+
+func TestCleanupOrphanedSecurityGroups(t *testing.T) {
+	ctx := context.Background()
+	var deleted []string
+
+	mockClient := &MockEC2Client{
+		DescribeSecurityGroupsFunc: func(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+			return &awsec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []types.SecurityGroup{
+					{GroupId: aws.String("sg-running"), Tags: []types.Tag{{Key: aws.String(TagNodeID), Value: aws.String("i-running")}}},
+					{GroupId: aws.String("sg-terminated"), Tags: []types.Tag{{Key: aws.String(TagNodeID), Value: aws.String("i-terminated")}}},
+				},
+			}, nil
+		},
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			state := types.InstanceStateNameRunning
+			if params.InstanceIds[0] == "i-terminated" {
+				state = types.InstanceStateNameTerminated
+			}
+			return newDescribeInstancesFunc(params.InstanceIds[0], state)(ctx, params)
+		},
+		DeleteSecurityGroupFunc: func(ctx context.Context, params *awsec2.DeleteSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteSecurityGroupOutput, error) {
+			deleted = append(deleted, *params.GroupId)
+			return &awsec2.DeleteSecurityGroupOutput{}, nil
+		},
+	}
+
+	if err := CleanupOrphanedSecurityGroups(ctx, mockClient); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "sg-terminated" {
+		t.Errorf("expected only sg-terminated to be deleted, got %v", deleted)
+	}
+}
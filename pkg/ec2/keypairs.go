@@ -0,0 +1,175 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/abteilung6/tilmancloud/pkg/sshkey"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	ErrKeyPairNotFound    = errkind.New(errkind.NotFound, "key pair not found")
+	ErrKeyPairExists      = errkind.New(errkind.Conflict, "key pair already exists")
+	ErrInvalidKeyPairName = errkind.New(errkind.InvalidInput, "invalid key pair name")
+)
+
+var keyPairNamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,255}$`)
+
+type KeyPairInfo struct {
+	Name        string
+	KeyPairID   string
+	Type        string
+	Fingerprint string
+	PublicKey   string
+	CreatedAt   time.Time
+}
+
+// ImportKeyPair validates an OpenSSH public key and imports it as an EC2
+// key pair. The stored public key is also what gets injected through
+// cloud-init, so EC2 is the single source of truth for keys.
+func ImportKeyPair(ctx context.Context, client EC2Client, name, publicKey string) (KeyPairInfo, error) {
+	if !keyPairNamePattern.MatchString(name) {
+		return KeyPairInfo{}, fmt.Errorf("%w: %q must be 1-255 letters, digits or ._@- characters", ErrInvalidKeyPairName, name)
+	}
+
+	key, err := sshkey.Parse(publicKey)
+	if err != nil {
+		return KeyPairInfo{}, err
+	}
+
+	slog.Info("Importing key pair", "name", name, "type", key.Algorithm(), "fingerprint", key.Fingerprint())
+
+	result, err := client.ImportKeyPair(ctx, &awsec2.ImportKeyPairInput{
+		KeyName:           aws.String(name),
+		PublicKeyMaterial: []byte(key.String()),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeKeyPair,
+				Tags: []types.Tag{
+					{Key: aws.String(TagManagedBy), Value: aws.String(ManagedByValue)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		if hasErrorCode(err, "InvalidKeyPair.Duplicate") {
+			return KeyPairInfo{}, fmt.Errorf("%w: %s", ErrKeyPairExists, name)
+		}
+		slog.Error("Failed to import key pair", "name", name, "error", err)
+		return KeyPairInfo{}, fmt.Errorf("failed to import key pair: %w", err)
+	}
+
+	info := KeyPairInfo{
+		Name:        name,
+		KeyPairID:   getPtrStringValue(result.KeyPairId),
+		Type:        key.Algorithm(),
+		Fingerprint: key.Fingerprint(),
+		PublicKey:   key.String(),
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	slog.Info("Key pair imported", "name", name, "key_pair_id", info.KeyPairID)
+	return info, nil
+}
+
+func ListKeyPairs(ctx context.Context, client EC2Client) ([]KeyPairInfo, error) {
+	result, err := client.DescribeKeyPairs(ctx, &awsec2.DescribeKeyPairsInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + TagManagedBy),
+				Values: []string{ManagedByValue},
+			},
+		},
+		IncludePublicKey: aws.Bool(true),
+	})
+	if err != nil {
+		slog.Error("Failed to describe key pairs", "error", err)
+		return nil, fmt.Errorf("failed to describe key pairs: %w", err)
+	}
+
+	keys := make([]KeyPairInfo, 0, len(result.KeyPairs))
+	for _, keyPair := range result.KeyPairs {
+		keys = append(keys, newKeyPairInfo(keyPair))
+	}
+	return keys, nil
+}
+
+func GetKeyPair(ctx context.Context, client EC2Client, name string) (KeyPairInfo, error) {
+	result, err := client.DescribeKeyPairs(ctx, &awsec2.DescribeKeyPairsInput{
+		KeyNames: []string{name},
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + TagManagedBy),
+				Values: []string{ManagedByValue},
+			},
+		},
+		IncludePublicKey: aws.Bool(true),
+	})
+	if err != nil {
+		if hasErrorCode(err, "InvalidKeyPair.NotFound") {
+			return KeyPairInfo{}, fmt.Errorf("%w: %s", ErrKeyPairNotFound, name)
+		}
+		return KeyPairInfo{}, fmt.Errorf("failed to describe key pair: %w", err)
+	}
+
+	if len(result.KeyPairs) == 0 {
+		return KeyPairInfo{}, fmt.Errorf("%w: %s", ErrKeyPairNotFound, name)
+	}
+	return newKeyPairInfo(result.KeyPairs[0]), nil
+}
+
+func DeleteKeyPair(ctx context.Context, client EC2Client, name string) error {
+	// Only delete key pairs this control plane imported
+	info, err := GetKeyPair(ctx, client, name)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Deleting key pair", "name", name, "key_pair_id", info.KeyPairID)
+	_, err = client.DeleteKeyPair(ctx, &awsec2.DeleteKeyPairInput{
+		KeyPairId: aws.String(info.KeyPairID),
+	})
+	if err != nil {
+		slog.Error("Failed to delete key pair", "name", name, "error", err)
+		return fmt.Errorf("failed to delete key pair: %w", err)
+	}
+	return nil
+}
+
+func newKeyPairInfo(keyPair types.KeyPairInfo) KeyPairInfo {
+	info := KeyPairInfo{
+		Name:        getPtrStringValue(keyPair.KeyName),
+		KeyPairID:   getPtrStringValue(keyPair.KeyPairId),
+		Type:        string(keyPair.KeyType),
+		Fingerprint: getPtrStringValue(keyPair.KeyFingerprint),
+		PublicKey:   getPtrStringValue(keyPair.PublicKey),
+	}
+	if keyPair.CreateTime != nil {
+		info.CreatedAt = *keyPair.CreateTime
+	}
+
+	// Prefer the OpenSSH fingerprint over the format EC2 reports, which
+	// differs between RSA and ed25519 keys
+	if key, err := sshkey.Parse(info.PublicKey); err == nil {
+		info.Fingerprint = key.Fingerprint()
+		info.Type = key.Algorithm()
+	}
+	return info
+}
+
+func hasErrorCode(err error, code string) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode() == code
+	}
+	return false
+}
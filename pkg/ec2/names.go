@@ -0,0 +1,175 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	TagName        = "Name"
+	TagManagedBy   = "ManagedBy"
+	TagPool        = "Pool"
+	TagBatch       = "Batch"
+	TagRequest     = "Request"
+	ManagedByValue = "tilmancloud"
+)
+
+var (
+	ErrInvalidNodeName = errkind.New(errkind.InvalidInput, "invalid node name")
+	ErrNodeNameTaken   = errkind.New(errkind.Conflict, "node name already in use")
+	// ErrAmbiguousNodeName is returned when several live nodes carry the
+	// name a node is referred to by; the node has to be named by its ID
+	ErrAmbiguousNodeName = errkind.New(errkind.Conflict, "ambiguous node name")
+)
+
+// Names double as hostnames, so they follow RFC 1123 label rules. The "i-"
+// prefix is reserved so a name can never be mistaken for an instance ID.
+var nodeNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+var (
+	nameAdjectives = []string{
+		"amber", "brave", "calm", "clever", "crimson", "dapper", "eager", "fuzzy",
+		"gentle", "golden", "happy", "jolly", "keen", "lucky", "mellow", "nimble",
+		"plucky", "quiet", "rapid", "shiny", "silent", "sturdy", "swift", "witty",
+	}
+	nameNouns = []string{
+		"badger", "beacon", "canyon", "comet", "falcon", "fjord", "glacier", "harbor",
+		"heron", "lantern", "meadow", "otter", "pebble", "pine", "quartz", "raven",
+		"reef", "river", "summit", "thistle", "tundra", "walrus", "willow", "yak",
+	}
+)
+
+const maxNameAttempts = 10
+
+func ValidateNodeName(name string) error {
+	if !nodeNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q must be 1-63 lowercase letters, digits or hyphens and start and end with a letter or digit", ErrInvalidNodeName, name)
+	}
+	if strings.HasPrefix(name, "i-") {
+		return fmt.Errorf("%w: %q must not start with \"i-\"", ErrInvalidNodeName, name)
+	}
+	return nil
+}
+
+func GenerateNodeName() string {
+	adjective := nameAdjectives[rand.IntN(len(nameAdjectives))]
+	noun := nameNouns[rand.IntN(len(nameNouns))]
+	return adjective + "-" + noun
+}
+
+// AssignNodeName validates a requested name, or generates one when empty,
+// and makes sure no other managed node uses it. The check is best effort:
+// two concurrent requests for the same name can both pass it.
+func AssignNodeName(ctx context.Context, client EC2Client, requested string) (string, error) {
+	if requested != "" {
+		if err := ValidateNodeName(requested); err != nil {
+			return "", err
+		}
+		ids, err := findManagedInstancesByName(ctx, client, requested)
+		if err != nil {
+			return "", err
+		}
+		if len(ids) > 0 {
+			return "", fmt.Errorf("%w: %s", ErrNodeNameTaken, requested)
+		}
+		return requested, nil
+	}
+
+	return GenerateUniqueNodeName(func(name string) (bool, error) {
+		ids, err := findManagedInstancesByName(ctx, client, name)
+		return len(ids) > 0, err
+	})
+}
+
+// GenerateUniqueNodeName generates names until taken reports one as free,
+// giving up after maxNameAttempts so a nearly exhausted name space fails
+// instead of looping.
+func GenerateUniqueNodeName(taken func(name string) (bool, error)) (string, error) {
+	for attempt := 0; attempt < maxNameAttempts; attempt++ {
+		name := GenerateNodeName()
+		inUse, err := taken(name)
+		if err != nil {
+			return "", err
+		}
+		if !inUse {
+			slog.Debug("Generated node name", "name", name)
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate a unique node name after %d attempts", maxNameAttempts)
+}
+
+// ResolveInstanceID maps a node reference, which is either an instance ID
+// or a node name, to an instance ID.
+func ResolveInstanceID(ctx context.Context, client EC2Client, idOrName string) (string, error) {
+	return ResolveNodeName(idOrName, func(name string) ([]string, error) {
+		return findManagedInstancesByName(ctx, client, name)
+	})
+}
+
+// ResolveNodeName maps a node reference to an instance ID. IDs are passed
+// through; names are looked up with matches, which returns the IDs of the
+// live nodes with that name.
+func ResolveNodeName(idOrName string, matches func(name string) ([]string, error)) (string, error) {
+	if strings.HasPrefix(idOrName, "i-") {
+		return idOrName, nil
+	}
+
+	ids, err := matches(idOrName)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrInstanceNotFound, idOrName)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("%w: %s matches instances %s", ErrAmbiguousNodeName, idOrName, strings.Join(ids, ", "))
+	}
+}
+
+func findManagedInstancesByName(ctx context.Context, client EC2Client, name string) ([]string, error) {
+	describeResult, err := client.DescribeInstances(ctx, &awsec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + TagName),
+				Values: []string{name},
+			},
+			{
+				Name:   aws.String("tag:" + TagManagedBy),
+				Values: []string{ManagedByValue},
+			},
+			{
+				Name: aws.String("instance-state-name"),
+				Values: []string{
+					string(types.InstanceStateNamePending),
+					string(types.InstanceStateNameRunning),
+					string(types.InstanceStateNameStopping),
+					string(types.InstanceStateNameStopped),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up instances by name: %w", err)
+	}
+
+	var ids []string
+	for _, reservation := range describeResult.Reservations {
+		for _, instance := range reservation.Instances {
+			ids = append(ids, getPtrStringValue(instance.InstanceId))
+		}
+	}
+	return ids, nil
+}
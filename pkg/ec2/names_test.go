@@ -0,0 +1,96 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestValidateNodeName(t *testing.T) {
+	valid := []string{"web", "brave-otter", "ci-runner-01", "a1"}
+	for _, name := range valid {
+		if err := ValidateNodeName(name); err != nil {
+			t.Errorf("expected %q to be valid, got %v", name, err)
+		}
+	}
+
+	invalid := []string{"", "-web", "web-", "Web", "web_1", "i-0abc", "a.b"}
+	for _, name := range invalid {
+		if err := ValidateNodeName(name); !errors.Is(err, ErrInvalidNodeName) {
+			t.Errorf("expected %q to be invalid, got %v", name, err)
+		}
+	}
+}
+
+func TestGenerateNodeName(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		name := GenerateNodeName()
+		if err := ValidateNodeName(name); err != nil {
+			t.Errorf("generated name %q is invalid: %v", name, err)
+		}
+	}
+}
+
+func TestResolveInstanceID(t *testing.T) {
+	ctx := context.Background()
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{Instances: []types.Instance{{InstanceId: aws.String("i-1234567890abcdef0")}}},
+				},
+			}, nil
+		},
+	}
+
+	id, err := ResolveInstanceID(ctx, mockClient, "i-0987654321fedcba0")
+	if err != nil || id != "i-0987654321fedcba0" {
+		t.Errorf("expected instance ID to pass through, got %s, %v", id, err)
+	}
+
+	id, err = ResolveInstanceID(ctx, mockClient, "brave-otter")
+	if err != nil || id != "i-1234567890abcdef0" {
+		t.Errorf("expected name to resolve to i-1234567890abcdef0, got %s, %v", id, err)
+	}
+}
+
+func TestResolveInstanceID_NotFound(t *testing.T) {
+	ctx := context.Background()
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{}, nil
+		},
+	}
+
+	_, err := ResolveInstanceID(ctx, mockClient, "brave-otter")
+	if !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+}
+
+func TestResolveInstanceID_Ambiguous(t *testing.T) {
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{Instances: []types.Instance{{InstanceId: aws.String("i-1")}, {InstanceId: aws.String("i-2")}}},
+				},
+			}, nil
+		},
+	}
+
+	_, err := ResolveInstanceID(context.Background(), mockClient, "brave-otter")
+	if !errors.Is(err, ErrAmbiguousNodeName) {
+		t.Fatalf("expected ErrAmbiguousNodeName, got %v", err)
+	}
+	if errkind.Of(err) != errkind.Conflict {
+		t.Errorf("expected a conflict, got %v", errkind.Of(err))
+	}
+}
@@ -2,80 +2,108 @@ package ec2
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 	"time"
 
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
+var (
+	ErrInstanceNotFound = errkind.New(errkind.NotFound, "instance not found")
+	// ErrPartialLaunch is returned when EC2 launched fewer instances than
+	// requested, typically for lack of capacity
+	ErrPartialLaunch = errkind.New(errkind.Unavailable, "fewer instances launched than requested")
+)
+
 type InstanceInfo struct {
-	InstanceID   string
-	State        string
-	InstanceType string
-	PublicIP     string
-	PrivateIP    string
+	InstanceID       string
+	Name             string
+	State            string
+	InstanceType     string
+	PublicIP         string
+	PrivateIP        string
+	LaunchTime       time.Time
+	AvailabilityZone string
+	SubnetID         string
+	VpcID            string
+	AMIID            string
+	ImageID          string
+	Architecture     string
+	KeyName          string
+	SecurityGroups   []SecurityGroupInfo
+	Tags             map[string]string
+	RootVolume       *RootVolumeInfo
+	BlockDevices     []BlockDeviceInfo
+	StateReason      string
+	StateReasonCode  string
+	Lifecycle        string
+	SpotRequestID    string
+	// HibernationConfigured is whether the instance was launched with
+	// hibernation enabled; only such instances can be hibernated
+	HibernationConfigured bool
+	// Spot is only set for spot instances, and only by calls that look up
+	// the spot request (see AttachSpotStatus)
+	Spot *SpotStatus
+	// Region is set by callers serving several regions; EC2 calls leave
+	// it empty
+	Region string
 }
 
-func WaitForInstanceRunning(ctx context.Context, client EC2Client, instanceID string) error {
-	slog.Info("Waiting for instance to be running", "instance_id", instanceID)
-	maxWaitTime := 5 * time.Minute
-	checkInterval := 10 * time.Second
-	startTime := time.Now()
-
-	for {
-		if time.Since(startTime) > maxWaitTime {
-			slog.Error("Timeout waiting for instance to start", "instance_id", instanceID, "timeout", maxWaitTime)
-			return fmt.Errorf("timeout waiting for instance to start")
-		}
-
-		describeInput := &awsec2.DescribeInstancesInput{
-			InstanceIds: []string{instanceID},
-		}
-		describeResult, err := client.DescribeInstances(ctx, describeInput)
-		if err != nil {
-			slog.Error("Failed to describe instance", "instance_id", instanceID, "error", err)
-			return fmt.Errorf("failed to describe instance: %w", err)
-		}
-
-		if len(describeResult.Reservations) > 0 && len(describeResult.Reservations[0].Instances) > 0 {
-			instance := describeResult.Reservations[0].Instances[0]
-			state := instance.State.Name
-
-			slog.Debug("Instance state check", "instance_id", instanceID, "state", state)
-
-			if state == types.InstanceStateNameRunning {
-				slog.Info("Instance is now running", "instance_id", instanceID)
-				return nil
-			}
+type SecurityGroupInfo struct {
+	GroupID   string
+	GroupName string
+}
 
-			if state == types.InstanceStateNameTerminated || state == types.InstanceStateNameStopped {
-				slog.Error("Instance entered invalid state", "instance_id", instanceID, "state", state)
-				return fmt.Errorf("instance entered %s state, failed to start", state)
-			}
-		}
+type RootVolumeInfo struct {
+	DeviceName string
+	VolumeID   string
+}
 
-		time.Sleep(checkInterval)
-	}
+// BlockDeviceInfo is an EBS volume mapped to an instance, including the
+// root volume.
+type BlockDeviceInfo struct {
+	DeviceName          string
+	VolumeID            string
+	DeleteOnTermination bool
 }
 
 type CreateInstanceConfig struct {
+	Name         string
 	ImageID      string
 	InstanceType types.InstanceType
+	KeyName      string
+	// UserData is the raw cloud-init document; it is base64-encoded here
+	UserData string
+	// Tags are added to the instance next to the ownership tags
+	Tags map[string]string
+	// Spot launches a spot instance instead of an on-demand one
+	Spot *SpotOptions
+	// ClientToken makes the launch idempotent: EC2 returns the instance of
+	// an earlier launch with the same token instead of starting another
+	ClientToken string
+	// Hibernation enables hibernation for the instance. EC2 writes the
+	// memory to the root volume, which is encrypted for it.
+	Hibernation bool
 }
 
+// RootDeviceName is the root device of the AMIs the image builder
+// registers.
+const RootDeviceName = "/dev/xvda"
+
 func CreateInstance(ctx context.Context, client EC2Client, config CreateInstanceConfig) (InstanceInfo, error) {
-	slog.Info("Creating EC2 instance", "image_id", config.ImageID, "instance_type", config.InstanceType)
+	slog.Info("Creating EC2 instance", "name", config.Name, "image_id", config.ImageID, "instance_type", config.InstanceType)
 
-	runInput := &awsec2.RunInstancesInput{
-		ImageId:      aws.String(config.ImageID),
-		InstanceType: config.InstanceType,
-		MinCount:     aws.Int32(1),
-		MaxCount:     aws.Int32(1),
+	runInput, err := runInstancesInput(config)
+	if err != nil {
+		return InstanceInfo{}, err
 	}
-
 	runResult, err := client.RunInstances(ctx, runInput)
 	if err != nil {
 		slog.Error("Failed to run instance", "error", err)
@@ -87,23 +115,131 @@ func CreateInstance(ctx context.Context, client EC2Client, config CreateInstance
 		return InstanceInfo{}, fmt.Errorf("no instances were created")
 	}
 
-	instance := runResult.Instances[0]
-	info := InstanceInfo{
-		InstanceID:   getPtrStringValue(instance.InstanceId),
-		State:        string(instance.State.Name),
-		InstanceType: string(instance.InstanceType),
-		PublicIP:     getPtrStringValue(instance.PublicIpAddress),
-		PrivateIP:    getPtrStringValue(instance.PrivateIpAddress),
+	info := newInstanceInfo(runResult.Instances[0])
+	// RunInstances does not echo the tag specifications back
+	if info.Name == "" {
+		info.Name = config.Name
 	}
 
 	slog.Info("Instance created successfully",
 		"instance_id", info.InstanceID,
+		"name", info.Name,
 		"state", info.State,
 		"instance_type", info.InstanceType)
 
 	return info, nil
 }
 
+// CreateInstances launches one instance per name from config in a single
+// RunInstances call and names them in launch order; config.Name is
+// ignored. EC2 launches fewer instances than requested when it runs out of
+// capacity. The launched instances are returned either way, together with
+// an ErrPartialLaunch when some are missing.
+func CreateInstances(ctx context.Context, client EC2Client, config CreateInstanceConfig, names []string) ([]InstanceInfo, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one instance name is required")
+	}
+	slog.Info("Creating EC2 instances", "count", len(names), "image_id", config.ImageID, "instance_type", config.InstanceType)
+
+	config.Name = ""
+	runInput, err := runInstancesInput(config)
+	if err != nil {
+		return nil, err
+	}
+	runInput.MaxCount = aws.Int32(int32(len(names)))
+	runResult, err := client.RunInstances(ctx, runInput)
+	if err != nil {
+		slog.Error("Failed to run instances", "error", err)
+		return nil, fmt.Errorf("failed to run instances: %w", err)
+	}
+	if len(runResult.Instances) == 0 {
+		slog.Error("No instances were created")
+		return nil, fmt.Errorf("no instances were created")
+	}
+
+	instances := make([]InstanceInfo, 0, len(runResult.Instances))
+	for i, instance := range runResult.Instances[:min(len(runResult.Instances), len(names))] {
+		info := newInstanceInfo(instance)
+		if info.Name != "" {
+			// Named by the original launch of an idempotent replay
+			instances = append(instances, info)
+			continue
+		}
+		// The instances share their tag specifications, so each is named
+		// once it exists
+		_, err := client.CreateTags(ctx, &awsec2.CreateTagsInput{
+			Resources: []string{info.InstanceID},
+			Tags:      []types.Tag{{Key: aws.String(TagName), Value: aws.String(names[i])}},
+		})
+		if err != nil {
+			slog.Warn("Failed to name instance", "instance_id", info.InstanceID, "name", names[i], "error", err)
+		} else {
+			info.Name = names[i]
+		}
+		instances = append(instances, info)
+	}
+
+	slog.Info("Instances created successfully", "requested", len(names), "created", len(instances))
+	if len(instances) < len(names) {
+		return instances, fmt.Errorf("%w: %d of %d instances", ErrPartialLaunch, len(instances), len(names))
+	}
+	return instances, nil
+}
+
+// runInstancesInput describes the launch of a single instance from config.
+func runInstancesInput(config CreateInstanceConfig) (*awsec2.RunInstancesInput, error) {
+	tags := []types.Tag{
+		{Key: aws.String(TagManagedBy), Value: aws.String(ManagedByValue)},
+	}
+	if config.Name != "" {
+		tags = append(tags, types.Tag{Key: aws.String(TagName), Value: aws.String(config.Name)})
+	}
+	for _, key := range slices.Sorted(maps.Keys(config.Tags)) {
+		if key == TagName || key == TagManagedBy {
+			continue
+		}
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(config.Tags[key])})
+	}
+
+	runInput := &awsec2.RunInstancesInput{
+		ImageId:      aws.String(config.ImageID),
+		InstanceType: config.InstanceType,
+		MinCount:     aws.Int32(1),
+		MaxCount:     aws.Int32(1),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeInstance,
+				Tags:         tags,
+			},
+		},
+	}
+	if config.KeyName != "" {
+		runInput.KeyName = aws.String(config.KeyName)
+	}
+	if config.ClientToken != "" {
+		runInput.ClientToken = aws.String(config.ClientToken)
+	}
+	if config.UserData != "" {
+		runInput.UserData = aws.String(base64.StdEncoding.EncodeToString([]byte(config.UserData)))
+	}
+	if config.Spot != nil {
+		if err := config.Spot.Validate(); err != nil {
+			return nil, err
+		}
+		runInput.InstanceMarketOptions = config.Spot.marketOptions()
+	}
+	if config.Hibernation {
+		runInput.HibernationOptions = &types.HibernationOptionsRequest{Configured: aws.Bool(true)}
+		runInput.BlockDeviceMappings = []types.BlockDeviceMapping{
+			{
+				DeviceName: aws.String(RootDeviceName),
+				Ebs:        &types.EbsBlockDevice{Encrypted: aws.Bool(true)},
+			},
+		}
+	}
+	return runInput, nil
+}
+
 func ListInstances(ctx context.Context, client EC2Client) ([]InstanceInfo, error) {
 	slog.Debug("Listing EC2 instances")
 
@@ -117,14 +253,7 @@ func ListInstances(ctx context.Context, client EC2Client) ([]InstanceInfo, error
 	var instances []InstanceInfo
 	for _, reservation := range describeResult.Reservations {
 		for _, instance := range reservation.Instances {
-			info := InstanceInfo{
-				InstanceID:   getPtrStringValue(instance.InstanceId),
-				State:        string(instance.State.Name),
-				InstanceType: string(instance.InstanceType),
-				PublicIP:     getPtrStringValue(instance.PublicIpAddress),
-				PrivateIP:    getPtrStringValue(instance.PrivateIpAddress),
-			}
-			instances = append(instances, info)
+			instances = append(instances, newInstanceInfo(instance))
 		}
 	}
 
@@ -132,15 +261,117 @@ func ListInstances(ctx context.Context, client EC2Client) ([]InstanceInfo, error
 	return instances, nil
 }
 
+// ListInstancesByTag returns the managed instances carrying the tag that
+// are not shutting down or terminated.
+func ListInstancesByTag(ctx context.Context, client EC2Client, key, value string) ([]InstanceInfo, error) {
+	describeResult, err := client.DescribeInstances(ctx, &awsec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + key),
+				Values: []string{value},
+			},
+			{
+				Name:   aws.String("tag:" + TagManagedBy),
+				Values: []string{ManagedByValue},
+			},
+			{
+				Name: aws.String("instance-state-name"),
+				Values: []string{
+					string(types.InstanceStateNamePending),
+					string(types.InstanceStateNameRunning),
+					string(types.InstanceStateNameStopping),
+					string(types.InstanceStateNameStopped),
+				},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to describe instances", "tag", key, "value", value, "error", err)
+		return nil, fmt.Errorf("failed to describe instances: %w", err)
+	}
+
+	var instances []InstanceInfo
+	for _, reservation := range describeResult.Reservations {
+		for _, instance := range reservation.Instances {
+			instances = append(instances, newInstanceInfo(instance))
+		}
+	}
+	return instances, nil
+}
+
+// ListImpairedInstances returns the IDs of the given instances whose
+// instance or system status check reports impaired.
+func ListImpairedInstances(ctx context.Context, client EC2Client, instanceIDs []string) ([]string, error) {
+	if len(instanceIDs) == 0 {
+		return nil, nil
+	}
+
+	result, err := client.DescribeInstanceStatus(ctx, &awsec2.DescribeInstanceStatusInput{
+		InstanceIds: instanceIDs,
+	})
+	if err != nil {
+		slog.Error("Failed to describe instance status", "error", err)
+		return nil, fmt.Errorf("failed to describe instance status: %w", err)
+	}
+
+	var impaired []string
+	for _, status := range result.InstanceStatuses {
+		if (status.InstanceStatus != nil && status.InstanceStatus.Status == types.SummaryStatusImpaired) ||
+			(status.SystemStatus != nil && status.SystemStatus.Status == types.SummaryStatusImpaired) {
+			impaired = append(impaired, getPtrStringValue(status.InstanceId))
+		}
+	}
+	return impaired, nil
+}
+
+func GetInstance(ctx context.Context, client EC2Client, instanceID string) (InstanceInfo, error) {
+	slog.Debug("Describing EC2 instance", "instance_id", instanceID)
+
+	describeInput := &awsec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	}
+	describeResult, err := client.DescribeInstances(ctx, describeInput)
+	if err != nil {
+		if isInstanceNotFoundError(err) {
+			return InstanceInfo{}, fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+		}
+		slog.Error("Failed to describe instance", "instance_id", instanceID, "error", err)
+		return InstanceInfo{}, fmt.Errorf("failed to describe instance: %w", err)
+	}
+
+	for _, reservation := range describeResult.Reservations {
+		for _, instance := range reservation.Instances {
+			if getPtrStringValue(instance.InstanceId) == instanceID {
+				info := newInstanceInfo(instance)
+				if info.ImageID == "" && info.AMIID != "" {
+					info.ImageID = lookupImageID(ctx, client, info.AMIID)
+				}
+				return info, nil
+			}
+		}
+	}
+
+	return InstanceInfo{}, fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+}
+
 func DeleteInstance(ctx context.Context, client EC2Client, instanceID string) error {
 	slog.Info("Deleting EC2 instance", "instance_id", instanceID)
 
+	// A persistent spot request outlives its instance and would launch a
+	// replacement, so it is cancelled before the instance is terminated
+	if err := cancelSpotRequest(ctx, client, instanceID); err != nil {
+		return err
+	}
+
 	terminateInput := &awsec2.TerminateInstancesInput{
 		InstanceIds: []string{instanceID},
 	}
 
 	terminateResult, err := client.TerminateInstances(ctx, terminateInput)
 	if err != nil {
+		if isInstanceNotFoundError(err) {
+			return fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+		}
 		slog.Error("Failed to terminate instance", "instance_id", instanceID, "error", err)
 		return fmt.Errorf("failed to terminate instance: %w", err)
 	}
@@ -159,6 +390,144 @@ func DeleteInstance(ctx context.Context, client EC2Client, instanceID string) er
 	return nil
 }
 
+// cancelSpotRequest cancels the spot request the instance was launched
+// from, if any.
+func cancelSpotRequest(ctx context.Context, client EC2Client, instanceID string) error {
+	describeResult, err := client.DescribeInstances(ctx, &awsec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		if isInstanceNotFoundError(err) {
+			return fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+		}
+		slog.Error("Failed to describe instance", "instance_id", instanceID, "error", err)
+		return fmt.Errorf("failed to describe instance: %w", err)
+	}
+
+	var requestID string
+	for _, reservation := range describeResult.Reservations {
+		for _, instance := range reservation.Instances {
+			if getPtrStringValue(instance.InstanceId) == instanceID {
+				requestID = getPtrStringValue(instance.SpotInstanceRequestId)
+			}
+		}
+	}
+	if requestID == "" {
+		return nil
+	}
+
+	slog.Info("Cancelling spot request", "instance_id", instanceID, "spot_request_id", requestID)
+	_, err = client.CancelSpotInstanceRequests(ctx, &awsec2.CancelSpotInstanceRequestsInput{
+		SpotInstanceRequestIds: []string{requestID},
+	})
+	if err != nil {
+		slog.Error("Failed to cancel spot request", "spot_request_id", requestID, "error", err)
+		return fmt.Errorf("failed to cancel spot request: %w", err)
+	}
+	return nil
+}
+
+// newInstanceInfo flattens an EC2 instance description into an InstanceInfo.
+func newInstanceInfo(instance types.Instance) InstanceInfo {
+	info := InstanceInfo{
+		InstanceID:   getPtrStringValue(instance.InstanceId),
+		InstanceType: string(instance.InstanceType),
+		PublicIP:     getPtrStringValue(instance.PublicIpAddress),
+		PrivateIP:    getPtrStringValue(instance.PrivateIpAddress),
+		SubnetID:     getPtrStringValue(instance.SubnetId),
+		VpcID:        getPtrStringValue(instance.VpcId),
+		AMIID:        getPtrStringValue(instance.ImageId),
+		Architecture: string(instance.Architecture),
+		KeyName:      getPtrStringValue(instance.KeyName),
+		Tags:         map[string]string{},
+		Lifecycle:    "on-demand",
+	}
+
+	if instance.State != nil {
+		info.State = string(instance.State.Name)
+	}
+	if instance.LaunchTime != nil {
+		info.LaunchTime = *instance.LaunchTime
+	}
+	if instance.Placement != nil {
+		info.AvailabilityZone = getPtrStringValue(instance.Placement.AvailabilityZone)
+	}
+	if instance.StateReason != nil {
+		info.StateReason = getPtrStringValue(instance.StateReason.Message)
+		info.StateReasonCode = getPtrStringValue(instance.StateReason.Code)
+	}
+	info.SpotRequestID = getPtrStringValue(instance.SpotInstanceRequestId)
+	if instance.HibernationOptions != nil {
+		info.HibernationConfigured = aws.ToBool(instance.HibernationOptions.Configured)
+	}
+	// InstanceLifecycle is only set for spot and scheduled instances
+	if instance.InstanceLifecycle != "" {
+		info.Lifecycle = string(instance.InstanceLifecycle)
+	}
+
+	for _, group := range instance.SecurityGroups {
+		info.SecurityGroups = append(info.SecurityGroups, SecurityGroupInfo{
+			GroupID:   getPtrStringValue(group.GroupId),
+			GroupName: getPtrStringValue(group.GroupName),
+		})
+	}
+
+	for _, tag := range instance.Tags {
+		if tag.Key == nil {
+			continue
+		}
+		info.Tags[*tag.Key] = getPtrStringValue(tag.Value)
+	}
+	info.Name = info.Tags[TagName]
+	info.ImageID = info.Tags["ImageID"]
+
+	rootDevice := getPtrStringValue(instance.RootDeviceName)
+	for _, mapping := range instance.BlockDeviceMappings {
+		if mapping.Ebs == nil {
+			continue
+		}
+		info.BlockDevices = append(info.BlockDevices, BlockDeviceInfo{
+			DeviceName:          getPtrStringValue(mapping.DeviceName),
+			VolumeID:            getPtrStringValue(mapping.Ebs.VolumeId),
+			DeleteOnTermination: aws.ToBool(mapping.Ebs.DeleteOnTermination),
+		})
+		if getPtrStringValue(mapping.DeviceName) != rootDevice {
+			continue
+		}
+		info.RootVolume = &RootVolumeInfo{
+			DeviceName: rootDevice,
+			VolumeID:   getPtrStringValue(mapping.Ebs.VolumeId),
+		}
+	}
+
+	return info
+}
+
+// lookupImageID resolves the content-based ImageID tag of an AMI. Instances
+// do not inherit AMI tags, so the detail view has to ask for it separately.
+func lookupImageID(ctx context.Context, client EC2Client, amiID string) string {
+	result, err := client.DescribeImages(ctx, &awsec2.DescribeImagesInput{
+		ImageIds: []string{amiID},
+	})
+	if err != nil {
+		slog.Debug("Failed to look up ImageID for AMI", "ami_id", amiID, "error", err)
+		return ""
+	}
+
+	for _, img := range result.Images {
+		for _, tag := range img.Tags {
+			if getPtrStringValue(tag.Key) == "ImageID" {
+				return getPtrStringValue(tag.Value)
+			}
+		}
+	}
+	return ""
+}
+
+func isInstanceNotFoundError(err error) bool {
+	return hasErrorCode(err, "InvalidInstanceID.NotFound") || hasErrorCode(err, "InvalidInstanceID.Malformed")
+}
+
 func getPtrStringValue(ptr *string) string {
 	if ptr == nil {
 		return ""
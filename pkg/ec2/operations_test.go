@@ -2,6 +2,7 @@ package ec2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -60,6 +61,51 @@ func TestCreateInstance_Success(t *testing.T) {
 	}
 }
 
+func TestCreateInstance_ClientToken(t *testing.T) {
+	mockClient := &MockEC2Client{
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			if aws.ToString(params.ClientToken) != "token-1" {
+				t.Errorf("expected client token token-1, got %v", params.ClientToken)
+			}
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{{InstanceId: aws.String("i-1234567890abcdef0")}},
+			}, nil
+		},
+	}
+
+	if _, err := CreateInstance(context.Background(), mockClient, CreateInstanceConfig{ImageID: "ami-1234567890abcdef0", ClientToken: "token-1"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestCreateInstance_Hibernation(t *testing.T) {
+	mockClient := &MockEC2Client{
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			if params.HibernationOptions == nil || !aws.ToBool(params.HibernationOptions.Configured) {
+				t.Errorf("expected hibernation to be configured, got %+v", params.HibernationOptions)
+			}
+			if len(params.BlockDeviceMappings) != 1 || aws.ToString(params.BlockDeviceMappings[0].DeviceName) != RootDeviceName ||
+				!aws.ToBool(params.BlockDeviceMappings[0].Ebs.Encrypted) {
+				t.Errorf("expected an encrypted root volume, got %+v", params.BlockDeviceMappings)
+			}
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{{
+					InstanceId:         aws.String("i-1234567890abcdef0"),
+					HibernationOptions: &types.HibernationOptions{Configured: aws.Bool(true)},
+				}},
+			}, nil
+		},
+	}
+
+	info, err := CreateInstance(context.Background(), mockClient, CreateInstanceConfig{ImageID: "ami-1234567890abcdef0", Hibernation: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !info.HibernationConfigured {
+		t.Error("expected the instance to report hibernation as configured")
+	}
+}
+
 func TestCreateInstance_RunInstancesError(t *testing.T) {
 	ctx := context.Background()
 	expectedError := fmt.Errorf("AWS API error: insufficient capacity")
@@ -86,3 +132,163 @@ func TestCreateInstance_RunInstancesError(t *testing.T) {
 		t.Errorf("expected error message to contain 'failed to run instance', got %v", err)
 	}
 }
+
+func TestGetInstance_NotInReservations(t *testing.T) {
+	ctx := context.Background()
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{}, nil
+		},
+	}
+
+	_, err := GetInstance(ctx, mockClient, "i-1234567890abcdef0")
+	if !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+}
+
+func TestGetInstance_SpotLifecycle(t *testing.T) {
+	ctx := context.Background()
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{
+						Instances: []types.Instance{
+							{
+								InstanceId:        aws.String(expectedInstanceID),
+								State:             &types.InstanceState{Name: types.InstanceStateNameStopped},
+								StateReason:       &types.StateReason{Message: aws.String("Client.UserInitiatedShutdown: User initiated shutdown")},
+								InstanceLifecycle: types.InstanceLifecycleTypeSpot,
+								Tags:              []types.Tag{{Key: aws.String("ImageID"), Value: aws.String("fedora-43-aarch64-76f2ddd3bac7da2b")}},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	info, err := GetInstance(ctx, mockClient, expectedInstanceID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.Lifecycle != "spot" {
+		t.Errorf("expected lifecycle spot, got %s", info.Lifecycle)
+	}
+	if info.StateReason == "" {
+		t.Error("expected state reason to be set")
+	}
+	if info.ImageID != "fedora-43-aarch64-76f2ddd3bac7da2b" {
+		t.Errorf("expected ImageID from instance tag, got %s", info.ImageID)
+	}
+}
+
+func TestDeleteInstance_CancelsSpotRequest(t *testing.T) {
+	ctx := context.Background()
+	var calls []string
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{
+						Instances: []types.Instance{
+							{
+								InstanceId:            aws.String("i-1"),
+								State:                 &types.InstanceState{Name: types.InstanceStateNameStopped},
+								InstanceLifecycle:     types.InstanceLifecycleTypeSpot,
+								SpotInstanceRequestId: aws.String("sir-1"),
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		CancelSpotInstanceRequestsFunc: func(ctx context.Context, params *awsec2.CancelSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.CancelSpotInstanceRequestsOutput, error) {
+			calls = append(calls, "cancel "+strings.Join(params.SpotInstanceRequestIds, ","))
+			return &awsec2.CancelSpotInstanceRequestsOutput{}, nil
+		},
+		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+			calls = append(calls, "terminate "+strings.Join(params.InstanceIds, ","))
+			return &awsec2.TerminateInstancesOutput{
+				TerminatingInstances: []types.InstanceStateChange{
+					{
+						InstanceId:    aws.String("i-1"),
+						PreviousState: &types.InstanceState{Name: types.InstanceStateNameStopped},
+						CurrentState:  &types.InstanceState{Name: types.InstanceStateNameShuttingDown},
+					},
+				},
+			}, nil
+		},
+	}
+
+	if err := DeleteInstance(ctx, mockClient, "i-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Join(calls, "; ") != "cancel sir-1; terminate i-1" {
+		t.Errorf("expected the spot request to be cancelled before termination, got %v", calls)
+	}
+}
+
+func TestCreateInstances_ReplayKeepsNames(t *testing.T) {
+	mockClient := &MockEC2Client{
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			// EC2 returns the instances of the original launch
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{{
+					InstanceId: aws.String("i-1"),
+					State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+					Tags:       []types.Tag{{Key: aws.String(TagName), Value: aws.String("web-1")}},
+				}},
+			}, nil
+		},
+		CreateTagsFunc: func(ctx context.Context, params *awsec2.CreateTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateTagsOutput, error) {
+			t.Errorf("expected a named instance not to be renamed, got %+v", params.Tags)
+			return &awsec2.CreateTagsOutput{}, nil
+		},
+	}
+
+	instances, err := CreateInstances(context.Background(), mockClient, CreateInstanceConfig{ImageID: "ami-1", ClientToken: "token"}, []string{"web-2"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if instances[0].Name != "web-1" {
+		t.Errorf("expected the original name, got %s", instances[0].Name)
+	}
+}
+
+func TestCreateInstances_PartialLaunch(t *testing.T) {
+	var named []string
+	mockClient := &MockEC2Client{
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			if aws.ToInt32(params.MinCount) != 1 || aws.ToInt32(params.MaxCount) != 3 {
+				t.Errorf("expected between 1 and 3 instances, got %v to %v", aws.ToInt32(params.MinCount), aws.ToInt32(params.MaxCount))
+			}
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{
+					{InstanceId: aws.String("i-1"), State: &types.InstanceState{Name: types.InstanceStateNamePending}},
+					{InstanceId: aws.String("i-2"), State: &types.InstanceState{Name: types.InstanceStateNamePending}},
+				},
+			}, nil
+		},
+		CreateTagsFunc: func(ctx context.Context, params *awsec2.CreateTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateTagsOutput, error) {
+			named = append(named, params.Resources[0]+"="+aws.ToString(params.Tags[0].Value))
+			return &awsec2.CreateTagsOutput{}, nil
+		},
+	}
+
+	instances, err := CreateInstances(context.Background(), mockClient, CreateInstanceConfig{ImageID: "ami-1234567890abcdef0"}, []string{"web-1", "web-2", "web-3"})
+	if !errors.Is(err, ErrPartialLaunch) {
+		t.Fatalf("expected ErrPartialLaunch, got %v", err)
+	}
+	if len(instances) != 2 || instances[0].Name != "web-1" || instances[1].Name != "web-2" {
+		t.Errorf("expected web-1 and web-2 to be launched, got %+v", instances)
+	}
+	if strings.Join(named, ",") != "i-1=web-1,i-2=web-2" {
+		t.Errorf("expected the instances to be named in launch order, got %v", named)
+	}
+}
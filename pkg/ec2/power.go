@@ -0,0 +1,171 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var ErrInvalidStateTransition = errkind.New(errkind.Conflict, "invalid state transition")
+
+// ErrHibernationNotConfigured is returned when hibernating an instance that
+// was not launched with hibernation enabled. EC2 would accept the stop and
+// then fail it.
+var ErrHibernationNotConfigured = errkind.New(errkind.Conflict, "hibernation not configured")
+
+type PowerAction string
+
+const (
+	PowerActionStart     PowerAction = "start"
+	PowerActionStop      PowerAction = "stop"
+	PowerActionHibernate PowerAction = "hibernate"
+	PowerActionForceStop PowerAction = "force-stop"
+	PowerActionReboot    PowerAction = "reboot"
+)
+
+// allowedPowerTransitions lists the states an instance must be in for a
+// power action to be accepted. EC2 rejects most of the others anyway, but
+// checking up front gives callers a clear error instead of an API fault.
+var allowedPowerTransitions = map[PowerAction][]types.InstanceStateName{
+	PowerActionStart:     {types.InstanceStateNameStopped},
+	PowerActionStop:      {types.InstanceStateNameRunning},
+	PowerActionHibernate: {types.InstanceStateNameRunning},
+	PowerActionForceStop: {types.InstanceStateNameRunning, types.InstanceStateNameStopping},
+	PowerActionReboot:    {types.InstanceStateNameRunning},
+}
+
+// SettledState returns the state an instance ends up in once the action
+// has completed, and false for a reboot: the instance stays running
+// throughout, so there is no state change to wait for.
+func (a PowerAction) SettledState() (types.InstanceStateName, bool) {
+	switch a {
+	case PowerActionReboot:
+		return "", false
+	case PowerActionStart:
+		return types.InstanceStateNameRunning, true
+	default:
+		return types.InstanceStateNameStopped, true
+	}
+}
+
+func ValidatePowerTransition(action PowerAction, state string) error {
+	allowed, ok := allowedPowerTransitions[action]
+	if !ok {
+		return fmt.Errorf("unknown power action: %s", action)
+	}
+	if !slices.Contains(allowed, types.InstanceStateName(state)) {
+		return fmt.Errorf("%w: cannot %s instance in %s state", ErrInvalidStateTransition, action, state)
+	}
+	return nil
+}
+
+func StartInstance(ctx context.Context, client EC2Client, instanceID string) error {
+	if err := checkPowerTransition(ctx, client, instanceID, PowerActionStart); err != nil {
+		return err
+	}
+
+	slog.Info("Starting EC2 instance", "instance_id", instanceID)
+	result, err := client.StartInstances(ctx, &awsec2.StartInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		slog.Error("Failed to start instance", "instance_id", instanceID, "error", err)
+		return fmt.Errorf("failed to start instance: %w", err)
+	}
+
+	logStateChanges("Instance start initiated", result.StartingInstances)
+	return nil
+}
+
+type StopInstanceOptions struct {
+	Hibernate bool
+	Force     bool
+}
+
+func StopInstance(ctx context.Context, client EC2Client, instanceID string, opts StopInstanceOptions) error {
+	action := PowerActionStop
+	switch {
+	case opts.Force:
+		action = PowerActionForceStop
+	case opts.Hibernate:
+		action = PowerActionHibernate
+	}
+
+	info, err := GetInstance(ctx, client, instanceID)
+	if err != nil {
+		return err
+	}
+	if err := ValidatePowerTransition(action, info.State); err != nil {
+		return err
+	}
+	if action == PowerActionHibernate && !info.HibernationConfigured {
+		return fmt.Errorf("%w: instance %s was not launched with hibernation enabled", ErrHibernationNotConfigured, instanceID)
+	}
+
+	slog.Info("Stopping EC2 instance", "instance_id", instanceID, "hibernate", opts.Hibernate, "force", opts.Force)
+	stopInput := &awsec2.StopInstancesInput{
+		InstanceIds: []string{instanceID},
+	}
+	if opts.Hibernate {
+		stopInput.Hibernate = &opts.Hibernate
+	}
+	if opts.Force {
+		stopInput.Force = &opts.Force
+	}
+
+	result, err := client.StopInstances(ctx, stopInput)
+	if err != nil {
+		slog.Error("Failed to stop instance", "instance_id", instanceID, "error", err)
+		return fmt.Errorf("failed to stop instance: %w", err)
+	}
+
+	logStateChanges("Instance stop initiated", result.StoppingInstances)
+	return nil
+}
+
+func RebootInstance(ctx context.Context, client EC2Client, instanceID string) error {
+	if err := checkPowerTransition(ctx, client, instanceID, PowerActionReboot); err != nil {
+		return err
+	}
+
+	slog.Info("Rebooting EC2 instance", "instance_id", instanceID)
+	_, err := client.RebootInstances(ctx, &awsec2.RebootInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		slog.Error("Failed to reboot instance", "instance_id", instanceID, "error", err)
+		return fmt.Errorf("failed to reboot instance: %w", err)
+	}
+
+	slog.Info("Instance reboot initiated", "instance_id", instanceID)
+	return nil
+}
+
+func checkPowerTransition(ctx context.Context, client EC2Client, instanceID string, action PowerAction) error {
+	info, err := GetInstance(ctx, client, instanceID)
+	if err != nil {
+		return err
+	}
+	return ValidatePowerTransition(action, info.State)
+}
+
+func logStateChanges(msg string, changes []types.InstanceStateChange) {
+	for _, change := range changes {
+		var previous, current types.InstanceStateName
+		if change.PreviousState != nil {
+			previous = change.PreviousState.Name
+		}
+		if change.CurrentState != nil {
+			current = change.CurrentState.Name
+		}
+		slog.Info(msg,
+			"instance_id", getPtrStringValue(change.InstanceId),
+			"previous_state", previous,
+			"current_state", current)
+	}
+}
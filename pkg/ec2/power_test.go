@@ -0,0 +1,129 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func newDescribeInstancesFunc(instanceID string, state types.InstanceStateName) func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+	return func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+		return &awsec2.DescribeInstancesOutput{
+			Reservations: []types.Reservation{
+				{
+					Instances: []types.Instance{
+						{
+							InstanceId: aws.String(instanceID),
+							State:      &types.InstanceState{Name: state},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+}
+
+func TestValidatePowerTransition(t *testing.T) {
+	tests := []struct {
+		action  PowerAction
+		state   types.InstanceStateName
+		wantErr bool
+	}{
+		{PowerActionStart, types.InstanceStateNameStopped, false},
+		{PowerActionStart, types.InstanceStateNameRunning, true},
+		{PowerActionStop, types.InstanceStateNameRunning, false},
+		{PowerActionStop, types.InstanceStateNameStopping, true},
+		{PowerActionHibernate, types.InstanceStateNameRunning, false},
+		{PowerActionForceStop, types.InstanceStateNameStopping, false},
+		{PowerActionForceStop, types.InstanceStateNameStopped, true},
+		{PowerActionReboot, types.InstanceStateNameRunning, false},
+		{PowerActionReboot, types.InstanceStateNameTerminated, true},
+	}
+
+	for _, tt := range tests {
+		err := ValidatePowerTransition(tt.action, string(tt.state))
+		if tt.wantErr && !errors.Is(err, ErrInvalidStateTransition) {
+			t.Errorf("%s from %s: expected ErrInvalidStateTransition, got %v", tt.action, tt.state, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s from %s: expected no error, got %v", tt.action, tt.state, err)
+		}
+	}
+}
+
+func TestStopInstance_Hibernate(t *testing.T) {
+	ctx := context.Background()
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{{
+					Instances: []types.Instance{{
+						InstanceId:         aws.String(expectedInstanceID),
+						State:              &types.InstanceState{Name: types.InstanceStateNameRunning},
+						HibernationOptions: &types.HibernationOptions{Configured: aws.Bool(true)},
+					}},
+				}},
+			}, nil
+		},
+		StopInstancesFunc: func(ctx context.Context, params *awsec2.StopInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StopInstancesOutput, error) {
+			if params.Hibernate == nil || !*params.Hibernate {
+				t.Errorf("expected hibernate to be set, got %v", params.Hibernate)
+			}
+			if params.Force != nil {
+				t.Errorf("expected force to be unset, got %v", *params.Force)
+			}
+			return &awsec2.StopInstancesOutput{}, nil
+		},
+	}
+
+	if err := StopInstance(ctx, mockClient, expectedInstanceID, StopInstanceOptions{Hibernate: true}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestStopInstance_HibernationNotConfigured(t *testing.T) {
+	ctx := context.Background()
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: newDescribeInstancesFunc(expectedInstanceID, types.InstanceStateNameRunning),
+		StopInstancesFunc: func(ctx context.Context, params *awsec2.StopInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StopInstancesOutput, error) {
+			t.Error("expected StopInstances not to be called")
+			return &awsec2.StopInstancesOutput{}, nil
+		},
+	}
+
+	err := StopInstance(ctx, mockClient, expectedInstanceID, StopInstanceOptions{Hibernate: true})
+	if !errors.Is(err, ErrHibernationNotConfigured) {
+		t.Fatalf("expected ErrHibernationNotConfigured, got %v", err)
+	}
+	if errkind.Of(err) != errkind.Conflict {
+		t.Errorf("expected a conflict, got %v", errkind.Of(err))
+	}
+}
+
+func TestStartInstance_InvalidState(t *testing.T) {
+	ctx := context.Background()
+	expectedInstanceID := "i-1234567890abcdef0"
+
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: newDescribeInstancesFunc(expectedInstanceID, types.InstanceStateNameRunning),
+		StartInstancesFunc: func(ctx context.Context, params *awsec2.StartInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StartInstancesOutput, error) {
+			t.Error("StartInstances should not be called for a running instance")
+			return &awsec2.StartInstancesOutput{}, nil
+		},
+	}
+
+	err := StartInstance(ctx, mockClient, expectedInstanceID)
+	if !errors.Is(err, ErrInvalidStateTransition) {
+		t.Errorf("expected ErrInvalidStateTransition, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package ec2
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// TagSpotReplace marks spot nodes that are replaced when EC2 reclaims them.
+const TagSpotReplace = "SpotReplace"
+
+var ErrInvalidSpotOptions = errkind.New(errkind.InvalidInput, "invalid spot options")
+
+type SpotOptions struct {
+	// MaxPrice is the maximum hourly price in USD, e.g. "0.005". Empty caps
+	// the price at the on-demand price.
+	MaxPrice string
+	// InterruptionBehavior is what EC2 does when it reclaims the instance;
+	// terminate when empty
+	InterruptionBehavior types.InstanceInterruptionBehavior
+}
+
+func (o SpotOptions) Validate() error {
+	if o.MaxPrice != "" {
+		price, err := strconv.ParseFloat(o.MaxPrice, 64)
+		if err != nil || price <= 0 {
+			return fmt.Errorf("%w: max price must be a positive number, got %q", ErrInvalidSpotOptions, o.MaxPrice)
+		}
+	}
+	switch o.InterruptionBehavior {
+	case "", types.InstanceInterruptionBehaviorTerminate, types.InstanceInterruptionBehaviorStop, types.InstanceInterruptionBehaviorHibernate:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown interruption behavior %q", ErrInvalidSpotOptions, o.InterruptionBehavior)
+	}
+}
+
+func (o SpotOptions) marketOptions() *types.InstanceMarketOptionsRequest {
+	behavior := o.InterruptionBehavior
+	if behavior == "" {
+		behavior = types.InstanceInterruptionBehaviorTerminate
+	}
+	spot := &types.SpotMarketOptions{
+		InstanceInterruptionBehavior: behavior,
+		SpotInstanceType:             types.SpotInstanceTypeOneTime,
+	}
+	// Stopped and hibernated spot instances are resumed by their request,
+	// so EC2 requires a persistent one
+	if behavior != types.InstanceInterruptionBehaviorTerminate {
+		spot.SpotInstanceType = types.SpotInstanceTypePersistent
+	}
+	if o.MaxPrice != "" {
+		spot.MaxPrice = aws.String(o.MaxPrice)
+	}
+	return &types.InstanceMarketOptionsRequest{
+		MarketType:  types.MarketTypeSpot,
+		SpotOptions: spot,
+	}
+}
+
+// SpotStatus is the state of the spot request behind a spot instance.
+type SpotStatus struct {
+	RequestID            string
+	State                string
+	StatusCode           string
+	StatusMessage        string
+	MaxPrice             string
+	InterruptionBehavior string
+}
+
+// Interrupted reports whether EC2 has reclaimed the instance or is about to.
+// Stops and terminations initiated by the user do not count.
+func (s SpotStatus) Interrupted() bool {
+	code := s.StatusCode
+	if strings.HasSuffix(code, "-by-user") {
+		return false
+	}
+	return strings.HasPrefix(code, "marked-for-") ||
+		strings.HasPrefix(code, "instance-terminated-") ||
+		strings.HasPrefix(code, "instance-stopped-") ||
+		strings.HasPrefix(code, "instance-hibernated-")
+}
+
+// DescribeSpotStatus returns the status of the given spot requests by ID.
+func DescribeSpotStatus(ctx context.Context, client EC2Client, requestIDs []string) (map[string]SpotStatus, error) {
+	statuses := make(map[string]SpotStatus, len(requestIDs))
+	if len(requestIDs) == 0 {
+		return statuses, nil
+	}
+
+	result, err := client.DescribeSpotInstanceRequests(ctx, &awsec2.DescribeSpotInstanceRequestsInput{
+		SpotInstanceRequestIds: requestIDs,
+	})
+	if err != nil {
+		slog.Error("Failed to describe spot instance requests", "error", err)
+		return nil, fmt.Errorf("failed to describe spot instance requests: %w", err)
+	}
+
+	for _, request := range result.SpotInstanceRequests {
+		status := SpotStatus{
+			RequestID:            getPtrStringValue(request.SpotInstanceRequestId),
+			State:                string(request.State),
+			MaxPrice:             getPtrStringValue(request.SpotPrice),
+			InterruptionBehavior: string(request.InstanceInterruptionBehavior),
+		}
+		if request.Status != nil {
+			status.StatusCode = getPtrStringValue(request.Status.Code)
+			status.StatusMessage = getPtrStringValue(request.Status.Message)
+		}
+		statuses[status.RequestID] = status
+	}
+	return statuses, nil
+}
+
+// AttachSpotStatus looks up the spot requests of the spot instances in a
+// single call and sets their Spot field.
+func AttachSpotStatus(ctx context.Context, client EC2Client, instances []InstanceInfo) error {
+	var requestIDs []string
+	for _, info := range instances {
+		if info.SpotRequestID != "" {
+			requestIDs = append(requestIDs, info.SpotRequestID)
+		}
+	}
+	if len(requestIDs) == 0 {
+		return nil
+	}
+
+	statuses, err := DescribeSpotStatus(ctx, client, requestIDs)
+	if err != nil {
+		return err
+	}
+	for i := range instances {
+		if status, ok := statuses[instances[i].SpotRequestID]; ok {
+			instances[i].Spot = &status
+		}
+	}
+	return nil
+}
+
+// ListSpotInstances returns all managed spot instances, including ones that
+// were recently terminated.
+func ListSpotInstances(ctx context.Context, client EC2Client) ([]InstanceInfo, error) {
+	describeResult, err := client.DescribeInstances(ctx, &awsec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("instance-lifecycle"),
+				Values: []string{string(types.InstanceLifecycleTypeSpot)},
+			},
+			{
+				Name:   aws.String("tag:" + TagManagedBy),
+				Values: []string{ManagedByValue},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to describe spot instances", "error", err)
+		return nil, fmt.Errorf("failed to describe instances: %w", err)
+	}
+
+	var instances []InstanceInfo
+	for _, reservation := range describeResult.Reservations {
+		for _, instance := range reservation.Instances {
+			instances = append(instances, newInstanceInfo(instance))
+		}
+	}
+	return instances, nil
+}
+
+// GetUserData returns the decoded user data the instance was launched with.
+func GetUserData(ctx context.Context, client EC2Client, instanceID string) (string, error) {
+	result, err := client.DescribeInstanceAttribute(ctx, &awsec2.DescribeInstanceAttributeInput{
+		InstanceId: aws.String(instanceID),
+		Attribute:  types.InstanceAttributeNameUserData,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe user data of %s: %w", instanceID, err)
+	}
+	if result.UserData == nil || result.UserData.Value == nil {
+		return "", nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(*result.UserData.Value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode user data of %s: %w", instanceID, err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,173 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestCreateInstance_Spot(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      SpotOptions
+		expectedType types.SpotInstanceType
+		expectedBy   types.InstanceInterruptionBehavior
+	}{
+		{"defaults", SpotOptions{}, types.SpotInstanceTypeOneTime, types.InstanceInterruptionBehaviorTerminate},
+		{"stop", SpotOptions{MaxPrice: "0.005", InterruptionBehavior: types.InstanceInterruptionBehaviorStop}, types.SpotInstanceTypePersistent, types.InstanceInterruptionBehaviorStop},
+		{"hibernate", SpotOptions{InterruptionBehavior: types.InstanceInterruptionBehaviorHibernate}, types.SpotInstanceTypePersistent, types.InstanceInterruptionBehaviorHibernate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockEC2Client{
+				RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+					market := params.InstanceMarketOptions
+					if market == nil || market.MarketType != types.MarketTypeSpot || market.SpotOptions == nil {
+						t.Fatalf("expected spot market options, got %+v", market)
+					}
+					if market.SpotOptions.SpotInstanceType != tt.expectedType {
+						t.Errorf("expected spot instance type %s, got %s", tt.expectedType, market.SpotOptions.SpotInstanceType)
+					}
+					if market.SpotOptions.InstanceInterruptionBehavior != tt.expectedBy {
+						t.Errorf("expected interruption behavior %s, got %s", tt.expectedBy, market.SpotOptions.InstanceInterruptionBehavior)
+					}
+					if aws.ToString(market.SpotOptions.MaxPrice) != tt.options.MaxPrice {
+						t.Errorf("expected max price %q, got %q", tt.options.MaxPrice, aws.ToString(market.SpotOptions.MaxPrice))
+					}
+					return &awsec2.RunInstancesOutput{
+						Instances: []types.Instance{{
+							InstanceId:            aws.String("i-1234567890abcdef0"),
+							State:                 &types.InstanceState{Name: types.InstanceStateNamePending},
+							InstanceLifecycle:     types.InstanceLifecycleTypeSpot,
+							SpotInstanceRequestId: aws.String("sir-1"),
+						}},
+					}, nil
+				},
+			}
+
+			options := tt.options
+			info, err := CreateInstance(context.Background(), mockClient, CreateInstanceConfig{
+				ImageID:      "ami-1234567890abcdef0",
+				InstanceType: types.InstanceTypeT4gMicro,
+				Spot:         &options,
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if info.Lifecycle != "spot" || info.SpotRequestID != "sir-1" {
+				t.Errorf("expected spot instance with request sir-1, got %s and %q", info.Lifecycle, info.SpotRequestID)
+			}
+		})
+	}
+}
+
+func TestCreateInstance_InvalidSpotOptions(t *testing.T) {
+	mockClient := &MockEC2Client{
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			t.Fatal("RunInstances must not be called with invalid spot options")
+			return nil, nil
+		},
+	}
+
+	for _, options := range []SpotOptions{
+		{MaxPrice: "cheap"},
+		{MaxPrice: "-1"},
+		{InterruptionBehavior: "explode"},
+	} {
+		_, err := CreateInstance(context.Background(), mockClient, CreateInstanceConfig{
+			ImageID:      "ami-1234567890abcdef0",
+			InstanceType: types.InstanceTypeT4gMicro,
+			Spot:         &options,
+		})
+		if !errors.Is(err, ErrInvalidSpotOptions) {
+			t.Errorf("%+v: expected ErrInvalidSpotOptions, got %v", options, err)
+		}
+	}
+}
+
+func TestSpotStatus_Interrupted(t *testing.T) {
+	tests := map[string]bool{
+		"fulfilled":                                   false,
+		"marked-for-termination":                      true,
+		"marked-for-stop":                             true,
+		"instance-terminated-no-capacity":             true,
+		"instance-stopped-by-price":                   true,
+		"instance-hibernated-no-capacity":             true,
+		"instance-terminated-by-user":                 false,
+		"instance-stopped-by-user":                    false,
+		"instance-terminated-capacity-oversubscribed": true,
+	}
+
+	for code, expected := range tests {
+		if got := (SpotStatus{StatusCode: code}).Interrupted(); got != expected {
+			t.Errorf("%s: expected interrupted %v, got %v", code, expected, got)
+		}
+	}
+}
+
+func TestAttachSpotStatus(t *testing.T) {
+	mockClient := &MockEC2Client{
+		DescribeSpotInstanceRequestsFunc: func(ctx context.Context, params *awsec2.DescribeSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSpotInstanceRequestsOutput, error) {
+			if len(params.SpotInstanceRequestIds) != 1 || params.SpotInstanceRequestIds[0] != "sir-1" {
+				t.Errorf("expected only the spot request to be described, got %v", params.SpotInstanceRequestIds)
+			}
+			return &awsec2.DescribeSpotInstanceRequestsOutput{
+				SpotInstanceRequests: []types.SpotInstanceRequest{{
+					SpotInstanceRequestId:        aws.String("sir-1"),
+					State:                        types.SpotInstanceStateActive,
+					SpotPrice:                    aws.String("0.005"),
+					InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
+					Status: &types.SpotInstanceStatus{
+						Code:    aws.String("marked-for-termination"),
+						Message: aws.String("Spot Instance is marked for termination"),
+					},
+				}},
+			}, nil
+		},
+	}
+
+	instances := []InstanceInfo{
+		{InstanceID: "i-ondemand"},
+		{InstanceID: "i-spot", SpotRequestID: "sir-1"},
+	}
+	if err := AttachSpotStatus(context.Background(), mockClient, instances); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if instances[0].Spot != nil {
+		t.Errorf("expected no spot status for the on-demand instance, got %+v", instances[0].Spot)
+	}
+	spot := instances[1].Spot
+	if spot == nil {
+		t.Fatal("expected spot status for the spot instance")
+	}
+	if spot.State != "active" || spot.MaxPrice != "0.005" || spot.InterruptionBehavior != "terminate" || !spot.Interrupted() {
+		t.Errorf("unexpected spot status %+v", spot)
+	}
+}
+
+func TestGetUserData(t *testing.T) {
+	mockClient := &MockEC2Client{
+		DescribeInstanceAttributeFunc: func(ctx context.Context, params *awsec2.DescribeInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceAttributeOutput, error) {
+			if params.Attribute != types.InstanceAttributeNameUserData {
+				t.Errorf("expected userData attribute, got %s", params.Attribute)
+			}
+			return &awsec2.DescribeInstanceAttributeOutput{
+				UserData: &types.AttributeValue{Value: aws.String("I2Nsb3VkLWNvbmZpZwo=")},
+			}, nil
+		},
+	}
+
+	userData, err := GetUserData(context.Background(), mockClient, "i-1234567890abcdef0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if userData != "#cloud-config\n" {
+		t.Errorf("expected decoded user data, got %q", userData)
+	}
+}
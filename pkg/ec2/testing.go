@@ -8,10 +8,41 @@ import (
 )
 
 type MockEC2Client struct {
-	RunInstancesFunc       func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error)
-	DescribeInstancesFunc  func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error)
-	TerminateInstancesFunc func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error)
-	DescribeImagesFunc     func(ctx context.Context, params *awsec2.DescribeImagesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeImagesOutput, error)
+	RunInstancesFunc                               func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error)
+	DescribeInstancesFunc                          func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error)
+	TerminateInstancesFunc                         func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error)
+	DescribeImagesFunc                             func(ctx context.Context, params *awsec2.DescribeImagesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeImagesOutput, error)
+	StartInstancesFunc                             func(ctx context.Context, params *awsec2.StartInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StartInstancesOutput, error)
+	StopInstancesFunc                              func(ctx context.Context, params *awsec2.StopInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StopInstancesOutput, error)
+	RebootInstancesFunc                            func(ctx context.Context, params *awsec2.RebootInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RebootInstancesOutput, error)
+	ImportKeyPairFunc                              func(ctx context.Context, params *awsec2.ImportKeyPairInput, optFns ...func(*awsec2.Options)) (*awsec2.ImportKeyPairOutput, error)
+	DescribeKeyPairsFunc                           func(ctx context.Context, params *awsec2.DescribeKeyPairsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeKeyPairsOutput, error)
+	DeleteKeyPairFunc                              func(ctx context.Context, params *awsec2.DeleteKeyPairInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteKeyPairOutput, error)
+	CreateSecurityGroupFunc                        func(ctx context.Context, params *awsec2.CreateSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateSecurityGroupOutput, error)
+	DeleteSecurityGroupFunc                        func(ctx context.Context, params *awsec2.DeleteSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteSecurityGroupOutput, error)
+	DescribeSecurityGroupsFunc                     func(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error)
+	AuthorizeSecurityGroupIngressFunc              func(ctx context.Context, params *awsec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.AuthorizeSecurityGroupIngressOutput, error)
+	RevokeSecurityGroupIngressFunc                 func(ctx context.Context, params *awsec2.RevokeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.RevokeSecurityGroupIngressOutput, error)
+	ModifyInstanceAttributeFunc                    func(ctx context.Context, params *awsec2.ModifyInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.ModifyInstanceAttributeOutput, error)
+	DescribeInstanceStatusFunc                     func(ctx context.Context, params *awsec2.DescribeInstanceStatusInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceStatusOutput, error)
+	DescribeSpotInstanceRequestsFunc               func(ctx context.Context, params *awsec2.DescribeSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSpotInstanceRequestsOutput, error)
+	CancelSpotInstanceRequestsFunc                 func(ctx context.Context, params *awsec2.CancelSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.CancelSpotInstanceRequestsOutput, error)
+	DescribeInstanceAttributeFunc                  func(ctx context.Context, params *awsec2.DescribeInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceAttributeOutput, error)
+	CreateVolumeFunc                               func(ctx context.Context, params *awsec2.CreateVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateVolumeOutput, error)
+	DescribeVolumesFunc                            func(ctx context.Context, params *awsec2.DescribeVolumesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeVolumesOutput, error)
+	DeleteVolumeFunc                               func(ctx context.Context, params *awsec2.DeleteVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteVolumeOutput, error)
+	AttachVolumeFunc                               func(ctx context.Context, params *awsec2.AttachVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.AttachVolumeOutput, error)
+	DetachVolumeFunc                               func(ctx context.Context, params *awsec2.DetachVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.DetachVolumeOutput, error)
+	AllocateAddressFunc                            func(ctx context.Context, params *awsec2.AllocateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AllocateAddressOutput, error)
+	AssociateAddressFunc                           func(ctx context.Context, params *awsec2.AssociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AssociateAddressOutput, error)
+	DisassociateAddressFunc                        func(ctx context.Context, params *awsec2.DisassociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.DisassociateAddressOutput, error)
+	ReleaseAddressFunc                             func(ctx context.Context, params *awsec2.ReleaseAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.ReleaseAddressOutput, error)
+	DescribeAddressesFunc                          func(ctx context.Context, params *awsec2.DescribeAddressesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeAddressesOutput, error)
+	CreateTagsFunc                                 func(ctx context.Context, params *awsec2.CreateTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateTagsOutput, error)
+	DeleteTagsFunc                                 func(ctx context.Context, params *awsec2.DeleteTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteTagsOutput, error)
+	GetConsoleOutputFunc                           func(ctx context.Context, params *awsec2.GetConsoleOutputInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleOutputOutput, error)
+	GetConsoleScreenshotFunc                       func(ctx context.Context, params *awsec2.GetConsoleScreenshotInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleScreenshotOutput, error)
+	UpdateSecurityGroupRuleDescriptionsIngressFunc func(ctx context.Context, params *awsec2.UpdateSecurityGroupRuleDescriptionsIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.UpdateSecurityGroupRuleDescriptionsIngressOutput, error)
 }
 
 func (m *MockEC2Client) RunInstances(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
@@ -41,3 +72,220 @@ func (m *MockEC2Client) DescribeImages(ctx context.Context, params *awsec2.Descr
 	}
 	return nil, fmt.Errorf("DescribeImagesFunc not set")
 }
+
+func (m *MockEC2Client) StartInstances(ctx context.Context, params *awsec2.StartInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StartInstancesOutput, error) {
+	if m.StartInstancesFunc != nil {
+		return m.StartInstancesFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("StartInstancesFunc not set")
+}
+
+func (m *MockEC2Client) StopInstances(ctx context.Context, params *awsec2.StopInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StopInstancesOutput, error) {
+	if m.StopInstancesFunc != nil {
+		return m.StopInstancesFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("StopInstancesFunc not set")
+}
+
+func (m *MockEC2Client) RebootInstances(ctx context.Context, params *awsec2.RebootInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RebootInstancesOutput, error) {
+	if m.RebootInstancesFunc != nil {
+		return m.RebootInstancesFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("RebootInstancesFunc not set")
+}
+
+func (m *MockEC2Client) ImportKeyPair(ctx context.Context, params *awsec2.ImportKeyPairInput, optFns ...func(*awsec2.Options)) (*awsec2.ImportKeyPairOutput, error) {
+	if m.ImportKeyPairFunc != nil {
+		return m.ImportKeyPairFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("ImportKeyPairFunc not set")
+}
+
+func (m *MockEC2Client) DescribeKeyPairs(ctx context.Context, params *awsec2.DescribeKeyPairsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeKeyPairsOutput, error) {
+	if m.DescribeKeyPairsFunc != nil {
+		return m.DescribeKeyPairsFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeKeyPairsFunc not set")
+}
+
+func (m *MockEC2Client) DeleteKeyPair(ctx context.Context, params *awsec2.DeleteKeyPairInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteKeyPairOutput, error) {
+	if m.DeleteKeyPairFunc != nil {
+		return m.DeleteKeyPairFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DeleteKeyPairFunc not set")
+}
+
+func (m *MockEC2Client) CreateSecurityGroup(ctx context.Context, params *awsec2.CreateSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateSecurityGroupOutput, error) {
+	if m.CreateSecurityGroupFunc != nil {
+		return m.CreateSecurityGroupFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("CreateSecurityGroupFunc not set")
+}
+
+func (m *MockEC2Client) DeleteSecurityGroup(ctx context.Context, params *awsec2.DeleteSecurityGroupInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteSecurityGroupOutput, error) {
+	if m.DeleteSecurityGroupFunc != nil {
+		return m.DeleteSecurityGroupFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DeleteSecurityGroupFunc not set")
+}
+
+func (m *MockEC2Client) DescribeSecurityGroups(ctx context.Context, params *awsec2.DescribeSecurityGroupsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSecurityGroupsOutput, error) {
+	if m.DescribeSecurityGroupsFunc != nil {
+		return m.DescribeSecurityGroupsFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeSecurityGroupsFunc not set")
+}
+
+func (m *MockEC2Client) AuthorizeSecurityGroupIngress(ctx context.Context, params *awsec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.AuthorizeSecurityGroupIngressOutput, error) {
+	if m.AuthorizeSecurityGroupIngressFunc != nil {
+		return m.AuthorizeSecurityGroupIngressFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("AuthorizeSecurityGroupIngressFunc not set")
+}
+
+func (m *MockEC2Client) RevokeSecurityGroupIngress(ctx context.Context, params *awsec2.RevokeSecurityGroupIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.RevokeSecurityGroupIngressOutput, error) {
+	if m.RevokeSecurityGroupIngressFunc != nil {
+		return m.RevokeSecurityGroupIngressFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("RevokeSecurityGroupIngressFunc not set")
+}
+
+func (m *MockEC2Client) ModifyInstanceAttribute(ctx context.Context, params *awsec2.ModifyInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.ModifyInstanceAttributeOutput, error) {
+	if m.ModifyInstanceAttributeFunc != nil {
+		return m.ModifyInstanceAttributeFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("ModifyInstanceAttributeFunc not set")
+}
+
+func (m *MockEC2Client) DescribeInstanceStatus(ctx context.Context, params *awsec2.DescribeInstanceStatusInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceStatusOutput, error) {
+	if m.DescribeInstanceStatusFunc != nil {
+		return m.DescribeInstanceStatusFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeInstanceStatusFunc not set")
+}
+
+func (m *MockEC2Client) DescribeSpotInstanceRequests(ctx context.Context, params *awsec2.DescribeSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSpotInstanceRequestsOutput, error) {
+	if m.DescribeSpotInstanceRequestsFunc != nil {
+		return m.DescribeSpotInstanceRequestsFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeSpotInstanceRequestsFunc not set")
+}
+
+func (m *MockEC2Client) CancelSpotInstanceRequests(ctx context.Context, params *awsec2.CancelSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.CancelSpotInstanceRequestsOutput, error) {
+	if m.CancelSpotInstanceRequestsFunc != nil {
+		return m.CancelSpotInstanceRequestsFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("CancelSpotInstanceRequestsFunc not set")
+}
+
+func (m *MockEC2Client) DescribeInstanceAttribute(ctx context.Context, params *awsec2.DescribeInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceAttributeOutput, error) {
+	if m.DescribeInstanceAttributeFunc != nil {
+		return m.DescribeInstanceAttributeFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeInstanceAttributeFunc not set")
+}
+
+func (m *MockEC2Client) CreateVolume(ctx context.Context, params *awsec2.CreateVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateVolumeOutput, error) {
+	if m.CreateVolumeFunc != nil {
+		return m.CreateVolumeFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("CreateVolumeFunc not set")
+}
+
+func (m *MockEC2Client) DescribeVolumes(ctx context.Context, params *awsec2.DescribeVolumesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeVolumesOutput, error) {
+	if m.DescribeVolumesFunc != nil {
+		return m.DescribeVolumesFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeVolumesFunc not set")
+}
+
+func (m *MockEC2Client) DeleteVolume(ctx context.Context, params *awsec2.DeleteVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteVolumeOutput, error) {
+	if m.DeleteVolumeFunc != nil {
+		return m.DeleteVolumeFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DeleteVolumeFunc not set")
+}
+
+func (m *MockEC2Client) AttachVolume(ctx context.Context, params *awsec2.AttachVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.AttachVolumeOutput, error) {
+	if m.AttachVolumeFunc != nil {
+		return m.AttachVolumeFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("AttachVolumeFunc not set")
+}
+
+func (m *MockEC2Client) DetachVolume(ctx context.Context, params *awsec2.DetachVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.DetachVolumeOutput, error) {
+	if m.DetachVolumeFunc != nil {
+		return m.DetachVolumeFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DetachVolumeFunc not set")
+}
+
+func (m *MockEC2Client) AllocateAddress(ctx context.Context, params *awsec2.AllocateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AllocateAddressOutput, error) {
+	if m.AllocateAddressFunc != nil {
+		return m.AllocateAddressFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("AllocateAddressFunc not set")
+}
+
+func (m *MockEC2Client) AssociateAddress(ctx context.Context, params *awsec2.AssociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AssociateAddressOutput, error) {
+	if m.AssociateAddressFunc != nil {
+		return m.AssociateAddressFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("AssociateAddressFunc not set")
+}
+
+func (m *MockEC2Client) DisassociateAddress(ctx context.Context, params *awsec2.DisassociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.DisassociateAddressOutput, error) {
+	if m.DisassociateAddressFunc != nil {
+		return m.DisassociateAddressFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DisassociateAddressFunc not set")
+}
+
+func (m *MockEC2Client) ReleaseAddress(ctx context.Context, params *awsec2.ReleaseAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.ReleaseAddressOutput, error) {
+	if m.ReleaseAddressFunc != nil {
+		return m.ReleaseAddressFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("ReleaseAddressFunc not set")
+}
+
+func (m *MockEC2Client) DescribeAddresses(ctx context.Context, params *awsec2.DescribeAddressesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeAddressesOutput, error) {
+	if m.DescribeAddressesFunc != nil {
+		return m.DescribeAddressesFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeAddressesFunc not set")
+}
+
+func (m *MockEC2Client) CreateTags(ctx context.Context, params *awsec2.CreateTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateTagsOutput, error) {
+	if m.CreateTagsFunc != nil {
+		return m.CreateTagsFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("CreateTagsFunc not set")
+}
+
+func (m *MockEC2Client) DeleteTags(ctx context.Context, params *awsec2.DeleteTagsInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteTagsOutput, error) {
+	if m.DeleteTagsFunc != nil {
+		return m.DeleteTagsFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DeleteTagsFunc not set")
+}
+
+func (m *MockEC2Client) GetConsoleOutput(ctx context.Context, params *awsec2.GetConsoleOutputInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleOutputOutput, error) {
+	if m.GetConsoleOutputFunc != nil {
+		return m.GetConsoleOutputFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("GetConsoleOutputFunc not set")
+}
+
+func (m *MockEC2Client) GetConsoleScreenshot(ctx context.Context, params *awsec2.GetConsoleScreenshotInput, optFns ...func(*awsec2.Options)) (*awsec2.GetConsoleScreenshotOutput, error) {
+	if m.GetConsoleScreenshotFunc != nil {
+		return m.GetConsoleScreenshotFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("GetConsoleScreenshotFunc not set")
+}
+
+func (m *MockEC2Client) UpdateSecurityGroupRuleDescriptionsIngress(ctx context.Context, params *awsec2.UpdateSecurityGroupRuleDescriptionsIngressInput, optFns ...func(*awsec2.Options)) (*awsec2.UpdateSecurityGroupRuleDescriptionsIngressOutput, error) {
+	if m.UpdateSecurityGroupRuleDescriptionsIngressFunc != nil {
+		return m.UpdateSecurityGroupRuleDescriptionsIngressFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("UpdateSecurityGroupRuleDescriptionsIngressFunc not set")
+}
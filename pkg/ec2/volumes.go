@@ -0,0 +1,457 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var (
+	ErrVolumeNotFound     = errkind.New(errkind.NotFound, "volume not found")
+	ErrInvalidVolume      = errkind.New(errkind.InvalidInput, "invalid volume configuration")
+	ErrVolumeInUse        = errkind.New(errkind.Conflict, "volume is attached")
+	ErrVolumeNotAttached  = errkind.New(errkind.Conflict, "volume is not attached")
+	ErrVolumeZoneMismatch = errkind.New(errkind.Conflict, "volume and node are in different availability zones")
+	ErrNoFreeDevice       = errkind.New(errkind.Conflict, "no free device name")
+)
+
+const (
+	DefaultVolumeType = types.VolumeTypeGp3
+	maxVolumeSizeGiB  = 16384
+)
+
+// dataDeviceNames are the device names AWS recommends for EBS data volumes.
+// Nitro instances expose them as NVMe devices, but the mapping keeps them.
+var dataDeviceNames = []string{
+	"/dev/sdf", "/dev/sdg", "/dev/sdh", "/dev/sdi", "/dev/sdj", "/dev/sdk",
+	"/dev/sdl", "/dev/sdm", "/dev/sdn", "/dev/sdo", "/dev/sdp",
+}
+
+var (
+	// attachPollInterval and attachTimeout bound the wait for an attachment
+	// before delete-on-termination can be set on it
+	attachPollInterval = 2 * time.Second
+	attachTimeout      = 2 * time.Minute
+)
+
+type VolumeConfig struct {
+	Name             string
+	AvailabilityZone string
+	SizeGiB          int32
+	// Type defaults to gp3
+	Type types.VolumeType
+	// IOPS is only allowed for gp3, io1 and io2, and required for io1 and io2
+	IOPS int32
+	// Throughput in MiB/s is only allowed for gp3
+	Throughput int32
+	Encrypted  bool
+	// KMSKeyID selects the encryption key; the account default when empty
+	KMSKeyID string
+}
+
+type VolumeInfo struct {
+	VolumeID         string
+	Name             string
+	State            string
+	AvailabilityZone string
+	SizeGiB          int32
+	Type             string
+	IOPS             int32
+	Throughput       int32
+	Encrypted        bool
+	KMSKeyID         string
+	CreatedAt        time.Time
+	Attachments      []VolumeAttachmentInfo
+	Tags             map[string]string
+}
+
+type VolumeAttachmentInfo struct {
+	InstanceID          string
+	DeviceName          string
+	State               string
+	DeleteOnTermination bool
+	AttachedAt          time.Time
+}
+
+type AttachVolumeOptions struct {
+	// DeviceName is picked from the free data device names when empty
+	DeviceName string
+	// DeleteOnTermination deletes the volume together with the node
+	DeleteOnTermination bool
+}
+
+func (c VolumeConfig) withDefaults() VolumeConfig {
+	if c.Type == "" {
+		c.Type = DefaultVolumeType
+	}
+	return c
+}
+
+func (c VolumeConfig) Validate() error {
+	c = c.withDefaults()
+	if c.AvailabilityZone == "" {
+		return fmt.Errorf("%w: availability zone is required", ErrInvalidVolume)
+	}
+	if !slices.Contains(types.VolumeTypeGp3.Values(), c.Type) {
+		return fmt.Errorf("%w: unknown volume type %q", ErrInvalidVolume, c.Type)
+	}
+
+	minSize := int32(1)
+	if c.Type == types.VolumeTypeSt1 || c.Type == types.VolumeTypeSc1 {
+		minSize = 125
+	}
+	if c.SizeGiB < minSize || c.SizeGiB > maxVolumeSizeGiB {
+		return fmt.Errorf("%w: size of a %s volume must be between %d and %d GiB, got %d", ErrInvalidVolume, c.Type, minSize, maxVolumeSizeGiB, c.SizeGiB)
+	}
+
+	switch c.Type {
+	case types.VolumeTypeGp3:
+		if c.IOPS != 0 && (c.IOPS < 3000 || c.IOPS > 16000) {
+			return fmt.Errorf("%w: gp3 IOPS must be between 3000 and 16000, got %d", ErrInvalidVolume, c.IOPS)
+		}
+		if c.Throughput != 0 && (c.Throughput < 125 || c.Throughput > 1000) {
+			return fmt.Errorf("%w: gp3 throughput must be between 125 and 1000 MiB/s, got %d", ErrInvalidVolume, c.Throughput)
+		}
+		return nil
+	case types.VolumeTypeIo1, types.VolumeTypeIo2:
+		if c.IOPS < 100 || c.IOPS > 64000 {
+			return fmt.Errorf("%w: %s volumes require IOPS between 100 and 64000, got %d", ErrInvalidVolume, c.Type, c.IOPS)
+		}
+	default:
+		if c.IOPS != 0 {
+			return fmt.Errorf("%w: IOPS cannot be set for %s volumes", ErrInvalidVolume, c.Type)
+		}
+	}
+	if c.Throughput != 0 {
+		return fmt.Errorf("%w: throughput can only be set for gp3 volumes", ErrInvalidVolume)
+	}
+	return nil
+}
+
+func CreateVolume(ctx context.Context, client EC2Client, config VolumeConfig) (VolumeInfo, error) {
+	if err := config.Validate(); err != nil {
+		return VolumeInfo{}, err
+	}
+	config = config.withDefaults()
+
+	slog.Info("Creating EBS volume", "name", config.Name, "size_gib", config.SizeGiB, "type", config.Type, "availability_zone", config.AvailabilityZone)
+
+	tags := []types.Tag{
+		{Key: aws.String(TagManagedBy), Value: aws.String(ManagedByValue)},
+	}
+	if config.Name != "" {
+		tags = append(tags, types.Tag{Key: aws.String(TagName), Value: aws.String(config.Name)})
+	}
+
+	input := &awsec2.CreateVolumeInput{
+		AvailabilityZone: aws.String(config.AvailabilityZone),
+		Size:             aws.Int32(config.SizeGiB),
+		VolumeType:       config.Type,
+		Encrypted:        aws.Bool(config.Encrypted),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeVolume,
+				Tags:         tags,
+			},
+		},
+	}
+	if config.IOPS != 0 {
+		input.Iops = aws.Int32(config.IOPS)
+	}
+	if config.Throughput != 0 {
+		input.Throughput = aws.Int32(config.Throughput)
+	}
+	if config.KMSKeyID != "" {
+		input.KmsKeyId = aws.String(config.KMSKeyID)
+	}
+
+	result, err := client.CreateVolume(ctx, input)
+	if err != nil {
+		slog.Error("Failed to create volume", "error", err)
+		return VolumeInfo{}, fmt.Errorf("failed to create volume: %w", err)
+	}
+
+	info := VolumeInfo{
+		VolumeID:         getPtrStringValue(result.VolumeId),
+		Name:             config.Name,
+		State:            string(result.State),
+		AvailabilityZone: getPtrStringValue(result.AvailabilityZone),
+		SizeGiB:          aws.ToInt32(result.Size),
+		Type:             string(result.VolumeType),
+		IOPS:             aws.ToInt32(result.Iops),
+		Throughput:       aws.ToInt32(result.Throughput),
+		Encrypted:        aws.ToBool(result.Encrypted),
+		KMSKeyID:         getPtrStringValue(result.KmsKeyId),
+		Tags:             map[string]string{TagManagedBy: ManagedByValue},
+	}
+	if result.CreateTime != nil {
+		info.CreatedAt = *result.CreateTime
+	}
+	if config.Name != "" {
+		info.Tags[TagName] = config.Name
+	}
+
+	slog.Info("Volume created", "volume_id", info.VolumeID, "state", info.State)
+	return info, nil
+}
+
+func ListVolumes(ctx context.Context, client EC2Client) ([]VolumeInfo, error) {
+	return describeManagedVolumes(ctx, client, nil)
+}
+
+func GetVolume(ctx context.Context, client EC2Client, volumeID string) (VolumeInfo, error) {
+	volumes, err := describeManagedVolumes(ctx, client, []string{volumeID})
+	if err != nil {
+		return VolumeInfo{}, err
+	}
+	if len(volumes) == 0 {
+		return VolumeInfo{}, fmt.Errorf("%w: %s", ErrVolumeNotFound, volumeID)
+	}
+	return volumes[0], nil
+}
+
+// DeleteVolume deletes a detached volume.
+func DeleteVolume(ctx context.Context, client EC2Client, volumeID string) error {
+	// Only delete volumes this control plane created
+	info, err := GetVolume(ctx, client, volumeID)
+	if err != nil {
+		return err
+	}
+	if len(info.Attachments) > 0 {
+		return fmt.Errorf("%w: %s is attached to %s", ErrVolumeInUse, volumeID, info.Attachments[0].InstanceID)
+	}
+
+	slog.Info("Deleting volume", "volume_id", volumeID)
+	_, err = client.DeleteVolume(ctx, &awsec2.DeleteVolumeInput{
+		VolumeId: aws.String(volumeID),
+	})
+	if err != nil {
+		if hasErrorCode(err, "VolumeInUse") {
+			return fmt.Errorf("%w: %s", ErrVolumeInUse, volumeID)
+		}
+		slog.Error("Failed to delete volume", "volume_id", volumeID, "error", err)
+		return fmt.Errorf("failed to delete volume: %w", err)
+	}
+	return nil
+}
+
+// AttachVolume attaches a volume to an instance in the same availability
+// zone. With DeleteOnTermination it waits for the attachment, because the
+// flag can only be set on an attached volume.
+func AttachVolume(ctx context.Context, client EC2Client, volumeID, instanceID string, opts AttachVolumeOptions) (VolumeInfo, error) {
+	volume, err := GetVolume(ctx, client, volumeID)
+	if err != nil {
+		return VolumeInfo{}, err
+	}
+	if len(volume.Attachments) > 0 {
+		return VolumeInfo{}, fmt.Errorf("%w: %s is attached to %s", ErrVolumeInUse, volumeID, volume.Attachments[0].InstanceID)
+	}
+
+	instance, err := GetInstance(ctx, client, instanceID)
+	if err != nil {
+		return VolumeInfo{}, err
+	}
+	if instance.AvailabilityZone != volume.AvailabilityZone {
+		return VolumeInfo{}, fmt.Errorf("%w: volume %s is in %s, node %s in %s",
+			ErrVolumeZoneMismatch, volumeID, volume.AvailabilityZone, instanceID, instance.AvailabilityZone)
+	}
+
+	used := make([]string, 0, len(instance.BlockDevices))
+	for _, device := range instance.BlockDevices {
+		used = append(used, device.DeviceName)
+	}
+	device := opts.DeviceName
+	if device == "" {
+		device, err = NextDeviceName(used)
+		if err != nil {
+			return VolumeInfo{}, err
+		}
+	} else if slices.ContainsFunc(used, func(name string) bool { return sameDevice(name, device) }) {
+		return VolumeInfo{}, fmt.Errorf("%w: device %s is already in use on %s", ErrInvalidVolume, device, instanceID)
+	}
+
+	slog.Info("Attaching volume", "volume_id", volumeID, "instance_id", instanceID, "device", device)
+	_, err = client.AttachVolume(ctx, &awsec2.AttachVolumeInput{
+		VolumeId:   aws.String(volumeID),
+		InstanceId: aws.String(instanceID),
+		Device:     aws.String(device),
+	})
+	if err != nil {
+		if hasErrorCode(err, "VolumeInUse") {
+			return VolumeInfo{}, fmt.Errorf("%w: %s", ErrVolumeInUse, volumeID)
+		}
+		slog.Error("Failed to attach volume", "volume_id", volumeID, "instance_id", instanceID, "error", err)
+		return VolumeInfo{}, fmt.Errorf("failed to attach volume: %w", err)
+	}
+
+	if opts.DeleteOnTermination {
+		if err := waitForAttachment(ctx, client, volumeID); err != nil {
+			return VolumeInfo{}, err
+		}
+		_, err = client.ModifyInstanceAttribute(ctx, &awsec2.ModifyInstanceAttributeInput{
+			InstanceId: aws.String(instanceID),
+			BlockDeviceMappings: []types.InstanceBlockDeviceMappingSpecification{
+				{
+					DeviceName: aws.String(device),
+					Ebs: &types.EbsInstanceBlockDeviceSpecification{
+						VolumeId:            aws.String(volumeID),
+						DeleteOnTermination: aws.Bool(true),
+					},
+				},
+			},
+		})
+		if err != nil {
+			slog.Error("Failed to set delete on termination", "volume_id", volumeID, "instance_id", instanceID, "error", err)
+			return VolumeInfo{}, fmt.Errorf("failed to set delete on termination: %w", err)
+		}
+	}
+
+	return GetVolume(ctx, client, volumeID)
+}
+
+func DetachVolume(ctx context.Context, client EC2Client, volumeID string, force bool) (VolumeInfo, error) {
+	volume, err := GetVolume(ctx, client, volumeID)
+	if err != nil {
+		return VolumeInfo{}, err
+	}
+	if len(volume.Attachments) == 0 {
+		return VolumeInfo{}, fmt.Errorf("%w: %s", ErrVolumeNotAttached, volumeID)
+	}
+
+	slog.Info("Detaching volume", "volume_id", volumeID, "instance_id", volume.Attachments[0].InstanceID, "force", force)
+	_, err = client.DetachVolume(ctx, &awsec2.DetachVolumeInput{
+		VolumeId: aws.String(volumeID),
+		Force:    aws.Bool(force),
+	})
+	if err != nil {
+		if hasErrorCode(err, "IncorrectState") {
+			return VolumeInfo{}, fmt.Errorf("%w: %s", ErrVolumeNotAttached, volumeID)
+		}
+		slog.Error("Failed to detach volume", "volume_id", volumeID, "error", err)
+		return VolumeInfo{}, fmt.Errorf("failed to detach volume: %w", err)
+	}
+
+	return GetVolume(ctx, client, volumeID)
+}
+
+// NextDeviceName returns the first data device name not in used. /dev/sdX
+// and /dev/xvdX name the same device.
+func NextDeviceName(used []string) (string, error) {
+	for _, candidate := range dataDeviceNames {
+		if !slices.ContainsFunc(used, func(name string) bool { return sameDevice(name, candidate) }) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: all of %s to %s are in use", ErrNoFreeDevice, dataDeviceNames[0], dataDeviceNames[len(dataDeviceNames)-1])
+}
+
+func sameDevice(a, b string) bool {
+	return deviceSuffix(a) == deviceSuffix(b)
+}
+
+func deviceSuffix(name string) string {
+	name = strings.TrimPrefix(name, "/dev/")
+	for _, prefix := range []string{"xvd", "sd"} {
+		if suffix, ok := strings.CutPrefix(name, prefix); ok {
+			return suffix
+		}
+	}
+	return name
+}
+
+func waitForAttachment(ctx context.Context, client EC2Client, volumeID string) error {
+	ctx, cancel := context.WithTimeout(ctx, attachTimeout)
+	defer cancel()
+
+	for {
+		volume, err := GetVolume(ctx, client, volumeID)
+		if err != nil {
+			return err
+		}
+		if len(volume.Attachments) > 0 && volume.Attachments[0].State == string(types.VolumeAttachmentStateAttached) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for volume %s to attach: %w", volumeID, ctx.Err())
+		case <-time.After(attachPollInterval):
+		}
+	}
+}
+
+func describeManagedVolumes(ctx context.Context, client EC2Client, volumeIDs []string) ([]VolumeInfo, error) {
+	result, err := client.DescribeVolumes(ctx, &awsec2.DescribeVolumesInput{
+		VolumeIds: volumeIDs,
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + TagManagedBy),
+				Values: []string{ManagedByValue},
+			},
+		},
+	})
+	if err != nil {
+		if hasErrorCode(err, "InvalidVolume.NotFound") {
+			return nil, fmt.Errorf("%w: %s", ErrVolumeNotFound, strings.Join(volumeIDs, ", "))
+		}
+		slog.Error("Failed to describe volumes", "error", err)
+		return nil, fmt.Errorf("failed to describe volumes: %w", err)
+	}
+
+	volumes := make([]VolumeInfo, 0, len(result.Volumes))
+	for _, volume := range result.Volumes {
+		volumes = append(volumes, newVolumeInfo(volume))
+	}
+	return volumes, nil
+}
+
+func newVolumeInfo(volume types.Volume) VolumeInfo {
+	info := VolumeInfo{
+		VolumeID:         getPtrStringValue(volume.VolumeId),
+		State:            string(volume.State),
+		AvailabilityZone: getPtrStringValue(volume.AvailabilityZone),
+		SizeGiB:          aws.ToInt32(volume.Size),
+		Type:             string(volume.VolumeType),
+		IOPS:             aws.ToInt32(volume.Iops),
+		Throughput:       aws.ToInt32(volume.Throughput),
+		Encrypted:        aws.ToBool(volume.Encrypted),
+		KMSKeyID:         getPtrStringValue(volume.KmsKeyId),
+		Tags:             map[string]string{},
+	}
+	if volume.CreateTime != nil {
+		info.CreatedAt = *volume.CreateTime
+	}
+	for _, tag := range volume.Tags {
+		if tag.Key == nil {
+			continue
+		}
+		info.Tags[*tag.Key] = getPtrStringValue(tag.Value)
+	}
+	info.Name = info.Tags[TagName]
+
+	for _, attachment := range volume.Attachments {
+		// Detached attachments linger in the description for a while
+		if attachment.State == types.VolumeAttachmentStateDetached {
+			continue
+		}
+		attached := VolumeAttachmentInfo{
+			InstanceID:          getPtrStringValue(attachment.InstanceId),
+			DeviceName:          getPtrStringValue(attachment.Device),
+			State:               string(attachment.State),
+			DeleteOnTermination: aws.ToBool(attachment.DeleteOnTermination),
+		}
+		if attachment.AttachTime != nil {
+			attached.AttachedAt = *attachment.AttachTime
+		}
+		info.Attachments = append(info.Attachments, attached)
+	}
+	return info
+}
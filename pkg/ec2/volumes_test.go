@@ -0,0 +1,203 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestVolumeConfig_Validate(t *testing.T) {
+	valid := []VolumeConfig{
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 20},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 20, IOPS: 4000, Throughput: 250},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 100, Type: types.VolumeTypeIo2, IOPS: 1000},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 500, Type: types.VolumeTypeSt1},
+	}
+	for _, config := range valid {
+		if err := config.Validate(); err != nil {
+			t.Errorf("%+v: expected valid, got %v", config, err)
+		}
+	}
+
+	invalid := []VolumeConfig{
+		{SizeGiB: 20},
+		{AvailabilityZone: "eu-central-1a"},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 20000},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 20, Type: "gp9"},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 20, IOPS: 100},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 100, Type: types.VolumeTypeIo1},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 20, Type: types.VolumeTypeGp2, IOPS: 3000},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 20, Type: types.VolumeTypeGp2, Throughput: 125},
+		{AvailabilityZone: "eu-central-1a", SizeGiB: 20, Type: types.VolumeTypeSc1},
+	}
+	for _, config := range invalid {
+		if err := config.Validate(); !errors.Is(err, ErrInvalidVolume) {
+			t.Errorf("%+v: expected ErrInvalidVolume, got %v", config, err)
+		}
+	}
+}
+
+func TestNextDeviceName(t *testing.T) {
+	device, err := NextDeviceName([]string{"/dev/xvda", "/dev/sdf", "/dev/xvdg"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if device != "/dev/sdh" {
+		t.Errorf("expected /dev/sdh, got %s", device)
+	}
+
+	if _, err := NextDeviceName(dataDeviceNames); !errors.Is(err, ErrNoFreeDevice) {
+		t.Errorf("expected ErrNoFreeDevice, got %v", err)
+	}
+}
+
+func TestCreateVolume(t *testing.T) {
+	mockClient := &MockEC2Client{
+		CreateVolumeFunc: func(ctx context.Context, params *awsec2.CreateVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.CreateVolumeOutput, error) {
+			if params.VolumeType != types.VolumeTypeGp3 {
+				t.Errorf("expected default type gp3, got %s", params.VolumeType)
+			}
+			if aws.ToInt32(params.Size) != 20 || !aws.ToBool(params.Encrypted) {
+				t.Errorf("expected an encrypted 20 GiB volume, got %d GiB, encrypted %v", aws.ToInt32(params.Size), aws.ToBool(params.Encrypted))
+			}
+			if params.Iops != nil || params.Throughput != nil {
+				t.Errorf("expected IOPS and throughput to be left to EC2, got %v and %v", params.Iops, params.Throughput)
+			}
+			return &awsec2.CreateVolumeOutput{
+				VolumeId:         aws.String("vol-1"),
+				State:            types.VolumeStateCreating,
+				AvailabilityZone: params.AvailabilityZone,
+				Size:             params.Size,
+				VolumeType:       params.VolumeType,
+				Encrypted:        params.Encrypted,
+			}, nil
+		},
+	}
+
+	info, err := CreateVolume(context.Background(), mockClient, VolumeConfig{
+		Name:             "scratch",
+		AvailabilityZone: "eu-central-1a",
+		SizeGiB:          20,
+		Encrypted:        true,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.VolumeID != "vol-1" || info.Name != "scratch" || info.State != "creating" {
+		t.Errorf("unexpected volume %+v", info)
+	}
+}
+
+// newVolumeMock serves one managed volume and one instance in the given
+// zones. The volume is attached as soon as AttachVolume is called.
+func newVolumeMock(t *testing.T, volumeZone, instanceZone string) (*MockEC2Client, *[]*awsec2.ModifyInstanceAttributeInput) {
+	t.Helper()
+	var attachment *types.VolumeAttachment
+	var modified []*awsec2.ModifyInstanceAttributeInput
+
+	client := &MockEC2Client{
+		DescribeVolumesFunc: func(ctx context.Context, params *awsec2.DescribeVolumesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeVolumesOutput, error) {
+			volume := types.Volume{
+				VolumeId:         aws.String("vol-1"),
+				AvailabilityZone: aws.String(volumeZone),
+				State:            types.VolumeStateAvailable,
+				Tags:             []types.Tag{{Key: aws.String(TagManagedBy), Value: aws.String(ManagedByValue)}},
+			}
+			if attachment != nil {
+				volume.State = types.VolumeStateInUse
+				volume.Attachments = []types.VolumeAttachment{*attachment}
+			}
+			return &awsec2.DescribeVolumesOutput{Volumes: []types.Volume{volume}}, nil
+		},
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{{
+					Instances: []types.Instance{{
+						InstanceId:     aws.String("i-1"),
+						Placement:      &types.Placement{AvailabilityZone: aws.String(instanceZone)},
+						RootDeviceName: aws.String("/dev/xvda"),
+						BlockDeviceMappings: []types.InstanceBlockDeviceMapping{
+							{DeviceName: aws.String("/dev/xvda"), Ebs: &types.EbsInstanceBlockDevice{VolumeId: aws.String("vol-root")}},
+							{DeviceName: aws.String("/dev/sdf"), Ebs: &types.EbsInstanceBlockDevice{VolumeId: aws.String("vol-data")}},
+						},
+					}},
+				}},
+			}, nil
+		},
+		AttachVolumeFunc: func(ctx context.Context, params *awsec2.AttachVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.AttachVolumeOutput, error) {
+			attachment = &types.VolumeAttachment{
+				InstanceId: params.InstanceId,
+				Device:     params.Device,
+				State:      types.VolumeAttachmentStateAttached,
+			}
+			return &awsec2.AttachVolumeOutput{}, nil
+		},
+		ModifyInstanceAttributeFunc: func(ctx context.Context, params *awsec2.ModifyInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.ModifyInstanceAttributeOutput, error) {
+			modified = append(modified, params)
+			attachment.DeleteOnTermination = aws.Bool(true)
+			return &awsec2.ModifyInstanceAttributeOutput{}, nil
+		},
+	}
+	return client, &modified
+}
+
+func TestAttachVolume(t *testing.T) {
+	client, modified := newVolumeMock(t, "eu-central-1a", "eu-central-1a")
+
+	info, err := AttachVolume(context.Background(), client, "vol-1", "i-1", AttachVolumeOptions{DeleteOnTermination: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(info.Attachments) != 1 {
+		t.Fatalf("expected one attachment, got %+v", info.Attachments)
+	}
+	attachment := info.Attachments[0]
+	if attachment.DeviceName != "/dev/sdg" || !attachment.DeleteOnTermination {
+		t.Errorf("expected /dev/sdg with delete on termination, got %+v", attachment)
+	}
+	if len(*modified) != 1 || aws.ToString((*modified)[0].BlockDeviceMappings[0].DeviceName) != "/dev/sdg" {
+		t.Errorf("expected delete on termination to be set on /dev/sdg, got %+v", *modified)
+	}
+
+	// A second attach is rejected while the volume is in use
+	if _, err := AttachVolume(context.Background(), client, "vol-1", "i-1", AttachVolumeOptions{}); !errors.Is(err, ErrVolumeInUse) {
+		t.Errorf("expected ErrVolumeInUse, got %v", err)
+	}
+}
+
+func TestAttachVolume_Errors(t *testing.T) {
+	client, _ := newVolumeMock(t, "eu-central-1a", "eu-central-1b")
+	if _, err := AttachVolume(context.Background(), client, "vol-1", "i-1", AttachVolumeOptions{}); !errors.Is(err, ErrVolumeZoneMismatch) {
+		t.Errorf("expected ErrVolumeZoneMismatch, got %v", err)
+	}
+
+	client, _ = newVolumeMock(t, "eu-central-1a", "eu-central-1a")
+	if _, err := AttachVolume(context.Background(), client, "vol-1", "i-1", AttachVolumeOptions{DeviceName: "/dev/xvdf"}); !errors.Is(err, ErrInvalidVolume) {
+		t.Errorf("expected ErrInvalidVolume for a used device, got %v", err)
+	}
+}
+
+func TestDeleteVolume_InUse(t *testing.T) {
+	client, _ := newVolumeMock(t, "eu-central-1a", "eu-central-1a")
+	client.DeleteVolumeFunc = func(ctx context.Context, params *awsec2.DeleteVolumeInput, optFns ...func(*awsec2.Options)) (*awsec2.DeleteVolumeOutput, error) {
+		return &awsec2.DeleteVolumeOutput{}, nil
+	}
+
+	if _, err := AttachVolume(context.Background(), client, "vol-1", "i-1", AttachVolumeOptions{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := DeleteVolume(context.Background(), client, "vol-1"); !errors.Is(err, ErrVolumeInUse) {
+		t.Errorf("expected ErrVolumeInUse, got %v", err)
+	}
+}
+
+func TestDetachVolume_NotAttached(t *testing.T) {
+	client, _ := newVolumeMock(t, "eu-central-1a", "eu-central-1a")
+	if _, err := DetachVolume(context.Background(), client, "vol-1", false); !errors.Is(err, ErrVolumeNotAttached) {
+		t.Errorf("expected ErrVolumeNotAttached, got %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	DefaultWaitTimeout         = 5 * time.Minute
+	DefaultWaitInitialInterval = 2 * time.Second
+	DefaultWaitMaxInterval     = 15 * time.Second
+	DefaultWaitJitter          = 0.2
+)
+
+// WaitOptions configures WaitForInstance. Zero values fall back to the
+// package defaults.
+type WaitOptions struct {
+	// TargetStates are the states that end the wait successfully
+	TargetStates []types.InstanceStateName
+	Timeout      time.Duration
+	// InitialInterval is the first poll delay; it doubles after every poll
+	// up to MaxInterval
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// Jitter randomizes each delay by up to this fraction, so that many
+	// waiters started together do not poll in lockstep
+	Jitter float64
+	// RequireStatusChecks additionally waits until the EC2 instance and
+	// system status checks pass. Only meaningful for the running state.
+	RequireStatusChecks bool
+	// OnProgress is called after every poll
+	OnProgress func(WaitProgress)
+}
+
+type WaitProgress struct {
+	InstanceID     string
+	State          types.InstanceStateName
+	InstanceStatus types.SummaryStatus
+	SystemStatus   types.SummaryStatus
+	Attempt        int
+	Elapsed        time.Duration
+}
+
+// WaitTimeoutError is returned when the instance did not reach a target
+// state within the timeout.
+type WaitTimeoutError struct {
+	InstanceID   string
+	TargetStates []types.InstanceStateName
+	LastState    types.InstanceStateName
+	Timeout      time.Duration
+}
+
+func (e *WaitTimeoutError) Error() string {
+	return fmt.Sprintf("timeout after %s waiting for instance %s to reach %v, last state %q", e.Timeout, e.InstanceID, e.TargetStates, e.LastState)
+}
+
+func (e *WaitTimeoutError) Is(target error) bool {
+	return target == errkind.Timeout
+}
+
+// TerminalStateError is returned when the instance entered a state from
+// which no target state can be reached without another API call.
+type TerminalStateError struct {
+	InstanceID   string
+	TargetStates []types.InstanceStateName
+	State        types.InstanceStateName
+	Reason       string
+}
+
+func (e *TerminalStateError) Error() string {
+	msg := fmt.Sprintf("instance %s entered %s state, cannot reach %v", e.InstanceID, e.State, e.TargetStates)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+func (e *TerminalStateError) Is(target error) bool {
+	return target == errkind.Conflict
+}
+
+func WaitForInstanceRunning(ctx context.Context, client EC2Client, instanceID string) error {
+	return WaitForInstanceState(ctx, client, instanceID, types.InstanceStateNameRunning)
+}
+
+func WaitForInstanceState(ctx context.Context, client EC2Client, instanceID string, target types.InstanceStateName) error {
+	_, err := WaitForInstance(ctx, client, instanceID, WaitOptions{TargetStates: []types.InstanceStateName{target}})
+	return err
+}
+
+// WaitForInstance polls the instance until it reaches one of the target
+// states, enters a state none of them can be reached from, the timeout
+// expires or ctx is cancelled. The last observed instance is returned.
+func WaitForInstance(ctx context.Context, client EC2Client, instanceID string, opts WaitOptions) (InstanceInfo, error) {
+	if len(opts.TargetStates) == 0 {
+		return InstanceInfo{}, fmt.Errorf("at least one target state is required")
+	}
+	opts = opts.withDefaults()
+
+	slog.Info("Waiting for instance state",
+		"instance_id", instanceID,
+		"target_states", opts.TargetStates,
+		"status_checks", opts.RequireStatusChecks,
+		"timeout", opts.Timeout)
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	interval := opts.InitialInterval
+	var last InstanceInfo
+
+	for attempt := 1; ; attempt++ {
+		info, found, err := describeInstanceForWait(waitCtx, client, instanceID)
+		if err != nil && waitCtx.Err() == nil {
+			slog.Error("Failed to describe instance", "instance_id", instanceID, "error", err)
+			return last, fmt.Errorf("failed to describe instance: %w", err)
+		}
+
+		progress := WaitProgress{InstanceID: instanceID, Attempt: attempt, Elapsed: time.Since(startTime)}
+		if found {
+			last = info
+			state := types.InstanceStateName(info.State)
+			progress.State = state
+
+			slog.Debug("Instance state check", "instance_id", instanceID, "state", state, "attempt", attempt)
+
+			if slices.Contains(opts.TargetStates, state) {
+				if !opts.RequireStatusChecks || state != types.InstanceStateNameRunning {
+					notifyProgress(opts, progress)
+					slog.Info("Instance reached target state", "instance_id", instanceID, "state", state)
+					return info, nil
+				}
+
+				instanceStatus, systemStatus, err := describeStatusChecks(waitCtx, client, instanceID)
+				if err != nil && waitCtx.Err() == nil {
+					return last, err
+				}
+				progress.InstanceStatus = instanceStatus
+				progress.SystemStatus = systemStatus
+				if instanceStatus == types.SummaryStatusOk && systemStatus == types.SummaryStatusOk {
+					notifyProgress(opts, progress)
+					slog.Info("Instance status checks passed", "instance_id", instanceID)
+					return info, nil
+				}
+				if instanceStatus == types.SummaryStatusImpaired || systemStatus == types.SummaryStatusImpaired {
+					notifyProgress(opts, progress)
+					return info, &TerminalStateError{
+						InstanceID:   instanceID,
+						TargetStates: opts.TargetStates,
+						State:        state,
+						Reason:       fmt.Sprintf("status checks impaired (instance %s, system %s)", instanceStatus, systemStatus),
+					}
+				}
+			} else if isTerminalForAll(state, opts.TargetStates) {
+				notifyProgress(opts, progress)
+				slog.Error("Instance entered invalid state", "instance_id", instanceID, "state", state, "target_states", opts.TargetStates)
+				return info, &TerminalStateError{
+					InstanceID:   instanceID,
+					TargetStates: opts.TargetStates,
+					State:        state,
+					Reason:       info.StateReason,
+				}
+			}
+		} else if slices.Contains(opts.TargetStates, types.InstanceStateNameTerminated) {
+			// Terminated instances eventually disappear from DescribeInstances
+			notifyProgress(opts, progress)
+			return last, nil
+		}
+		// A missing instance right after RunInstances is eventual
+		// consistency, so keep polling until the timeout
+		if err == nil {
+			notifyProgress(opts, progress)
+		}
+
+		timer := time.NewTimer(jitter(interval, opts.Jitter))
+		select {
+		case <-waitCtx.Done():
+			timer.Stop()
+			if ctx.Err() != nil {
+				return last, ctx.Err()
+			}
+			slog.Error("Timeout waiting for instance state", "instance_id", instanceID, "target_states", opts.TargetStates, "timeout", opts.Timeout)
+			return last, &WaitTimeoutError{
+				InstanceID:   instanceID,
+				TargetStates: opts.TargetStates,
+				LastState:    types.InstanceStateName(last.State),
+				Timeout:      opts.Timeout,
+			}
+		case <-timer.C:
+		}
+
+		interval = min(interval*2, opts.MaxInterval)
+	}
+}
+
+func (o WaitOptions) withDefaults() WaitOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultWaitTimeout
+	}
+	if o.InitialInterval <= 0 {
+		o.InitialInterval = DefaultWaitInitialInterval
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = DefaultWaitMaxInterval
+	}
+	if o.MaxInterval < o.InitialInterval {
+		o.MaxInterval = o.InitialInterval
+	}
+	if o.Jitter <= 0 {
+		o.Jitter = DefaultWaitJitter
+	}
+	return o
+}
+
+func notifyProgress(opts WaitOptions, progress WaitProgress) {
+	if opts.OnProgress != nil {
+		opts.OnProgress(progress)
+	}
+}
+
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	delta := (rand.Float64()*2 - 1) * fraction * float64(d)
+	return d + time.Duration(delta)
+}
+
+// describeInstanceForWait looks the instance up by ID across all
+// reservations. found is false when EC2 does not know the instance (yet).
+func describeInstanceForWait(ctx context.Context, client EC2Client, instanceID string) (InstanceInfo, bool, error) {
+	result, err := client.DescribeInstances(ctx, &awsec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		if isInstanceNotFoundError(err) {
+			return InstanceInfo{}, false, nil
+		}
+		return InstanceInfo{}, false, err
+	}
+
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			if getPtrStringValue(instance.InstanceId) == instanceID {
+				return newInstanceInfo(instance), true, nil
+			}
+		}
+	}
+	return InstanceInfo{}, false, nil
+}
+
+func describeStatusChecks(ctx context.Context, client EC2Client, instanceID string) (types.SummaryStatus, types.SummaryStatus, error) {
+	result, err := client.DescribeInstanceStatus(ctx, &awsec2.DescribeInstanceStatusInput{
+		InstanceIds:         []string{instanceID},
+		IncludeAllInstances: aws.Bool(true),
+	})
+	if err != nil {
+		slog.Error("Failed to describe instance status", "instance_id", instanceID, "error", err)
+		return "", "", fmt.Errorf("failed to describe instance status: %w", err)
+	}
+
+	for _, status := range result.InstanceStatuses {
+		if getPtrStringValue(status.InstanceId) != instanceID {
+			continue
+		}
+		var instanceStatus, systemStatus types.SummaryStatus
+		if status.InstanceStatus != nil {
+			instanceStatus = status.InstanceStatus.Status
+		}
+		if status.SystemStatus != nil {
+			systemStatus = status.SystemStatus.Status
+		}
+		return instanceStatus, systemStatus, nil
+	}
+	return "", "", nil
+}
+
+// isTerminalForAll reports whether none of the targets can be reached from
+// state without another API call.
+func isTerminalForAll(state types.InstanceStateName, targets []types.InstanceStateName) bool {
+	for _, target := range targets {
+		if !isTerminalStateFor(state, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTerminalStateFor reports whether an instance in state can no longer
+// reach target without another API call. A stopped instance is not terminal
+// for running: right after StartInstances, DescribeInstances may still
+// report stopped for a few seconds.
+func isTerminalStateFor(state, target types.InstanceStateName) bool {
+	switch state {
+	case types.InstanceStateNameTerminated:
+		return target != types.InstanceStateNameTerminated
+	case types.InstanceStateNameShuttingDown:
+		return target != types.InstanceStateNameTerminated
+	}
+	return false
+}
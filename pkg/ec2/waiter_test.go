@@ -0,0 +1,181 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// fastWaitOptions keeps the tests quick while still exercising the backoff.
+func fastWaitOptions(targets ...types.InstanceStateName) WaitOptions {
+	return WaitOptions{
+		TargetStates:    targets,
+		Timeout:         time.Second,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+	}
+}
+
+// newStateSequenceFunc reports the given states in order, repeating the
+// last one once the sequence is exhausted.
+func newStateSequenceFunc(instanceID string, states ...types.InstanceStateName) func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+	calls := 0
+	return func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+		state := states[min(calls, len(states)-1)]
+		calls++
+		return newDescribeInstancesFunc(instanceID, state)(ctx, params, optFns...)
+	}
+}
+
+func TestWaitForInstance(t *testing.T) {
+	instanceID := "i-1234567890abcdef0"
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: newStateSequenceFunc(instanceID,
+			types.InstanceStateNameStopped,
+			types.InstanceStateNamePending,
+			types.InstanceStateNameRunning),
+	}
+
+	var progress []WaitProgress
+	opts := fastWaitOptions(types.InstanceStateNameRunning)
+	opts.OnProgress = func(p WaitProgress) {
+		progress = append(progress, p)
+	}
+
+	info, err := WaitForInstance(context.Background(), mockClient, instanceID, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.State != string(types.InstanceStateNameRunning) {
+		t.Errorf("expected state running, got %s", info.State)
+	}
+	if len(progress) != 3 {
+		t.Fatalf("expected 3 progress updates, got %d", len(progress))
+	}
+	if progress[2].Attempt != 3 || progress[2].State != types.InstanceStateNameRunning {
+		t.Errorf("unexpected final progress %+v", progress[2])
+	}
+}
+
+func TestWaitForInstance_SkipsOtherInstances(t *testing.T) {
+	instanceID := "i-1234567890abcdef0"
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{
+					{Instances: []types.Instance{{InstanceId: aws.String("i-other"), State: &types.InstanceState{Name: types.InstanceStateNameTerminated}}}},
+					{Instances: []types.Instance{{InstanceId: aws.String(instanceID), State: &types.InstanceState{Name: types.InstanceStateNameRunning}}}},
+				},
+			}, nil
+		},
+	}
+
+	if _, err := WaitForInstance(context.Background(), mockClient, instanceID, fastWaitOptions(types.InstanceStateNameRunning)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWaitForInstance_TerminalState(t *testing.T) {
+	instanceID := "i-1234567890abcdef0"
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: newStateSequenceFunc(instanceID,
+			types.InstanceStateNamePending,
+			types.InstanceStateNameShuttingDown),
+	}
+
+	_, err := WaitForInstance(context.Background(), mockClient, instanceID, fastWaitOptions(types.InstanceStateNameRunning))
+
+	var terminalErr *TerminalStateError
+	if !errors.As(err, &terminalErr) {
+		t.Fatalf("expected TerminalStateError, got %v", err)
+	}
+	if terminalErr.State != types.InstanceStateNameShuttingDown {
+		t.Errorf("expected state shutting-down, got %s", terminalErr.State)
+	}
+}
+
+func TestWaitForInstance_Timeout(t *testing.T) {
+	instanceID := "i-1234567890abcdef0"
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: newDescribeInstancesFunc(instanceID, types.InstanceStateNameStopping),
+	}
+
+	opts := fastWaitOptions(types.InstanceStateNameStopped)
+	opts.Timeout = 20 * time.Millisecond
+
+	_, err := WaitForInstance(context.Background(), mockClient, instanceID, opts)
+
+	var timeoutErr *WaitTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected WaitTimeoutError, got %v", err)
+	}
+	if timeoutErr.LastState != types.InstanceStateNameStopping {
+		t.Errorf("expected last state stopping, got %s", timeoutErr.LastState)
+	}
+}
+
+func TestWaitForInstance_ContextCancelled(t *testing.T) {
+	instanceID := "i-1234567890abcdef0"
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: newDescribeInstancesFunc(instanceID, types.InstanceStateNamePending),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := fastWaitOptions(types.InstanceStateNameRunning)
+	opts.OnProgress = func(WaitProgress) { cancel() }
+
+	_, err := WaitForInstance(ctx, mockClient, instanceID, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWaitForInstance_TerminatedAndGone(t *testing.T) {
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return nil, &smithy.GenericAPIError{Code: "InvalidInstanceID.NotFound", Message: "not found"}
+		},
+	}
+
+	if _, err := WaitForInstance(context.Background(), mockClient, "i-1234567890abcdef0", fastWaitOptions(types.InstanceStateNameTerminated)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWaitForInstance_StatusChecks(t *testing.T) {
+	instanceID := "i-1234567890abcdef0"
+	statuses := []types.SummaryStatus{types.SummaryStatusInitializing, types.SummaryStatusOk}
+	calls := 0
+	mockClient := &MockEC2Client{
+		DescribeInstancesFunc: newDescribeInstancesFunc(instanceID, types.InstanceStateNameRunning),
+		DescribeInstanceStatusFunc: func(ctx context.Context, params *awsec2.DescribeInstanceStatusInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceStatusOutput, error) {
+			status := statuses[min(calls, len(statuses)-1)]
+			calls++
+			return &awsec2.DescribeInstanceStatusOutput{
+				InstanceStatuses: []types.InstanceStatus{
+					{
+						InstanceId:     aws.String(instanceID),
+						InstanceStatus: &types.InstanceStatusSummary{Status: status},
+						SystemStatus:   &types.InstanceStatusSummary{Status: types.SummaryStatusOk},
+					},
+				},
+			}, nil
+		},
+	}
+
+	opts := fastWaitOptions(types.InstanceStateNameRunning)
+	opts.RequireStatusChecks = true
+
+	if _, err := WaitForInstance(context.Background(), mockClient, instanceID, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 status checks, got %d", calls)
+	}
+}
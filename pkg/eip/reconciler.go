@@ -0,0 +1,250 @@
+// Package eip keeps managed Elastic IPs in line with the nodes they are
+// tied to. It associates static IPs once their node can take them, releases
+// the ones left behind by deleted nodes, and flags idle addresses, which
+// AWS bills for.
+package eip
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const DefaultInterval = 30 * time.Second
+
+// DefaultGracePeriod is how long an address whose node is missing from the
+// instance list is kept. Freshly launched instances can take a moment to
+// show up in DescribeInstances.
+const DefaultGracePeriod = 10 * time.Minute
+
+// Actor attributes reconciler actions in the inventory.
+const Actor = "eip"
+
+// Reconciler associates addresses with the node in their NodeID tag once the
+// node is running or stopped, and releases addresses marked ReleaseWithNode
+// whose node is terminating, terminated, or missing for longer than
+// GracePeriod. Addresses that end up associated with nothing are
+// reported as idle.
+type Reconciler struct {
+	Client    ec2.EC2Client
+	Inventory inventory.Store
+	Interval  time.Duration
+	// GracePeriod is how long an address is kept while its node is missing
+	// from the instance list, counted from when the reconciler first saw the
+	// address unassociated
+	GracePeriod time.Duration
+	// OnChange is called after an address was associated or released, e.g.
+	// to invalidate cached instance lists; optional
+	OnChange func()
+
+	mu      sync.Mutex
+	idle    map[string]IdleAddress
+	trigger chan struct{}
+}
+
+type IdleAddress struct {
+	Address ec2.AddressInfo
+	// Since is when the reconciler first saw the address idle
+	Since time.Time
+}
+
+type Report struct {
+	Associated []string
+	Released   []string
+	Idle       []IdleAddress
+}
+
+func NewReconciler(client ec2.EC2Client, store inventory.Store) *Reconciler {
+	return &Reconciler{
+		Client:      client,
+		Inventory:   store,
+		Interval:    DefaultInterval,
+		GracePeriod: DefaultGracePeriod,
+		idle:        make(map[string]IdleAddress),
+		trigger:     make(chan struct{}, 1),
+	}
+}
+
+// Run reconciles every Interval and whenever Trigger is called, until ctx
+// is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(ctx); err != nil {
+			slog.Warn("Elastic IP reconciliation failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.trigger:
+		}
+	}
+}
+
+// Trigger requests a pass without waiting for it, e.g. after a node with a
+// static IP was created. A nil reconciler is a no-op.
+func (r *Reconciler) Trigger() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// IdleSince reports whether the address was idle in the last pass and since
+// when. A nil reconciler knows no idle addresses.
+func (r *Reconciler) IdleSince(allocationID string) (time.Time, bool) {
+	if r == nil {
+		return time.Time{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idle, ok := r.idle[allocationID]
+	return idle.Since, ok
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context) (Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	addresses, err := ec2.ListAddresses(ctx, r.Client)
+	if err != nil {
+		return Report{}, err
+	}
+	instances, err := ec2.ListInstances(ctx, r.Client)
+	if err != nil {
+		return Report{}, err
+	}
+	states := make(map[string]string, len(instances))
+	for _, instance := range instances {
+		states[instance.InstanceID] = instance.State
+	}
+
+	var report Report
+	var errs []error
+	idle := make(map[string]IdleAddress)
+	now := time.Now().UTC()
+	for _, address := range addresses {
+		if address.Associated() {
+			continue
+		}
+
+		if address.NodeID != "" {
+			switch types.InstanceStateName(states[address.NodeID]) {
+			case types.InstanceStateNamePending:
+				// Associated once the node is running
+				continue
+			case types.InstanceStateNameRunning, types.InstanceStateNameStopping, types.InstanceStateNameStopped:
+				if err := r.associate(ctx, address); err != nil {
+					errs = append(errs, err)
+				} else {
+					report.Associated = append(report.Associated, address.AllocationID)
+					continue
+				}
+			case types.InstanceStateNameShuttingDown, types.InstanceStateNameTerminated:
+				if address.ReleaseWithNode {
+					if err := r.release(ctx, address); err != nil {
+						errs = append(errs, err)
+					} else {
+						report.Released = append(report.Released, address.AllocationID)
+						continue
+					}
+				}
+			default:
+				// The node is long gone, or too new to be listed yet
+				since := now
+				if entry, seen := r.idle[address.AllocationID]; seen {
+					since = entry.Since
+				}
+				if address.ReleaseWithNode && now.Sub(since) >= r.GracePeriod {
+					if err := r.release(ctx, address); err != nil {
+						errs = append(errs, err)
+					} else {
+						report.Released = append(report.Released, address.AllocationID)
+						continue
+					}
+				}
+			}
+		}
+
+		entry, seen := r.idle[address.AllocationID]
+		if !seen {
+			entry.Since = now
+			slog.Warn("Elastic IP is not associated with a node and is billed while idle",
+				"allocation_id", address.AllocationID,
+				"public_ip", address.PublicIP,
+				"node_id", address.NodeID)
+		}
+		entry.Address = address
+		idle[address.AllocationID] = entry
+	}
+	r.idle = idle
+
+	for _, id := range slices.Sorted(maps.Keys(idle)) {
+		report.Idle = append(report.Idle, idle[id])
+	}
+	return report, errors.Join(errs...)
+}
+
+func (r *Reconciler) associate(ctx context.Context, address ec2.AddressInfo) error {
+	started := time.Now().UTC()
+	_, err := ec2.AssociateAddress(ctx, r.Client, address.AllocationID, address.NodeID)
+	r.recordOperation(ctx, "associate-address", address.AllocationID, map[string]string{"nodeId": address.NodeID}, started, err)
+	if err != nil {
+		return err
+	}
+	slog.Info("Associated static IP with node", "allocation_id", address.AllocationID, "public_ip", address.PublicIP, "instance_id", address.NodeID)
+	r.changed()
+	return nil
+}
+
+func (r *Reconciler) release(ctx context.Context, address ec2.AddressInfo) error {
+	started := time.Now().UTC()
+	err := ec2.ReleaseAddress(ctx, r.Client, address.AllocationID)
+	r.recordOperation(ctx, "release-address", address.AllocationID, map[string]string{"nodeId": address.NodeID, "reason": "node-deleted"}, started, err)
+	if err != nil {
+		return err
+	}
+	slog.Info("Released static IP of deleted node", "allocation_id", address.AllocationID, "public_ip", address.PublicIP, "instance_id", address.NodeID)
+	r.changed()
+	return nil
+}
+
+func (r *Reconciler) recordOperation(ctx context.Context, opType, target string, params map[string]string, started time.Time, err error) {
+	finished := time.Now().UTC()
+	op := inventory.OperationRecord{
+		Type:       opType,
+		Target:     target,
+		Actor:      Actor,
+		Params:     params,
+		Status:     inventory.OperationSucceeded,
+		StartedAt:  started,
+		FinishedAt: &finished,
+	}
+	if err != nil {
+		op.Status = inventory.OperationFailed
+		op.Error = err.Error()
+	}
+	if _, err := r.Inventory.AddOperation(ctx, op); err != nil {
+		slog.Warn("Failed to record operation", "type", opType, "target", target, "error", err)
+	}
+}
+
+func (r *Reconciler) changed() {
+	if r.OnChange != nil {
+		r.OnChange()
+	}
+}
@@ -0,0 +1,171 @@
+package eip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func managedAddress(allocationID string, tags map[string]string) types.Address {
+	address := types.Address{
+		AllocationId: aws.String(allocationID),
+		PublicIp:     aws.String("3.120.0.10"),
+		Tags:         []types.Tag{{Key: aws.String(ec2.TagManagedBy), Value: aws.String(ec2.ManagedByValue)}},
+	}
+	for key, value := range tags {
+		address.Tags = append(address.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return address
+}
+
+// newReconcilerMock serves the given addresses and instances and records
+// associations and releases.
+func newReconcilerMock(addresses []types.Address, instances map[string]types.InstanceStateName, associated, released *[]string) *ec2.MockEC2Client {
+	return &ec2.MockEC2Client{
+		DescribeAddressesFunc: func(ctx context.Context, params *awsec2.DescribeAddressesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeAddressesOutput, error) {
+			// Lookups by allocation ID return the matching address only
+			for _, filter := range params.Filters {
+				if aws.ToString(filter.Name) != "allocation-id" {
+					continue
+				}
+				for _, address := range addresses {
+					if aws.ToString(address.AllocationId) == filter.Values[0] {
+						return &awsec2.DescribeAddressesOutput{Addresses: []types.Address{address}}, nil
+					}
+				}
+				return &awsec2.DescribeAddressesOutput{}, nil
+			}
+			return &awsec2.DescribeAddressesOutput{Addresses: addresses}, nil
+		},
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			var reservation types.Reservation
+			for id, state := range instances {
+				reservation.Instances = append(reservation.Instances, types.Instance{
+					InstanceId: aws.String(id),
+					State:      &types.InstanceState{Name: state},
+				})
+			}
+			return &awsec2.DescribeInstancesOutput{Reservations: []types.Reservation{reservation}}, nil
+		},
+		AssociateAddressFunc: func(ctx context.Context, params *awsec2.AssociateAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.AssociateAddressOutput, error) {
+			*associated = append(*associated, aws.ToString(params.AllocationId))
+			return &awsec2.AssociateAddressOutput{AssociationId: aws.String("eipassoc-1")}, nil
+		},
+		ReleaseAddressFunc: func(ctx context.Context, params *awsec2.ReleaseAddressInput, optFns ...func(*awsec2.Options)) (*awsec2.ReleaseAddressOutput, error) {
+			*released = append(*released, aws.ToString(params.AllocationId))
+			return &awsec2.ReleaseAddressOutput{}, nil
+		},
+	}
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	var associated, released []string
+	addresses := []types.Address{
+		// Static IP of a node that has come up
+		managedAddress("eipalloc-running", map[string]string{ec2.TagNodeID: "i-running", ec2.TagReleaseWithNode: "true"}),
+		// Static IP of a node that is still booting
+		managedAddress("eipalloc-pending", map[string]string{ec2.TagNodeID: "i-pending", ec2.TagReleaseWithNode: "true"}),
+		// Static IP left behind by a deleted node
+		managedAddress("eipalloc-deleted", map[string]string{ec2.TagNodeID: "i-deleted", ec2.TagReleaseWithNode: "true"}),
+		// Address kept after its node was deleted
+		managedAddress("eipalloc-kept", map[string]string{ec2.TagNodeID: "i-deleted"}),
+		// Address never associated with anything
+		managedAddress("eipalloc-spare", nil),
+	}
+	instances := map[string]types.InstanceStateName{
+		"i-running": types.InstanceStateNameRunning,
+		"i-pending": types.InstanceStateNamePending,
+		"i-deleted": types.InstanceStateNameTerminated,
+	}
+
+	store := inventory.NewMemoryStore()
+	reconciler := NewReconciler(newReconcilerMock(addresses, instances, &associated, &released), store)
+	changes := 0
+	reconciler.OnChange = func() { changes++ }
+
+	report, err := reconciler.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(report.Associated) != 1 || report.Associated[0] != "eipalloc-running" || len(associated) != 1 {
+		t.Errorf("expected eipalloc-running to be associated, got %v", report.Associated)
+	}
+	if len(report.Released) != 1 || report.Released[0] != "eipalloc-deleted" || len(released) != 1 {
+		t.Errorf("expected eipalloc-deleted to be released, got %v", report.Released)
+	}
+	if len(report.Idle) != 2 || report.Idle[0].Address.AllocationID != "eipalloc-kept" || report.Idle[1].Address.AllocationID != "eipalloc-spare" {
+		t.Errorf("expected eipalloc-kept and eipalloc-spare to be idle, got %+v", report.Idle)
+	}
+	if changes != 2 {
+		t.Errorf("expected OnChange for each change, got %d", changes)
+	}
+
+	ops, _ := store.ListOperations(ctx, "eipalloc-deleted")
+	if len(ops) != 1 || ops[0].Type != "release-address" || ops[0].Actor != Actor {
+		t.Errorf("expected release-address operation, got %+v", ops)
+	}
+
+	since, ok := reconciler.IdleSince("eipalloc-spare")
+	if !ok {
+		t.Fatal("expected eipalloc-spare to be idle")
+	}
+	if _, ok := reconciler.IdleSince("eipalloc-pending"); ok {
+		t.Error("expected the address of a pending node not to be idle")
+	}
+
+	// Idle addresses keep the time they were first seen
+	if _, err := reconciler.Reconcile(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if again, _ := reconciler.IdleSince("eipalloc-spare"); !again.Equal(since) {
+		t.Errorf("expected idle since %v, got %v", since, again)
+	}
+}
+
+func TestReconciler_Reconcile_MissingNode(t *testing.T) {
+	ctx := context.Background()
+	var associated, released []string
+	addresses := []types.Address{
+		managedAddress("eipalloc-1", map[string]string{ec2.TagNodeID: "i-new", ec2.TagReleaseWithNode: "true"}),
+	}
+
+	// The node is not listed by DescribeInstances at all
+	reconciler := NewReconciler(newReconcilerMock(addresses, nil, &associated, &released), inventory.NewMemoryStore())
+	reconciler.GracePeriod = time.Hour
+
+	report, err := reconciler.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(report.Released) != 0 || len(released) != 0 {
+		t.Errorf("expected the address to be kept within the grace period, got %v", report.Released)
+	}
+
+	// Missing for longer than the grace period
+	idle := reconciler.idle["eipalloc-1"]
+	idle.Since = idle.Since.Add(-2 * time.Hour)
+	reconciler.idle["eipalloc-1"] = idle
+
+	report, err = reconciler.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(report.Released) != 1 || len(released) != 1 {
+		t.Errorf("expected the address to be released after the grace period, got %v", report.Released)
+	}
+}
+
+func TestReconciler_NilSafe(t *testing.T) {
+	var reconciler *Reconciler
+	reconciler.Trigger()
+	if _, ok := reconciler.IdleSince("eipalloc-1"); ok {
+		t.Error("expected a nil reconciler to know no idle addresses")
+	}
+}
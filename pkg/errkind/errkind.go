@@ -0,0 +1,191 @@
+// Package errkind classifies errors into the few kinds callers act on, such
+// as not found or throttled, independent of the package or cloud API they
+// come from. Package sentinels are created with New, AWS API errors are
+// classified from their error codes:
+//
+//	if errors.Is(err, errkind.Throttled) {
+//		// back off and retry
+//	}
+package errkind
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Kind is the class of an error. Kinds are stable and double as the error
+// codes of API problem responses.
+type Kind string
+
+const (
+	NotFound      Kind = "not_found"
+	Conflict      Kind = "conflict"
+	Throttled     Kind = "throttled"
+	QuotaExceeded Kind = "quota_exceeded"
+	InvalidInput  Kind = "invalid_input"
+	Unavailable   Kind = "unavailable"
+	Timeout       Kind = "timeout"
+)
+
+func (k Kind) Error() string {
+	return strings.ReplaceAll(string(k), "_", " ")
+}
+
+// Error is an error of a kind. It reads like the error it wraps.
+type Error struct {
+	Kind Kind
+	// Code is the AWS error code the kind was derived from, if any
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, kind) report the kind of err.
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// New returns a sentinel error of a kind.
+func New(kind Kind, message string) error {
+	return &Error{Kind: kind, Err: errors.New(message)}
+}
+
+// kinds are all kinds, for errors that report theirs through an Is method.
+var kinds = []Kind{NotFound, Conflict, Throttled, QuotaExceeded, InvalidInput, Unavailable, Timeout}
+
+// Of returns the kind of err: the kind of the first Error in its chain, a
+// kind an error in the chain reports through its Is method, or the kind of
+// the AWS API error it wraps. It is empty for unclassified errors.
+func Of(err error) Kind {
+	var kindErr *Error
+	if errors.As(err, &kindErr) {
+		return kindErr.Kind
+	}
+	for _, kind := range kinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return FromCode(apiErr.ErrorCode(), apiErr.ErrorFault())
+	}
+	return ""
+}
+
+// Classify wraps an AWS API error in an Error of the kind its code maps
+// to. Other errors, and errors that already have a kind, are returned as
+// they are.
+func Classify(err error) error {
+	var kindErr *Error
+	if err == nil || errors.As(err, &kindErr) {
+		return err
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	kind := FromCode(apiErr.ErrorCode(), apiErr.ErrorFault())
+	if kind == "" {
+		return err
+	}
+	return &Error{Kind: kind, Code: apiErr.ErrorCode(), Err: err}
+}
+
+// codes are the AWS error codes that do not follow the suffix conventions
+// FromCode understands.
+var codes = map[string]Kind{
+	"NotFound":     NotFound,
+	"NoSuchBucket": NotFound,
+	"NoSuchKey":    NotFound,
+
+	"IncorrectInstanceState":      Conflict,
+	"IncorrectState":              Conflict,
+	"DependencyViolation":         Conflict,
+	"VolumeInUse":                 Conflict,
+	"IdempotentParameterMismatch": Conflict,
+	"Resource.AlreadyAssociated":  Conflict,
+	"BucketAlreadyOwnedByYou":     Conflict,
+
+	"RequestLimitExceeded":      Throttled,
+	"Throttling":                Throttled,
+	"ThrottlingException":       Throttled,
+	"RequestThrottled":          Throttled,
+	"RequestThrottledException": Throttled,
+	"TooManyRequestsException":  Throttled,
+	"SlowDown":                  Throttled,
+
+	"MaxSpotInstanceCountExceeded":  QuotaExceeded,
+	"ServiceQuotaExceededException": QuotaExceeded,
+
+	"InvalidParameter":            InvalidInput,
+	"InvalidParameterValue":       InvalidInput,
+	"InvalidParameterCombination": InvalidInput,
+	"MissingParameter":            InvalidInput,
+	"ValidationError":             InvalidInput,
+	"UnsupportedOperation":        InvalidInput,
+	"Unsupported":                 InvalidInput,
+	"InvalidUserData.Malformed":   InvalidInput,
+
+	"InsufficientInstanceCapacity": Unavailable,
+	"InsufficientAddressCapacity":  Unavailable,
+	"InsufficientVolumeCapacity":   Unavailable,
+	"InsufficientCapacity":         Unavailable,
+	"ServiceUnavailable":           Unavailable,
+	"Unavailable":                  Unavailable,
+	"InternalError":                Unavailable,
+	"InternalFailure":              Unavailable,
+
+	"RequestTimeout":          Timeout,
+	"RequestTimeoutException": Timeout,
+}
+
+// FromCode maps an AWS error code to a kind. Codes not known by name are
+// classified by the conventions of EC2 error codes, e.g. the NotFound in
+// InvalidInstanceID.NotFound; server faults are unavailable.
+func FromCode(code string, fault smithy.ErrorFault) Kind {
+	if kind, ok := codes[code]; ok {
+		return kind
+	}
+	switch {
+	case strings.HasSuffix(code, ".NotFound"):
+		return NotFound
+	case strings.HasSuffix(code, ".Duplicate"), strings.HasSuffix(code, ".InUse"):
+		return Conflict
+	case strings.HasSuffix(code, "LimitExceeded"):
+		return QuotaExceeded
+	case strings.HasSuffix(code, ".Malformed"), strings.HasSuffix(code, ".Range"):
+		return InvalidInput
+	case fault == smithy.FaultServer:
+		return Unavailable
+	}
+	return ""
+}
+
+// AddClassifier is an API option for AWS clients that classifies the
+// errors of every operation:
+//
+//	ec2.NewFromConfig(cfg, func(o *ec2.Options) {
+//		o.APIOptions = append(o.APIOptions, errkind.AddClassifier)
+//	})
+func AddClassifier(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ErrorKindClassifier", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		return out, metadata, Classify(err)
+	}), middleware.Before)
+}
@@ -0,0 +1,117 @@
+package errkind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestFromCode(t *testing.T) {
+	tests := []struct {
+		code  string
+		fault smithy.ErrorFault
+		want  Kind
+	}{
+		{"InvalidInstanceID.NotFound", smithy.FaultClient, NotFound},
+		{"InvalidAMIID.NotFound", smithy.FaultClient, NotFound},
+		{"NoSuchKey", smithy.FaultClient, NotFound},
+		{"InvalidKeyPair.Duplicate", smithy.FaultClient, Conflict},
+		{"IncorrectInstanceState", smithy.FaultClient, Conflict},
+		{"InvalidIPAddress.InUse", smithy.FaultClient, Conflict},
+		{"RequestLimitExceeded", smithy.FaultClient, Throttled},
+		{"SlowDown", smithy.FaultServer, Throttled},
+		{"InstanceLimitExceeded", smithy.FaultClient, QuotaExceeded},
+		{"VcpuLimitExceeded", smithy.FaultClient, QuotaExceeded},
+		{"InvalidParameterValue", smithy.FaultClient, InvalidInput},
+		{"InvalidInstanceID.Malformed", smithy.FaultClient, InvalidInput},
+		{"InsufficientInstanceCapacity", smithy.FaultServer, Unavailable},
+		{"SomethingNew", smithy.FaultServer, Unavailable},
+		{"UnauthorizedOperation", smithy.FaultClient, ""},
+	}
+	for _, tt := range tests {
+		if got := FromCode(tt.code, tt.fault); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.code, tt.want, got)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	apiErr := &smithy.GenericAPIError{Code: "RequestLimitExceeded", Message: "Request limit exceeded."}
+	err := fmt.Errorf("failed to describe instances: %w", Classify(apiErr))
+
+	if !errors.Is(err, Throttled) || errors.Is(err, NotFound) {
+		t.Errorf("expected a throttled error, got %v", err)
+	}
+	var kindErr *Error
+	if !errors.As(err, &kindErr) || kindErr.Code != "RequestLimitExceeded" {
+		t.Errorf("expected the AWS code to be kept, got %+v", kindErr)
+	}
+	if err.Error() != "failed to describe instances: api error RequestLimitExceeded: Request limit exceeded." {
+		t.Errorf("expected the message to be unchanged, got %q", err.Error())
+	}
+	var unwrapped smithy.APIError
+	if !errors.As(err, &unwrapped) {
+		t.Errorf("expected the API error to stay reachable")
+	}
+
+	plain := errors.New("disk full")
+	if Classify(plain) != plain || Classify(nil) != nil {
+		t.Errorf("expected other errors to pass through")
+	}
+}
+
+func TestNew(t *testing.T) {
+	errMissing := New(NotFound, "widget not found")
+	err := fmt.Errorf("%w: w-1", errMissing)
+
+	if !errors.Is(err, errMissing) || !errors.Is(err, NotFound) {
+		t.Errorf("expected both the sentinel and its kind to match")
+	}
+	if err.Error() != "widget not found: w-1" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestOf(t *testing.T) {
+	if kind := Of(fmt.Errorf("wrapped: %w", New(Conflict, "busy"))); kind != Conflict {
+		t.Errorf("expected conflict, got %q", kind)
+	}
+	if kind := Of(&smithy.GenericAPIError{Code: "InvalidVolume.NotFound"}); kind != NotFound {
+		t.Errorf("expected an unclassified API error to be classified, got %q", kind)
+	}
+	if kind := Of(fmt.Errorf("wrapped: %w", kindOfError{})); kind != Unavailable {
+		t.Errorf("expected the kind reported by Is, got %q", kind)
+	}
+	if kind := Of(context.DeadlineExceeded); kind != Timeout {
+		t.Errorf("expected timeout, got %q", kind)
+	}
+	if kind := Of(errors.New("boom")); kind != "" {
+		t.Errorf("expected no kind, got %q", kind)
+	}
+}
+
+func TestAddClassifier(t *testing.T) {
+	stack := middleware.NewStack("test", func() interface{} { return nil })
+	if err := AddClassifier(stack); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	handler := middleware.DecorateHandler(middleware.HandlerFunc(func(ctx context.Context, input interface{}) (interface{}, middleware.Metadata, error) {
+		return nil, middleware.Metadata{}, &smithy.GenericAPIError{Code: "InvalidInstanceID.NotFound"}
+	}), stack)
+
+	_, _, err := handler.Handle(context.Background(), nil)
+	if !errors.Is(err, NotFound) {
+		t.Errorf("expected a classified error, got %v", err)
+	}
+}
+
+// kindOfError reports its kind through an Is method.
+type kindOfError struct{}
+
+func (kindOfError) Error() string { return "no capacity" }
+
+func (kindOfError) Is(target error) bool { return target == Unavailable }
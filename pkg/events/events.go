@@ -0,0 +1,196 @@
+// Package events is an in-process event bus. Waiters, reconcilers and the
+// inventory sync publish to it, and any component (such as the SSE endpoint)
+// can subscribe. Recent events are kept in a ring buffer so subscribers can
+// resume after a reconnect.
+package events
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	TypeNodeState  Type = "node.state"
+	TypeBuildStage Type = "build.stage"
+	TypeImageState Type = "image.state"
+	// TypeSpotInterruption is published once when EC2 reclaims a spot node
+	TypeSpotInterruption Type = "node.spot-interruption"
+)
+
+const (
+	DefaultBufferSize = 1024
+	// subscriberBuffer is how many events a subscriber may fall behind before
+	// it is disconnected; it can resume from the ring buffer
+	subscriberBuffer = 64
+)
+
+// Event is published on the bus. IDs increase monotonically per bus.
+type Event struct {
+	ID      uint64    `json:"id"`
+	Type    Type      `json:"type"`
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+	Data    any       `json:"data"`
+}
+
+// NodeStateChanged is the data of a TypeNodeState event.
+type NodeStateChanged struct {
+	InstanceID    string `json:"instanceId"`
+	Name          string `json:"name,omitempty"`
+	Pool          string `json:"pool,omitempty"`
+	PreviousState string `json:"previousState,omitempty"`
+	State         string `json:"state"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// BuildStageChanged is the data of a TypeBuildStage event.
+type BuildStageChanged struct {
+	BuildID string `json:"buildId"`
+	Stage   string `json:"stage"`
+	Status  string `json:"status"`
+	AMIID   string `json:"amiId,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ImageStateChanged is the data of a TypeImageState event.
+type ImageStateChanged struct {
+	AMIID         string `json:"amiId"`
+	Name          string `json:"name,omitempty"`
+	PreviousState string `json:"previousState,omitempty"`
+	State         string `json:"state"`
+}
+
+// SpotInterrupted is the data of a TypeSpotInterruption event.
+type SpotInterrupted struct {
+	InstanceID string `json:"instanceId"`
+	Name       string `json:"name,omitempty"`
+	StatusCode string `json:"statusCode"`
+	Message    string `json:"message,omitempty"`
+	// ReplacementID is the node launched in its place, if any
+	ReplacementID string `json:"replacementId,omitempty"`
+}
+
+type Bus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	buffer      []Event
+	size        int
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBus(size int) *Bus {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Bus{
+		nextID:      1,
+		size:        size,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the event an ID and delivers it to every matching
+// subscriber. Subscribers that cannot keep up are closed rather than
+// blocking the publisher. Publishing on a nil bus is a no-op.
+func (b *Bus) Publish(typ Type, subject string, data any) Event {
+	if b == nil {
+		return Event{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := Event{ID: b.nextID, Type: typ, Time: time.Now().UTC(), Subject: subject, Data: data}
+	b.nextID++
+	b.buffer = append(b.buffer, event)
+	if len(b.buffer) > b.size {
+		b.buffer = slices.Clone(b.buffer[len(b.buffer)-b.size:])
+	}
+
+	for sub := range b.subscribers {
+		if !sub.matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			b.removeLocked(sub)
+		}
+	}
+	return event
+}
+
+// Subscription receives events on C until it is closed, either by Close,
+// by its context, or because it fell too far behind.
+type Subscription struct {
+	C <-chan Event
+	// Replay holds the buffered events after the requested ID, oldest first.
+	// They precede everything delivered on C.
+	Replay []Event
+	// Truncated is set when events after the requested ID have already been
+	// dropped from the ring buffer
+	Truncated bool
+
+	ch    chan Event
+	types []Type
+	bus   *Bus
+}
+
+// Subscribe starts a subscription for the given types (all types if none
+// are given). With afterID > 0, buffered events newer than afterID are
+// returned in Replay, so a client can resume from its Last-Event-ID.
+func (b *Bus) Subscribe(ctx context.Context, afterID uint64, types ...Type) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, types: types, bus: b}
+
+	b.mu.Lock()
+	if afterID >= b.nextID {
+		// The ID was issued before a restart; everything buffered is new
+		afterID = 0
+		sub.Truncated = true
+	}
+	if afterID > 0 || sub.Truncated {
+		if len(b.buffer) > 0 && b.buffer[0].ID > afterID+1 {
+			sub.Truncated = true
+		}
+		for _, event := range b.buffer {
+			if event.ID > afterID && sub.matches(event) {
+				sub.Replay = append(sub.Replay, event)
+			}
+		}
+	}
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	context.AfterFunc(ctx, sub.Close)
+	return sub
+}
+
+// Close ends the subscription and closes C. It is safe to call repeatedly.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.removeLocked(s)
+}
+
+// LastID returns the ID of the most recently published event.
+func (b *Bus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nextID - 1
+}
+
+func (b *Bus) removeLocked(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
+
+func (s *Subscription) matches(event Event) bool {
+	return len(s.types) == 0 || slices.Contains(s.types, event.Type)
+}
@@ -0,0 +1,153 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed unexpectedly")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return Event{}
+}
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	bus := NewBus(0)
+	sub := bus.Subscribe(context.Background(), 0, TypeNodeState)
+	defer sub.Close()
+
+	bus.Publish(TypeBuildStage, "build-1", BuildStageChanged{BuildID: "build-1", Stage: "upload"})
+	published := bus.Publish(TypeNodeState, "i-1", NodeStateChanged{InstanceID: "i-1", State: "running"})
+
+	event := receive(t, sub)
+	if event.ID != published.ID || event.ID != 2 || event.Type != TypeNodeState {
+		t.Errorf("expected the node event with ID 2, got %+v", event)
+	}
+	if data, ok := event.Data.(NodeStateChanged); !ok || data.State != "running" {
+		t.Errorf("unexpected data %+v", event.Data)
+	}
+	if bus.LastID() != 2 {
+		t.Errorf("expected last ID 2, got %d", bus.LastID())
+	}
+}
+
+func TestBus_Subscribe_Replay(t *testing.T) {
+	bus := NewBus(3)
+	for range 5 {
+		bus.Publish(TypeNodeState, "i-1", nil)
+	}
+
+	sub := bus.Subscribe(context.Background(), 3)
+	defer sub.Close()
+	if len(sub.Replay) != 2 || sub.Replay[0].ID != 4 || sub.Truncated {
+		t.Errorf("expected events 4 and 5 to be replayed, got %+v (truncated %v)", sub.Replay, sub.Truncated)
+	}
+
+	old := bus.Subscribe(context.Background(), 1)
+	defer old.Close()
+	if !old.Truncated || len(old.Replay) != 3 {
+		t.Errorf("expected a truncated replay of 3 events, got %+v (truncated %v)", old.Replay, old.Truncated)
+	}
+
+	// An ID from before a restart replays the whole buffer
+	restarted := bus.Subscribe(context.Background(), 100)
+	defer restarted.Close()
+	if !restarted.Truncated || len(restarted.Replay) != 3 {
+		t.Errorf("expected the whole buffer for an unknown ID, got %+v", restarted.Replay)
+	}
+
+	bus.Publish(TypeNodeState, "i-1", nil)
+	if event := receive(t, sub); event.ID != 6 {
+		t.Errorf("expected live event 6 after replay, got %d", event.ID)
+	}
+}
+
+func TestBus_SlowSubscriberIsClosed(t *testing.T) {
+	bus := NewBus(0)
+	slow := bus.Subscribe(context.Background(), 0)
+
+	for range subscriberBuffer + 1 {
+		bus.Publish(TypeNodeState, "i-1", nil)
+	}
+
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("expected %d buffered events before close, got %d", subscriberBuffer, received)
+	}
+	slow.Close()
+}
+
+func TestBus_Subscribe_ContextCancel(t *testing.T) {
+	bus := NewBus(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := bus.Subscribe(ctx, 0)
+	cancel()
+
+	select {
+	case _, ok := <-sub.C:
+		if ok {
+			t.Error("expected no events")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected subscription to close with its context")
+	}
+
+	var nilBus *Bus
+	nilBus.Publish(TypeNodeState, "i-1", nil)
+}
+
+func TestNodeTracker_Observe(t *testing.T) {
+	bus := NewBus(0)
+	tracker := NewNodeTracker(bus)
+
+	tracker.Observe(NodeStateChanged{InstanceID: "i-1", State: "pending"})
+	tracker.Observe(NodeStateChanged{InstanceID: "i-1", State: "pending"})
+	tracker.Observe(NodeStateChanged{InstanceID: "i-1", State: "running"})
+	// The caller's baseline is ignored once the tracker knows the node
+	tracker.Observe(NodeStateChanged{InstanceID: "i-1", PreviousState: "stopped", State: "running"})
+	// and used for nodes it has not seen
+	tracker.Observe(NodeStateChanged{InstanceID: "i-2", PreviousState: "running", State: "running"})
+
+	if bus.LastID() != 2 {
+		t.Fatalf("expected 2 transitions to be published, got %d", bus.LastID())
+	}
+
+	sub := bus.Subscribe(context.Background(), 1)
+	defer sub.Close()
+	data := sub.Replay[0].Data.(NodeStateChanged)
+	if data.PreviousState != "pending" || data.State != "running" {
+		t.Errorf("unexpected transition %+v", data)
+	}
+
+	var nilTracker *NodeTracker
+	if nilTracker.Observe(NodeStateChanged{InstanceID: "i-1", State: "running"}) {
+		t.Error("expected nil tracker to be a no-op")
+	}
+	nilTracker.Forget("i-1")
+}
+
+func TestNodeTracker_Forget(t *testing.T) {
+	tracker := NewNodeTracker(NewBus(0))
+	tracker.Observe(NodeStateChanged{InstanceID: "i-1", State: "running"})
+
+	tracker.Forget("i-1")
+	if len(tracker.states) != 0 {
+		t.Errorf("expected the node to be forgotten, got %v", tracker.states)
+	}
+	// A forgotten node is judged by the caller's baseline again
+	if tracker.Observe(NodeStateChanged{InstanceID: "i-1", PreviousState: "running", State: "running"}) {
+		t.Error("expected no transition against the caller's baseline")
+	}
+}
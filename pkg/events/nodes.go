@@ -0,0 +1,64 @@
+package events
+
+import (
+	"sync"
+)
+
+// NodeTracker publishes node state events for actual transitions only, so
+// several observers of the same node (API waits, the pool reconciler, the
+// inventory sync) do not publish duplicates.
+type NodeTracker struct {
+	Bus *Bus
+
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func NewNodeTracker(bus *Bus) *NodeTracker {
+	return &NodeTracker{
+		Bus:    bus,
+		states: make(map[string]string),
+	}
+}
+
+// Observe records the node's current state and publishes a TypeNodeState
+// event if it changed. A PreviousState set by the caller is used as the
+// baseline for nodes the tracker has not seen yet. A nil tracker is a no-op.
+func (t *NodeTracker) Observe(change NodeStateChanged) bool {
+	if t == nil || change.InstanceID == "" || change.State == "" {
+		return false
+	}
+
+	t.mu.Lock()
+	previous, known := t.states[change.InstanceID]
+	if !known {
+		previous = change.PreviousState
+	}
+	if previous == change.State {
+		t.states[change.InstanceID] = change.State
+		t.mu.Unlock()
+		return false
+	}
+	if change.State == "terminated" {
+		delete(t.states, change.InstanceID)
+	} else {
+		t.states[change.InstanceID] = change.State
+	}
+	t.mu.Unlock()
+
+	change.PreviousState = previous
+	t.Bus.Publish(TypeNodeState, change.InstanceID, change)
+	return true
+}
+
+// Forget drops what the tracker knows about a node, for nodes that vanished
+// from a listing without a terminated observation. Otherwise the entry
+// would be kept forever. A nil tracker is a no-op.
+func (t *NodeTracker) Forget(instanceID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.states, instanceID)
+}
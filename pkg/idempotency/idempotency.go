@@ -0,0 +1,135 @@
+// Package idempotency remembers the responses of mutating requests by their
+// idempotency key, so a client that retries a request after a timeout gets
+// the original response instead of repeating its effect.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+)
+
+// DefaultTTL is how long responses are remembered.
+const DefaultTTL = 24 * time.Hour
+
+var (
+	ErrKeyReused  = errkind.New(errkind.Conflict, "idempotency key was used for a different request")
+	ErrInProgress = errkind.New(errkind.Conflict, "a request with this idempotency key is still in progress")
+)
+
+// Response is a recorded response.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	fingerprint string
+	// response is nil while the first request is in progress
+	response *Response
+	expires  time.Time
+}
+
+// Store maps idempotency keys to the responses of the requests that first
+// used them. Keys expire TTL after they were first used.
+type Store struct {
+	TTL time.Duration
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+func NewStore() *Store {
+	return &Store{
+		TTL:     DefaultTTL,
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Begin claims key for a request with fingerprint, see Fingerprint. It
+// returns the response recorded for an earlier request with the same key,
+// or nil when the caller should serve the request and then Complete or
+// Release the key. A key of a different request is ErrKeyReused, a key of
+// a request still being served ErrInProgress.
+func (s *Store) Begin(key, fingerprint string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	e, ok := s.entries[key]
+	switch {
+	case !ok:
+		s.entries[key] = &entry{fingerprint: fingerprint, expires: now.Add(s.TTL)}
+		return nil, nil
+	case e.fingerprint != fingerprint:
+		return nil, ErrKeyReused
+	case e.response == nil:
+		return nil, ErrInProgress
+	}
+	response := *e.response
+	response.Header = e.response.Header.Clone()
+	return &response, nil
+}
+
+// Complete records the response of the request that claimed key.
+func (s *Store) Complete(key string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		response.Header = response.Header.Clone()
+		e.response = &response
+	}
+}
+
+// Release forgets key without recording a response, so the request can be
+// retried with it, e.g. after a server error.
+func (s *Store) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// Fingerprint identifies a request by its method, path and body, so a key
+// reused for another request is detected.
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ClientToken derives the EC2 client token of a launch from the key of the
+// request. Keys are hashed as client tokens are limited to 64 ASCII
+// characters; the token is exactly that long.
+func ClientToken(key string) string {
+	sum := sha256.Sum256([]byte("tilmancloud:" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+// WithKey returns a context carrying the idempotency key of a request.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// KeyFromContext returns the idempotency key of the request, if any.
+func KeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(contextKey{}).(string)
+	return key
+}
@@ -0,0 +1,77 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStore_Begin(t *testing.T) {
+	store := NewStore()
+	fingerprint := Fingerprint("POST", "/nodes", []byte(`{"name":"web"}`))
+
+	response, err := store.Begin("key-1", fingerprint)
+	if err != nil || response != nil {
+		t.Fatalf("expected to claim a new key, got %v, %v", response, err)
+	}
+	if _, err := store.Begin("key-1", fingerprint); !errors.Is(err, ErrInProgress) {
+		t.Errorf("expected ErrInProgress, got %v", err)
+	}
+
+	store.Complete("key-1", Response{Status: http.StatusCreated, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"id":"i-1"}`)})
+	response, err = store.Begin("key-1", fingerprint)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if response == nil || response.Status != http.StatusCreated || string(response.Body) != `{"id":"i-1"}` || response.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected the recorded response, got %+v", response)
+	}
+
+	if _, err := store.Begin("key-1", Fingerprint("POST", "/nodes", []byte(`{"name":"db"}`))); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("expected ErrKeyReused, got %v", err)
+	}
+}
+
+func TestStore_Release(t *testing.T) {
+	store := NewStore()
+	store.Begin("key-1", "a")
+	store.Release("key-1")
+
+	if response, err := store.Begin("key-1", "a"); err != nil || response != nil {
+		t.Errorf("expected a released key to be claimable, got %v, %v", response, err)
+	}
+}
+
+func TestStore_Expiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewStore()
+	store.now = func() time.Time { return now }
+	store.Begin("key-1", "a")
+	store.Complete("key-1", Response{Status: http.StatusCreated})
+
+	now = now.Add(DefaultTTL + time.Second)
+	if response, err := store.Begin("key-1", "b"); err != nil || response != nil {
+		t.Errorf("expected an expired key to be claimable, got %v, %v", response, err)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	token := ClientToken("key-1")
+	if len(token) != 64 {
+		t.Errorf("expected a 64 character token, got %d", len(token))
+	}
+	if token != ClientToken("key-1") || token == ClientToken("key-2") {
+		t.Errorf("expected tokens to be derived from the key")
+	}
+}
+
+func TestKeyFromContext(t *testing.T) {
+	if key := KeyFromContext(context.Background()); key != "" {
+		t.Errorf("expected no key, got %q", key)
+	}
+	if key := KeyFromContext(WithKey(context.Background(), "key-1")); key != "key-1" {
+		t.Errorf("expected key-1, got %q", key)
+	}
+}
@@ -6,54 +6,86 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
+// ErrNoAMI is returned when no available AMI matches.
+var ErrNoAMI = errkind.New(errkind.Unavailable, "no available AMIs found")
+
 type AMIRegistrar struct {
-	client *ec2.Client
-	region string
+	client AMIRegistrarClient
+	waiter ImageAvailableWaiter
+	// Timeout bounds the wait for a registered AMI, DefaultAvailableTimeout
+	// when zero
+	Timeout time.Duration
 }
 
-func NewAMIRegistrar(ctx context.Context, region string) (*AMIRegistrar, error) {
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
+func NewAMIRegistrar(cfg aws.Config) *AMIRegistrar {
+	return NewAMIRegistrarFromClient(ec2.NewFromConfig(cfg, classifyErrors), nil)
+}
 
+// NewAMIRegistrarFromClient builds a registrar on client. A nil waiter polls
+// the AMI with ec2.ImageAvailableWaiter.
+func NewAMIRegistrarFromClient(client AMIRegistrarClient, waiter ImageAvailableWaiter) *AMIRegistrar {
+	if waiter == nil {
+		waiter = ec2.NewImageAvailableWaiter(client)
+	}
 	return &AMIRegistrar{
-		client: ec2.NewFromConfig(cfg),
-		region: region,
-	}, nil
+		client: client,
+		waiter: waiter,
+	}
 }
 
+// LatestChannel selects the newest AMI regardless of its name.
+const LatestChannel = "latest"
+
 type AMIFinder interface {
 	FindLatestAMI(ctx context.Context) (string, error)
 }
 
+// ChannelAMIFinder finds the newest AMI of a named image channel.
+type ChannelAMIFinder interface {
+	FindLatestAMIInChannel(ctx context.Context, channel string) (string, error)
+}
+
 type ImageLister interface {
 	ListImages(ctx context.Context) ([]types.Image, error)
 }
 
 func (r *AMIRegistrar) FindLatestAMI(ctx context.Context) (string, error) {
-	slog.Info("Finding latest available AMI")
-	result, err := r.client.DescribeImages(ctx, &ec2.DescribeImagesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("state"),
-				Values: []string{"available"},
-			},
+	return r.FindLatestAMIInChannel(ctx, LatestChannel)
+}
+
+// FindLatestAMIInChannel returns the newest available AMI whose name starts
+// with the channel, e.g. "fedora-43-aarch64". LatestChannel matches any AMI.
+func (r *AMIRegistrar) FindLatestAMIInChannel(ctx context.Context, channel string) (string, error) {
+	slog.Info("Finding latest available AMI", "channel", channel)
+	filters := []types.Filter{
+		{
+			Name:   aws.String("state"),
+			Values: []string{"available"},
 		},
-		Owners: []string{"self"},
+	}
+	if channel != LatestChannel && channel != "" {
+		filters = append(filters, types.Filter{
+			Name:   aws.String("name"),
+			Values: []string{channel + "-*"},
+		})
+	}
+
+	result, err := r.client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Filters: filters,
+		Owners:  []string{"self"},
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to query AMIs: %w", err)
 	}
 
 	if len(result.Images) == 0 {
-		return "", fmt.Errorf("no available AMIs found")
+		return "", fmt.Errorf("%w in channel %s", ErrNoAMI, channel)
 	}
 
 	var latest *types.Image
@@ -71,10 +103,10 @@ func (r *AMIRegistrar) FindLatestAMI(ctx context.Context) (string, error) {
 	}
 
 	if latest == nil || latest.ImageId == nil {
-		return "", fmt.Errorf("no available AMIs found")
+		return "", fmt.Errorf("%w in channel %s", ErrNoAMI, channel)
 	}
 
-	slog.Info("Found latest AMI", "ami_id", *latest.ImageId, "creation_date", latest.CreationDate)
+	slog.Info("Found latest AMI", "ami_id", *latest.ImageId, "channel", channel, "creation_date", latest.CreationDate)
 	return *latest.ImageId, nil
 }
 
@@ -190,14 +222,16 @@ func (r *AMIRegistrar) RegisterAMI(ctx context.Context, snapshotID, imageID, nam
 func (r *AMIRegistrar) WaitForAvailable(ctx context.Context, amiID string) error {
 	slog.Info("Waiting for AMI to become available", "ami_id", amiID)
 
-	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultAvailableTimeout
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	waiter := ec2.NewImageAvailableWaiter(r.client)
-
-	err := waiter.Wait(waitCtx, &ec2.DescribeImagesInput{
+	err := r.waiter.Wait(waitCtx, &ec2.DescribeImagesInput{
 		ImageIds: []string{amiID},
-	}, 5*time.Minute)
+	}, timeout)
 	if err != nil {
 		return fmt.Errorf("AMI did not become available: %w", err)
 	}
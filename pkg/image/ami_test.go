@@ -0,0 +1,201 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// registrarClient registers ami-new and finds existing among the AMIs tagged
+// with an ImageID.
+func registrarClient(existing ...types.Image) *MockImageClient {
+	return &MockImageClient{
+		DescribeImagesFunc: func(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+			return &ec2.DescribeImagesOutput{Images: existing}, nil
+		},
+		RegisterImageFunc: func(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error) {
+			return &ec2.RegisterImageOutput{ImageId: aws.String("ami-new")}, nil
+		},
+		CreateTagsFunc: func(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+			return &ec2.CreateTagsOutput{}, nil
+		},
+	}
+}
+
+func TestAMIRegistrar_RegisterAMI(t *testing.T) {
+	client := registrarClient()
+	var registered *ec2.RegisterImageInput
+	client.RegisterImageFunc = func(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error) {
+		registered = params
+		return &ec2.RegisterImageOutput{ImageId: aws.String("ami-new")}, nil
+	}
+	var tagged *ec2.CreateTagsInput
+	client.CreateTagsFunc = func(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+		tagged = params
+		return &ec2.CreateTagsOutput{}, nil
+	}
+	var waitedFor []string
+	waiter := &MockImageAvailableWaiter{
+		WaitFunc: func(ctx context.Context, params *ec2.DescribeImagesInput, maxWaitDur time.Duration) error {
+			waitedFor = params.ImageIds
+			return nil
+		},
+	}
+
+	amiID, err := NewAMIRegistrarFromClient(client, waiter).RegisterAMI(context.Background(), "snap-1", "abc123", "fedora-43-aarch64-base-abc123", "Fedora")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if amiID != "ami-new" {
+		t.Errorf("expected ami-new, got %s", amiID)
+	}
+	if aws.ToString(registered.BlockDeviceMappings[0].Ebs.SnapshotId) != "snap-1" || registered.Architecture != types.ArchitectureValuesArm64 {
+		t.Errorf("unexpected register input %+v", registered)
+	}
+	if tagged == nil || !hasTag(tagged.Tags, "ImageID", "abc123") || !hasTag(tagged.Tags, "SnapshotID", "snap-1") {
+		t.Errorf("expected the AMI to be tagged with its ImageID and snapshot, got %+v", tagged)
+	}
+	if len(waitedFor) != 1 || waitedFor[0] != "ami-new" {
+		t.Errorf("expected to wait for ami-new, got %v", waitedFor)
+	}
+}
+
+func TestAMIRegistrar_RegisterAMI_ReusesExisting(t *testing.T) {
+	client := registrarClient(
+		types.Image{ImageId: aws.String("ami-old"), CreationDate: aws.String("2025-01-01T00:00:00.000Z")},
+		types.Image{ImageId: aws.String("ami-latest"), CreationDate: aws.String("2025-02-01T00:00:00.000Z")},
+	)
+	client.RegisterImageFunc = nil
+
+	amiID, err := NewAMIRegistrarFromClient(client, &MockImageAvailableWaiter{}).RegisterAMI(context.Background(), "snap-1", "abc123", "fedora", "Fedora")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if amiID != "ami-latest" {
+		t.Errorf("expected the newest existing AMI, got %s", amiID)
+	}
+}
+
+func TestAMIRegistrar_RegisterAMI_TaggingFailure(t *testing.T) {
+	client := registrarClient()
+	client.CreateTagsFunc = func(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+		return nil, errors.New("UnauthorizedOperation")
+	}
+
+	amiID, err := NewAMIRegistrarFromClient(client, &MockImageAvailableWaiter{}).RegisterAMI(context.Background(), "snap-1", "abc123", "fedora", "Fedora")
+	if err != nil {
+		t.Fatalf("expected tagging failures to be tolerated, got %v", err)
+	}
+	if amiID != "ami-new" {
+		t.Errorf("expected ami-new, got %s", amiID)
+	}
+}
+
+func TestAMIRegistrar_RegisterAMI_Failures(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*MockImageClient, *MockImageAvailableWaiter)
+		want   string
+	}{
+		{
+			name: "lookup fails",
+			mutate: func(c *MockImageClient, w *MockImageAvailableWaiter) {
+				c.DescribeImagesFunc = func(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+					return nil, errors.New("throttled")
+				}
+			},
+			want: "failed to check for existing AMI",
+		},
+		{
+			name: "register rejected",
+			mutate: func(c *MockImageClient, w *MockImageAvailableWaiter) {
+				c.RegisterImageFunc = func(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error) {
+					return nil, errors.New("InvalidSnapshot.NotFound")
+				}
+			},
+			want: "failed to register AMI",
+		},
+		{
+			name: "no AMI ID",
+			mutate: func(c *MockImageClient, w *MockImageAvailableWaiter) {
+				c.RegisterImageFunc = func(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error) {
+					return &ec2.RegisterImageOutput{}, nil
+				}
+			},
+			want: "AMI ID is nil",
+		},
+		{
+			name: "AMI fails",
+			mutate: func(c *MockImageClient, w *MockImageAvailableWaiter) {
+				w.WaitFunc = func(ctx context.Context, params *ec2.DescribeImagesInput, maxWaitDur time.Duration) error {
+					return errors.New("waiter state transitioned to Failure")
+				}
+			},
+			want: "wait for AMI available failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := registrarClient()
+			waiter := &MockImageAvailableWaiter{}
+			tt.mutate(client, waiter)
+
+			_, err := NewAMIRegistrarFromClient(client, waiter).RegisterAMI(context.Background(), "snap-1", "abc123", "fedora", "Fedora")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestAMIRegistrar_WaitForAvailable_Timeout(t *testing.T) {
+	waiter := &MockImageAvailableWaiter{
+		WaitFunc: func(ctx context.Context, params *ec2.DescribeImagesInput, maxWaitDur time.Duration) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	registrar := NewAMIRegistrarFromClient(registrarClient(), waiter)
+	registrar.Timeout = 10 * time.Millisecond
+
+	if err := registrar.WaitForAvailable(context.Background(), "ami-new"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline exceeded error, got %v", err)
+	}
+}
+
+func TestAMIRegistrar_FindLatestAMIInChannel(t *testing.T) {
+	var filters []types.Filter
+	client := registrarClient(
+		types.Image{ImageId: aws.String("ami-1"), CreationDate: aws.String("2025-01-01T00:00:00.000Z")},
+		types.Image{ImageId: aws.String("ami-2"), CreationDate: aws.String("2025-03-01T00:00:00.000Z")},
+		types.Image{ImageId: aws.String("ami-3"), CreationDate: aws.String("2025-02-01T00:00:00.000Z")},
+	)
+	describe := client.DescribeImagesFunc
+	client.DescribeImagesFunc = func(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+		filters = params.Filters
+		return describe(ctx, params, optFns...)
+	}
+	registrar := NewAMIRegistrarFromClient(client, nil)
+
+	amiID, err := registrar.FindLatestAMIInChannel(context.Background(), "fedora-43-aarch64")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if amiID != "ami-2" {
+		t.Errorf("expected the newest AMI ami-2, got %s", amiID)
+	}
+	if len(filters) != 2 || filters[1].Values[0] != "fedora-43-aarch64-*" {
+		t.Errorf("expected a name filter for the channel, got %+v", filters)
+	}
+
+	if _, err := NewAMIRegistrarFromClient(registrarClient(), nil).FindLatestAMI(context.Background()); err == nil {
+		t.Errorf("expected an error without AMIs")
+	}
+}
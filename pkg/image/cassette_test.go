@@ -0,0 +1,64 @@
+package image
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/cassette"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// pollImmediately replays waiter polls without the SDK's delays.
+type pollImmediately struct {
+	client cassette.EC2API
+}
+
+func (p pollImmediately) Wait(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, maxWaitDur time.Duration, optFns ...func(*ec2.SnapshotImportedWaiterOptions)) error {
+	return ec2.NewSnapshotImportedWaiter(p.client, func(o *ec2.SnapshotImportedWaiterOptions) {
+		o.MinDelay = time.Millisecond
+		o.MaxDelay = time.Millisecond
+	}).Wait(ctx, params, maxWaitDur, optFns...)
+}
+
+// TestImageBuild_Cassette replays the import of an uploaded raw image and
+// its AMI registration. The cassette is synthetic; record it with
+// TILMAN_RECORD_CASSETTES=1 to replace it, and again after changing the
+// calls. The upload is not part of it, so the image has to be in the bucket
+// first.
+func TestImageBuild_Cassette(t *testing.T) {
+	client := cassette.EC2(t, "testdata/cassettes/image_build.json")
+	ctx := context.Background()
+	const (
+		imageID = "3f9c2a71d4e8b605"
+		bucket  = "tilman-images"
+		s3Key   = "images/Fedora-Cloud-Base-AmazonEC2-43-1.6.aarch64.raw"
+	)
+	description := "Fedora 43 aarch64 base image"
+
+	importer := NewImporterFromClient(client, pollImmediately{client})
+	snapshotID, err := importer.ImportSnapshot(ctx, bucket, s3Key, description, imageID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if snapshotID != "snap-0e1d2c3b4a5f6e7d8" {
+		t.Errorf("expected the imported snapshot, got %s", snapshotID)
+	}
+
+	registrar := NewAMIRegistrarFromClient(client, nil)
+	amiID, err := registrar.RegisterAMI(ctx, snapshotID, imageID, "fedora-43-aarch64-base-"+imageID, description)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if amiID != "ami-0c1d2e3f4a5b6c7d8" {
+		t.Errorf("expected the registered AMI, got %s", amiID)
+	}
+
+	latest, err := registrar.FindLatestAMIInChannel(ctx, "fedora-43-aarch64")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if latest != amiID {
+		t.Errorf("expected the new AMI to be the latest in its channel, got %s", latest)
+	}
+}
@@ -0,0 +1,68 @@
+package image
+
+import (
+	"context"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// The image pipeline only needs a handful of EC2 operations. Importer and
+// AMIRegistrar depend on these narrow interfaces instead of *ec2.Client, so
+// MockImageClient can stand in for EC2 in tests.
+
+type SnapshotClient interface {
+	DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error)
+}
+
+type ImportClient interface {
+	ImportSnapshot(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error)
+	DescribeImportSnapshotTasks(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error)
+}
+
+type ImageClient interface {
+	DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+	RegisterImage(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error)
+}
+
+type TagClient interface {
+	CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error)
+}
+
+// ImporterClient is what Importer needs from EC2.
+type ImporterClient interface {
+	SnapshotClient
+	ImportClient
+	TagClient
+}
+
+// AMIRegistrarClient is what AMIRegistrar needs from EC2.
+type AMIRegistrarClient interface {
+	ImageClient
+	TagClient
+}
+
+// SnapshotImportWaiter waits for an import snapshot task to complete, like
+// ec2.SnapshotImportedWaiter.
+type SnapshotImportWaiter interface {
+	Wait(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, maxWaitDur time.Duration, optFns ...func(*ec2.SnapshotImportedWaiterOptions)) error
+}
+
+// ImageAvailableWaiter waits for an AMI to become available, like
+// ec2.ImageAvailableWaiter.
+type ImageAvailableWaiter interface {
+	Wait(ctx context.Context, params *ec2.DescribeImagesInput, maxWaitDur time.Duration, optFns ...func(*ec2.ImageAvailableWaiterOptions)) error
+}
+
+// Default timeouts of the waiters.
+const (
+	DefaultImportTimeout    = 60 * time.Minute
+	DefaultAvailableTimeout = 5 * time.Minute
+)
+
+// classifyErrors makes the EC2 clients of the pipeline return API errors
+// that carry an errkind.Kind.
+func classifyErrors(o *ec2.Options) {
+	o.APIOptions = append(o.APIOptions, errkind.AddClassifier)
+}
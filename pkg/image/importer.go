@@ -7,26 +7,31 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
 type Importer struct {
-	client *ec2.Client
-	region string
+	client ImporterClient
+	waiter SnapshotImportWaiter
+	// Timeout bounds the wait for an import, DefaultImportTimeout when zero
+	Timeout time.Duration
 }
 
-func NewImporter(ctx context.Context, region string) (*Importer, error) {
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
+func NewImporter(cfg aws.Config) *Importer {
+	return NewImporterFromClient(ec2.NewFromConfig(cfg, classifyErrors), nil)
+}
 
+// NewImporterFromClient builds an importer on client. A nil waiter polls the
+// import task with ec2.SnapshotImportedWaiter.
+func NewImporterFromClient(client ImporterClient, waiter SnapshotImportWaiter) *Importer {
+	if waiter == nil {
+		waiter = ec2.NewSnapshotImportedWaiter(client)
+	}
 	return &Importer{
-		client: ec2.NewFromConfig(cfg),
-		region: region,
-	}, nil
+		client: client,
+		waiter: waiter,
+	}
 }
 
 func (i *Importer) ImportSnapshot(ctx context.Context, s3Bucket, s3Key, description, imageID string) (string, error) {
@@ -138,14 +143,16 @@ func (i *Importer) FindSnapshotByImageID(ctx context.Context, imageID string) (s
 func (i *Importer) WaitForImport(ctx context.Context, taskID string) (string, error) {
 	slog.Info("Waiting for snapshot import to complete", "task_id", taskID)
 
-	importCtx, cancel := context.WithTimeout(ctx, 60*time.Minute)
+	timeout := i.Timeout
+	if timeout <= 0 {
+		timeout = DefaultImportTimeout
+	}
+	importCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	waiter := ec2.NewSnapshotImportedWaiter(i.client)
-
-	err := waiter.Wait(importCtx, &ec2.DescribeImportSnapshotTasksInput{
+	err := i.waiter.Wait(importCtx, &ec2.DescribeImportSnapshotTasksInput{
 		ImportTaskIds: []string{taskID},
-	}, 60*time.Minute)
+	}, timeout)
 	if err != nil {
 		return "", fmt.Errorf("snapshot import timeout or failed: %w", err)
 	}
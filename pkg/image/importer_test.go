@@ -0,0 +1,214 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// importClient imports snapshot snap-new through task import-snap-1.
+func importClient(existing ...types.Snapshot) *MockImageClient {
+	return &MockImageClient{
+		DescribeSnapshotsFunc: func(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+			return &ec2.DescribeSnapshotsOutput{Snapshots: existing}, nil
+		},
+		ImportSnapshotFunc: func(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error) {
+			return &ec2.ImportSnapshotOutput{ImportTaskId: aws.String("import-snap-1")}, nil
+		},
+		DescribeImportSnapshotTasksFunc: func(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error) {
+			return &ec2.DescribeImportSnapshotTasksOutput{
+				ImportSnapshotTasks: []types.ImportSnapshotTask{
+					{ImportTaskId: aws.String("import-snap-1"), SnapshotTaskDetail: &types.SnapshotTaskDetail{SnapshotId: aws.String("snap-new")}},
+				},
+			}, nil
+		},
+		CreateTagsFunc: func(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+			return &ec2.CreateTagsOutput{}, nil
+		},
+	}
+}
+
+func TestImporter_ImportSnapshot(t *testing.T) {
+	client := importClient()
+	var imported *ec2.ImportSnapshotInput
+	client.ImportSnapshotFunc = func(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error) {
+		imported = params
+		return &ec2.ImportSnapshotOutput{ImportTaskId: aws.String("import-snap-1")}, nil
+	}
+	var tagged *ec2.CreateTagsInput
+	client.CreateTagsFunc = func(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+		tagged = params
+		return &ec2.CreateTagsOutput{}, nil
+	}
+	var waitedFor []string
+	waiter := &MockSnapshotImportWaiter{
+		WaitFunc: func(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, maxWaitDur time.Duration) error {
+			waitedFor = params.ImportTaskIds
+			return nil
+		},
+	}
+
+	snapshotID, err := NewImporterFromClient(client, waiter).ImportSnapshot(context.Background(), "images", "fedora.raw", "Fedora", "abc123")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if snapshotID != "snap-new" {
+		t.Errorf("expected snap-new, got %s", snapshotID)
+	}
+	if aws.ToString(imported.ClientToken) != "abc123" || aws.ToString(imported.DiskContainer.UserBucket.S3Key) != "fedora.raw" {
+		t.Errorf("unexpected import input %+v", imported)
+	}
+	if len(waitedFor) != 1 || waitedFor[0] != "import-snap-1" {
+		t.Errorf("expected to wait for import-snap-1, got %v", waitedFor)
+	}
+	if tagged == nil || tagged.Resources[0] != "snap-new" || !hasTag(tagged.Tags, "ImageID", "abc123") {
+		t.Errorf("expected the snapshot to be tagged with its ImageID, got %+v", tagged)
+	}
+}
+
+func TestImporter_ImportSnapshot_ReusesExisting(t *testing.T) {
+	older := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	client := importClient(
+		types.Snapshot{SnapshotId: aws.String("snap-old"), StartTime: &older},
+		types.Snapshot{SnapshotId: aws.String("snap-latest"), StartTime: &newer},
+	)
+	client.ImportSnapshotFunc = nil
+
+	snapshotID, err := NewImporterFromClient(client, &MockSnapshotImportWaiter{}).ImportSnapshot(context.Background(), "images", "fedora.raw", "Fedora", "abc123")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if snapshotID != "snap-latest" {
+		t.Errorf("expected the newest existing snapshot, got %s", snapshotID)
+	}
+}
+
+func TestImporter_ImportSnapshot_TaggingFailure(t *testing.T) {
+	client := importClient()
+	client.CreateTagsFunc = func(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+		return nil, errors.New("UnauthorizedOperation")
+	}
+
+	snapshotID, err := NewImporterFromClient(client, &MockSnapshotImportWaiter{}).ImportSnapshot(context.Background(), "images", "fedora.raw", "Fedora", "abc123")
+	if err != nil {
+		t.Fatalf("expected tagging failures to be tolerated, got %v", err)
+	}
+	if snapshotID != "snap-new" {
+		t.Errorf("expected snap-new, got %s", snapshotID)
+	}
+}
+
+func TestImporter_ImportSnapshot_Failures(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*MockImageClient, *MockSnapshotImportWaiter)
+		want   string
+	}{
+		{
+			name: "lookup fails",
+			mutate: func(c *MockImageClient, w *MockSnapshotImportWaiter) {
+				c.DescribeSnapshotsFunc = func(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+					return nil, errors.New("throttled")
+				}
+			},
+			want: "failed to check for existing snapshot",
+		},
+		{
+			name: "import rejected",
+			mutate: func(c *MockImageClient, w *MockSnapshotImportWaiter) {
+				c.ImportSnapshotFunc = func(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error) {
+					return nil, errors.New("InvalidParameter: vmimport role missing")
+				}
+			},
+			want: "failed to initiate snapshot import",
+		},
+		{
+			name: "no task ID",
+			mutate: func(c *MockImageClient, w *MockSnapshotImportWaiter) {
+				c.ImportSnapshotFunc = func(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error) {
+					return &ec2.ImportSnapshotOutput{}, nil
+				}
+			},
+			want: "import task ID is nil",
+		},
+		{
+			name: "import task fails",
+			mutate: func(c *MockImageClient, w *MockSnapshotImportWaiter) {
+				w.WaitFunc = func(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, maxWaitDur time.Duration) error {
+					return errors.New("waiter state transitioned to Failure")
+				}
+			},
+			want: "snapshot import timeout or failed",
+		},
+		{
+			name: "task disappears",
+			mutate: func(c *MockImageClient, w *MockSnapshotImportWaiter) {
+				c.DescribeImportSnapshotTasksFunc = func(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error) {
+					return &ec2.DescribeImportSnapshotTasksOutput{}, nil
+				}
+			},
+			want: "import task not found",
+		},
+		{
+			name: "no snapshot ID",
+			mutate: func(c *MockImageClient, w *MockSnapshotImportWaiter) {
+				c.DescribeImportSnapshotTasksFunc = func(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error) {
+					return &ec2.DescribeImportSnapshotTasksOutput{
+						ImportSnapshotTasks: []types.ImportSnapshotTask{{SnapshotTaskDetail: &types.SnapshotTaskDetail{}}},
+					}, nil
+				}
+			},
+			want: "snapshot ID is nil",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := importClient()
+			waiter := &MockSnapshotImportWaiter{}
+			tt.mutate(client, waiter)
+
+			_, err := NewImporterFromClient(client, waiter).ImportSnapshot(context.Background(), "images", "fedora.raw", "Fedora", "abc123")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestImporter_WaitForImport_Timeout(t *testing.T) {
+	var maxWait time.Duration
+	waiter := &MockSnapshotImportWaiter{
+		WaitFunc: func(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, maxWaitDur time.Duration) error {
+			maxWait = maxWaitDur
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	importer := NewImporterFromClient(importClient(), waiter)
+	importer.Timeout = 10 * time.Millisecond
+
+	_, err := importer.WaitForImport(context.Background(), "import-snap-1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline exceeded error, got %v", err)
+	}
+	if maxWait != 10*time.Millisecond {
+		t.Errorf("expected the waiter to get the timeout, got %s", maxWait)
+	}
+}
+
+func hasTag(tags []types.Tag, key, value string) bool {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key && aws.ToString(tag.Value) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -8,8 +8,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/smithy-go"
@@ -20,16 +20,15 @@ type S3Uploader struct {
 	bucket string
 }
 
-func NewS3Uploader(ctx context.Context, bucket, region string) (*S3Uploader, error) {
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
-
+// NewS3Uploader builds an uploader for bucket. optFns apply what aws.Config
+// cannot carry, such as path-style addressing, see awsconfig.S3Options.
+func NewS3Uploader(cfg aws.Config, bucket string, optFns ...func(*s3.Options)) *S3Uploader {
 	return &S3Uploader{
-		client: s3.NewFromConfig(cfg),
+		client: s3.NewFromConfig(cfg, append(optFns, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, errkind.AddClassifier)
+		})...),
 		bucket: bucket,
-	}, nil
+	}
 }
 
 func (u *S3Uploader) Upload(ctx context.Context, filePath, key string) error {
@@ -2,7 +2,10 @@ package image
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
@@ -27,3 +30,90 @@ func (m *MockImageLister) ListImages(ctx context.Context) ([]types.Image, error)
 	}
 	return []types.Image{}, nil
 }
+
+type MockChannelAMIFinder struct {
+	FindLatestAMIInChannelFunc func(ctx context.Context, channel string) (string, error)
+}
+
+func (m *MockChannelAMIFinder) FindLatestAMIInChannel(ctx context.Context, channel string) (string, error) {
+	if m.FindLatestAMIInChannelFunc != nil {
+		return m.FindLatestAMIInChannelFunc(ctx, channel)
+	}
+	return "", nil
+}
+
+// MockImageClient implements ImporterClient and AMIRegistrarClient.
+type MockImageClient struct {
+	DescribeSnapshotsFunc           func(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error)
+	ImportSnapshotFunc              func(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error)
+	DescribeImportSnapshotTasksFunc func(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error)
+	DescribeImagesFunc              func(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+	RegisterImageFunc               func(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error)
+	CreateTagsFunc                  func(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error)
+}
+
+func (m *MockImageClient) DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	if m.DescribeSnapshotsFunc != nil {
+		return m.DescribeSnapshotsFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeSnapshotsFunc not set")
+}
+
+func (m *MockImageClient) ImportSnapshot(ctx context.Context, params *ec2.ImportSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.ImportSnapshotOutput, error) {
+	if m.ImportSnapshotFunc != nil {
+		return m.ImportSnapshotFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("ImportSnapshotFunc not set")
+}
+
+func (m *MockImageClient) DescribeImportSnapshotTasks(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error) {
+	if m.DescribeImportSnapshotTasksFunc != nil {
+		return m.DescribeImportSnapshotTasksFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeImportSnapshotTasksFunc not set")
+}
+
+func (m *MockImageClient) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	if m.DescribeImagesFunc != nil {
+		return m.DescribeImagesFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("DescribeImagesFunc not set")
+}
+
+func (m *MockImageClient) RegisterImage(ctx context.Context, params *ec2.RegisterImageInput, optFns ...func(*ec2.Options)) (*ec2.RegisterImageOutput, error) {
+	if m.RegisterImageFunc != nil {
+		return m.RegisterImageFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("RegisterImageFunc not set")
+}
+
+func (m *MockImageClient) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	if m.CreateTagsFunc != nil {
+		return m.CreateTagsFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("CreateTagsFunc not set")
+}
+
+// MockSnapshotImportWaiter succeeds right away unless WaitFunc is set.
+type MockSnapshotImportWaiter struct {
+	WaitFunc func(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, maxWaitDur time.Duration) error
+}
+
+func (m *MockSnapshotImportWaiter) Wait(ctx context.Context, params *ec2.DescribeImportSnapshotTasksInput, maxWaitDur time.Duration, optFns ...func(*ec2.SnapshotImportedWaiterOptions)) error {
+	if m.WaitFunc != nil {
+		return m.WaitFunc(ctx, params, maxWaitDur)
+	}
+	return nil
+}
+
+// MockImageAvailableWaiter succeeds right away unless WaitFunc is set.
+type MockImageAvailableWaiter struct {
+	WaitFunc func(ctx context.Context, params *ec2.DescribeImagesInput, maxWaitDur time.Duration) error
+}
+
+func (m *MockImageAvailableWaiter) Wait(ctx context.Context, params *ec2.DescribeImagesInput, maxWaitDur time.Duration, optFns ...func(*ec2.ImageAvailableWaiterOptions)) error {
+	if m.WaitFunc != nil {
+		return m.WaitFunc(ctx, params, maxWaitDur)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The inventory file is shared by the admin API and the image builder.
+const (
+	EnvPath     = "INVENTORY_PATH"
+	DefaultPath = "data/inventory.json"
+)
+
+// PathFromEnv returns the inventory path set in the environment, or
+// DefaultPath.
+func PathFromEnv() string {
+	if path := os.Getenv(EnvPath); path != "" {
+		return path
+	}
+	return DefaultPath
+}
+
+// FileStore persists the inventory as a single JSON document. Every write
+// replaces the file atomically, and the file is re-read when another process
+// (e.g. the image builder) has changed it since the last access. Writes
+// hold an exclusive lock on a lock file next to it, so processes sharing
+// the file do not lose each other's changes.
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	data    *snapshot
+	modTime time.Time
+	size    int64
+}
+
+// OpenFileStore loads the inventory at path, creating its directory if needed.
+func OpenFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create inventory directory: %w", err)
+	}
+	s := &FileStore{path: path, data: newSnapshot()}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+func (s *FileStore) PutNode(ctx context.Context, node NodeRecord) error {
+	return s.update(func(d *snapshot) { d.putNode(node) })
+}
+
+func (s *FileStore) PutNodes(ctx context.Context, nodes []NodeRecord) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	return s.update(func(d *snapshot) {
+		for _, node := range nodes {
+			d.putNode(node)
+		}
+	})
+}
+
+func (s *FileStore) GetNode(ctx context.Context, instanceID string) (NodeRecord, error) {
+	var node NodeRecord
+	err := s.view(func(d *snapshot) error {
+		var err error
+		node, err = d.getNode(instanceID)
+		return err
+	})
+	return node, err
+}
+
+func (s *FileStore) ListNodes(ctx context.Context) ([]NodeRecord, error) {
+	var nodes []NodeRecord
+	err := s.view(func(d *snapshot) error {
+		nodes = d.listNodes()
+		return nil
+	})
+	return nodes, err
+}
+
+func (s *FileStore) PutImage(ctx context.Context, image ImageRecord) error {
+	return s.update(func(d *snapshot) { d.Images[image.AMIID] = image })
+}
+
+func (s *FileStore) PutImages(ctx context.Context, images []ImageRecord) error {
+	if len(images) == 0 {
+		return nil
+	}
+	return s.update(func(d *snapshot) {
+		for _, image := range images {
+			d.Images[image.AMIID] = image
+		}
+	})
+}
+
+func (s *FileStore) ListImages(ctx context.Context) ([]ImageRecord, error) {
+	var images []ImageRecord
+	err := s.view(func(d *snapshot) error {
+		images = d.listImages()
+		return nil
+	})
+	return images, err
+}
+
+func (s *FileStore) PutBuild(ctx context.Context, build BuildRecord) error {
+	return s.update(func(d *snapshot) { d.Builds[build.ID] = build })
+}
+
+func (s *FileStore) ListBuilds(ctx context.Context) ([]BuildRecord, error) {
+	var builds []BuildRecord
+	err := s.view(func(d *snapshot) error {
+		builds = d.listBuilds()
+		return nil
+	})
+	return builds, err
+}
+
+func (s *FileStore) PutPool(ctx context.Context, pool PoolRecord) error {
+	return s.update(func(d *snapshot) { d.putPool(pool) })
+}
+
+func (s *FileStore) ListPools(ctx context.Context) ([]PoolRecord, error) {
+	var pools []PoolRecord
+	err := s.view(func(d *snapshot) error {
+		pools = d.listPools()
+		return nil
+	})
+	return pools, err
+}
+
+func (s *FileStore) DeletePool(ctx context.Context, name string) error {
+	return s.update(func(d *snapshot) { delete(d.Pools, name) })
+}
+
+func (s *FileStore) AddOperation(ctx context.Context, op OperationRecord) (OperationRecord, error) {
+	var added OperationRecord
+	err := s.update(func(d *snapshot) { added = d.addOperation(op) })
+	return added, err
+}
+
+func (s *FileStore) ListOperations(ctx context.Context, target string) ([]OperationRecord, error) {
+	var ops []OperationRecord
+	err := s.view(func(d *snapshot) error {
+		ops = d.listOperations(target)
+		return nil
+	})
+	return ops, err
+}
+
+func (s *FileStore) view(fn func(*snapshot) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadIfChanged(); err != nil {
+		return err
+	}
+	return fn(s.data)
+}
+
+func (s *FileStore) update(fn func(*snapshot)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// The modification time may not change between two quick writes of
+	// the same size, so the file is always re-read under the lock
+	if err := s.reload(); err != nil {
+		return err
+	}
+	fn(s.data)
+	return s.save()
+}
+
+func (s *FileStore) reloadIfChanged() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat inventory: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	return s.reload()
+}
+
+func (s *FileStore) reload() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open inventory: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat inventory: %w", err)
+	}
+	data := newSnapshot()
+	if err := json.NewDecoder(f).Decode(data); err != nil {
+		return fmt.Errorf("failed to decode inventory %s: %w", s.path, err)
+	}
+	// Maps are nil when the file was written without them
+	if data.Nodes == nil {
+		data.Nodes = make(map[string]NodeRecord)
+	}
+	if data.Images == nil {
+		data.Images = make(map[string]ImageRecord)
+	}
+	if data.Builds == nil {
+		data.Builds = make(map[string]BuildRecord)
+	}
+	if data.Pools == nil {
+		data.Pools = make(map[string]PoolRecord)
+	}
+	s.data = data
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileStore) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create inventory temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := json.NewEncoder(tmp)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s.data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode inventory: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync inventory: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close inventory temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace inventory: %w", err)
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat inventory: %w", err)
+	}
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
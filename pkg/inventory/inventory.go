@@ -0,0 +1,178 @@
+// Package inventory records what the control plane created, when, by whom
+// and with which parameters, and tracks how that drifts from EC2.
+package inventory
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+)
+
+var ErrNotFound = errkind.New(errkind.NotFound, "record not found")
+
+// MaxOperations bounds the operation log; the oldest entries are dropped.
+const MaxOperations = 1000
+
+type Drift string
+
+const (
+	DriftNone Drift = ""
+	// DriftMissing means the resource is recorded but no longer exists
+	DriftMissing Drift = "missing"
+	// DriftUnrecorded means the resource exists but was not created through
+	// the control plane
+	DriftUnrecorded Drift = "unrecorded"
+	// DriftTerminatedExternally means the node was terminated without a
+	// delete through the control plane
+	DriftTerminatedExternally Drift = "terminated-externally"
+)
+
+type OperationStatus string
+
+const (
+	OperationSucceeded OperationStatus = "succeeded"
+	OperationFailed    OperationStatus = "failed"
+	OperationRunning   OperationStatus = "running"
+)
+
+// Build stages in the order the image builder runs them.
+const (
+	BuildStageDownload   = "download"
+	BuildStageDecompress = "decompress"
+	BuildStageUpload     = "upload"
+	BuildStageImport     = "import"
+	BuildStageRegister   = "register"
+)
+
+type NodeRecord struct {
+	InstanceID  string            `json:"instanceId"`
+	Name        string            `json:"name,omitempty"`
+	Pool        string            `json:"pool,omitempty"`
+	Region      string            `json:"region,omitempty"`
+	CreatedBy   string            `json:"createdBy,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Params      map[string]string `json:"params,omitempty"`
+	State       string            `json:"state,omitempty"`
+	StateReason string            `json:"stateReason,omitempty"`
+	LastSeenAt  *time.Time        `json:"lastSeenAt,omitempty"`
+	DeletedBy   string            `json:"deletedBy,omitempty"`
+	DeletedAt   *time.Time        `json:"deletedAt,omitempty"`
+	Drift       Drift             `json:"drift,omitempty"`
+	DriftDetail string            `json:"driftDetail,omitempty"`
+}
+
+type ImageRecord struct {
+	AMIID       string     `json:"amiId"`
+	Name        string     `json:"name,omitempty"`
+	ImageID     string     `json:"imageId,omitempty"`
+	SnapshotID  string     `json:"snapshotId,omitempty"`
+	BuildID     string     `json:"buildId,omitempty"`
+	Region      string     `json:"region,omitempty"`
+	State       string     `json:"state,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastSeenAt  *time.Time `json:"lastSeenAt,omitempty"`
+	RemovedAt   *time.Time `json:"removedAt,omitempty"`
+	Drift       Drift      `json:"drift,omitempty"`
+	DriftDetail string     `json:"driftDetail,omitempty"`
+}
+
+type BuildRecord struct {
+	ID         string          `json:"id"`
+	SourceURL  string          `json:"sourceUrl,omitempty"`
+	ImageID    string          `json:"imageId,omitempty"`
+	SnapshotID string          `json:"snapshotId,omitempty"`
+	AMIID      string          `json:"amiId,omitempty"`
+	CreatedBy  string          `json:"createdBy,omitempty"`
+	Stage      string          `json:"stage,omitempty"`
+	Status     OperationStatus `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// PoolRecord is the definition of a node pool. Its members are found
+// through their Pool tag, so only the definition is kept.
+type PoolRecord struct {
+	Name         string            `json:"name"`
+	InstanceType string            `json:"instanceType"`
+	ImageChannel string            `json:"imageChannel,omitempty"`
+	KeyName      string            `json:"keyName,omitempty"`
+	UserData     *PoolUserData     `json:"userData,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	DesiredCount int               `json:"desiredCount"`
+	Deleting     bool              `json:"deleting,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+}
+
+type PoolUserData struct {
+	Template  string              `json:"template,omitempty"`
+	Variables cloudinit.Variables `json:"variables"`
+	// TemplateSnapshot is the template as of pool creation
+	TemplateSnapshot *cloudinit.Template `json:"templateSnapshot,omitempty"`
+}
+
+type OperationRecord struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Target     string            `json:"target,omitempty"`
+	Actor      string            `json:"actor,omitempty"`
+	Params     map[string]string `json:"params,omitempty"`
+	Status     OperationStatus   `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+}
+
+// Store persists inventory records. Put methods insert or replace by key.
+type Store interface {
+	PutNode(ctx context.Context, node NodeRecord) error
+	// PutNodes writes many records at once, e.g. after a sync
+	PutNodes(ctx context.Context, nodes []NodeRecord) error
+	GetNode(ctx context.Context, instanceID string) (NodeRecord, error)
+	ListNodes(ctx context.Context) ([]NodeRecord, error)
+
+	PutImage(ctx context.Context, image ImageRecord) error
+	PutImages(ctx context.Context, images []ImageRecord) error
+	ListImages(ctx context.Context) ([]ImageRecord, error)
+
+	PutBuild(ctx context.Context, build BuildRecord) error
+	ListBuilds(ctx context.Context) ([]BuildRecord, error)
+
+	PutPool(ctx context.Context, pool PoolRecord) error
+	ListPools(ctx context.Context) ([]PoolRecord, error)
+	// DeletePool removes a pool definition; unknown pools are ignored
+	DeletePool(ctx context.Context, name string) error
+
+	// AddOperation appends to the operation log, assigning an ID if empty
+	AddOperation(ctx context.Context, op OperationRecord) (OperationRecord, error)
+	// ListOperations returns the newest operations first, optionally only
+	// those for one target
+	ListOperations(ctx context.Context, target string) ([]OperationRecord, error)
+}
+
+// NewID returns a random identifier with the given prefix, e.g. "op-1a2b...".
+func NewID(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + "-" + hex.EncodeToString(b)
+}
+
+// MarkNodeDeleted records that a node was deleted through the control plane.
+// Unknown nodes get a minimal record so the deletion is not lost.
+func MarkNodeDeleted(ctx context.Context, store Store, instanceID, actor string) error {
+	node, err := store.GetNode(ctx, instanceID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	now := time.Now().UTC()
+	node.InstanceID = instanceID
+	node.DeletedAt = &now
+	node.DeletedBy = actor
+	return store.PutNode(ctx, node)
+}
@@ -0,0 +1,37 @@
+//go:build !unix
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// staleLockAge is how old a lock file has to be before it is considered
+// left behind by a writer that crashed. Writes take milliseconds.
+const staleLockAge = 30 * time.Second
+
+// lock takes the exclusive lock that serializes writers across processes.
+// Without flock, the lock is a file that only one writer can create.
+// Readers need no lock, since the file is replaced atomically.
+func (s *FileStore) lock() (func(), error) {
+	path := s.path + ".lock"
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to lock inventory: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lock takes the exclusive lock that serializes writers across processes.
+// Readers need no lock, since the file is replaced atomically.
+func (s *FileStore) lock() (func(), error) {
+	f, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open inventory lock: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock inventory: %w", err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
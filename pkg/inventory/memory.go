@@ -0,0 +1,226 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshot is the complete inventory; the file store persists it as JSON.
+type snapshot struct {
+	Nodes      map[string]NodeRecord  `json:"nodes"`
+	Images     map[string]ImageRecord `json:"images"`
+	Builds     map[string]BuildRecord `json:"builds"`
+	Pools      map[string]PoolRecord  `json:"pools"`
+	Operations []OperationRecord      `json:"operations"`
+}
+
+func newSnapshot() *snapshot {
+	return &snapshot{
+		Nodes:  make(map[string]NodeRecord),
+		Images: make(map[string]ImageRecord),
+		Builds: make(map[string]BuildRecord),
+		Pools:  make(map[string]PoolRecord),
+	}
+}
+
+// MemoryStore keeps the inventory in memory. It is used in tests and as the
+// default when no inventory file is configured.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data *snapshot
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: newSnapshot()}
+}
+
+func (s *MemoryStore) PutNode(ctx context.Context, node NodeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putNode(node)
+	return nil
+}
+
+func (s *MemoryStore) PutNodes(ctx context.Context, nodes []NodeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, node := range nodes {
+		s.data.putNode(node)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetNode(ctx context.Context, instanceID string) (NodeRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.getNode(instanceID)
+}
+
+func (s *MemoryStore) ListNodes(ctx context.Context) ([]NodeRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.listNodes(), nil
+}
+
+func (s *MemoryStore) PutImage(ctx context.Context, image ImageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Images[image.AMIID] = image
+	return nil
+}
+
+func (s *MemoryStore) PutImages(ctx context.Context, images []ImageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, image := range images {
+		s.data.Images[image.AMIID] = image
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListImages(ctx context.Context) ([]ImageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.listImages(), nil
+}
+
+func (s *MemoryStore) PutBuild(ctx context.Context, build BuildRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Builds[build.ID] = build
+	return nil
+}
+
+func (s *MemoryStore) ListBuilds(ctx context.Context) ([]BuildRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.listBuilds(), nil
+}
+
+func (s *MemoryStore) PutPool(ctx context.Context, pool PoolRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putPool(pool)
+	return nil
+}
+
+func (s *MemoryStore) ListPools(ctx context.Context) ([]PoolRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.listPools(), nil
+}
+
+func (s *MemoryStore) DeletePool(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Pools, name)
+	return nil
+}
+
+func (s *MemoryStore) AddOperation(ctx context.Context, op OperationRecord) (OperationRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.addOperation(op), nil
+}
+
+func (s *MemoryStore) ListOperations(ctx context.Context, target string) ([]OperationRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.listOperations(target), nil
+}
+
+func (d *snapshot) putNode(node NodeRecord) {
+	node.Params = maps.Clone(node.Params)
+	d.Nodes[node.InstanceID] = node
+}
+
+func (d *snapshot) getNode(instanceID string) (NodeRecord, error) {
+	node, ok := d.Nodes[instanceID]
+	if !ok {
+		return NodeRecord{}, fmt.Errorf("%w: node %s", ErrNotFound, instanceID)
+	}
+	node.Params = maps.Clone(node.Params)
+	return node, nil
+}
+
+func (d *snapshot) listNodes() []NodeRecord {
+	nodes := make([]NodeRecord, 0, len(d.Nodes))
+	for _, node := range d.Nodes {
+		node.Params = maps.Clone(node.Params)
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(a, b NodeRecord) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.InstanceID, b.InstanceID)
+	})
+	return nodes
+}
+
+func (d *snapshot) listImages() []ImageRecord {
+	images := slices.Collect(maps.Values(d.Images))
+	slices.SortFunc(images, func(a, b ImageRecord) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.AMIID, b.AMIID)
+	})
+	return images
+}
+
+func (d *snapshot) listBuilds() []BuildRecord {
+	builds := slices.Collect(maps.Values(d.Builds))
+	slices.SortFunc(builds, func(a, b BuildRecord) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return builds
+}
+
+func (d *snapshot) putPool(pool PoolRecord) {
+	pool.Tags = maps.Clone(pool.Tags)
+	d.Pools[pool.Name] = pool
+}
+
+func (d *snapshot) listPools() []PoolRecord {
+	pools := make([]PoolRecord, 0, len(d.Pools))
+	for _, pool := range d.Pools {
+		pool.Tags = maps.Clone(pool.Tags)
+		pools = append(pools, pool)
+	}
+	slices.SortFunc(pools, func(a, b PoolRecord) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return pools
+}
+
+func (d *snapshot) addOperation(op OperationRecord) OperationRecord {
+	if op.ID == "" {
+		op.ID = NewID("op")
+	}
+	if op.StartedAt.IsZero() {
+		op.StartedAt = time.Now().UTC()
+	}
+	op.Params = maps.Clone(op.Params)
+	d.Operations = append(d.Operations, op)
+	if len(d.Operations) > MaxOperations {
+		d.Operations = slices.Clone(d.Operations[len(d.Operations)-MaxOperations:])
+	}
+	return op
+}
+
+func (d *snapshot) listOperations(target string) []OperationRecord {
+	var ops []OperationRecord
+	for i := len(d.Operations) - 1; i >= 0; i-- {
+		op := d.Operations[i]
+		if target == "" || op.Target == target {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
@@ -0,0 +1,245 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	fileStore, err := OpenFileStore(filepath.Join(t.TempDir(), "inventory.json"))
+	if err != nil {
+		t.Fatalf("failed to open file store: %v", err)
+	}
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+}
+
+func TestStore_Nodes(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			params := map[string]string{"instanceType": "t4g.micro"}
+			if err := store.PutNode(ctx, NodeRecord{InstanceID: "i-2", Name: "web", CreatedBy: "alice", CreatedAt: created.Add(time.Minute), Params: params}); err != nil {
+				t.Fatalf("PutNode failed: %v", err)
+			}
+			if err := store.PutNode(ctx, NodeRecord{InstanceID: "i-1", Name: "db", CreatedAt: created}); err != nil {
+				t.Fatalf("PutNode failed: %v", err)
+			}
+			params["instanceType"] = "changed"
+
+			node, err := store.GetNode(ctx, "i-2")
+			if err != nil {
+				t.Fatalf("GetNode failed: %v", err)
+			}
+			if node.CreatedBy != "alice" || node.Params["instanceType"] != "t4g.micro" {
+				t.Errorf("unexpected node %+v", node)
+			}
+
+			nodes, err := store.ListNodes(ctx)
+			if err != nil {
+				t.Fatalf("ListNodes failed: %v", err)
+			}
+			if len(nodes) != 2 || nodes[0].InstanceID != "i-1" || nodes[1].InstanceID != "i-2" {
+				t.Errorf("expected nodes ordered by creation, got %+v", nodes)
+			}
+
+			if err := MarkNodeDeleted(ctx, store, "i-2", "bob"); err != nil {
+				t.Fatalf("MarkNodeDeleted failed: %v", err)
+			}
+			node, _ = store.GetNode(ctx, "i-2")
+			if node.DeletedAt == nil || node.DeletedBy != "bob" || node.CreatedBy != "alice" {
+				t.Errorf("expected deletion to be recorded, got %+v", node)
+			}
+
+			if _, err := store.GetNode(ctx, "i-missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_PutMany(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.PutNode(ctx, NodeRecord{InstanceID: "i-1", Name: "old"})
+			if err := store.PutNodes(ctx, []NodeRecord{{InstanceID: "i-1", Name: "web"}, {InstanceID: "i-2", Name: "db"}}); err != nil {
+				t.Fatalf("PutNodes failed: %v", err)
+			}
+			if err := store.PutNodes(ctx, nil); err != nil {
+				t.Fatalf("PutNodes without records failed: %v", err)
+			}
+			nodes, _ := store.ListNodes(ctx)
+			if len(nodes) != 2 {
+				t.Fatalf("expected 2 nodes, got %+v", nodes)
+			}
+			if node, _ := store.GetNode(ctx, "i-1"); node.Name != "web" {
+				t.Errorf("expected i-1 to be replaced, got %+v", node)
+			}
+
+			if err := store.PutImages(ctx, []ImageRecord{{AMIID: "ami-1"}, {AMIID: "ami-2"}}); err != nil {
+				t.Fatalf("PutImages failed: %v", err)
+			}
+			if images, _ := store.ListImages(ctx); len(images) != 2 {
+				t.Errorf("expected 2 images, got %+v", images)
+			}
+		})
+	}
+}
+
+func TestStore_Operations(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first, err := store.AddOperation(ctx, OperationRecord{Type: "create-node", Target: "i-1", Status: OperationSucceeded})
+			if err != nil {
+				t.Fatalf("AddOperation failed: %v", err)
+			}
+			if first.ID == "" || first.StartedAt.IsZero() {
+				t.Errorf("expected ID and start time to be assigned, got %+v", first)
+			}
+			store.AddOperation(ctx, OperationRecord{Type: "create-node", Target: "i-2", Status: OperationFailed})
+			store.AddOperation(ctx, OperationRecord{Type: "stop-node", Target: "i-1", Status: OperationSucceeded})
+
+			ops, err := store.ListOperations(ctx, "")
+			if err != nil {
+				t.Fatalf("ListOperations failed: %v", err)
+			}
+			if len(ops) != 3 || ops[0].Type != "stop-node" {
+				t.Errorf("expected newest operation first, got %+v", ops)
+			}
+
+			ops, _ = store.ListOperations(ctx, "i-1")
+			if len(ops) != 2 {
+				t.Errorf("expected 2 operations for i-1, got %d", len(ops))
+			}
+		})
+	}
+}
+
+func TestStore_Pools(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			tags := map[string]string{"team": "ci"}
+			if err := store.PutPool(ctx, PoolRecord{Name: "web", InstanceType: "t4g.micro", DesiredCount: 2, Tags: tags}); err != nil {
+				t.Fatalf("PutPool failed: %v", err)
+			}
+			if err := store.PutPool(ctx, PoolRecord{Name: "ci", InstanceType: "t4g.small", UserData: &PoolUserData{Template: "runner"}}); err != nil {
+				t.Fatalf("PutPool failed: %v", err)
+			}
+			tags["team"] = "changed"
+
+			pools, err := store.ListPools(ctx)
+			if err != nil {
+				t.Fatalf("ListPools failed: %v", err)
+			}
+			if len(pools) != 2 || pools[0].Name != "ci" || pools[1].Tags["team"] != "ci" || pools[0].UserData.Template != "runner" {
+				t.Errorf("expected pools ordered by name, got %+v", pools)
+			}
+
+			if err := store.DeletePool(ctx, "web"); err != nil {
+				t.Fatalf("DeletePool failed: %v", err)
+			}
+			if err := store.DeletePool(ctx, "missing"); err != nil {
+				t.Errorf("expected deleting an unknown pool to succeed, got %v", err)
+			}
+			pools, _ = store.ListPools(ctx)
+			if len(pools) != 1 || pools[0].Name != "ci" {
+				t.Errorf("expected only ci to remain, got %+v", pools)
+			}
+		})
+	}
+}
+
+func TestMemoryStore_OperationRetention(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for range MaxOperations + 10 {
+		store.AddOperation(ctx, OperationRecord{Type: "stop-node"})
+	}
+	ops, _ := store.ListOperations(ctx, "")
+	if len(ops) != MaxOperations {
+		t.Errorf("expected %d operations, got %d", MaxOperations, len(ops))
+	}
+}
+
+func TestFileStore_Persistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state", "inventory.json")
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	if err := store.PutBuild(ctx, BuildRecord{ID: "build-1", AMIID: "ami-1", Status: OperationSucceeded}); err != nil {
+		t.Fatalf("PutBuild failed: %v", err)
+	}
+
+	// A second process writing to the same file is picked up on next access
+	other, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	if err := other.PutImage(ctx, ImageRecord{AMIID: "ami-1", BuildID: "build-1"}); err != nil {
+		t.Fatalf("PutImage failed: %v", err)
+	}
+
+	images, err := store.ListImages(ctx)
+	if err != nil {
+		t.Fatalf("ListImages failed: %v", err)
+	}
+	if len(images) != 1 || images[0].BuildID != "build-1" {
+		t.Errorf("expected image written by the other store, got %+v", images)
+	}
+	builds, _ := other.ListBuilds(ctx)
+	if len(builds) != 1 || builds[0].AMIID != "ami-1" {
+		t.Errorf("expected persisted build, got %+v", builds)
+	}
+}
+
+func TestFileStore_ConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "inventory.json")
+
+	// Two stores on the same file stand in for the admin API and the
+	// image builder
+	var stores []*FileStore
+	for range 2 {
+		store, err := OpenFileStore(path)
+		if err != nil {
+			t.Fatalf("OpenFileStore failed: %v", err)
+		}
+		stores = append(stores, store)
+	}
+
+	const writes = 25
+	var wg sync.WaitGroup
+	for _, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range writes {
+				if _, err := store.AddOperation(ctx, OperationRecord{Type: "stop-node"}); err != nil {
+					t.Errorf("AddOperation failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	ops, err := stores[0].ListOperations(ctx, "")
+	if err != nil {
+		t.Fatalf("ListOperations failed: %v", err)
+	}
+	if len(ops) != 2*writes {
+		t.Errorf("expected %d operations, got %d", 2*writes, len(ops))
+	}
+}
@@ -0,0 +1,366 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	DefaultSyncInterval = 5 * time.Minute
+	// DefaultBuildInterval is how often build records are checked for stage
+	// changes; they are local, so this is cheap
+	DefaultBuildInterval = 2 * time.Second
+)
+
+// Syncer reconciles the inventory against EC2. It refreshes the observed
+// state of every record and marks records that have drifted; it never
+// changes anything in EC2.
+type Syncer struct {
+	Store         Store
+	Client        ec2.EC2Client
+	Images        image.ImageLister
+	Interval      time.Duration
+	BuildInterval time.Duration
+
+	// Region is the region of Client and Images. Only records of that
+	// region are synced, so every region needs a syncer of its own.
+	Region string
+	// DefaultRegion marks the syncer of the default region, which also
+	// syncs records without a region and checks builds
+	DefaultRegion bool
+
+	// Events receives image state and build stage changes, NodeEvents node
+	// state transitions observed during a sync; both optional
+	Events     *events.Bus
+	NodeEvents *events.NodeTracker
+
+	mu sync.Mutex
+	// builds holds the last seen stage and status per build; nil until the
+	// first SyncBuilds, which only seeds it
+	builds map[string]string
+}
+
+func NewSyncer(store Store, client ec2.EC2Client, images image.ImageLister) *Syncer {
+	return &Syncer{
+		Store:         store,
+		Client:        client,
+		Images:        images,
+		Interval:      DefaultSyncInterval,
+		BuildInterval: DefaultBuildInterval,
+		DefaultRegion: true,
+	}
+}
+
+// owns reports whether records of region are synced by this syncer.
+func (s *Syncer) owns(region string) bool {
+	return region == s.Region || (region == "" && s.DefaultRegion)
+}
+
+type SyncReport struct {
+	Nodes   int
+	Images  int
+	Drifted int
+}
+
+// Run syncs once immediately and then every Interval, and checks builds
+// every BuildInterval, until ctx is cancelled.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	buildTicker := time.NewTicker(s.BuildInterval)
+	defer buildTicker.Stop()
+
+	for {
+		report, err := s.Sync(ctx)
+		if err != nil {
+			slog.Warn("Inventory sync failed", "error", err)
+		} else if report.Drifted > 0 {
+			slog.Info("Inventory has drifted from EC2", "nodes", report.Nodes, "images", report.Images, "drifted", report.Drifted)
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-buildTicker.C:
+				if !s.DefaultRegion {
+					continue
+				}
+				if err := s.SyncBuilds(ctx); err != nil {
+					slog.Warn("Build sync failed", "error", err)
+				}
+			case <-ticker.C:
+				break wait
+			}
+		}
+	}
+}
+
+// SyncBuilds publishes a build.stage event for every build whose stage or
+// status changed since the previous call. Builds are written by the image
+// builder, which runs in its own process.
+func (s *Syncer) SyncBuilds(ctx context.Context) error {
+	builds, err := s.Store.ListBuilds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list build records: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seeded := s.builds != nil
+	if !seeded {
+		s.builds = make(map[string]string, len(builds))
+	}
+	for _, build := range builds {
+		key := build.Stage + "/" + string(build.Status)
+		if s.builds[build.ID] == key {
+			continue
+		}
+		s.builds[build.ID] = key
+		if !seeded {
+			continue
+		}
+		s.Events.Publish(events.TypeBuildStage, build.ID, events.BuildStageChanged{
+			BuildID: build.ID,
+			Stage:   build.Stage,
+			Status:  string(build.Status),
+			AMIID:   build.AMIID,
+			Error:   build.Error,
+		})
+	}
+	return nil
+}
+
+func (s *Syncer) Sync(ctx context.Context) (SyncReport, error) {
+	var report SyncReport
+	nodeErr := s.syncNodes(ctx, &report)
+	imageErr := s.syncImages(ctx, &report)
+	return report, errors.Join(nodeErr, imageErr)
+}
+
+func (s *Syncer) syncNodes(ctx context.Context, report *SyncReport) error {
+	instances, err := ec2.ListInstances(ctx, s.Client)
+	if err != nil {
+		return err
+	}
+	records, err := s.Store.ListNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list node records: %w", err)
+	}
+
+	known := make(map[string]NodeRecord, len(records))
+	for _, record := range records {
+		if s.owns(record.Region) {
+			known[record.InstanceID] = record
+		}
+	}
+
+	// Records are written at once, as every write of a file store rewrites
+	// the whole inventory
+	var updated []NodeRecord
+	now := time.Now().UTC()
+	seen := make(map[string]bool)
+	for _, instance := range instances {
+		if instance.Tags[ec2.TagManagedBy] != ec2.ManagedByValue {
+			continue
+		}
+		seen[instance.InstanceID] = true
+
+		record, ok := known[instance.InstanceID]
+		if !ok {
+			record = NodeRecord{
+				InstanceID: instance.InstanceID,
+				CreatedAt:  instance.LaunchTime,
+				Pool:       instance.Tags[ec2.TagPool],
+			}
+		}
+		if instance.Name != "" {
+			record.Name = instance.Name
+		}
+		record.Region = s.Region
+		s.NodeEvents.Observe(events.NodeStateChanged{
+			InstanceID:    instance.InstanceID,
+			Name:          record.Name,
+			Pool:          record.Pool,
+			PreviousState: record.State,
+			State:         instance.State,
+			Reason:        instance.StateReason,
+		})
+		record.State = instance.State
+		record.StateReason = instance.StateReason
+		record.LastSeenAt = &now
+		record.Drift, record.DriftDetail = nodeDrift(ok, record, instance)
+		updated = append(updated, record)
+		report.Nodes++
+		if record.Drift != DriftNone {
+			report.Drifted++
+		}
+	}
+
+	for _, record := range known {
+		if seen[record.InstanceID] {
+			continue
+		}
+		s.NodeEvents.Forget(record.InstanceID)
+		report.Nodes++
+		// Terminated instances disappear from EC2 after about an hour
+		if record.DeletedAt != nil || record.Drift == DriftTerminatedExternally {
+			continue
+		}
+		if record.Drift != DriftMissing {
+			record.Drift = DriftMissing
+			record.DriftDetail = "instance no longer exists in EC2"
+			updated = append(updated, record)
+		}
+		report.Drifted++
+	}
+
+	if err := s.Store.PutNodes(ctx, updated); err != nil {
+		return fmt.Errorf("failed to update node records: %w", err)
+	}
+	return nil
+}
+
+func nodeDrift(recorded bool, record NodeRecord, instance ec2.InstanceInfo) (Drift, string) {
+	switch instance.State {
+	case string(types.InstanceStateNameShuttingDown), string(types.InstanceStateNameTerminated):
+		if record.DeletedAt == nil {
+			detail := "instance was terminated outside the control plane"
+			if instance.StateReason != "" {
+				detail += ": " + instance.StateReason
+			}
+			return DriftTerminatedExternally, detail
+		}
+		return DriftNone, ""
+	}
+	if !recorded || record.Drift == DriftUnrecorded {
+		return DriftUnrecorded, "instance was not created through the control plane"
+	}
+	return DriftNone, ""
+}
+
+func (s *Syncer) syncImages(ctx context.Context, report *SyncReport) error {
+	if s.Images == nil {
+		return nil
+	}
+	awsImages, err := s.Images.ListImages(ctx)
+	if err != nil {
+		return err
+	}
+	records, err := s.Store.ListImages(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list image records: %w", err)
+	}
+	builds, err := s.Store.ListBuilds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list build records: %w", err)
+	}
+
+	known := make(map[string]ImageRecord, len(records))
+	for _, record := range records {
+		if s.owns(record.Region) {
+			known[record.AMIID] = record
+		}
+	}
+	buildByAMI := make(map[string]string)
+	for _, build := range builds {
+		if build.AMIID != "" {
+			buildByAMI[build.AMIID] = build.ID
+		}
+	}
+
+	var updated []ImageRecord
+	now := time.Now().UTC()
+	seen := make(map[string]bool)
+	for _, awsImage := range awsImages {
+		if awsImage.ImageId == nil {
+			continue
+		}
+		amiID := *awsImage.ImageId
+		seen[amiID] = true
+
+		record, ok := known[amiID]
+		if !ok {
+			record = ImageRecord{AMIID: amiID}
+			if awsImage.CreationDate != nil {
+				record.CreatedAt, _ = time.Parse(time.RFC3339, *awsImage.CreationDate)
+			}
+		}
+		if awsImage.Name != nil {
+			record.Name = *awsImage.Name
+		}
+		for _, tag := range awsImage.Tags {
+			if tag.Key == nil || tag.Value == nil {
+				continue
+			}
+			switch *tag.Key {
+			case "ImageID":
+				record.ImageID = *tag.Value
+			case "SnapshotID":
+				record.SnapshotID = *tag.Value
+			}
+		}
+		if buildID, ok := buildByAMI[amiID]; ok {
+			record.BuildID = buildID
+		}
+		record.Region = s.Region
+		if state := string(awsImage.State); state != record.State {
+			s.Events.Publish(events.TypeImageState, amiID, events.ImageStateChanged{
+				AMIID:         amiID,
+				Name:          record.Name,
+				PreviousState: record.State,
+				State:         state,
+			})
+		}
+		record.State = string(awsImage.State)
+		record.LastSeenAt = &now
+		record.RemovedAt = nil
+		record.Drift, record.DriftDetail = DriftNone, ""
+		if record.BuildID == "" {
+			record.Drift, record.DriftDetail = DriftUnrecorded, "image was not registered by a recorded build"
+		}
+		updated = append(updated, record)
+		report.Images++
+		if record.Drift != DriftNone {
+			report.Drifted++
+		}
+	}
+
+	for _, record := range known {
+		if seen[record.AMIID] {
+			continue
+		}
+		report.Images++
+		report.Drifted++
+		if record.Drift == DriftMissing {
+			continue
+		}
+		s.Events.Publish(events.TypeImageState, record.AMIID, events.ImageStateChanged{
+			AMIID:         record.AMIID,
+			Name:          record.Name,
+			PreviousState: record.State,
+			State:         string(types.ImageStateDeregistered),
+		})
+		record.State = string(types.ImageStateDeregistered)
+		record.RemovedAt = &now
+		record.Drift = DriftMissing
+		record.DriftDetail = "image is no longer registered in EC2"
+		updated = append(updated, record)
+	}
+
+	if err := s.Store.PutImages(ctx, updated); err != nil {
+		return fmt.Errorf("failed to update image records: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func newManagedInstance(id, name string, state types.InstanceStateName) types.Instance {
+	return types.Instance{
+		InstanceId: aws.String(id),
+		State:      &types.InstanceState{Name: state},
+		LaunchTime: aws.Time(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Tags: []types.Tag{
+			{Key: aws.String(ec2.TagName), Value: aws.String(name)},
+			{Key: aws.String(ec2.TagManagedBy), Value: aws.String(ec2.ManagedByValue)},
+		},
+	}
+}
+
+func TestSyncer_Sync_Nodes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	deletedAt := time.Now().UTC()
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-ok", Name: "ok", CreatedBy: "alice"})
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-gone", Name: "gone", CreatedBy: "alice"})
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-killed", Name: "killed", CreatedBy: "alice"})
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-deleted", Name: "deleted", DeletedAt: &deletedAt})
+
+	killed := newManagedInstance("i-killed", "killed", types.InstanceStateNameTerminated)
+	killed.StateReason = &types.StateReason{Message: aws.String("Server.SpotInstanceTermination")}
+	unmanaged := newManagedInstance("i-foreign", "foreign", types.InstanceStateNameRunning)
+	unmanaged.Tags = nil
+
+	client := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: []types.Instance{
+				newManagedInstance("i-ok", "ok", types.InstanceStateNameRunning),
+				killed,
+				newManagedInstance("i-new", "new", types.InstanceStateNameRunning),
+				unmanaged,
+			}}}}, nil
+		},
+	}
+
+	syncer := NewSyncer(store, client, nil)
+	report, err := syncer.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.Nodes != 5 || report.Drifted != 3 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	expected := map[string]Drift{
+		"i-ok":      DriftNone,
+		"i-gone":    DriftMissing,
+		"i-killed":  DriftTerminatedExternally,
+		"i-new":     DriftUnrecorded,
+		"i-deleted": DriftNone,
+	}
+	for id, drift := range expected {
+		node, err := store.GetNode(ctx, id)
+		if err != nil {
+			t.Fatalf("GetNode(%s) failed: %v", id, err)
+		}
+		if node.Drift != drift {
+			t.Errorf("%s: expected drift %q, got %q (%s)", id, drift, node.Drift, node.DriftDetail)
+		}
+	}
+
+	node, _ := store.GetNode(ctx, "i-ok")
+	if node.State != "running" || node.LastSeenAt == nil || node.CreatedBy != "alice" {
+		t.Errorf("expected observed state to be refreshed, got %+v", node)
+	}
+	node, _ = store.GetNode(ctx, "i-killed")
+	if node.StateReason != "Server.SpotInstanceTermination" {
+		t.Errorf("expected state reason to be recorded, got %q", node.StateReason)
+	}
+	if _, err := store.GetNode(ctx, "i-foreign"); err == nil {
+		t.Error("expected unmanaged instance to be ignored")
+	}
+}
+
+func TestSyncer_Sync_Images(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.PutBuild(ctx, BuildRecord{ID: "build-1", AMIID: "ami-built", Status: OperationSucceeded})
+	store.PutImage(ctx, ImageRecord{AMIID: "ami-removed", BuildID: "build-0"})
+
+	images := &image.MockImageLister{
+		ListImagesFunc: func(ctx context.Context) ([]types.Image, error) {
+			return []types.Image{
+				{
+					ImageId: aws.String("ami-built"),
+					Name:    aws.String("fedora-43"),
+					State:   types.ImageStateAvailable,
+					Tags:    []types.Tag{{Key: aws.String("ImageID"), Value: aws.String("abc")}},
+				},
+				{ImageId: aws.String("ami-manual"), State: types.ImageStateAvailable},
+			}, nil
+		},
+	}
+	client := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{}, nil
+		},
+	}
+
+	report, err := NewSyncer(store, client, images).Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.Images != 3 || report.Drifted != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	records, _ := store.ListImages(ctx)
+	byID := map[string]ImageRecord{}
+	for _, record := range records {
+		byID[record.AMIID] = record
+	}
+	if built := byID["ami-built"]; built.BuildID != "build-1" || built.ImageID != "abc" || built.Drift != DriftNone {
+		t.Errorf("unexpected built image record %+v", built)
+	}
+	if byID["ami-manual"].Drift != DriftUnrecorded {
+		t.Errorf("expected manual image to be unrecorded, got %+v", byID["ami-manual"])
+	}
+	if removed := byID["ami-removed"]; removed.Drift != DriftMissing || removed.RemovedAt == nil {
+		t.Errorf("expected removed image to be missing, got %+v", removed)
+	}
+}
+
+func TestSyncer_SyncBuilds(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.PutBuild(ctx, BuildRecord{ID: "build-old", Stage: BuildStageRegister, Status: OperationSucceeded})
+	store.PutBuild(ctx, BuildRecord{ID: "build-1", Stage: BuildStageDownload, Status: OperationRunning})
+
+	bus := events.NewBus(0)
+	syncer := NewSyncer(store, &ec2.MockEC2Client{}, nil)
+	syncer.Events = bus
+
+	// The first pass only records what exists
+	if err := syncer.SyncBuilds(ctx); err != nil {
+		t.Fatalf("SyncBuilds failed: %v", err)
+	}
+	if bus.LastID() != 0 {
+		t.Errorf("expected no events when seeding, got %d", bus.LastID())
+	}
+
+	sub := bus.Subscribe(ctx, 0)
+	defer sub.Close()
+
+	store.PutBuild(ctx, BuildRecord{ID: "build-1", Stage: BuildStageUpload, Status: OperationRunning})
+	syncer.SyncBuilds(ctx)
+	syncer.SyncBuilds(ctx)
+
+	if bus.LastID() != 1 {
+		t.Fatalf("expected exactly one stage change, got %d", bus.LastID())
+	}
+	data := (<-sub.C).Data.(events.BuildStageChanged)
+	if data.BuildID != "build-1" || data.Stage != BuildStageUpload || data.Status != string(OperationRunning) {
+		t.Errorf("unexpected event %+v", data)
+	}
+}
+
+func TestSyncer_Sync_PublishesNodeTransitions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-1", State: "running"})
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-2", State: "running"})
+
+	client := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: []types.Instance{
+				newManagedInstance("i-1", "one", types.InstanceStateNameStopped),
+				newManagedInstance("i-2", "two", types.InstanceStateNameRunning),
+			}}}}, nil
+		},
+	}
+
+	bus := events.NewBus(0)
+	sub := bus.Subscribe(ctx, 0)
+	defer sub.Close()
+
+	syncer := NewSyncer(store, client, nil)
+	syncer.NodeEvents = events.NewNodeTracker(bus)
+	if _, err := syncer.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if bus.LastID() != 1 {
+		t.Fatalf("expected one transition, got %d", bus.LastID())
+	}
+	data := (<-sub.C).Data.(events.NodeStateChanged)
+	if data.InstanceID != "i-1" || data.PreviousState != "running" || data.State != "stopped" {
+		t.Errorf("unexpected transition %+v", data)
+	}
+}
+
+func TestSyncer_Sync_ForgetsVanishedNodes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-1", State: "running"})
+
+	client := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{}, nil
+		},
+	}
+
+	bus := events.NewBus(0)
+	tracker := events.NewNodeTracker(bus)
+	tracker.Observe(events.NodeStateChanged{InstanceID: "i-1", State: "running"})
+
+	syncer := NewSyncer(store, client, nil)
+	syncer.NodeEvents = tracker
+	if _, err := syncer.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// Known to the tracker, the node would not be published again
+	if !tracker.Observe(events.NodeStateChanged{InstanceID: "i-1", State: "running"}) {
+		t.Error("expected the vanished node to have been forgotten")
+	}
+}
+
+func TestSyncer_Sync_Regions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-east", Name: "east"})
+	store.PutNode(ctx, NodeRecord{InstanceID: "i-west", Name: "west", Region: "us-west-2"})
+
+	describe := func(instance types.Instance) *ec2.MockEC2Client {
+		return &ec2.MockEC2Client{
+			DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+				return &awsec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: []types.Instance{instance}}}}, nil
+			},
+		}
+	}
+	east := NewSyncer(store, describe(newManagedInstance("i-east", "east", types.InstanceStateNameRunning)), nil)
+	east.Region = "us-east-1"
+	west := NewSyncer(store, describe(newManagedInstance("i-west", "west", types.InstanceStateNameStopped)), nil)
+	west.Region = "us-west-2"
+	west.DefaultRegion = false
+
+	for _, syncer := range []*Syncer{east, west} {
+		if _, err := syncer.Sync(ctx); err != nil {
+			t.Fatalf("Sync(%s) failed: %v", syncer.Region, err)
+		}
+	}
+
+	expected := map[string]struct{ region, state string }{
+		"i-east": {"us-east-1", "running"},
+		"i-west": {"us-west-2", "stopped"},
+	}
+	for id, want := range expected {
+		node, err := store.GetNode(ctx, id)
+		if err != nil {
+			t.Fatalf("GetNode(%s) failed: %v", id, err)
+		}
+		if node.Drift != DriftNone || node.Region != want.region || node.State != want.state {
+			t.Errorf("%s: expected %+v without drift, got %+v", id, want, node)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package pool
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// MaxDesiredCount bounds a single pool so a typo cannot launch a fleet.
+const MaxDesiredCount = 100
+
+var (
+	ErrPoolNotFound = errkind.New(errkind.NotFound, "pool not found")
+	ErrPoolExists   = errkind.New(errkind.Conflict, "pool already exists")
+	ErrInvalidPool  = errkind.New(errkind.InvalidInput, "invalid pool")
+	ErrPoolDeleting = errkind.New(errkind.Conflict, "pool is being deleted")
+)
+
+// Member names are "<pool>-<suffix>", so pool names are kept short enough
+// for the result to remain a valid node name.
+var poolNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$`)
+
+var reservedTagKeys = []string{ec2.TagName, ec2.TagManagedBy, ec2.TagPool, ec2.TagNodeID}
+
+type Pool struct {
+	Name         string
+	InstanceType types.InstanceType
+	// ImageChannel selects the AMI by name prefix, see image.LatestChannel
+	ImageChannel string
+	KeyName      string
+	UserData     *UserData
+	// Tags are applied to every member instance
+	Tags         map[string]string
+	DesiredCount int
+	// Deleting marks a pool whose members are being drained; it is removed
+	// from the store once they are gone
+	Deleting  bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Status    Status
+}
+
+// UserData is rendered per member with the member name as hostname.
+type UserData struct {
+	Template  string
+	Variables cloudinit.Variables
+	// Snapshot is the template as of pool creation. Members are rendered
+	// from it, so they keep launching after a restart or once the template
+	// is deleted.
+	Snapshot *cloudinit.Template
+}
+
+type Status struct {
+	Members          []string
+	Pending          int
+	Running          int
+	Unhealthy        int
+	LastReconciledAt time.Time
+	LastError        string
+}
+
+func Validate(pool *Pool) error {
+	if !poolNamePattern.MatchString(pool.Name) || strings.HasPrefix(pool.Name, "i-") {
+		return fmt.Errorf("%w: name %q must be 1-40 lowercase letters, digits or hyphens and must not start with \"i-\"", ErrInvalidPool, pool.Name)
+	}
+	if pool.DesiredCount < 0 || pool.DesiredCount > MaxDesiredCount {
+		return fmt.Errorf("%w: desired count must be between 0 and %d", ErrInvalidPool, MaxDesiredCount)
+	}
+	if !slices.Contains(pool.InstanceType.Values(), pool.InstanceType) {
+		return fmt.Errorf("%w: unknown instance type %q", ErrInvalidPool, pool.InstanceType)
+	}
+	for key := range pool.Tags {
+		if slices.Contains(reservedTagKeys, key) || strings.HasPrefix(key, "aws:") {
+			return fmt.Errorf("%w: tag key %q is reserved", ErrInvalidPool, key)
+		}
+	}
+	return nil
+}
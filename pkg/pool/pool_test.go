@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pool    Pool
+		wantErr bool
+	}{
+		{"valid", Pool{Name: "ci-runners", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: 3}, false},
+		{"scaled to zero", Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro}, false},
+		{"name too long", Pool{Name: "a-very-long-pool-name-that-leaves-no-room", InstanceType: types.InstanceTypeT4gMicro}, true},
+		{"instance ID prefix", Pool{Name: "i-pool", InstanceType: types.InstanceTypeT4gMicro}, true},
+		{"negative count", Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: -1}, true},
+		{"count over limit", Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: MaxDesiredCount + 1}, true},
+		{"unknown instance type", Pool{Name: "ci", InstanceType: "t9.huge"}, true},
+		{"reserved tag", Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, Tags: map[string]string{"Pool": "other"}}, true},
+		{"aws tag", Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, Tags: map[string]string{"aws:foo": "bar"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&tt.pool)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPool) {
+				t.Errorf("expected ErrInvalidPool, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenStore_RestoresPools(t *testing.T) {
+	ctx := context.Background()
+	inv := inventory.NewMemoryStore()
+
+	store, err := OpenStore(ctx, inv)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.Create(ctx, Pool{
+		Name:         "ci",
+		InstanceType: types.InstanceTypeT4gMicro,
+		DesiredCount: 1,
+		UserData: &UserData{
+			Template:  "runner",
+			Variables: cloudinit.Variables{Packages: []string{"git"}},
+			Snapshot:  &cloudinit.Template{Name: "runner", Config: cloudinit.CloudConfig{RunCmd: []string{"start-runner"}}},
+		},
+	})
+	store.Create(ctx, Pool{Name: "web", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: 1})
+	if _, err := store.SetDesiredCount(ctx, "ci", 3); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := store.Delete(ctx, "web"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// A restart loads the pools from the inventory
+	restored, err := OpenStore(ctx, inv)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	pools := restored.List()
+	if len(pools) != 1 || pools[0].Name != "ci" || pools[0].DesiredCount != 3 {
+		t.Fatalf("expected the ci pool scaled to 3, got %+v", pools)
+	}
+	if pools[0].UserData == nil || pools[0].UserData.Template != "runner" || len(pools[0].UserData.Variables.Packages) != 1 {
+		t.Errorf("expected the user data to be restored, got %+v", pools[0].UserData)
+	}
+	if snapshot := pools[0].UserData.Snapshot; snapshot == nil || len(snapshot.Config.RunCmd) != 1 {
+		t.Errorf("expected the template snapshot to be restored, got %+v", snapshot)
+	}
+}
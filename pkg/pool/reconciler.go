@@ -0,0 +1,413 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const DefaultReconcileInterval = time.Minute
+
+const memberSuffixAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// Reconciler makes the members of every pool match its desired count. It
+// replaces members that stopped or whose status checks are impaired.
+type Reconciler struct {
+	Client    ec2.EC2Client
+	Store     *Store
+	Images    image.ChannelAMIFinder
+	Templates *cloudinit.TemplateStore
+	Interval  time.Duration
+	// Inventory records the members the reconciler creates and terminates.
+	// It defaults to an in-memory store.
+	Inventory inventory.Store
+	// OnChange is called after the reconciler created or terminated a
+	// member, e.g. to invalidate cached instance lists; optional
+	OnChange func()
+	// Events publishes state transitions of members the reconciler creates
+	// and terminates; optional
+	Events *events.NodeTracker
+
+	// mu serializes passes so an API-triggered pass and the periodic one
+	// never launch the same replacement twice
+	mu      sync.Mutex
+	trigger chan struct{}
+}
+
+func NewReconciler(client ec2.EC2Client, store *Store, images image.ChannelAMIFinder, templates *cloudinit.TemplateStore) *Reconciler {
+	return &Reconciler{
+		Client:    client,
+		Store:     store,
+		Images:    images,
+		Templates: templates,
+		Interval:  DefaultReconcileInterval,
+		Inventory: inventory.NewMemoryStore(),
+		trigger:   make(chan struct{}, 1),
+	}
+}
+
+// Run reconciles all pools every Interval and whenever Trigger is called,
+// until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.trigger:
+		}
+		r.ReconcileAll(ctx)
+	}
+}
+
+// Trigger requests a pass without waiting for it. Requests made while a
+// pass is pending are coalesced.
+func (r *Reconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Reconciler) ReconcileAll(ctx context.Context) {
+	for _, pool := range r.Store.List() {
+		if pool.Deleting {
+			// A deletion whose drain failed or was cut short by a restart
+			if err := r.Delete(ctx, pool.Name); err != nil {
+				slog.Error("Failed to delete pool", "pool", pool.Name, "error", err)
+			}
+			continue
+		}
+		if _, err := r.Reconcile(ctx, pool); err != nil {
+			slog.Error("Failed to reconcile pool", "pool", pool.Name, "error", err)
+		}
+	}
+}
+
+// Reconcile runs a single pass for the pool and records the resulting
+// status in the store.
+func (r *Reconciler) Reconcile(ctx context.Context, pool Pool) (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The pool may have been marked for deletion and drained since it was
+	// listed
+	if current, err := r.Store.Get(pool.Name); err != nil || current.Deleting {
+		return Status{}, nil
+	}
+
+	status, err := r.reconcile(ctx, pool)
+	status.LastReconciledAt = time.Now().UTC()
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	r.Store.SetStatus(pool.Name, status)
+	return status, err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, pool Pool) (Status, error) {
+	members, err := ec2.ListInstancesByTag(ctx, r.Client, ec2.TagPool, pool.Name)
+	if err != nil {
+		return Status{}, err
+	}
+
+	healthy, unhealthy, err := r.classifyMembers(ctx, members)
+	if err != nil {
+		return Status{}, err
+	}
+
+	// Unhealthy members are only terminated once their replacements can be
+	// created, so a pool whose image or template is gone keeps its members
+	var errs []error
+	var amiID string
+	if len(unhealthy) > 0 || len(healthy) < pool.DesiredCount {
+		amiID, err = r.prepareMembers(ctx, pool)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if amiID != "" {
+		for _, member := range unhealthy {
+			slog.Info("Replacing unhealthy pool member", "pool", pool.Name, "instance_id", member.InstanceID, "state", member.State)
+			if err := r.terminate(ctx, pool.Name, member.InstanceID, "unhealthy"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if surplus := len(healthy) - pool.DesiredCount; surplus > 0 {
+		// Scale down newest first; pending members have not done any work yet
+		slices.SortFunc(healthy, func(a, b ec2.InstanceInfo) int {
+			return b.LaunchTime.Compare(a.LaunchTime)
+		})
+		for _, member := range healthy[:surplus] {
+			slog.Info("Scaling down pool", "pool", pool.Name, "instance_id", member.InstanceID)
+			if err := r.terminate(ctx, pool.Name, member.InstanceID, "scale-down"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		healthy = healthy[surplus:]
+	}
+
+	if missing := pool.DesiredCount - len(healthy); missing > 0 && amiID != "" {
+		created, err := r.createMembers(ctx, pool, amiID, missing)
+		healthy = append(healthy, created...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	status := Status{Unhealthy: len(unhealthy)}
+	for _, member := range healthy {
+		status.Members = append(status.Members, member.InstanceID)
+		if member.State == string(types.InstanceStateNameRunning) {
+			status.Running++
+		} else {
+			status.Pending++
+		}
+	}
+	slices.Sort(status.Members)
+	return status, errors.Join(errs...)
+}
+
+// Delete drains a pool marked as deleting and removes it from the store
+// once all its members are terminated. A pool whose drain fails stays
+// marked, so the next pass retries it.
+func (r *Reconciler) Delete(ctx context.Context, name string) error {
+	if err := r.Drain(ctx, name); err != nil {
+		return err
+	}
+	return r.Store.Delete(ctx, name)
+}
+
+// Drain terminates all members of a pool. It is used once the pool is
+// marked as deleting, so no later pass brings members back.
+func (r *Reconciler) Drain(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members, err := ec2.ListInstancesByTag(ctx, r.Client, ec2.TagPool, name)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, member := range members {
+		slog.Info("Draining pool member", "pool", name, "instance_id", member.InstanceID)
+		if err := r.terminate(ctx, name, member.InstanceID, "drain"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Reconciler) classifyMembers(ctx context.Context, members []ec2.InstanceInfo) (healthy, unhealthy []ec2.InstanceInfo, err error) {
+	var running []string
+	for _, member := range members {
+		if member.State == string(types.InstanceStateNameRunning) {
+			running = append(running, member.InstanceID)
+		}
+	}
+
+	impaired, err := ec2.ListImpairedInstances(ctx, r.Client, running)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, member := range members {
+		switch {
+		case member.State == string(types.InstanceStateNameStopping),
+			member.State == string(types.InstanceStateNameStopped),
+			slices.Contains(impaired, member.InstanceID):
+			unhealthy = append(unhealthy, member)
+		default:
+			healthy = append(healthy, member)
+		}
+	}
+	return healthy, unhealthy, nil
+}
+
+// prepareMembers returns the AMI new members of pool boot and checks that
+// their user data renders.
+func (r *Reconciler) prepareMembers(ctx context.Context, pool Pool) (string, error) {
+	channel := pool.ImageChannel
+	if channel == "" {
+		channel = image.LatestChannel
+	}
+	amiID, err := r.Images.FindLatestAMIInChannel(ctx, channel)
+	if err != nil {
+		return "", fmt.Errorf("failed to find AMI for channel %s: %w", channel, err)
+	}
+	if pool.UserData != nil {
+		if _, err := r.renderUserData(pool.UserData, pool.Name); err != nil {
+			return "", err
+		}
+	}
+	return amiID, nil
+}
+
+func (r *Reconciler) createMembers(ctx context.Context, pool Pool, amiID string, count int) ([]ec2.InstanceInfo, error) {
+	tags := maps.Clone(pool.Tags)
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	tags[ec2.TagPool] = pool.Name
+
+	var created []ec2.InstanceInfo
+	for range count {
+		name, err := ec2.AssignNodeName(ctx, r.Client, pool.Name+"-"+memberSuffix())
+		if err != nil {
+			return created, err
+		}
+
+		config := ec2.CreateInstanceConfig{
+			Name:         name,
+			ImageID:      amiID,
+			InstanceType: pool.InstanceType,
+			KeyName:      pool.KeyName,
+			Tags:         tags,
+		}
+		if pool.UserData != nil {
+			userData, err := r.renderUserData(pool.UserData, name)
+			if err != nil {
+				return created, err
+			}
+			config.UserData = userData
+		}
+
+		slog.Info("Scaling up pool", "pool", pool.Name, "name", name)
+		started := time.Now().UTC()
+		params := map[string]string{
+			"imageId":      amiID,
+			"instanceType": string(pool.InstanceType),
+		}
+		if pool.KeyName != "" {
+			params["keyName"] = pool.KeyName
+		}
+		if pool.UserData != nil && pool.UserData.Template != "" {
+			params["template"] = pool.UserData.Template
+		}
+
+		info, err := ec2.CreateInstance(ctx, r.Client, config)
+		target := name
+		if err == nil {
+			target = info.InstanceID
+		}
+		r.recordOperation(ctx, "create-node", target, pool.Name, params, started, err)
+		if err != nil {
+			return created, err
+		}
+		r.changed()
+		r.Events.Observe(events.NodeStateChanged{InstanceID: info.InstanceID, Name: info.Name, Pool: pool.Name, State: info.State})
+		if err := r.Inventory.PutNode(ctx, inventory.NodeRecord{
+			InstanceID: info.InstanceID,
+			Name:       info.Name,
+			Pool:       pool.Name,
+			CreatedBy:  poolActor(pool.Name),
+			CreatedAt:  started,
+			Params:     params,
+			State:      info.State,
+		}); err != nil {
+			slog.Warn("Failed to record pool member", "pool", pool.Name, "instance_id", info.InstanceID, "error", err)
+		}
+		created = append(created, info)
+	}
+	return created, nil
+}
+
+// terminate deletes a member and records why the reconciler removed it.
+func (r *Reconciler) terminate(ctx context.Context, poolName, instanceID, reason string) error {
+	started := time.Now().UTC()
+	err := ec2.DeleteInstance(ctx, r.Client, instanceID)
+	r.recordOperation(ctx, "delete-node", instanceID, poolName, map[string]string{"reason": reason}, started, err)
+	if err != nil {
+		return err
+	}
+	r.changed()
+	r.Events.Observe(events.NodeStateChanged{
+		InstanceID: instanceID,
+		Pool:       poolName,
+		State:      string(types.InstanceStateNameShuttingDown),
+		Reason:     reason,
+	})
+	if err := inventory.MarkNodeDeleted(ctx, r.Inventory, instanceID, poolActor(poolName)); err != nil {
+		slog.Warn("Failed to record pool member deletion", "pool", poolName, "instance_id", instanceID, "error", err)
+	}
+	return nil
+}
+
+func (r *Reconciler) recordOperation(ctx context.Context, opType, target, poolName string, params map[string]string, started time.Time, err error) {
+	finished := time.Now().UTC()
+	op := inventory.OperationRecord{
+		Type:       opType,
+		Target:     target,
+		Actor:      poolActor(poolName),
+		Params:     params,
+		Status:     inventory.OperationSucceeded,
+		StartedAt:  started,
+		FinishedAt: &finished,
+	}
+	if err != nil {
+		op.Status = inventory.OperationFailed
+		op.Error = err.Error()
+	}
+	if _, err := r.Inventory.AddOperation(ctx, op); err != nil {
+		slog.Warn("Failed to record operation", "type", opType, "target", target, "error", err)
+	}
+}
+
+func (r *Reconciler) changed() {
+	if r.OnChange != nil {
+		r.OnChange()
+	}
+}
+
+// poolActor attributes reconciler actions to the pool they were made for.
+func poolActor(poolName string) string {
+	return "pool:" + poolName
+}
+
+// renderUserData renders the template snapshot of a pool, or looks the
+// template up for pools recorded without one.
+func (r *Reconciler) renderUserData(spec *UserData, hostname string) (string, error) {
+	tmpl := spec.Snapshot
+	if tmpl == nil && spec.Template != "" {
+		found, err := r.Templates.Get(spec.Template)
+		if err != nil {
+			return "", err
+		}
+		tmpl = &found
+	}
+
+	vars := spec.Variables
+	vars.Hostname = hostname
+	userData, err := cloudinit.Render(tmpl, vars)
+	if err != nil {
+		return "", err
+	}
+	return userData.Content, nil
+}
+
+func memberSuffix() string {
+	suffix := make([]byte, 5)
+	for i := range suffix {
+		suffix[i] = memberSuffixAlphabet[rand.IntN(len(memberSuffixAlphabet))]
+	}
+	return string(suffix)
+}
@@ -0,0 +1,374 @@
+package pool
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/cloudinit"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// fakeFleet is a minimal in-memory EC2 that understands the tag filters the
+// reconciler uses.
+type fakeFleet struct {
+	instances  []types.Instance
+	impaired   []string
+	userData   map[string]string
+	terminated []string
+	launches   int
+}
+
+func newFakeFleet() *fakeFleet {
+	return &fakeFleet{userData: map[string]string{}}
+}
+
+func (f *fakeFleet) add(id, pool string, state types.InstanceStateName, launchTime time.Time) {
+	f.instances = append(f.instances, types.Instance{
+		InstanceId: aws.String(id),
+		State:      &types.InstanceState{Name: state},
+		LaunchTime: aws.Time(launchTime),
+		Tags: []types.Tag{
+			{Key: aws.String(ec2.TagManagedBy), Value: aws.String(ec2.ManagedByValue)},
+			{Key: aws.String(ec2.TagPool), Value: aws.String(pool)},
+		},
+	})
+}
+
+func (f *fakeFleet) client() *ec2.MockEC2Client {
+	return &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			var matched []types.Instance
+			for _, instance := range f.instances {
+				if matchesFilters(instance, params.Filters) {
+					matched = append(matched, instance)
+				}
+			}
+			return &awsec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: matched}}}, nil
+		},
+		DescribeInstanceStatusFunc: func(ctx context.Context, params *awsec2.DescribeInstanceStatusInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceStatusOutput, error) {
+			var statuses []types.InstanceStatus
+			for _, id := range params.InstanceIds {
+				status := types.SummaryStatusOk
+				if slices.Contains(f.impaired, id) {
+					status = types.SummaryStatusImpaired
+				}
+				statuses = append(statuses, types.InstanceStatus{
+					InstanceId:     aws.String(id),
+					InstanceStatus: &types.InstanceStatusSummary{Status: status},
+					SystemStatus:   &types.InstanceStatusSummary{Status: types.SummaryStatusOk},
+				})
+			}
+			return &awsec2.DescribeInstanceStatusOutput{InstanceStatuses: statuses}, nil
+		},
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			f.launches++
+			instance := types.Instance{
+				InstanceId: aws.String(fmt.Sprintf("i-launched%d", f.launches)),
+				State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+				LaunchTime: aws.Time(time.Now()),
+				Tags:       params.TagSpecifications[0].Tags,
+			}
+			if params.UserData != nil {
+				decoded, _ := base64.StdEncoding.DecodeString(*params.UserData)
+				f.userData[*instance.InstanceId] = string(decoded)
+			}
+			f.instances = append(f.instances, instance)
+			return &awsec2.RunInstancesOutput{Instances: []types.Instance{instance}}, nil
+		},
+		TerminateInstancesFunc: func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+			id := params.InstanceIds[0]
+			f.terminated = append(f.terminated, id)
+			for i := range f.instances {
+				if *f.instances[i].InstanceId == id {
+					f.instances[i].State = &types.InstanceState{Name: types.InstanceStateNameShuttingDown}
+				}
+			}
+			return &awsec2.TerminateInstancesOutput{
+				TerminatingInstances: []types.InstanceStateChange{
+					{
+						InstanceId:    aws.String(id),
+						PreviousState: &types.InstanceState{Name: types.InstanceStateNameRunning},
+						CurrentState:  &types.InstanceState{Name: types.InstanceStateNameShuttingDown},
+					},
+				},
+			}, nil
+		},
+	}
+}
+
+func matchesFilters(instance types.Instance, filters []types.Filter) bool {
+	tags := map[string]string{}
+	for _, tag := range instance.Tags {
+		tags[*tag.Key] = *tag.Value
+	}
+	for _, filter := range filters {
+		name := *filter.Name
+		switch {
+		case name == "instance-state-name":
+			if !slices.Contains(filter.Values, string(instance.State.Name)) {
+				return false
+			}
+		case strings.HasPrefix(name, "tag:"):
+			if !slices.Contains(filter.Values, tags[strings.TrimPrefix(name, "tag:")]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func newTestReconciler(fleet *fakeFleet, store *Store, templates *cloudinit.TemplateStore) *Reconciler {
+	images := &image.MockChannelAMIFinder{
+		FindLatestAMIInChannelFunc: func(ctx context.Context, channel string) (string, error) {
+			return "ami-1234567890abcdef0", nil
+		},
+	}
+	return NewReconciler(fleet.client(), store, images, templates)
+}
+
+func TestReconciler_ScaleUp(t *testing.T) {
+	fleet := newFakeFleet()
+	store := NewStore()
+	templates := cloudinit.NewTemplateStore()
+	templates.Create(cloudinit.Template{Name: "runner", Config: cloudinit.CloudConfig{Packages: []string{"git"}}})
+
+	pool, err := store.Create(context.Background(), Pool{
+		Name:         "ci",
+		InstanceType: types.InstanceTypeT4gMicro,
+		DesiredCount: 3,
+		Tags:         map[string]string{"Team": "infra"},
+		UserData:     &UserData{Template: "runner"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status, err := newTestReconciler(fleet, store, templates).Reconcile(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fleet.launches != 3 {
+		t.Errorf("expected 3 launches, got %d", fleet.launches)
+	}
+	if status.Pending != 3 || len(status.Members) != 3 {
+		t.Errorf("expected 3 pending members, got %+v", status)
+	}
+
+	for _, instance := range fleet.instances {
+		info := ec2.InstanceInfo{Tags: map[string]string{}}
+		for _, tag := range instance.Tags {
+			info.Tags[*tag.Key] = *tag.Value
+		}
+		if info.Tags[ec2.TagPool] != "ci" || info.Tags["Team"] != "infra" {
+			t.Errorf("expected pool and custom tags, got %v", info.Tags)
+		}
+		name := info.Tags[ec2.TagName]
+		if !strings.HasPrefix(name, "ci-") {
+			t.Errorf("expected member name with pool prefix, got %q", name)
+		}
+		if !strings.Contains(fleet.userData[*instance.InstanceId], `hostname: "`+name+`"`) {
+			t.Errorf("expected user data with hostname %s, got:\n%s", name, fleet.userData[*instance.InstanceId])
+		}
+	}
+
+	stored, _ := store.Get("ci")
+	if stored.Status.LastReconciledAt.IsZero() {
+		t.Error("expected status to be recorded in the store")
+	}
+}
+
+func TestReconciler_ScaleDown(t *testing.T) {
+	fleet := newFakeFleet()
+	now := time.Now()
+	fleet.add("i-oldest", "ci", types.InstanceStateNameRunning, now.Add(-3*time.Hour))
+	fleet.add("i-middle", "ci", types.InstanceStateNameRunning, now.Add(-2*time.Hour))
+	fleet.add("i-newest", "ci", types.InstanceStateNameRunning, now.Add(-time.Hour))
+	fleet.add("i-other", "other", types.InstanceStateNameRunning, now)
+
+	store := NewStore()
+	pool, _ := store.Create(context.Background(), Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: 1})
+
+	status, err := newTestReconciler(fleet, store, cloudinit.NewTemplateStore()).Reconcile(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedTerminated := []string{"i-newest", "i-middle"}
+	if !slices.Equal(fleet.terminated, expectedTerminated) {
+		t.Errorf("expected %v to be terminated, got %v", expectedTerminated, fleet.terminated)
+	}
+	if !slices.Equal(status.Members, []string{"i-oldest"}) {
+		t.Errorf("expected only i-oldest to remain, got %v", status.Members)
+	}
+	if fleet.launches != 0 {
+		t.Errorf("expected no launches, got %d", fleet.launches)
+	}
+}
+
+func TestReconciler_ReplacesUnhealthy(t *testing.T) {
+	fleet := newFakeFleet()
+	now := time.Now()
+	fleet.add("i-healthy", "ci", types.InstanceStateNameRunning, now)
+	fleet.add("i-stopped", "ci", types.InstanceStateNameStopped, now)
+	fleet.add("i-impaired", "ci", types.InstanceStateNameRunning, now)
+	fleet.impaired = []string{"i-impaired"}
+
+	store := NewStore()
+	pool, _ := store.Create(context.Background(), Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: 3})
+
+	reconciler := newTestReconciler(fleet, store, cloudinit.NewTemplateStore())
+	status, err := reconciler.Reconcile(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	slices.Sort(fleet.terminated)
+	if !slices.Equal(fleet.terminated, []string{"i-impaired", "i-stopped"}) {
+		t.Errorf("expected unhealthy members to be terminated, got %v", fleet.terminated)
+	}
+	if fleet.launches != 2 {
+		t.Errorf("expected 2 replacements, got %d", fleet.launches)
+	}
+	if status.Running != 1 || status.Pending != 2 || status.Unhealthy != 2 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	ops, _ := reconciler.Inventory.ListOperations(context.Background(), "i-stopped")
+	if len(ops) != 1 || ops[0].Actor != "pool:ci" || ops[0].Params["reason"] != "unhealthy" {
+		t.Errorf("expected replacement to be recorded, got %+v", ops)
+	}
+	nodes, _ := reconciler.Inventory.ListNodes(context.Background())
+	created := 0
+	for _, node := range nodes {
+		if node.Pool == "ci" && node.CreatedBy == "pool:ci" {
+			created++
+		}
+	}
+	if created != 2 {
+		t.Errorf("expected 2 recorded replacements, got %d", created)
+	}
+}
+
+func TestReconciler_MissingTemplate(t *testing.T) {
+	fleet := newFakeFleet()
+	fleet.add("i-stopped", "ci", types.InstanceStateNameStopped, time.Now())
+	store := NewStore()
+	pool, _ := store.Create(context.Background(), Pool{
+		Name:         "ci",
+		InstanceType: types.InstanceTypeT4gMicro,
+		DesiredCount: 1,
+		UserData:     &UserData{Template: "deleted"},
+	})
+
+	_, err := newTestReconciler(fleet, store, cloudinit.NewTemplateStore()).Reconcile(context.Background(), pool)
+	if err == nil {
+		t.Fatal("expected error for missing template")
+	}
+
+	stored, _ := store.Get("ci")
+	if stored.Status.LastError == "" {
+		t.Error("expected error to be recorded in the status")
+	}
+	if fleet.launches != 0 {
+		t.Errorf("expected no launches, got %d", fleet.launches)
+	}
+	// Without a replacement the unhealthy member is kept
+	if len(fleet.terminated) != 0 {
+		t.Errorf("expected no terminations, got %v", fleet.terminated)
+	}
+}
+
+func TestReconciler_TemplateSnapshot(t *testing.T) {
+	fleet := newFakeFleet()
+	store := NewStore()
+	// The template itself is gone, e.g. after a restart
+	pool, _ := store.Create(context.Background(), Pool{
+		Name:         "ci",
+		InstanceType: types.InstanceTypeT4gMicro,
+		DesiredCount: 1,
+		UserData: &UserData{
+			Template: "runner",
+			Snapshot: &cloudinit.Template{Name: "runner", Config: cloudinit.CloudConfig{Packages: []string{"git"}}},
+		},
+	})
+
+	if _, err := newTestReconciler(fleet, store, cloudinit.NewTemplateStore()).Reconcile(context.Background(), pool); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fleet.launches != 1 {
+		t.Fatalf("expected 1 launch, got %d", fleet.launches)
+	}
+	if userData := fleet.userData[*fleet.instances[0].InstanceId]; !strings.Contains(userData, "git") {
+		t.Errorf("expected user data from the snapshot, got:\n%s", userData)
+	}
+}
+
+func TestReconciler_Drain(t *testing.T) {
+	fleet := newFakeFleet()
+	fleet.add("i-a", "ci", types.InstanceStateNameRunning, time.Now())
+	fleet.add("i-b", "ci", types.InstanceStateNameStopped, time.Now())
+	fleet.add("i-other", "other", types.InstanceStateNameRunning, time.Now())
+
+	reconciler := newTestReconciler(fleet, NewStore(), cloudinit.NewTemplateStore())
+	if err := reconciler.Drain(context.Background(), "ci"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	slices.Sort(fleet.terminated)
+	if !slices.Equal(fleet.terminated, []string{"i-a", "i-b"}) {
+		t.Errorf("expected pool members to be terminated, got %v", fleet.terminated)
+	}
+}
+
+func TestReconciler_DeleteRetriesFailedDrain(t *testing.T) {
+	ctx := context.Background()
+	fleet := newFakeFleet()
+	fleet.add("i-a", "ci", types.InstanceStateNameRunning, time.Now())
+	store := NewStore()
+	pool, _ := store.Create(ctx, Pool{Name: "ci", InstanceType: types.InstanceTypeT4gMicro, DesiredCount: 2})
+
+	reconciler := newTestReconciler(fleet, store, cloudinit.NewTemplateStore())
+	client := reconciler.Client.(*ec2.MockEC2Client)
+	terminate := client.TerminateInstancesFunc
+	client.TerminateInstancesFunc = func(ctx context.Context, params *awsec2.TerminateInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.TerminateInstancesOutput, error) {
+		return nil, fmt.Errorf("throttled")
+	}
+
+	if err := store.MarkDeleting(ctx, "ci"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reconciler.Delete(ctx, "ci"); err == nil {
+		t.Fatal("expected the failed drain to be returned")
+	}
+	stored, err := store.Get("ci")
+	if err != nil || !stored.Deleting {
+		t.Fatalf("expected the pool to stay marked as deleting, got %+v, %v", stored, err)
+	}
+
+	// A pass over the pool listed before it was marked launches nothing
+	if _, err := reconciler.Reconcile(ctx, pool); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fleet.launches != 0 {
+		t.Errorf("expected no launches for a deleting pool, got %d", fleet.launches)
+	}
+
+	client.TerminateInstancesFunc = terminate
+	reconciler.ReconcileAll(ctx)
+	if !slices.Equal(fleet.terminated, []string{"i-a"}) {
+		t.Errorf("expected the member to be drained, got %v", fleet.terminated)
+	}
+	if _, err := store.Get("ci"); err == nil {
+		t.Error("expected the pool to be removed after the drain")
+	}
+}
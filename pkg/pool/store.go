@@ -0,0 +1,225 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Store keeps pools in memory and, when opened on an inventory, persists
+// their definitions there so pools survive a restart. Members are found
+// through their Pool tag, so a restored pool adopts its existing
+// instances. The status is not persisted; the next reconcile restores it.
+type Store struct {
+	mu    sync.RWMutex
+	pools map[string]Pool
+	// inventory is nil for a store that only lives in memory
+	inventory inventory.Store
+}
+
+func NewStore() *Store {
+	return &Store{pools: make(map[string]Pool)}
+}
+
+// OpenStore returns a store persisting to store, loaded with the pools
+// recorded there.
+func OpenStore(ctx context.Context, store inventory.Store) (*Store, error) {
+	records, err := store.ListPools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pools: %w", err)
+	}
+	s := &Store{pools: make(map[string]Pool, len(records)), inventory: store}
+	for _, record := range records {
+		s.pools[record.Name] = poolFromRecord(record)
+	}
+	return s, nil
+}
+
+func (s *Store) List() []Pool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pools := make([]Pool, 0, len(s.pools))
+	for _, pool := range s.pools {
+		pools = append(pools, clonePool(pool))
+	}
+	slices.SortFunc(pools, func(a, b Pool) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return pools
+}
+
+func (s *Store) Get(name string) (Pool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pool, ok := s.pools[name]
+	if !ok {
+		return Pool{}, fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+	}
+	return clonePool(pool), nil
+}
+
+func (s *Store) Create(ctx context.Context, pool Pool) (Pool, error) {
+	if err := Validate(&pool); err != nil {
+		return Pool{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pools[pool.Name]; ok {
+		return Pool{}, fmt.Errorf("%w: %s", ErrPoolExists, pool.Name)
+	}
+
+	now := time.Now().UTC()
+	pool.CreatedAt = now
+	pool.UpdatedAt = now
+	pool.Status = Status{}
+	if err := s.persist(ctx, pool); err != nil {
+		return Pool{}, err
+	}
+	s.pools[pool.Name] = clonePool(pool)
+	return pool, nil
+}
+
+func (s *Store) SetDesiredCount(ctx context.Context, name string, count int) (Pool, error) {
+	if count < 0 || count > MaxDesiredCount {
+		return Pool{}, fmt.Errorf("%w: desired count must be between 0 and %d", ErrInvalidPool, MaxDesiredCount)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pool, ok := s.pools[name]
+	if !ok {
+		return Pool{}, fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+	}
+	if pool.Deleting {
+		return Pool{}, fmt.Errorf("%w: %s", ErrPoolDeleting, name)
+	}
+	pool.DesiredCount = count
+	pool.UpdatedAt = time.Now().UTC()
+	if err := s.persist(ctx, pool); err != nil {
+		return Pool{}, err
+	}
+	s.pools[name] = pool
+	return clonePool(pool), nil
+}
+
+// SetStatus records the outcome of a reconcile pass. Pools deleted in the
+// meantime are ignored.
+func (s *Store) SetStatus(name string, status Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pool, ok := s.pools[name]
+	if !ok {
+		return
+	}
+	pool.Status = status
+	s.pools[name] = pool
+}
+
+// MarkDeleting marks a pool for deletion, so the reconciler drains it
+// instead of replacing members.
+func (s *Store) MarkDeleting(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pool, ok := s.pools[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+	}
+	pool.Deleting = true
+	pool.UpdatedAt = time.Now().UTC()
+	if err := s.persist(ctx, pool); err != nil {
+		return err
+	}
+	s.pools[name] = pool
+	return nil
+}
+
+func (s *Store) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pools[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+	}
+	if s.inventory != nil {
+		if err := s.inventory.DeletePool(ctx, name); err != nil {
+			return fmt.Errorf("failed to delete pool: %w", err)
+		}
+	}
+	delete(s.pools, name)
+	return nil
+}
+
+// persist records the definition of pool. The caller holds the lock.
+func (s *Store) persist(ctx context.Context, pool Pool) error {
+	if s.inventory == nil {
+		return nil
+	}
+	if err := s.inventory.PutPool(ctx, poolToRecord(pool)); err != nil {
+		return fmt.Errorf("failed to save pool: %w", err)
+	}
+	return nil
+}
+
+func poolToRecord(pool Pool) inventory.PoolRecord {
+	record := inventory.PoolRecord{
+		Name:         pool.Name,
+		InstanceType: string(pool.InstanceType),
+		ImageChannel: pool.ImageChannel,
+		KeyName:      pool.KeyName,
+		Tags:         pool.Tags,
+		DesiredCount: pool.DesiredCount,
+		Deleting:     pool.Deleting,
+		CreatedAt:    pool.CreatedAt,
+		UpdatedAt:    pool.UpdatedAt,
+	}
+	if pool.UserData != nil {
+		record.UserData = &inventory.PoolUserData{
+			Template:         pool.UserData.Template,
+			Variables:        pool.UserData.Variables,
+			TemplateSnapshot: pool.UserData.Snapshot,
+		}
+	}
+	return record
+}
+
+func poolFromRecord(record inventory.PoolRecord) Pool {
+	pool := Pool{
+		Name:         record.Name,
+		InstanceType: types.InstanceType(record.InstanceType),
+		ImageChannel: record.ImageChannel,
+		KeyName:      record.KeyName,
+		Tags:         record.Tags,
+		DesiredCount: record.DesiredCount,
+		Deleting:     record.Deleting,
+		CreatedAt:    record.CreatedAt,
+		UpdatedAt:    record.UpdatedAt,
+	}
+	if record.UserData != nil {
+		pool.UserData = &UserData{
+			Template:  record.UserData.Template,
+			Variables: record.UserData.Variables,
+			Snapshot:  record.UserData.TemplateSnapshot,
+		}
+	}
+	return pool
+}
+
+func clonePool(pool Pool) Pool {
+	pool.Tags = maps.Clone(pool.Tags)
+	pool.Status.Members = slices.Clone(pool.Status.Members)
+	return pool
+}
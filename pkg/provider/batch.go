@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Helpers for operations on many nodes at once.
+
+var ErrInvalidSelector = errkind.New(errkind.InvalidInput, "invalid selector")
+
+// CreateEach implements CreateNodes for providers that launch nodes one at
+// a time. It stops at the first node that fails to launch. Client tokens
+// are made unique per node.
+func CreateEach(ctx context.Context, config ec2.CreateInstanceConfig, names []string, create func(context.Context, ec2.CreateInstanceConfig) (ec2.InstanceInfo, error)) ([]ec2.InstanceInfo, error) {
+	clientToken := config.ClientToken
+	var nodes []ec2.InstanceInfo
+	for i, name := range names {
+		config.Name = name
+		if clientToken != "" {
+			config.ClientToken = fmt.Sprintf("%s-%d", clientToken, i)
+		}
+		info, err := create(ctx, config)
+		if err != nil {
+			return nodes, err
+		}
+		nodes = append(nodes, info)
+	}
+	return nodes, nil
+}
+
+// AssignNames assigns the names of count new nodes with a single listing:
+// "<prefix>-<n>" counting from 1 and skipping names in use, or generated
+// names without a prefix. Names are unique among the live nodes and each
+// other. The names of live nodes already tagged with batch come first, so
+// an idempotent replay of a batch gets the names of the original launch.
+func AssignNames(ctx context.Context, nodes Provider, prefix string, count int, batch string) ([]string, error) {
+	existing, err := nodes.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, count)
+	taken := make(map[string]bool)
+	for _, node := range existing {
+		if !live(node) {
+			continue
+		}
+		taken[node.Name] = true
+		if batch != "" && node.Tags[ec2.TagBatch] == batch && node.Name != "" && len(names) < count {
+			names = append(names, node.Name)
+		}
+	}
+
+	for n := 1; len(names) < count; n++ {
+		requested := ""
+		if prefix != "" {
+			requested = fmt.Sprintf("%s-%d", prefix, n)
+			if taken[requested] {
+				continue
+			}
+		}
+		name, err := AssignName(requested, func(name string) bool { return taken[name] })
+		if err != nil {
+			return nil, err
+		}
+		taken[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// FindTagged returns a live node tagged key=value and whether there is one,
+// e.g. the node an earlier attempt of an idempotent create launched.
+func FindTagged(ctx context.Context, nodes Provider, key, value string) (ec2.InstanceInfo, bool, error) {
+	existing, err := nodes.ListNodes(ctx)
+	if err != nil {
+		return ec2.InstanceInfo{}, false, err
+	}
+	for _, node := range existing {
+		if live(node) && node.Tags[key] == value {
+			return node, true, nil
+		}
+	}
+	return ec2.InstanceInfo{}, false, nil
+}
+
+// Selector matches nodes by their tags, e.g. env=test. Every tag must
+// match.
+type Selector map[string]string
+
+// ParseSelector parses comma separated key=value pairs, e.g.
+// "env=test,team=ci".
+func ParseSelector(s string) (Selector, error) {
+	selector := make(Selector)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w: %q, expected key=value pairs", ErrInvalidSelector, s)
+		}
+		selector[key] = value
+	}
+	return selector, nil
+}
+
+func (s Selector) String() string {
+	pairs := make([]string, 0, len(s))
+	for _, key := range slices.Sorted(maps.Keys(s)) {
+		pairs = append(pairs, key+"="+s[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Matches reports whether a node carries every tag of the selector.
+func (s Selector) Matches(node ec2.InstanceInfo) bool {
+	for key, value := range s {
+		if tag, ok := node.Tags[key]; !ok || tag != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectNodes returns the live managed nodes matching selector. An empty
+// selector is rejected rather than matching every node.
+func SelectNodes(ctx context.Context, nodes Provider, selector Selector) ([]ec2.InstanceInfo, error) {
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("%w: selector must not be empty", ErrInvalidSelector)
+	}
+	existing, err := nodes.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var selected []ec2.InstanceInfo
+	for _, node := range existing {
+		if live(node) && node.Tags[ec2.TagManagedBy] == ec2.ManagedByValue && selector.Matches(node) {
+			selected = append(selected, node)
+		}
+	}
+	return selected, nil
+}
+
+// live reports whether a node still counts, i.e. is not being terminated.
+func live(node ec2.InstanceInfo) bool {
+	state := types.InstanceStateName(node.State)
+	return state != types.InstanceStateNameShuttingDown && state != types.InstanceStateNameTerminated
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+)
+
+func TestParseSelector(t *testing.T) {
+	selector, err := ParseSelector("env=test, team=ci")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if selector.String() != "env=test,team=ci" {
+		t.Errorf("expected env=test,team=ci, got %s", selector)
+	}
+
+	for _, invalid := range []string{"", "env", "=test", "env=test,"} {
+		if _, err := ParseSelector(invalid); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("expected ErrInvalidSelector for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	selector := Selector{"env": "test", "team": "ci"}
+	node := ec2.InstanceInfo{Tags: map[string]string{"env": "test", "team": "ci", "Name": "web"}}
+	if !selector.Matches(node) {
+		t.Error("expected a node with all tags to match")
+	}
+	node.Tags["team"] = "web"
+	if selector.Matches(node) {
+		t.Error("expected a node with a different tag value not to match")
+	}
+}
+
+func TestAssignName_NamesExhausted(t *testing.T) {
+	attempts := 0
+	_, err := AssignName("", func(name string) bool {
+		attempts++
+		return true
+	})
+	if err == nil {
+		t.Fatal("expected an error once every generated name is taken")
+	}
+	if attempts == 0 || attempts > 100 {
+		t.Errorf("expected a bounded number of attempts, got %d", attempts)
+	}
+}
@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// EC2 is the Provider backed by the EC2 API.
+type EC2 struct {
+	Client ec2.EC2Client
+	// Images finds the AMI new nodes boot; it also lists images when it
+	// implements image.ImageLister
+	Images image.AMIFinder
+}
+
+func NewEC2(client ec2.EC2Client, images image.AMIFinder) *EC2 {
+	return &EC2{Client: client, Images: images}
+}
+
+func (p *EC2) Name() string {
+	return "ec2"
+}
+
+func (p *EC2) FindLatestAMI(ctx context.Context) (string, error) {
+	if p.Images == nil {
+		return "", fmt.Errorf("%w: no AMI finder configured", ErrUnsupported)
+	}
+	return p.Images.FindLatestAMI(ctx)
+}
+
+func (p *EC2) ListImages(ctx context.Context) ([]types.Image, error) {
+	lister, ok := p.Images.(image.ImageLister)
+	if !ok {
+		return nil, fmt.Errorf("%w: listing images", ErrUnsupported)
+	}
+	return lister.ListImages(ctx)
+}
+
+func (p *EC2) AssignNodeName(ctx context.Context, requested string) (string, error) {
+	return ec2.AssignNodeName(ctx, p.Client, requested)
+}
+
+func (p *EC2) ResolveNode(ctx context.Context, idOrName string) (string, error) {
+	return ec2.ResolveInstanceID(ctx, p.Client, idOrName)
+}
+
+func (p *EC2) CreateNode(ctx context.Context, config ec2.CreateInstanceConfig) (ec2.InstanceInfo, error) {
+	return ec2.CreateInstance(ctx, p.Client, config)
+}
+
+func (p *EC2) CreateNodes(ctx context.Context, config ec2.CreateInstanceConfig, names []string) ([]ec2.InstanceInfo, error) {
+	return ec2.CreateInstances(ctx, p.Client, config, names)
+}
+
+func (p *EC2) ListNodes(ctx context.Context) ([]ec2.InstanceInfo, error) {
+	return ec2.ListInstances(ctx, p.Client)
+}
+
+func (p *EC2) GetNode(ctx context.Context, instanceID string) (ec2.InstanceInfo, error) {
+	return ec2.GetInstance(ctx, p.Client, instanceID)
+}
+
+func (p *EC2) DeleteNode(ctx context.Context, instanceID string) error {
+	return ec2.DeleteInstance(ctx, p.Client, instanceID)
+}
+
+func (p *EC2) PowerNode(ctx context.Context, instanceID string, action ec2.PowerAction) error {
+	switch action {
+	case ec2.PowerActionStart:
+		return ec2.StartInstance(ctx, p.Client, instanceID)
+	case ec2.PowerActionStop:
+		return ec2.StopInstance(ctx, p.Client, instanceID, ec2.StopInstanceOptions{})
+	case ec2.PowerActionHibernate:
+		return ec2.StopInstance(ctx, p.Client, instanceID, ec2.StopInstanceOptions{Hibernate: true})
+	case ec2.PowerActionForceStop:
+		return ec2.StopInstance(ctx, p.Client, instanceID, ec2.StopInstanceOptions{Force: true})
+	case ec2.PowerActionReboot:
+		return ec2.RebootInstance(ctx, p.Client, instanceID)
+	}
+	return fmt.Errorf("unknown power action: %s", action)
+}
+
+func (p *EC2) WaitForNode(ctx context.Context, instanceID string, opts ec2.WaitOptions) (ec2.InstanceInfo, error) {
+	return ec2.WaitForInstance(ctx, p.Client, instanceID, opts)
+}
+
+func (p *EC2) ConsoleOutput(ctx context.Context, instanceID string, latest bool) (ec2.ConsoleOutput, error) {
+	return ec2.GetConsoleOutput(ctx, p.Client, instanceID, latest)
+}
+
+func (p *EC2) ConsoleScreenshot(ctx context.Context, instanceID string) ([]byte, error) {
+	return ec2.GetConsoleScreenshot(ctx, p.Client, instanceID)
+}
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestEC2_PowerNode(t *testing.T) {
+	var stopped *awsec2.StopInstancesInput
+	client := &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{{
+					Instances: []types.Instance{{
+						InstanceId:         aws.String("i-1"),
+						State:              &types.InstanceState{Name: types.InstanceStateNameRunning},
+						HibernationOptions: &types.HibernationOptions{Configured: aws.Bool(true)},
+					}},
+				}},
+			}, nil
+		},
+		StopInstancesFunc: func(ctx context.Context, params *awsec2.StopInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.StopInstancesOutput, error) {
+			stopped = params
+			return &awsec2.StopInstancesOutput{}, nil
+		},
+	}
+	p := NewEC2(client, nil)
+
+	if err := p.PowerNode(context.Background(), "i-1", ec2.PowerActionHibernate); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stopped == nil || !aws.ToBool(stopped.Hibernate) {
+		t.Errorf("expected a hibernating stop, got %+v", stopped)
+	}
+	if err := p.PowerNode(context.Background(), "i-1", ec2.PowerActionStart); !errors.Is(err, ec2.ErrInvalidStateTransition) {
+		t.Errorf("expected ErrInvalidStateTransition, got %v", err)
+	}
+}
+
+func TestEC2_ListImages(t *testing.T) {
+	p := NewEC2(&ec2.MockEC2Client{}, &image.MockAMIFinder{})
+	if _, err := p.ListImages(context.Background()); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported without an image lister, got %v", err)
+	}
+}
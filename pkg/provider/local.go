@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Helpers for providers that keep their nodes in process and therefore know
+// every state change as it happens.
+
+// AssignName validates a requested node name, or generates one when it is
+// empty. taken reports whether a live node already carries a name.
+func AssignName(requested string, taken func(name string) bool) (string, error) {
+	if requested != "" {
+		if err := ec2.ValidateNodeName(requested); err != nil {
+			return "", err
+		}
+		if taken(requested) {
+			return "", fmt.Errorf("%w: %s", ec2.ErrNodeNameTaken, requested)
+		}
+		return requested, nil
+	}
+	return ec2.GenerateUniqueNodeName(func(name string) (bool, error) {
+		return taken(name), nil
+	})
+}
+
+// ResolveName maps a node reference to a node ID like
+// ec2.ResolveNodeName, for providers whose matches cannot fail.
+func ResolveName(idOrName string, matches func(name string) []string) (string, error) {
+	return ec2.ResolveNodeName(idOrName, func(name string) ([]string, error) {
+		return matches(name), nil
+	})
+}
+
+// NodeLookup returns the node, whether it exists, and a channel closed on
+// the next state change of any node.
+type NodeLookup func() (info ec2.InstanceInfo, found bool, changed <-chan struct{})
+
+// WaitForState implements WaitForNode on top of change notifications.
+// Nodes are also looked up every opts.InitialInterval, for statusChecks,
+// which decides whether a running node passes its status checks. A nil
+// statusChecks passes every running node.
+func WaitForState(ctx context.Context, instanceID string, opts ec2.WaitOptions, lookup NodeLookup, statusChecks func(ec2.InstanceInfo) bool) (ec2.InstanceInfo, error) {
+	if len(opts.TargetStates) == 0 {
+		return ec2.InstanceInfo{}, fmt.Errorf("at least one target state is required")
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = ec2.DefaultWaitTimeout
+	}
+	interval := opts.InitialInterval
+	if interval <= 0 {
+		interval = ec2.DefaultWaitInitialInterval
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	started := time.Now()
+	var last ec2.InstanceInfo
+	for attempt := 1; ; attempt++ {
+		info, found, changed := lookup()
+		if found {
+			last = info
+		}
+
+		state := types.InstanceStateName(last.State)
+		progress := ec2.WaitProgress{InstanceID: instanceID, State: state, Attempt: attempt, Elapsed: time.Since(started)}
+		switch {
+		case !found && slices.Contains(opts.TargetStates, types.InstanceStateNameTerminated):
+			notifyProgress(opts, progress)
+			return last, nil
+		case !found:
+			return last, fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+		case slices.Contains(opts.TargetStates, state):
+			if !opts.RequireStatusChecks || state != types.InstanceStateNameRunning {
+				notifyProgress(opts, progress)
+				return last, nil
+			}
+			progress.InstanceStatus = types.SummaryStatusInitializing
+			progress.SystemStatus = types.SummaryStatusOk
+			if statusChecks == nil || statusChecks(last) {
+				progress.InstanceStatus = types.SummaryStatusOk
+				notifyProgress(opts, progress)
+				return last, nil
+			}
+		case (state == types.InstanceStateNameShuttingDown || state == types.InstanceStateNameTerminated) &&
+			!slices.Contains(opts.TargetStates, types.InstanceStateNameTerminated):
+			notifyProgress(opts, progress)
+			return last, &ec2.TerminalStateError{
+				InstanceID:   instanceID,
+				TargetStates: opts.TargetStates,
+				State:        state,
+				Reason:       last.StateReason,
+			}
+		}
+		notifyProgress(opts, progress)
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return last, ctx.Err()
+			}
+			return last, &ec2.WaitTimeoutError{
+				InstanceID:   instanceID,
+				TargetStates: opts.TargetStates,
+				LastState:    state,
+				Timeout:      timeout,
+			}
+		}
+	}
+}
+
+func notifyProgress(opts ec2.WaitOptions, progress ec2.WaitProgress) {
+	if opts.OnProgress != nil {
+		opts.OnProgress(progress)
+	}
+}
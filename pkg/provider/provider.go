@@ -0,0 +1,52 @@
+// Package provider abstracts the compute backend behind nodes and images, so
+// the API and CLI can run against EC2 or a stand-in such as the in-process
+// simulator.
+package provider
+
+import (
+	"context"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+)
+
+var ErrUnsupported = errkind.New(errkind.InvalidInput, "not supported by provider")
+
+// Provider manages the lifecycle of nodes and finds the images they boot.
+// Nodes and images are described with the EC2 types, which every provider
+// maps its own state onto.
+type Provider interface {
+	// Name identifies the provider, e.g. "ec2"
+	Name() string
+
+	image.AMIFinder
+	image.ImageLister
+
+	// AssignNodeName validates a requested name, or generates one when it
+	// is empty, and makes sure no live node carries it
+	AssignNodeName(ctx context.Context, requested string) (string, error)
+	// ResolveNode accepts a node ID or name and returns the node ID
+	ResolveNode(ctx context.Context, idOrName string) (string, error)
+
+	CreateNode(ctx context.Context, config ec2.CreateInstanceConfig) (ec2.InstanceInfo, error)
+	// CreateNodes launches one node per name from config, whose Name is
+	// ignored. It returns the nodes it launched; when they are fewer than
+	// the names, the error tells why the rest were not
+	CreateNodes(ctx context.Context, config ec2.CreateInstanceConfig, names []string) ([]ec2.InstanceInfo, error)
+	ListNodes(ctx context.Context) ([]ec2.InstanceInfo, error)
+	GetNode(ctx context.Context, instanceID string) (ec2.InstanceInfo, error)
+	DeleteNode(ctx context.Context, instanceID string) error
+	// PowerNode runs a power action, rejecting it with
+	// ec2.ErrInvalidStateTransition when the node is in the wrong state
+	PowerNode(ctx context.Context, instanceID string, action ec2.PowerAction) error
+	// WaitForNode follows the semantics of ec2.WaitForInstance, including
+	// its timeout and terminal state errors
+	WaitForNode(ctx context.Context, instanceID string, opts ec2.WaitOptions) (ec2.InstanceInfo, error)
+
+	// ConsoleOutput returns the serial console output of a node; latest
+	// asks for the most recent output where it is buffered, as on EC2
+	ConsoleOutput(ctx context.Context, instanceID string, latest bool) (ec2.ConsoleOutput, error)
+	// ConsoleScreenshot returns a screenshot of a node's display as a PNG
+	ConsoleScreenshot(ctx context.Context, instanceID string) ([]byte, error)
+}
@@ -0,0 +1,137 @@
+package qemu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// imageCacheDir is the directory in the state directory holding the images
+// node overlays are backed by, one directory per image ID.
+const imageCacheDir = "images"
+
+// rawImage is a raw disk image nodes can boot.
+type rawImage struct {
+	ID       string
+	Path     string
+	Arch     string
+	Modified time.Time
+}
+
+// scanImages lists the raw images in dir, newest first. Compressed images
+// in the build cache are skipped until the image builder decompressed them.
+func scanImages(dir string) ([]rawImage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read image directory: %w", err)
+	}
+
+	var images []rawImage
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".raw") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path, err := filepath.Abs(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, rawImage{
+			ID:       imageID(entry.Name(), info.Size(), info.ModTime()),
+			Path:     path,
+			Arch:     guestArch(entry.Name()),
+			Modified: info.ModTime(),
+		})
+	}
+	slices.SortFunc(images, func(a, b rawImage) int {
+		return b.Modified.Compare(a.Modified)
+	})
+	return images, nil
+}
+
+// imageID identifies an image by file name, size and modification time, so
+// a rebuilt image gets a new ID without hashing gigabytes of disk.
+func imageID(name string, size int64, modified time.Time) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d", name, size, modified.UnixNano())))
+	return "img-" + hex.EncodeToString(sum[:])[:17]
+}
+
+// ec2Image describes a raw image like an AMI.
+func (i rawImage) ec2Image() types.Image {
+	name := filepath.Base(i.Path)
+	return types.Image{
+		ImageId:            aws.String(i.ID),
+		Name:               aws.String(strings.TrimSuffix(name, ".raw")),
+		Description:        aws.String(i.Path),
+		State:              types.ImageStateAvailable,
+		Architecture:       ec2Architecture(i.Arch),
+		VirtualizationType: types.VirtualizationTypeHvm,
+		CreationDate:       aws.String(i.Modified.UTC().Format(time.RFC3339)),
+	}
+}
+
+// cacheImage copies a raw image into the image cache of stateDir and
+// returns the absolute path of the copy. Overlays are backed by the copy,
+// as the image pipeline rewrites the files in the image directory in place.
+// A rebuilt image gets a new ID and with it a copy of its own.
+func cacheImage(stateDir, id, path string) (string, error) {
+	dir, err := filepath.Abs(filepath.Join(stateDir, imageCacheDir, id))
+	if err != nil {
+		return "", err
+	}
+	cached := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+
+	source, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open image: %w", err)
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return "", fmt.Errorf("open image: %w", err)
+	}
+	if imageID(info.Name(), info.Size(), info.ModTime()) != id {
+		return "", fmt.Errorf("%w: %s was rebuilt", ErrImageNotFound, id)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create image cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".copy-*")
+	if err != nil {
+		return "", fmt.Errorf("create image copy: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, source); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("copy image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("copy image: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o444); err != nil {
+		return "", fmt.Errorf("copy image: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), cached); err != nil {
+		return "", fmt.Errorf("copy image: %w", err)
+	}
+	return cached, nil
+}
@@ -0,0 +1,746 @@
+// Package qemu is a compute provider that runs nodes as local QEMU virtual
+// machines booted from the raw images of the image pipeline, so images and
+// user-data can be tested without an AWS account.
+//
+// Every node gets a directory under the state directory holding a qcow2
+// overlay backed by a cached copy of the raw image, a NoCloud cloud-init seed and the serial
+// console log. Nodes reach the network through user-mode networking with SSH
+// forwarded to a loopback port, published in the SSHForward tag. QEMU runs
+// daemonized, so nodes keep running across restarts of the provider and
+// are picked up again from their directories.
+package qemu
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var ErrImageNotFound = errkind.New(errkind.NotFound, "image not found")
+
+// TagSSHForward holds the loopback address SSH of a node is forwarded to.
+const TagSSHForward = "SSHForward"
+
+const (
+	DefaultImageDir     = "build/images"
+	DefaultStateDir     = "data/qemu"
+	DefaultStopTimeout  = 2 * time.Minute
+	DefaultPollInterval = time.Second
+)
+
+// Environment variables read by FromEnv.
+const (
+	EnvImageDir = "TILMAN_QEMU_IMAGE_DIR"
+	EnvStateDir = "TILMAN_QEMU_STATE_DIR"
+	EnvAccel    = "TILMAN_QEMU_ACCEL"
+	EnvFirmware = "TILMAN_QEMU_FIRMWARE"
+)
+
+type Config struct {
+	// ImageDir holds the raw images nodes boot
+	ImageDir string
+	// StateDir holds one directory per node
+	StateDir string
+	// Accel is kvm or tcg; KVM is used when the host supports it if empty
+	Accel string
+	// Firmware is the UEFI firmware aarch64 guests boot from; the usual
+	// install locations are searched if empty
+	Firmware string
+	// StopTimeout is how long a guest may take to shut down before QEMU is
+	// killed
+	StopTimeout time.Duration
+	// PollInterval is how often running QEMU processes are checked
+	PollInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ImageDir:     DefaultImageDir,
+		StateDir:     DefaultStateDir,
+		StopTimeout:  DefaultStopTimeout,
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// FromEnv returns DefaultConfig with the directories, accelerator and
+// firmware overridden from the environment.
+func FromEnv() (Config, error) {
+	config := DefaultConfig()
+	if value := os.Getenv(EnvImageDir); value != "" {
+		config.ImageDir = value
+	}
+	if value := os.Getenv(EnvStateDir); value != "" {
+		config.StateDir = value
+	}
+	config.Firmware = os.Getenv(EnvFirmware)
+	switch accel := os.Getenv(EnvAccel); accel {
+	case "", "kvm", "tcg":
+		config.Accel = accel
+	default:
+		return Config{}, fmt.Errorf("invalid %s: %q, expected kvm or tcg", EnvAccel, accel)
+	}
+	return config, nil
+}
+
+// Provider runs nodes as QEMU processes. It is safe for concurrent use.
+type Provider struct {
+	config Config
+
+	mu    sync.Mutex
+	nodes map[string]*node
+	// changed is closed and replaced on every state change, waking up
+	// waiters
+	changed chan struct{}
+
+	// Process and QMP access, replaced in tests
+	run   func(ctx context.Context, name string, args ...string) error
+	alive func(pid int) bool
+	owns  func(pid int, instanceID, dir string) bool
+	kill  func(pid int) error
+	qmp   func(socket, command string) error
+	ready func(port int) bool
+}
+
+type node struct {
+	info      ec2.InstanceInfo
+	imagePath string
+	userData  string
+	sshPort   int
+	pid       int
+}
+
+// nodeState is what node.json persists of a node.
+type nodeState struct {
+	Info      ec2.InstanceInfo
+	ImagePath string
+	SSHPort   int
+}
+
+var _ provider.Provider = (*Provider)(nil)
+
+// New loads the nodes found in the state directory. Nodes whose QEMU
+// process still runs are running, all others stopped.
+func New(config Config) (*Provider, error) {
+	if config.StopTimeout <= 0 {
+		config.StopTimeout = DefaultStopTimeout
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	p := &Provider{
+		config:  config,
+		nodes:   make(map[string]*node),
+		changed: make(chan struct{}),
+		run:     runCommand,
+		alive:   processAlive,
+		owns:    nodeProcess,
+		kill:    killProcess,
+		qmp:     qmpExecute,
+		ready:   sshReady,
+	}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Provider) Name() string {
+	return "qemu"
+}
+
+func (p *Provider) FindLatestAMI(ctx context.Context) (string, error) {
+	images, err := scanImages(p.config.ImageDir)
+	if err != nil {
+		return "", err
+	}
+	if len(images) == 0 {
+		return "", fmt.Errorf("%w: no raw image in %s", image.ErrNoAMI, p.config.ImageDir)
+	}
+	return images[0].ID, nil
+}
+
+func (p *Provider) ListImages(ctx context.Context) ([]types.Image, error) {
+	images, err := scanImages(p.config.ImageDir)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]types.Image, 0, len(images))
+	for _, img := range images {
+		result = append(result, img.ec2Image())
+	}
+	return result, nil
+}
+
+func (p *Provider) AssignNodeName(ctx context.Context, requested string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return provider.AssignName(requested, func(name string) bool {
+		return len(p.liveNodesNamed(name)) > 0
+	})
+}
+
+func (p *Provider) ResolveNode(ctx context.Context, idOrName string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return provider.ResolveName(idOrName, p.liveNodesNamed)
+}
+
+// CreateNode returns the node in pending; the overlay, seed and QEMU
+// process are set up in the background.
+func (p *Provider) CreateNode(ctx context.Context, config ec2.CreateInstanceConfig) (ec2.InstanceInfo, error) {
+	if config.Spot != nil {
+		return ec2.InstanceInfo{}, fmt.Errorf("%w: spot instances", provider.ErrUnsupported)
+	}
+	if config.KeyName != "" {
+		return ec2.InstanceInfo{}, fmt.Errorf("%w: key pairs", provider.ErrUnsupported)
+	}
+	images, err := scanImages(p.config.ImageDir)
+	if err != nil {
+		return ec2.InstanceInfo{}, err
+	}
+	idx := slices.IndexFunc(images, func(img rawImage) bool { return img.ID == config.ImageID })
+	if idx < 0 {
+		return ec2.InstanceInfo{}, fmt.Errorf("%w: %s", ErrImageNotFound, config.ImageID)
+	}
+	img := images[idx]
+	port, err := freePort()
+	if err != nil {
+		return ec2.InstanceInfo{}, err
+	}
+
+	instanceType := config.InstanceType
+	if instanceType == "" {
+		instanceType = types.InstanceTypeT4gMicro
+	}
+	tags := map[string]string{ec2.TagManagedBy: ec2.ManagedByValue}
+	for key, value := range config.Tags {
+		tags[key] = value
+	}
+	if config.Name != "" {
+		tags[ec2.TagName] = config.Name
+	}
+	tags[TagSSHForward] = "127.0.0.1:" + strconv.Itoa(port)
+
+	n := &node{
+		info: ec2.InstanceInfo{
+			InstanceID:       newInstanceID(),
+			Name:             config.Name,
+			State:            string(types.InstanceStateNamePending),
+			InstanceType:     string(instanceType),
+			PrivateIP:        guestPrivateIP,
+			LaunchTime:       time.Now().UTC(),
+			AvailabilityZone: "local",
+			AMIID:            img.ID,
+			Architecture:     string(ec2Architecture(img.Arch)),
+			Tags:             tags,
+			Lifecycle:        "on-demand",
+		},
+		imagePath: img.Path,
+		userData:  config.UserData,
+		sshPort:   port,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nodes[n.info.InstanceID] = n
+	if err := p.save(n); err != nil {
+		delete(p.nodes, n.info.InstanceID)
+		return ec2.InstanceInfo{}, err
+	}
+	p.notify()
+	go p.launch(n.info.InstanceID, true)
+
+	slog.Info("QEMU node created", "instance_id", n.info.InstanceID, "name", n.info.Name, "image", img.Path, "ssh_port", port)
+	return cloneInfo(n.info), nil
+}
+
+func (p *Provider) CreateNodes(ctx context.Context, config ec2.CreateInstanceConfig, names []string) ([]ec2.InstanceInfo, error) {
+	return provider.CreateEach(ctx, config, names, p.CreateNode)
+}
+
+func (p *Provider) ListNodes(ctx context.Context) ([]ec2.InstanceInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var instances []ec2.InstanceInfo
+	for _, n := range p.nodes {
+		if isGone(n.info.State) {
+			continue
+		}
+		instances = append(instances, cloneInfo(n.info))
+	}
+	slices.SortFunc(instances, func(a, b ec2.InstanceInfo) int {
+		return a.LaunchTime.Compare(b.LaunchTime)
+	})
+	return instances, nil
+}
+
+func (p *Provider) GetNode(ctx context.Context, instanceID string) (ec2.InstanceInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		return ec2.InstanceInfo{}, fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+	}
+	return cloneInfo(n.info), nil
+}
+
+// DeleteNode kills QEMU and removes the node directory in the background.
+func (p *Provider) DeleteNode(ctx context.Context, instanceID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+	}
+	if isGone(n.info.State) {
+		return nil
+	}
+	n.setReason("Client.UserInitiatedShutdown", "User initiated shutdown")
+	p.setState(n, types.InstanceStateNameShuttingDown)
+	go p.terminate(instanceID)
+	return nil
+}
+
+func (p *Provider) PowerNode(ctx context.Context, instanceID string, action ec2.PowerAction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+	}
+	if action == ec2.PowerActionHibernate {
+		return fmt.Errorf("%w: hibernation", provider.ErrUnsupported)
+	}
+	if err := ec2.ValidatePowerTransition(action, n.info.State); err != nil {
+		return err
+	}
+
+	socket := filepath.Join(p.nodeDir(instanceID), qmpSocket)
+	switch action {
+	case ec2.PowerActionStart:
+		n.setReason("", "")
+		p.setState(n, types.InstanceStateNamePending)
+		go p.launch(instanceID, false)
+	case ec2.PowerActionStop:
+		// ACPI shutdown lets the guest stop cleanly; QEMU exits once it
+		// powered off
+		if err := p.qmp(socket, "system_powerdown"); err != nil {
+			return fmt.Errorf("failed to stop node: %w", err)
+		}
+		n.setReason("Client.UserInitiatedShutdown", "User initiated shutdown")
+		p.setState(n, types.InstanceStateNameStopping)
+		go p.killAfter(instanceID, n.pid, p.config.StopTimeout)
+	case ec2.PowerActionForceStop:
+		if n.pid != 0 {
+			if err := p.kill(n.pid); err != nil {
+				return fmt.Errorf("failed to force stop node: %w", err)
+			}
+		}
+		n.setReason("Client.UserInitiatedShutdown", "User initiated forced shutdown")
+		p.setState(n, types.InstanceStateNameStopping)
+	case ec2.PowerActionReboot:
+		if err := p.qmp(socket, "system_reset"); err != nil {
+			return fmt.Errorf("failed to reboot node: %w", err)
+		}
+	}
+	return nil
+}
+
+// WaitForNode waits for the node to reach one of the target states. Status
+// checks pass once the guest SSH server answers.
+func (p *Provider) WaitForNode(ctx context.Context, instanceID string, opts ec2.WaitOptions) (ec2.InstanceInfo, error) {
+	return provider.WaitForState(ctx, instanceID, opts, func() (ec2.InstanceInfo, bool, <-chan struct{}) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		n, found := p.nodes[instanceID]
+		if !found {
+			return ec2.InstanceInfo{}, false, p.changed
+		}
+		return cloneInfo(n.info), true, p.changed
+	}, func(info ec2.InstanceInfo) bool {
+		p.mu.Lock()
+		n, found := p.nodes[info.InstanceID]
+		port := 0
+		if found {
+			port = n.sshPort
+		}
+		p.mu.Unlock()
+		return port != 0 && p.ready(port)
+	})
+}
+
+// ConsoleOutput reads the serial console log of a node, limited to the most
+// recent ec2.MaxConsoleOutput bytes as on EC2. The log is written as the
+// guest prints, so the output is always the latest.
+func (p *Provider) ConsoleOutput(ctx context.Context, instanceID string, latest bool) (ec2.ConsoleOutput, error) {
+	p.mu.Lock()
+	_, ok := p.nodes[instanceID]
+	p.mu.Unlock()
+	if !ok {
+		return ec2.ConsoleOutput{}, fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+	}
+
+	output := ec2.ConsoleOutput{InstanceID: instanceID}
+	path := filepath.Join(p.nodeDir(instanceID), consoleFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// The node has not been started yet or was removed
+		return output, nil
+	}
+	if err != nil {
+		return ec2.ConsoleOutput{}, fmt.Errorf("failed to read console log: %w", err)
+	}
+	output.Output = string(data[max(0, len(data)-ec2.MaxConsoleOutput):])
+	if info, err := os.Stat(path); err == nil && len(data) > 0 {
+		output.Timestamp = info.ModTime().UTC()
+	}
+	return output, nil
+}
+
+// ConsoleScreenshot is not supported, nodes run without a display. Their
+// serial console is in ConsoleOutput.
+func (p *Provider) ConsoleScreenshot(ctx context.Context, instanceID string) ([]byte, error) {
+	return nil, fmt.Errorf("%w: console screenshots", provider.ErrUnsupported)
+}
+
+// launch starts QEMU for a pending node, first creating its overlay and
+// seed when the node is new. A failed launch terminates a new node and
+// stops an existing one, with the error as state reason.
+func (p *Provider) launch(instanceID string, create bool) {
+	p.mu.Lock()
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	info := cloneInfo(n.info)
+	imagePath, userData := n.imagePath, n.userData
+	if !portFree(n.sshPort) {
+		if port, err := freePort(); err == nil {
+			n.sshPort = port
+			n.info.Tags[TagSSHForward] = "127.0.0.1:" + strconv.Itoa(port)
+		}
+	}
+	port := n.sshPort
+	p.mu.Unlock()
+
+	pid, err := p.startVM(info, imagePath, userData, port, create)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n.info.State != string(types.InstanceStateNamePending) {
+		// Deleted while launching; terminate cleans up
+		if err == nil {
+			p.kill(pid)
+		}
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to launch QEMU node", "instance_id", instanceID, "error", err)
+		n.setReason("Server.InternalError", err.Error())
+		if create {
+			p.setState(n, types.InstanceStateNameTerminated)
+			os.RemoveAll(p.nodeDir(instanceID))
+			return
+		}
+		p.setState(n, types.InstanceStateNameStopped)
+		p.save(n)
+		return
+	}
+	n.pid = pid
+	p.setState(n, types.InstanceStateNameRunning)
+	p.save(n)
+	go p.monitor(instanceID, pid)
+}
+
+func (p *Provider) startVM(info ec2.InstanceInfo, imagePath, userData string, port int, create bool) (int, error) {
+	ctx := context.Background()
+	dir := p.nodeDir(info.InstanceID)
+	arch := guestArch(imagePath)
+
+	if create {
+		hostname := info.Name
+		if hostname == "" {
+			hostname = info.InstanceID
+		}
+		if err := writeSeed(dir, info.InstanceID, hostname, userData); err != nil {
+			return 0, err
+		}
+		backing, err := cacheImage(p.config.StateDir, info.AMIID, imagePath)
+		if err != nil {
+			return 0, err
+		}
+		if err := p.run(ctx, "qemu-img", "create", "-q", "-f", "qcow2", "-F", "raw", "-b", backing, filepath.Join(dir, diskFile)); err != nil {
+			return 0, fmt.Errorf("create overlay: %w", err)
+		}
+	}
+
+	spec := vmSpec{
+		Name:      info.InstanceID,
+		Dir:       dir,
+		Arch:      arch,
+		Accel:     p.config.Accel,
+		Firmware:  p.config.Firmware,
+		Resources: instanceResources(types.InstanceType(info.InstanceType)),
+		SSHPort:   port,
+	}
+	if spec.Accel == "" {
+		spec.Accel = "tcg"
+		if kvmAvailable(arch) {
+			spec.Accel = "kvm"
+		}
+	}
+	if arch == "aarch64" && spec.Firmware == "" {
+		firmware, err := findFirmware()
+		if err != nil {
+			return 0, err
+		}
+		spec.Firmware = firmware
+	}
+	os.Remove(filepath.Join(dir, pidFile))
+	if err := p.run(ctx, "qemu-system-"+arch, spec.args()...); err != nil {
+		return 0, fmt.Errorf("start QEMU: %w", err)
+	}
+	pid, err := readPID(dir)
+	if err != nil {
+		return 0, fmt.Errorf("read QEMU PID: %w", err)
+	}
+	slog.Info("QEMU started", "instance_id", info.InstanceID, "pid", pid, "accel", spec.Accel, "ssh_port", port)
+	return pid, nil
+}
+
+// monitor waits for the QEMU process of a node to exit. An exit the API did
+// not ask for means the guest shut itself down.
+func (p *Provider) monitor(instanceID string, pid int) {
+	ticker := time.NewTicker(p.config.PollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if p.alive(pid) {
+			continue
+		}
+
+		p.mu.Lock()
+		n, ok := p.nodes[instanceID]
+		if ok && n.pid == pid {
+			n.pid = 0
+			switch types.InstanceStateName(n.info.State) {
+			case types.InstanceStateNameRunning:
+				n.setReason("Client.InstanceInitiatedShutdown", "Instance initiated shutdown")
+				p.setState(n, types.InstanceStateNameStopped)
+				p.save(n)
+			case types.InstanceStateNameStopping:
+				p.setState(n, types.InstanceStateNameStopped)
+				p.save(n)
+			}
+			slog.Info("QEMU exited", "instance_id", instanceID, "pid", pid)
+		}
+		p.mu.Unlock()
+		return
+	}
+}
+
+// killAfter kills QEMU when the guest did not shut down within timeout.
+func (p *Provider) killAfter(instanceID string, pid int, timeout time.Duration) {
+	time.Sleep(timeout)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n, ok := p.nodes[instanceID]
+	if ok && n.pid == pid && pid != 0 && n.info.State == string(types.InstanceStateNameStopping) {
+		slog.Warn("Guest did not shut down in time, killing QEMU", "instance_id", instanceID, "pid", pid)
+		p.kill(pid)
+	}
+}
+
+// terminate kills QEMU, waits for it to exit and removes the node
+// directory.
+func (p *Provider) terminate(instanceID string) {
+	p.mu.Lock()
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	pid := n.pid
+	p.mu.Unlock()
+
+	if pid != 0 {
+		p.kill(pid)
+		for p.alive(pid) {
+			time.Sleep(p.config.PollInterval)
+		}
+	}
+	if err := os.RemoveAll(p.nodeDir(instanceID)); err != nil {
+		slog.Warn("Failed to remove node directory", "instance_id", instanceID, "error", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n.pid = 0
+	p.setState(n, types.InstanceStateNameTerminated)
+	p.pruneImageCache()
+}
+
+// pruneImageCache removes the cached images no node is backed by anymore.
+// The caller holds p.mu.
+func (p *Provider) pruneImageCache() {
+	dir := filepath.Join(p.config.StateDir, imageCacheDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	used := make(map[string]bool)
+	for _, n := range p.nodes {
+		if !isGone(n.info.State) {
+			used[n.info.AMIID] = true
+		}
+	}
+	for _, entry := range entries {
+		if used[entry.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			slog.Warn("Failed to remove cached image", "image", entry.Name(), "error", err)
+		}
+	}
+}
+
+// load picks up the nodes of earlier runs from the state directory.
+func (p *Provider) load() error {
+	entries, err := os.ReadDir(p.config.StateDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read state directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(p.config.StateDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, nodeFile))
+		if err != nil {
+			continue
+		}
+		var state nodeState
+		if err := json.Unmarshal(data, &state); err != nil {
+			slog.Warn("Skipping unreadable QEMU node", "dir", dir, "error", err)
+			continue
+		}
+		n := &node{info: state.Info, imagePath: state.ImagePath, sshPort: state.SSHPort}
+		// The PID file outlives a crashed QEMU, and its PID may have been
+		// reused by an unrelated process since
+		if pid, err := readPID(dir); err == nil && p.alive(pid) && p.owns(pid, n.info.InstanceID, dir) {
+			n.pid = pid
+			n.info.State = string(types.InstanceStateNameRunning)
+			go p.monitor(n.info.InstanceID, pid)
+		} else {
+			n.info.State = string(types.InstanceStateNameStopped)
+		}
+		p.nodes[n.info.InstanceID] = n
+	}
+	slog.Info("Loaded QEMU nodes", "count", len(p.nodes), "state_dir", p.config.StateDir)
+	return nil
+}
+
+// save writes node.json. The caller holds p.mu.
+func (p *Provider) save(n *node) error {
+	dir := p.nodeDir(n.info.InstanceID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create node directory: %w", err)
+	}
+	data, err := json.MarshalIndent(nodeState{Info: n.info, ImagePath: n.imagePath, SSHPort: n.sshPort}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, nodeFile), data, 0o644); err != nil {
+		return fmt.Errorf("write node state: %w", err)
+	}
+	return nil
+}
+
+func (p *Provider) nodeDir(instanceID string) string {
+	return filepath.Join(p.config.StateDir, instanceID)
+}
+
+// setState moves the node to state and wakes up waiters. The caller holds
+// p.mu.
+func (p *Provider) setState(n *node, state types.InstanceStateName) {
+	n.info.State = string(state)
+	p.notify()
+}
+
+// setReason records why the node left its last state, formatted like the
+// EC2 state reason message; an empty code clears it.
+func (n *node) setReason(code, message string) {
+	n.info.StateReasonCode = code
+	n.info.StateReason = ""
+	if code != "" {
+		n.info.StateReason = code + ": " + message
+	}
+}
+
+func (p *Provider) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// liveNodesNamed returns the IDs of nodes carrying name that are not
+// shutting down or terminated. The caller holds p.mu.
+func (p *Provider) liveNodesNamed(name string) []string {
+	var ids []string
+	for id, n := range p.nodes {
+		if n.info.Name == name && !isGone(n.info.State) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func isGone(state string) bool {
+	return state == string(types.InstanceStateNameShuttingDown) || state == string(types.InstanceStateNameTerminated)
+}
+
+func cloneInfo(info ec2.InstanceInfo) ec2.InstanceInfo {
+	info.Tags = maps.Clone(info.Tags)
+	return info
+}
+
+func newInstanceID() string {
+	b := make([]byte, 9)
+	rand.Read(b)
+	return "i-" + hex.EncodeToString(b)[:17]
+}
+
+// runCommand runs a command to completion, returning its output on failure.
+func runCommand(ctx context.Context, name string, args ...string) error {
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, output)
+	}
+	return nil
+}
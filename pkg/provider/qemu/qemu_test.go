@@ -0,0 +1,351 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// fakeHost stands in for qemu-img, QEMU processes and QMP.
+type fakeHost struct {
+	mu       sync.Mutex
+	commands [][]string
+	running  map[int]bool
+	nextPID  int
+	qmp      []string
+}
+
+func newTestProvider(t *testing.T) (*Provider, *fakeHost) {
+	t.Helper()
+	imageDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(imageDir, "Fedora-Cloud-Base-43-1.6.aarch64.raw"), []byte("disk"), 0o644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	p, err := New(Config{
+		ImageDir:     imageDir,
+		StateDir:     t.TempDir(),
+		Accel:        "tcg",
+		Firmware:     "/firmware.fd",
+		StopTimeout:  time.Minute,
+		PollInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	host := &fakeHost{running: make(map[int]bool), nextPID: 1000}
+	p.run = host.run
+	p.alive = host.alive
+	p.owns = func(pid int, instanceID, dir string) bool { return host.alive(pid) }
+	p.kill = host.kill
+	p.qmp = host.execute
+	p.ready = func(port int) bool { return true }
+	return p, host
+}
+
+func (h *fakeHost) run(ctx context.Context, name string, args ...string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.commands = append(h.commands, append([]string{name}, args...))
+	if name == "qemu-img" {
+		return os.WriteFile(args[len(args)-1], nil, 0o644)
+	}
+	pidPath := args[slices.Index(args, "-pidfile")+1]
+	h.nextPID++
+	h.running[h.nextPID] = true
+	return os.WriteFile(pidPath, []byte(strconv.Itoa(h.nextPID)+"\n"), 0o644)
+}
+
+func (h *fakeHost) alive(pid int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.running[pid]
+}
+
+func (h *fakeHost) kill(pid int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.running, pid)
+	return nil
+}
+
+// execute powers the guest off right away on system_powerdown.
+func (h *fakeHost) execute(socket, command string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.qmp = append(h.qmp, command)
+	if command == "system_powerdown" {
+		for pid := range h.running {
+			delete(h.running, pid)
+		}
+	}
+	return nil
+}
+
+func waitFor(t *testing.T, p *Provider, instanceID string, target types.InstanceStateName) ec2.InstanceInfo {
+	t.Helper()
+	info, err := p.WaitForNode(context.Background(), instanceID, ec2.WaitOptions{
+		TargetStates:        []types.InstanceStateName{target},
+		Timeout:             time.Second,
+		InitialInterval:     5 * time.Millisecond,
+		RequireStatusChecks: target == types.InstanceStateNameRunning,
+	})
+	if err != nil {
+		t.Fatalf("expected no error waiting for %s, got %v", target, err)
+	}
+	return info
+}
+
+func TestProvider_Lifecycle(t *testing.T) {
+	p, host := newTestProvider(t)
+	ctx := context.Background()
+
+	amiID, err := p.FindLatestAMI(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	info, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{Name: "web", ImageID: amiID, UserData: "#cloud-config\npackages: [nginx]\n"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.State != "pending" || info.Architecture != "arm64" || !strings.HasPrefix(info.Tags[TagSSHForward], "127.0.0.1:") {
+		t.Errorf("unexpected node %+v", info)
+	}
+
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameRunning)
+	dir := p.nodeDir(info.InstanceID)
+	userData, err := os.ReadFile(filepath.Join(dir, seedDir, "user-data"))
+	if err != nil || !strings.Contains(string(userData), "nginx") {
+		t.Errorf("expected the user-data in the seed, got %q, %v", userData, err)
+	}
+	if len(host.commands) != 2 || host.commands[0][0] != "qemu-img" || host.commands[1][0] != "qemu-system-aarch64" {
+		t.Fatalf("expected an overlay and a QEMU process, got %v", host.commands)
+	}
+	if args := strings.Join(host.commands[1], " "); !strings.Contains(args, "-bios /firmware.fd") || !strings.Contains(args, "file.label=CIDATA") {
+		t.Errorf("unexpected QEMU arguments %s", args)
+	}
+
+	if err := p.PowerNode(ctx, info.InstanceID, ec2.PowerActionStop); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameStopped)
+
+	if err := p.PowerNode(ctx, info.InstanceID, ec2.PowerActionStart); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameRunning)
+	if len(host.commands) != 3 || host.commands[2][0] != "qemu-system-aarch64" {
+		t.Errorf("expected a restart without a new overlay, got %v", host.commands)
+	}
+
+	if err := p.DeleteNode(ctx, info.InstanceID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameTerminated)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the node directory to be removed, got %v", err)
+	}
+}
+
+func TestProvider_BackingImageCache(t *testing.T) {
+	p, host := newTestProvider(t)
+	ctx := context.Background()
+	amiID, _ := p.FindLatestAMI(ctx)
+	info, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{Name: "web", ImageID: amiID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameRunning)
+
+	create := host.commands[0]
+	backing := create[slices.Index(create, "-b")+1]
+	if filepath.Dir(filepath.Dir(backing)) != filepath.Join(p.config.StateDir, imageCacheDir) {
+		t.Fatalf("expected the overlay to be backed by the image cache, got %s", backing)
+	}
+
+	// Rebuilding the image leaves the backing file of the node alone
+	images, _ := scanImages(p.config.ImageDir)
+	if err := os.WriteFile(images[0].Path, []byte("rebuilt"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite image: %v", err)
+	}
+	if data, err := os.ReadFile(backing); err != nil || string(data) != "disk" {
+		t.Errorf("expected the cached copy to be unchanged, got %q (%v)", data, err)
+	}
+
+	if err := p.DeleteNode(ctx, info.InstanceID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameTerminated)
+	if _, err := os.Stat(filepath.Dir(backing)); !os.IsNotExist(err) {
+		t.Errorf("expected the unused cached image to be removed, got %v", err)
+	}
+}
+
+func TestProvider_GuestShutdown(t *testing.T) {
+	p, host := newTestProvider(t)
+	ctx := context.Background()
+	amiID, _ := p.FindLatestAMI(ctx)
+	info, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{ImageID: amiID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameRunning)
+
+	// The guest powers itself off
+	host.mu.Lock()
+	clear(host.running)
+	host.mu.Unlock()
+
+	info = waitFor(t, p, info.InstanceID, types.InstanceStateNameStopped)
+	if info.StateReasonCode != "Client.InstanceInitiatedShutdown" {
+		t.Errorf("expected an instance initiated shutdown, got %q", info.StateReasonCode)
+	}
+}
+
+func TestProvider_Reload(t *testing.T) {
+	p, _ := newTestProvider(t)
+	ctx := context.Background()
+	amiID, _ := p.FindLatestAMI(ctx)
+	info, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{Name: "db", ImageID: amiID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameRunning)
+	if err := p.PowerNode(ctx, info.InstanceID, ec2.PowerActionStop); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameStopped)
+
+	reloaded, err := New(p.config)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, err := reloaded.GetNode(ctx, info.InstanceID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.Name != "db" || got.State != "stopped" || got.Tags[TagSSHForward] != info.Tags[TagSSHForward] {
+		t.Errorf("expected the stopped node to be reloaded, got %+v", got)
+	}
+}
+
+func TestProvider_Reload_StalePID(t *testing.T) {
+	p, _ := newTestProvider(t)
+	ctx := context.Background()
+	amiID, _ := p.FindLatestAMI(ctx)
+	info, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{Name: "db", ImageID: amiID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameRunning)
+
+	// QEMU crashed and its PID went to a process that is not QEMU
+	pidPath := filepath.Join(p.nodeDir(info.InstanceID), pidFile)
+	if err := os.WriteFile(pidPath, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write PID file: %v", err)
+	}
+
+	reloaded, err := New(p.config)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, err := reloaded.GetNode(ctx, info.InstanceID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.State != "stopped" {
+		t.Errorf("expected a node with a stale PID file to be stopped, got %s", got.State)
+	}
+}
+
+func TestProvider_LaunchFailure(t *testing.T) {
+	p, _ := newTestProvider(t)
+	p.run = func(ctx context.Context, name string, args ...string) error {
+		return errors.New("qemu-img: not found")
+	}
+	ctx := context.Background()
+	amiID, _ := p.FindLatestAMI(ctx)
+	info, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{ImageID: amiID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, err = p.WaitForNode(ctx, info.InstanceID, ec2.WaitOptions{
+		TargetStates: []types.InstanceStateName{types.InstanceStateNameRunning},
+		Timeout:      time.Second,
+	})
+	var terminalErr *ec2.TerminalStateError
+	if !errors.As(err, &terminalErr) || !strings.Contains(terminalErr.Reason, "qemu-img: not found") {
+		t.Errorf("expected a TerminalStateError with the launch error, got %v", err)
+	}
+}
+
+func TestProvider_Unsupported(t *testing.T) {
+	p, _ := newTestProvider(t)
+	ctx := context.Background()
+	amiID, _ := p.FindLatestAMI(ctx)
+
+	if _, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{ImageID: amiID, Spot: &ec2.SpotOptions{}}); !errors.Is(err, provider.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for spot, got %v", err)
+	}
+	if _, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{ImageID: "img-unknown"}); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("expected ErrImageNotFound, got %v", err)
+	}
+}
+
+func TestInstanceResources(t *testing.T) {
+	if got := instanceResources(types.InstanceTypeT4gMicro); got != (resources{CPUs: 2, MemoryMiB: 1024}) {
+		t.Errorf("unexpected resources for t4g.micro: %+v", got)
+	}
+	if got := instanceResources("custom"); got != (resources{CPUs: 2, MemoryMiB: 2048}) {
+		t.Errorf("unexpected default resources: %+v", got)
+	}
+}
+
+func TestGuestArch(t *testing.T) {
+	if arch := guestArch("Fedora-Cloud-Base-43-1.6.x86_64.raw"); arch != "x86_64" {
+		t.Errorf("expected x86_64, got %s", arch)
+	}
+	if arch := guestArch("Fedora-Cloud-Base-AmazonEC2-43-1.6.aarch64.raw"); arch != "aarch64" {
+		t.Errorf("expected aarch64, got %s", arch)
+	}
+}
+
+func TestProvider_ConsoleOutput(t *testing.T) {
+	p, _ := newTestProvider(t)
+	ctx := context.Background()
+	amiID, _ := p.FindLatestAMI(ctx)
+	info, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{Name: "web", ImageID: amiID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameRunning)
+
+	log := filepath.Join(p.nodeDir(info.InstanceID), consoleFile)
+	if err := os.WriteFile(log, []byte("web login: \n"), 0o644); err != nil {
+		t.Fatalf("failed to write console log: %v", err)
+	}
+	output, err := p.ConsoleOutput(ctx, info.InstanceID, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if output.Output != "web login: \n" || output.Timestamp.IsZero() {
+		t.Errorf("expected the console log, got %+v", output)
+	}
+	if _, err := p.ConsoleScreenshot(ctx, info.InstanceID); !errors.Is(err, provider.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for screenshots, got %v", err)
+	}
+	if _, err := p.ConsoleOutput(ctx, "i-unknown", false); !errors.Is(err, ec2.ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+}
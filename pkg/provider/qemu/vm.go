@@ -0,0 +1,314 @@
+package qemu
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Files kept in the directory of every node.
+const (
+	nodeFile    = "node.json"
+	diskFile    = "disk.qcow2"
+	seedDir     = "seed"
+	consoleFile = "console.log"
+	qmpSocket   = "qmp.sock"
+	pidFile     = "qemu.pid"
+)
+
+// guestPrivateIP is the address QEMU user-mode networking hands the guest.
+const guestPrivateIP = "10.0.2.15"
+
+// firmwarePaths are where distributions install the UEFI firmware that
+// aarch64 guests boot from.
+var firmwarePaths = []string{
+	"/usr/share/AAVMF/AAVMF_CODE.fd",
+	"/usr/share/edk2/aarch64/QEMU_EFI.fd",
+	"/usr/share/qemu/edk2-aarch64-code.fd",
+	"/opt/homebrew/share/qemu/edk2-aarch64-code.fd",
+}
+
+// resources are the vCPUs and memory of a node.
+type resources struct {
+	CPUs      int
+	MemoryMiB int
+}
+
+// instanceResources sizes a node after the size of its instance type, e.g.
+// the micro in t4g.micro, so local nodes roughly match their EC2 peers.
+func instanceResources(instanceType types.InstanceType) resources {
+	_, size, _ := strings.Cut(string(instanceType), ".")
+	switch size {
+	case "nano":
+		return resources{CPUs: 1, MemoryMiB: 512}
+	case "micro":
+		return resources{CPUs: 2, MemoryMiB: 1024}
+	case "small":
+		return resources{CPUs: 2, MemoryMiB: 2048}
+	case "medium":
+		return resources{CPUs: 2, MemoryMiB: 4096}
+	case "large":
+		return resources{CPUs: 2, MemoryMiB: 8192}
+	case "xlarge":
+		return resources{CPUs: 4, MemoryMiB: 16384}
+	}
+	return resources{CPUs: 2, MemoryMiB: 2048}
+}
+
+// guestArch derives the architecture of a raw image from its file name,
+// falling back to the host architecture.
+func guestArch(imagePath string) string {
+	name := strings.ToLower(filepath.Base(imagePath))
+	switch {
+	case strings.Contains(name, "aarch64"), strings.Contains(name, "arm64"):
+		return "aarch64"
+	case strings.Contains(name, "x86_64"), strings.Contains(name, "amd64"):
+		return "x86_64"
+	}
+	return hostArch()
+}
+
+func hostArch() string {
+	if runtime.GOARCH == "arm64" {
+		return "aarch64"
+	}
+	return "x86_64"
+}
+
+// ec2Architecture maps a QEMU architecture to the EC2 one.
+func ec2Architecture(arch string) types.ArchitectureValues {
+	if arch == "aarch64" {
+		return types.ArchitectureValuesArm64
+	}
+	return types.ArchitectureValuesX8664
+}
+
+// kvmAvailable reports whether guests of arch can use KVM on this host.
+func kvmAvailable(arch string) bool {
+	if arch != hostArch() {
+		return false
+	}
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// findFirmware returns the first installed UEFI firmware.
+func findFirmware() (string, error) {
+	for _, path := range firmwarePaths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no aarch64 UEFI firmware found in %s; set %s", strings.Join(firmwarePaths, ", "), EnvFirmware)
+}
+
+// vmSpec is everything needed to start the QEMU process of a node.
+type vmSpec struct {
+	Name      string
+	Dir       string
+	Arch      string
+	Accel     string
+	Firmware  string
+	Resources resources
+	SSHPort   int
+}
+
+// args returns the QEMU command line. The node boots its copy-on-write
+// overlay, reads cloud-init from a NoCloud seed exposed as a FAT drive
+// labelled cidata, and reaches the network through user-mode networking
+// with SSH forwarded to SSHPort on the loopback interface. QEMU daemonizes
+// once the guest is started and writes its PID file.
+func (s vmSpec) args() []string {
+	args := []string{"-name", s.Name}
+	switch s.Arch {
+	case "aarch64":
+		args = append(args, "-machine", "virt")
+		if s.Firmware != "" {
+			args = append(args, "-bios", s.Firmware)
+		}
+	default:
+		args = append(args, "-machine", "q35")
+	}
+	if s.Accel == "kvm" {
+		args = append(args, "-accel", "kvm", "-cpu", "host")
+	} else {
+		args = append(args, "-accel", "tcg", "-cpu", "max")
+	}
+	args = append(args,
+		"-smp", strconv.Itoa(s.Resources.CPUs),
+		"-m", strconv.Itoa(s.Resources.MemoryMiB),
+		"-drive", "if=virtio,format=qcow2,file="+filepath.Join(s.Dir, diskFile),
+		"-drive", "if=virtio,format=raw,readonly=on,file.driver=vvfat,file.dir="+filepath.Join(s.Dir, seedDir)+",file.label=CIDATA",
+		"-smbios", "type=1,serial=ds=nocloud",
+		"-netdev", fmt.Sprintf("user,id=net0,hostfwd=tcp:127.0.0.1:%d-:22", s.SSHPort),
+		"-device", "virtio-net-pci,netdev=net0",
+		"-display", "none",
+		"-serial", "file:"+filepath.Join(s.Dir, consoleFile),
+		"-qmp", "unix:"+filepath.Join(s.Dir, qmpSocket)+",server=on,wait=off",
+		"-pidfile", filepath.Join(s.Dir, pidFile),
+		"-daemonize",
+	)
+	return args
+}
+
+// writeSeed writes the NoCloud meta-data and user-data of a node.
+func writeSeed(dir, instanceID, hostname, userData string) error {
+	seed := filepath.Join(dir, seedDir)
+	if err := os.MkdirAll(seed, 0o755); err != nil {
+		return fmt.Errorf("create seed directory: %w", err)
+	}
+	metaData := fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", instanceID, hostname)
+	if err := os.WriteFile(filepath.Join(seed, "meta-data"), []byte(metaData), 0o644); err != nil {
+		return fmt.Errorf("write meta-data: %w", err)
+	}
+	if userData == "" {
+		userData = "#cloud-config\n"
+	}
+	if err := os.WriteFile(filepath.Join(seed, "user-data"), []byte(userData), 0o644); err != nil {
+		return fmt.Errorf("write user-data: %w", err)
+	}
+	return nil
+}
+
+// freePort returns a loopback TCP port nothing listens on.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("find a free port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// portFree reports whether nothing listens on a loopback port.
+func portFree(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// sshReady reports whether the guest SSH server answers on the forwarded
+// port. User-mode networking accepts the connection before the guest does,
+// so only the SSH banner proves the guest is up.
+func sshReady(port int) bool {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	return err == nil && strings.HasPrefix(banner, "SSH-")
+}
+
+// qmpExecute runs one command on the QEMU machine protocol socket.
+func qmpExecute(socket, command string) error {
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("connect to QMP: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+	var greeting map[string]json.RawMessage
+	if err := decoder.Decode(&greeting); err != nil {
+		return fmt.Errorf("read QMP greeting: %w", err)
+	}
+	for _, execute := range []string{"qmp_capabilities", command} {
+		if err := encoder.Encode(map[string]string{"execute": execute}); err != nil {
+			return fmt.Errorf("send QMP %s: %w", execute, err)
+		}
+		if err := readQMPReply(decoder); err != nil {
+			return fmt.Errorf("QMP %s: %w", execute, err)
+		}
+	}
+	return nil
+}
+
+// readQMPReply skips asynchronous events up to the reply of the last
+// command.
+func readQMPReply(decoder *json.Decoder) error {
+	for {
+		var reply struct {
+			Event  string           `json:"event"`
+			Return *json.RawMessage `json:"return"`
+			Error  *struct {
+				Desc string `json:"desc"`
+			} `json:"error"`
+		}
+		if err := decoder.Decode(&reply); err != nil {
+			return err
+		}
+		switch {
+		case reply.Error != nil:
+			return fmt.Errorf("%s", reply.Error.Desc)
+		case reply.Return != nil:
+			return nil
+		}
+	}
+}
+
+// processAlive reports whether a process with pid exists.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// nodeProcess reports whether pid is the QEMU process of the node with
+// instanceID, judged by its command line. Without procfs, e.g. on macOS,
+// only that process answers on the QMP socket in dir.
+func nodeProcess(pid int, instanceID, dir string) bool {
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		if _, err := os.Stat("/proc/self"); err != nil {
+			return qmpExecute(filepath.Join(dir, qmpSocket), "query-status") == nil
+		}
+		return false
+	}
+	args := strings.Split(string(cmdline), "\x00")
+	if len(args) == 0 || !strings.Contains(filepath.Base(args[0]), "qemu-system") {
+		return false
+	}
+	name := slices.Index(args, "-name")
+	return name >= 0 && name+1 < len(args) && args[name+1] == instanceID
+}
+
+func killProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+// readPID reads the PID file QEMU writes once daemonized.
+func readPID(dir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, pidFile))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// ipPool hands out the addresses of a prefix, lowest free address first.
+type ipPool struct {
+	prefix netip.Prefix
+	// first skips addresses reserved at the start of the prefix
+	first netip.Addr
+	used  map[netip.Addr]bool
+}
+
+func newIPPool(prefix string, reserved int) *ipPool {
+	p := netip.MustParsePrefix(prefix).Masked()
+	first := p.Addr()
+	for i := 0; i < reserved; i++ {
+		first = first.Next()
+	}
+	return &ipPool{prefix: p, first: first, used: make(map[netip.Addr]bool)}
+}
+
+func (p *ipPool) allocate() (string, error) {
+	for addr := p.first; p.prefix.Contains(addr); addr = addr.Next() {
+		// Skip the broadcast address
+		if !p.prefix.Contains(addr.Next()) {
+			break
+		}
+		if !p.used[addr] {
+			p.used[addr] = true
+			return addr.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrAddressesExhausted, p.prefix)
+}
+
+func (p *ipPool) release(ip string) {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		delete(p.used, addr)
+	}
+}
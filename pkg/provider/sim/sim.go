@@ -0,0 +1,604 @@
+// Package sim is an in-process compute provider. It keeps nodes in memory and
+// moves them through the EC2 state machine on timers, allocating private and
+// public IPs along the way, so the API and console can run without AWS.
+// Failures can be injected at random or per operation.
+package sim
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	mathrand "math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var (
+	ErrInjected           = errkind.New(errkind.Unavailable, "injected failure")
+	ErrImageNotFound      = errkind.New(errkind.NotFound, "image not found")
+	ErrAddressesExhausted = errkind.New(errkind.QuotaExceeded, "no free addresses")
+)
+
+// Operations accepted by FailNext, named after the Provider methods.
+const (
+	OpCreateNode = "CreateNode"
+	OpListNodes  = "ListNodes"
+	OpGetNode    = "GetNode"
+	OpDeleteNode = "DeleteNode"
+	OpPowerNode  = "PowerNode"
+	OpListImages = "ListImages"
+)
+
+const (
+	DefaultBootDelay      = 3 * time.Second
+	DefaultStopDelay      = 2 * time.Second
+	DefaultTerminateDelay = 2 * time.Second
+	DefaultRetention      = time.Hour
+)
+
+// Delays are how long nodes stay in the transitional states.
+type Delays struct {
+	// Boot is spent in pending, on launch and on start
+	Boot time.Duration
+	// Stop is spent in stopping; a force stop completes at once
+	Stop time.Duration
+	// Terminate is spent in shutting-down
+	Terminate time.Duration
+}
+
+type Config struct {
+	Delays Delays
+	// FailureRate is the probability of any API call failing with
+	// ErrInjected
+	FailureRate float64
+	// LaunchFailureRate is the probability of a new node failing to boot,
+	// which terminates it with a Server.InternalError state reason
+	LaunchFailureRate float64
+	// Retention is how long terminated nodes can still be looked up
+	Retention time.Duration
+	// Images are the images nodes can boot; a single sample image is
+	// offered when empty
+	Images []types.Image
+	// AvailabilityZone places every node
+	AvailabilityZone string
+}
+
+// DefaultConfig returns delays in the range of real EC2 transitions,
+// shortened so the console stays responsive, and no injected failures.
+func DefaultConfig() Config {
+	return Config{
+		Delays: Delays{
+			Boot:      DefaultBootDelay,
+			Stop:      DefaultStopDelay,
+			Terminate: DefaultTerminateDelay,
+		},
+		Retention:        DefaultRetention,
+		AvailabilityZone: "sim-1a",
+	}
+}
+
+// Environment variables read by FromEnv.
+const (
+	EnvBootDelay         = "TILMAN_SIM_BOOT_DELAY"
+	EnvFailureRate       = "TILMAN_SIM_FAILURE_RATE"
+	EnvLaunchFailureRate = "TILMAN_SIM_LAUNCH_FAILURE_RATE"
+)
+
+// FromEnv returns DefaultConfig with the boot delay and failure rates
+// overridden from the environment.
+func FromEnv() (Config, error) {
+	config := DefaultConfig()
+	if value := os.Getenv(EnvBootDelay); value != "" {
+		delay, err := time.ParseDuration(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", EnvBootDelay, err)
+		}
+		config.Delays.Boot = delay
+	}
+	for name, rate := range map[string]*float64{EnvFailureRate: &config.FailureRate, EnvLaunchFailureRate: &config.LaunchFailureRate} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			return Config{}, fmt.Errorf("invalid %s: %q is not a probability between 0 and 1", name, value)
+		}
+		*rate = parsed
+	}
+	return config, nil
+}
+
+// Provider simulates nodes. It is safe for concurrent use.
+type Provider struct {
+	config Config
+
+	mu         sync.Mutex
+	nodes      map[string]*node
+	images     []types.Image
+	privateIPs *ipPool
+	publicIPs  *ipPool
+	failNext   map[string][]error
+	// clientTokens maps the client token of a launch to its node, so
+	// retried launches return the node instead of creating another
+	clientTokens map[string]string
+	// changed is closed and replaced on every state transition, waking up
+	// waiters
+	changed chan struct{}
+	closed  bool
+}
+
+type node struct {
+	info ec2.InstanceInfo
+	// generation invalidates the transition scheduled before the last
+	// state change
+	generation int
+	timer      *time.Timer
+	// console is the serial console output, a few lines per transition
+	console        strings.Builder
+	consoleUpdated time.Time
+}
+
+var _ provider.Provider = (*Provider)(nil)
+
+func New(config Config) *Provider {
+	images := slices.Clone(config.Images)
+	if len(images) == 0 {
+		images = []types.Image{sampleImage()}
+	}
+	return &Provider{
+		config:       config,
+		nodes:        make(map[string]*node),
+		images:       images,
+		privateIPs:   newIPPool("10.0.0.0/16", 4),
+		publicIPs:    newIPPool("198.51.100.0/24", 1),
+		failNext:     make(map[string][]error),
+		clientTokens: make(map[string]string),
+		changed:      make(chan struct{}),
+	}
+}
+
+func sampleImage() types.Image {
+	return types.Image{
+		ImageId:            aws.String("ami-0000000000000sim0"),
+		Name:               aws.String("tilmancloud-sim"),
+		Description:        aws.String("Simulated image"),
+		State:              types.ImageStateAvailable,
+		Architecture:       types.ArchitectureValuesArm64,
+		VirtualizationType: types.VirtualizationTypeHvm,
+		CreationDate:       aws.String("2024-01-01T00:00:00.000Z"),
+		Tags:               []types.Tag{{Key: aws.String("ImageID"), Value: aws.String("sim")}},
+	}
+}
+
+func (p *Provider) Name() string {
+	return "sim"
+}
+
+// FailNext makes the next call of op fail with err. Calls queue up, so
+// FailNext twice fails the next two calls.
+func (p *Provider) FailNext(op string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failNext[op] = append(p.failNext[op], err)
+}
+
+// Close cancels all pending transitions. Nodes keep their current state.
+func (p *Provider) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, n := range p.nodes {
+		if n.timer != nil {
+			n.timer.Stop()
+		}
+	}
+}
+
+func (p *Provider) FindLatestAMI(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var latest *types.Image
+	for i, img := range p.images {
+		if img.State != types.ImageStateAvailable {
+			continue
+		}
+		if latest == nil || aws.ToString(img.CreationDate) > aws.ToString(latest.CreationDate) {
+			latest = &p.images[i]
+		}
+	}
+	if latest == nil {
+		return "", image.ErrNoAMI
+	}
+	return aws.ToString(latest.ImageId), nil
+}
+
+func (p *Provider) ListImages(ctx context.Context) ([]types.Image, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.inject(OpListImages); err != nil {
+		return nil, err
+	}
+	return slices.Clone(p.images), nil
+}
+
+func (p *Provider) AssignNodeName(ctx context.Context, requested string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return provider.AssignName(requested, func(name string) bool {
+		return len(p.liveNodesNamed(name)) > 0
+	})
+}
+
+func (p *Provider) ResolveNode(ctx context.Context, idOrName string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return provider.ResolveName(idOrName, p.liveNodesNamed)
+}
+
+func (p *Provider) CreateNode(ctx context.Context, config ec2.CreateInstanceConfig) (ec2.InstanceInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.inject(OpCreateNode); err != nil {
+		return ec2.InstanceInfo{}, err
+	}
+	if n, ok := p.nodes[p.clientTokens[config.ClientToken]]; ok && config.ClientToken != "" {
+		return cloneInfo(n.info), nil
+	}
+	if config.Spot != nil {
+		return ec2.InstanceInfo{}, fmt.Errorf("%w: spot instances", provider.ErrUnsupported)
+	}
+	idx := slices.IndexFunc(p.images, func(img types.Image) bool {
+		return aws.ToString(img.ImageId) == config.ImageID && img.State == types.ImageStateAvailable
+	})
+	if idx < 0 {
+		return ec2.InstanceInfo{}, fmt.Errorf("%w: %s", ErrImageNotFound, config.ImageID)
+	}
+	img := p.images[idx]
+
+	privateIP, err := p.privateIPs.allocate()
+	if err != nil {
+		return ec2.InstanceInfo{}, err
+	}
+
+	instanceType := config.InstanceType
+	if instanceType == "" {
+		instanceType = types.InstanceTypeT4gMicro
+	}
+	tags := map[string]string{ec2.TagManagedBy: ec2.ManagedByValue}
+	for key, value := range config.Tags {
+		tags[key] = value
+	}
+	if config.Name != "" {
+		tags[ec2.TagName] = config.Name
+	}
+	info := ec2.InstanceInfo{
+		InstanceID:            newInstanceID(),
+		Name:                  config.Name,
+		State:                 string(types.InstanceStateNamePending),
+		InstanceType:          string(instanceType),
+		PrivateIP:             privateIP,
+		LaunchTime:            time.Now().UTC(),
+		AvailabilityZone:      p.config.AvailabilityZone,
+		SubnetID:              "subnet-sim",
+		VpcID:                 "vpc-sim",
+		AMIID:                 config.ImageID,
+		Architecture:          string(img.Architecture),
+		KeyName:               config.KeyName,
+		Tags:                  tags,
+		Lifecycle:             "on-demand",
+		HibernationConfigured: config.Hibernation,
+	}
+	for _, tag := range img.Tags {
+		if aws.ToString(tag.Key) == "ImageID" {
+			info.ImageID = aws.ToString(tag.Value)
+		}
+	}
+
+	n := &node{info: info}
+	n.printConsole("Booting %s from %s", info.InstanceID, info.AMIID)
+	p.nodes[info.InstanceID] = n
+	if config.ClientToken != "" {
+		p.clientTokens[config.ClientToken] = info.InstanceID
+	}
+	p.schedule(n, p.config.Delays.Boot, p.finishBoot(true))
+	p.notify()
+
+	slog.Info("Simulated node created", "instance_id", info.InstanceID, "name", info.Name, "private_ip", privateIP)
+	return cloneInfo(info), nil
+}
+
+func (p *Provider) CreateNodes(ctx context.Context, config ec2.CreateInstanceConfig, names []string) ([]ec2.InstanceInfo, error) {
+	return provider.CreateEach(ctx, config, names, p.CreateNode)
+}
+
+func (p *Provider) ListNodes(ctx context.Context) ([]ec2.InstanceInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.inject(OpListNodes); err != nil {
+		return nil, err
+	}
+	var instances []ec2.InstanceInfo
+	for _, n := range p.nodes {
+		if isGone(n.info.State) {
+			continue
+		}
+		instances = append(instances, cloneInfo(n.info))
+	}
+	slices.SortFunc(instances, func(a, b ec2.InstanceInfo) int {
+		return a.LaunchTime.Compare(b.LaunchTime)
+	})
+	return instances, nil
+}
+
+func (p *Provider) GetNode(ctx context.Context, instanceID string) (ec2.InstanceInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.inject(OpGetNode); err != nil {
+		return ec2.InstanceInfo{}, err
+	}
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		return ec2.InstanceInfo{}, fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+	}
+	return cloneInfo(n.info), nil
+}
+
+func (p *Provider) DeleteNode(ctx context.Context, instanceID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.inject(OpDeleteNode); err != nil {
+		return err
+	}
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+	}
+	// Terminating twice is a no-op, as on EC2
+	if isGone(n.info.State) {
+		return nil
+	}
+
+	p.releasePublicIP(n)
+	n.setReason("Client.UserInitiatedShutdown", "User initiated shutdown")
+	p.setState(n, types.InstanceStateNameShuttingDown)
+	p.schedule(n, p.config.Delays.Terminate, p.finishTerminate)
+	return nil
+}
+
+func (p *Provider) PowerNode(ctx context.Context, instanceID string, action ec2.PowerAction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.inject(OpPowerNode); err != nil {
+		return err
+	}
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+	}
+	if err := ec2.ValidatePowerTransition(action, n.info.State); err != nil {
+		return err
+	}
+	if action == ec2.PowerActionHibernate && !n.info.HibernationConfigured {
+		return fmt.Errorf("%w: instance %s was not launched with hibernation enabled", ec2.ErrHibernationNotConfigured, instanceID)
+	}
+
+	switch action {
+	case ec2.PowerActionStart:
+		n.setReason("", "")
+		n.printConsole("Booting %s from %s", n.info.InstanceID, n.info.AMIID)
+		p.setState(n, types.InstanceStateNamePending)
+		p.schedule(n, p.config.Delays.Boot, p.finishBoot(false))
+	case ec2.PowerActionStop, ec2.PowerActionHibernate:
+		n.printConsole("reboot: Power down")
+		p.releasePublicIP(n)
+		n.setReason("Client.UserInitiatedShutdown", "User initiated shutdown")
+		p.setState(n, types.InstanceStateNameStopping)
+		p.schedule(n, p.config.Delays.Stop, p.finishStop)
+	case ec2.PowerActionForceStop:
+		p.releasePublicIP(n)
+		n.setReason("Client.UserInitiatedShutdown", "User initiated forced shutdown")
+		p.setState(n, types.InstanceStateNameStopped)
+	case ec2.PowerActionReboot:
+		// A reboot keeps the node running, as on EC2
+		n.printConsole("reboot: Restarting system")
+	}
+	return nil
+}
+
+// WaitForNode waits for the node to reach one of the target states. Every
+// transition wakes it up. Status checks pass as soon as a node runs.
+func (p *Provider) WaitForNode(ctx context.Context, instanceID string, opts ec2.WaitOptions) (ec2.InstanceInfo, error) {
+	return provider.WaitForState(ctx, instanceID, opts, func() (ec2.InstanceInfo, bool, <-chan struct{}) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		n, found := p.nodes[instanceID]
+		if !found {
+			return ec2.InstanceInfo{}, false, p.changed
+		}
+		return cloneInfo(n.info), true, p.changed
+	}, nil)
+}
+
+// ConsoleOutput returns the lines the node printed on its simulated serial
+// console; it is always the latest.
+func (p *Provider) ConsoleOutput(ctx context.Context, instanceID string, latest bool) (ec2.ConsoleOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, ok := p.nodes[instanceID]
+	if !ok {
+		return ec2.ConsoleOutput{}, fmt.Errorf("%w: %s", ec2.ErrInstanceNotFound, instanceID)
+	}
+	output := n.console.String()
+	return ec2.ConsoleOutput{
+		InstanceID: instanceID,
+		Output:     output[max(0, len(output)-ec2.MaxConsoleOutput):],
+		Timestamp:  n.consoleUpdated,
+	}, nil
+}
+
+// ConsoleScreenshot is not supported, simulated nodes have no display.
+func (p *Provider) ConsoleScreenshot(ctx context.Context, instanceID string) ([]byte, error) {
+	return nil, fmt.Errorf("%w: console screenshots", provider.ErrUnsupported)
+}
+
+// finishBoot returns the transition out of pending. Only launches can fail.
+func (p *Provider) finishBoot(launch bool) func(*node) {
+	return func(n *node) {
+		if launch && p.config.LaunchFailureRate > 0 && mathrand.Float64() < p.config.LaunchFailureRate {
+			slog.Info("Simulated node failed to launch", "instance_id", n.info.InstanceID)
+			p.privateIPs.release(n.info.PrivateIP)
+			n.info.PrivateIP = ""
+			n.printConsole("Kernel panic - not syncing: Internal error on launch")
+			n.setReason("Server.InternalError", "Internal error on launch")
+			p.setState(n, types.InstanceStateNameTerminated)
+			p.schedule(n, p.config.Retention, p.forget)
+			return
+		}
+		// Without a public IP the node still runs, as in a private subnet
+		if ip, err := p.publicIPs.allocate(); err == nil {
+			n.info.PublicIP = ip
+		}
+		n.printConsole("Cloud-init finished")
+		n.printConsole("%s login:", n.info.Name)
+		p.setState(n, types.InstanceStateNameRunning)
+	}
+}
+
+func (p *Provider) finishStop(n *node) {
+	p.setState(n, types.InstanceStateNameStopped)
+}
+
+func (p *Provider) finishTerminate(n *node) {
+	p.privateIPs.release(n.info.PrivateIP)
+	n.info.PrivateIP = ""
+	p.setState(n, types.InstanceStateNameTerminated)
+	p.schedule(n, p.config.Retention, p.forget)
+}
+
+func (p *Provider) forget(n *node) {
+	delete(p.nodes, n.info.InstanceID)
+	p.notify()
+}
+
+// schedule runs transition after delay unless the node changes state first.
+// The caller holds p.mu; transition runs with p.mu held.
+func (p *Provider) schedule(n *node, delay time.Duration, transition func(*node)) {
+	if p.closed {
+		return
+	}
+	generation := n.generation
+	n.timer = time.AfterFunc(delay, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.closed || n.generation != generation {
+			return
+		}
+		transition(n)
+	})
+}
+
+// setState moves the node to state and wakes up waiters. The caller holds
+// p.mu.
+func (p *Provider) setState(n *node, state types.InstanceStateName) {
+	n.generation++
+	if n.timer != nil {
+		n.timer.Stop()
+		n.timer = nil
+	}
+	n.info.State = string(state)
+	slog.Debug("Simulated node state changed", "instance_id", n.info.InstanceID, "state", state)
+	p.notify()
+}
+
+// setReason records why the node left its last state, formatted like the
+// EC2 state reason message; an empty code clears it.
+func (n *node) setReason(code, message string) {
+	n.info.StateReasonCode = code
+	n.info.StateReason = ""
+	if code != "" {
+		n.info.StateReason = code + ": " + message
+	}
+}
+
+// printConsole appends a line to the console output, stamped with the
+// seconds since launch like kernel messages. The caller holds p.mu.
+func (n *node) printConsole(format string, args ...any) {
+	now := time.Now().UTC()
+	fmt.Fprintf(&n.console, "[%11.6f] %s\n", now.Sub(n.info.LaunchTime).Seconds(), fmt.Sprintf(format, args...))
+	n.consoleUpdated = now
+}
+
+func (p *Provider) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *Provider) releasePublicIP(n *node) {
+	if n.info.PublicIP != "" {
+		p.publicIPs.release(n.info.PublicIP)
+		n.info.PublicIP = ""
+	}
+}
+
+// inject returns the error queued by FailNext or, at FailureRate, a random
+// failure. The caller holds p.mu.
+func (p *Provider) inject(op string) error {
+	if queued := p.failNext[op]; len(queued) > 0 {
+		p.failNext[op] = queued[1:]
+		return queued[0]
+	}
+	if p.config.FailureRate > 0 && mathrand.Float64() < p.config.FailureRate {
+		return fmt.Errorf("%w: %s", ErrInjected, op)
+	}
+	return nil
+}
+
+// liveNodesNamed returns the IDs of nodes carrying name that are not
+// shutting down or terminated. The caller holds p.mu.
+func (p *Provider) liveNodesNamed(name string) []string {
+	var ids []string
+	for id, n := range p.nodes {
+		if n.info.Name == name && !isGone(n.info.State) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func isGone(state string) bool {
+	return state == string(types.InstanceStateNameShuttingDown) || state == string(types.InstanceStateNameTerminated)
+}
+
+func cloneInfo(info ec2.InstanceInfo) ec2.InstanceInfo {
+	info.Tags = maps.Clone(info.Tags)
+	return info
+}
+
+func newInstanceID() string {
+	b := make([]byte, 9)
+	rand.Read(b)
+	return "i-" + hex.EncodeToString(b)[:17]
+}
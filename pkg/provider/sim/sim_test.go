@@ -0,0 +1,300 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func newTestProvider(t *testing.T, config Config) *Provider {
+	t.Helper()
+	if config.Delays == (Delays{}) {
+		config.Delays = Delays{Boot: 10 * time.Millisecond, Stop: 10 * time.Millisecond, Terminate: 10 * time.Millisecond}
+	}
+	if config.Retention == 0 {
+		config.Retention = time.Minute
+	}
+	p := New(config)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func createNode(t *testing.T, p *Provider, name string) ec2.InstanceInfo {
+	t.Helper()
+	ctx := context.Background()
+	amiID, err := p.FindLatestAMI(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	info, err := p.CreateNode(ctx, ec2.CreateInstanceConfig{Name: name, ImageID: amiID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return info
+}
+
+func waitFor(t *testing.T, p *Provider, instanceID string, target types.InstanceStateName) ec2.InstanceInfo {
+	t.Helper()
+	info, err := p.WaitForNode(context.Background(), instanceID, ec2.WaitOptions{
+		TargetStates: []types.InstanceStateName{target},
+		Timeout:      time.Second,
+	})
+	if err != nil {
+		t.Fatalf("expected no error waiting for %s, got %v", target, err)
+	}
+	return info
+}
+
+func TestProvider_Lifecycle(t *testing.T) {
+	p := newTestProvider(t, Config{})
+	ctx := context.Background()
+
+	info := createNode(t, p, "web")
+	if !strings.HasPrefix(info.InstanceID, "i-") || len(info.InstanceID) != 19 {
+		t.Errorf("expected an EC2 style instance ID, got %s", info.InstanceID)
+	}
+	if info.State != "pending" || info.PrivateIP != "10.0.0.4" || info.PublicIP != "" {
+		t.Errorf("expected a pending node with only a private IP, got %+v", info)
+	}
+	if info.Tags[ec2.TagManagedBy] != ec2.ManagedByValue || info.ImageID != "sim" {
+		t.Errorf("unexpected tags %v and image ID %s", info.Tags, info.ImageID)
+	}
+
+	info = waitFor(t, p, info.InstanceID, types.InstanceStateNameRunning)
+	if info.PublicIP != "198.51.100.1" {
+		t.Errorf("expected a public IP once running, got %q", info.PublicIP)
+	}
+
+	if err := p.PowerNode(ctx, info.InstanceID, ec2.PowerActionStop); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	info = waitFor(t, p, info.InstanceID, types.InstanceStateNameStopped)
+	if info.PublicIP != "" || info.PrivateIP != "10.0.0.4" {
+		t.Errorf("expected the public IP released and the private IP kept, got %+v", info)
+	}
+	if info.StateReasonCode != "Client.UserInitiatedShutdown" {
+		t.Errorf("expected a user initiated shutdown reason, got %q", info.StateReasonCode)
+	}
+
+	if err := p.DeleteNode(ctx, info.InstanceID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameTerminated)
+	nodes, err := p.ListNodes(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(nodes) != 0 {
+		t.Errorf("expected terminated nodes to be hidden, got %+v", nodes)
+	}
+
+	// The private IP is free again
+	if next := createNode(t, p, "web"); next.PrivateIP != "10.0.0.4" {
+		t.Errorf("expected the released private IP to be reused, got %s", next.PrivateIP)
+	}
+}
+
+func TestProvider_PowerNode_InvalidTransition(t *testing.T) {
+	p := newTestProvider(t, Config{})
+	info := createNode(t, p, "")
+
+	err := p.PowerNode(context.Background(), info.InstanceID, ec2.PowerActionStart)
+	if !errors.Is(err, ec2.ErrInvalidStateTransition) {
+		t.Errorf("expected ErrInvalidStateTransition, got %v", err)
+	}
+}
+
+func TestProvider_Names(t *testing.T) {
+	p := newTestProvider(t, Config{})
+	ctx := context.Background()
+	info := createNode(t, p, "db")
+
+	if _, err := p.AssignNodeName(ctx, "db"); !errors.Is(err, ec2.ErrNodeNameTaken) {
+		t.Errorf("expected ErrNodeNameTaken, got %v", err)
+	}
+	id, err := p.ResolveNode(ctx, "db")
+	if err != nil || id != info.InstanceID {
+		t.Errorf("expected db to resolve to %s, got %s, %v", info.InstanceID, id, err)
+	}
+	if _, err := p.ResolveNode(ctx, "cache"); !errors.Is(err, ec2.ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+}
+
+func TestProvider_FailNext(t *testing.T) {
+	p := newTestProvider(t, Config{})
+	injected := errors.New("throttled")
+	p.FailNext(OpListNodes, injected)
+
+	if _, err := p.ListNodes(context.Background()); !errors.Is(err, injected) {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+	if _, err := p.ListNodes(context.Background()); err != nil {
+		t.Errorf("expected only the next call to fail, got %v", err)
+	}
+}
+
+func TestProvider_FailureRate(t *testing.T) {
+	p := newTestProvider(t, Config{FailureRate: 1})
+
+	if _, err := p.ListImages(context.Background()); !errors.Is(err, ErrInjected) {
+		t.Errorf("expected ErrInjected, got %v", err)
+	}
+}
+
+func TestProvider_LaunchFailure(t *testing.T) {
+	p := newTestProvider(t, Config{LaunchFailureRate: 1})
+	info := createNode(t, p, "")
+
+	_, err := p.WaitForNode(context.Background(), info.InstanceID, ec2.WaitOptions{
+		TargetStates: []types.InstanceStateName{types.InstanceStateNameRunning},
+		Timeout:      time.Second,
+	})
+	var terminalErr *ec2.TerminalStateError
+	if !errors.As(err, &terminalErr) {
+		t.Fatalf("expected a TerminalStateError, got %v", err)
+	}
+	if !strings.Contains(terminalErr.Reason, "Server.InternalError") {
+		t.Errorf("expected an internal error reason, got %q", terminalErr.Reason)
+	}
+}
+
+func TestProvider_WaitForNode_Timeout(t *testing.T) {
+	p := newTestProvider(t, Config{Delays: Delays{Boot: time.Hour}})
+	info := createNode(t, p, "")
+
+	_, err := p.WaitForNode(context.Background(), info.InstanceID, ec2.WaitOptions{
+		TargetStates: []types.InstanceStateName{types.InstanceStateNameRunning},
+		Timeout:      20 * time.Millisecond,
+	})
+	var timeoutErr *ec2.WaitTimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.LastState != types.InstanceStateNamePending {
+		t.Errorf("expected a WaitTimeoutError in pending, got %v", err)
+	}
+}
+
+func TestProvider_CreateNode_Spot(t *testing.T) {
+	p := newTestProvider(t, Config{})
+
+	_, err := p.CreateNode(context.Background(), ec2.CreateInstanceConfig{ImageID: "ami-0000000000000sim0", Spot: &ec2.SpotOptions{}})
+	if !errors.Is(err, provider.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EnvBootDelay, "500ms")
+	t.Setenv(EnvLaunchFailureRate, "0.25")
+
+	config, err := FromEnv()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.Delays.Boot != 500*time.Millisecond || config.LaunchFailureRate != 0.25 || config.Delays.Stop != DefaultStopDelay {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	t.Setenv(EnvFailureRate, "2")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a rate above 1")
+	}
+}
+
+func TestProvider_CreateNode_ClientToken(t *testing.T) {
+	p := newTestProvider(t, Config{})
+	ctx := context.Background()
+	config := ec2.CreateInstanceConfig{ImageID: "ami-0000000000000sim0", ClientToken: "token-1"}
+
+	first, err := p.CreateNode(ctx, config)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	retried, err := p.CreateNode(ctx, config)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if retried.InstanceID != first.InstanceID {
+		t.Errorf("expected the retried launch to return %s, got %s", first.InstanceID, retried.InstanceID)
+	}
+	nodes, _ := p.ListNodes(ctx)
+	if len(nodes) != 1 {
+		t.Errorf("expected 1 node, got %d", len(nodes))
+	}
+}
+
+func TestProvider_CreateNodes(t *testing.T) {
+	p := newTestProvider(t, Config{})
+	ctx := context.Background()
+	createNode(t, p, "web-1")
+
+	names, err := provider.AssignNames(ctx, p, "web", 2, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Join(names, ",") != "web-2,web-3" {
+		t.Errorf("expected web-2 and web-3, got %v", names)
+	}
+
+	config := ec2.CreateInstanceConfig{ImageID: "ami-0000000000000sim0", ClientToken: "token-1", Tags: map[string]string{"env": "test"}}
+	nodes, err := p.CreateNodes(ctx, config, names)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(nodes) != 2 || nodes[0].Name != "web-2" || nodes[1].Name != "web-3" {
+		t.Errorf("expected web-2 and web-3 to be created, got %+v", nodes)
+	}
+
+	selected, err := provider.SelectNodes(ctx, p, provider.Selector{"env": "test"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(selected) != 2 {
+		t.Errorf("expected the 2 tagged nodes to be selected, got %+v", selected)
+	}
+	if _, err := provider.SelectNodes(ctx, p, provider.Selector{}); !errors.Is(err, provider.ErrInvalidSelector) {
+		t.Errorf("expected ErrInvalidSelector for an empty selector, got %v", err)
+	}
+}
+
+func TestAssignNames_ReusesBatchNames(t *testing.T) {
+	p := newTestProvider(t, Config{})
+	ctx := context.Background()
+	config := ec2.CreateInstanceConfig{ImageID: "ami-0000000000000sim0", Tags: map[string]string{ec2.TagBatch: "batch-1"}}
+	if _, err := p.CreateNodes(ctx, config, []string{"web-1", "web-2"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// A replay of the batch gets its names back, a new batch fresh ones
+	names, err := provider.AssignNames(ctx, p, "web", 2, "batch-1")
+	if err != nil || strings.Join(names, ",") != "web-1,web-2" {
+		t.Errorf("expected web-1 and web-2 for the replay, got %v (%v)", names, err)
+	}
+	names, err = provider.AssignNames(ctx, p, "web", 2, "batch-2")
+	if err != nil || strings.Join(names, ",") != "web-3,web-4" {
+		t.Errorf("expected web-3 and web-4 for a new batch, got %v (%v)", names, err)
+	}
+}
+
+func TestProvider_ConsoleOutput(t *testing.T) {
+	p := newTestProvider(t, Config{LaunchFailureRate: 1})
+	ctx := context.Background()
+	info := createNode(t, p, "web")
+	waitFor(t, p, info.InstanceID, types.InstanceStateNameTerminated)
+
+	output, err := p.ConsoleOutput(ctx, info.InstanceID, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(output.Output, "Booting "+info.InstanceID) || !strings.Contains(output.Output, "Kernel panic") {
+		t.Errorf("expected the boot and the failed launch on the console, got %q", output.Output)
+	}
+	if _, err := p.ConsoleScreenshot(ctx, info.InstanceID); !errors.Is(err, provider.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for screenshots, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Package spot watches managed spot nodes for interruptions. It records
+// every interruption in the inventory and, for nodes that opted in, launches
+// a replacement.
+package spot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// DefaultInterval is how often spot requests are checked. EC2 gives a two
+// minute notice before it reclaims an instance.
+const DefaultInterval = 30 * time.Second
+
+const (
+	// Actor attributes interruption handling in the inventory
+	Actor = "spot"
+
+	OperationInterruption = "spot-interruption"
+	OperationReplace      = "replace-node"
+)
+
+// Handler records spot interruptions and replaces interrupted nodes tagged
+// with ec2.TagSpotReplace. Pool members are never replaced here; the pool
+// reconciler already keeps their count.
+type Handler struct {
+	Client    ec2.EC2Client
+	Inventory inventory.Store
+	Interval  time.Duration
+	// OnChange is called after a replacement was launched, e.g. to
+	// invalidate cached instance lists; optional
+	OnChange func()
+	// Events receives interruption events, NodeEvents the state of
+	// replacements; both optional
+	Events     *events.Bus
+	NodeEvents *events.NodeTracker
+	// Region is recorded on replacements so the inventory syncer of that
+	// region keeps them; empty means the default region
+	Region string
+}
+
+func NewHandler(client ec2.EC2Client, store inventory.Store) *Handler {
+	return &Handler{
+		Client:    client,
+		Inventory: store,
+		Interval:  DefaultInterval,
+	}
+}
+
+// Interruption is a spot node that was reclaimed, with its replacement if
+// one was launched.
+type Interruption struct {
+	Node        ec2.InstanceInfo
+	Replacement *ec2.InstanceInfo
+}
+
+// Run checks for interruptions every Interval until ctx is cancelled.
+func (h *Handler) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := h.Check(ctx); err != nil {
+			slog.Warn("Spot interruption check failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check handles all interruptions that were not handled before. Handled
+// interruptions are recognized by their operation in the inventory, so a
+// restart does not replace a node twice.
+func (h *Handler) Check(ctx context.Context) ([]Interruption, error) {
+	instances, err := ec2.ListSpotInstances(ctx, h.Client)
+	if err != nil {
+		return nil, err
+	}
+	if err := ec2.AttachSpotStatus(ctx, h.Client, instances); err != nil {
+		return nil, err
+	}
+
+	var handled []Interruption
+	var errs []error
+	for _, node := range instances {
+		if node.Spot == nil || !node.Spot.Interrupted() {
+			continue
+		}
+		seen, err := h.alreadyHandled(ctx, node.InstanceID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen {
+			continue
+		}
+
+		interruption, err := h.handle(ctx, node)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		handled = append(handled, interruption)
+	}
+	return handled, errors.Join(errs...)
+}
+
+func (h *Handler) alreadyHandled(ctx context.Context, instanceID string) (bool, error) {
+	ops, err := h.Inventory.ListOperations(ctx, instanceID)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(ops, func(op inventory.OperationRecord) bool {
+		return op.Type == OperationInterruption
+	}), nil
+}
+
+func (h *Handler) handle(ctx context.Context, node ec2.InstanceInfo) (Interruption, error) {
+	interruption := Interruption{Node: node}
+	slog.Warn("Spot node interrupted",
+		"instance_id", node.InstanceID,
+		"name", node.Name,
+		"status_code", node.Spot.StatusCode,
+		"behavior", node.Spot.InterruptionBehavior)
+
+	var replaceErr error
+	if shouldReplace(node) {
+		replacement, err := h.replace(ctx, node)
+		if err != nil {
+			slog.Error("Failed to replace interrupted spot node", "instance_id", node.InstanceID, "error", err)
+			replaceErr = err
+		} else {
+			interruption.Replacement = &replacement
+		}
+	}
+
+	params := map[string]string{
+		"statusCode": node.Spot.StatusCode,
+		"behavior":   node.Spot.InterruptionBehavior,
+	}
+	if interruption.Replacement != nil {
+		params["replacementId"] = interruption.Replacement.InstanceID
+	}
+	now := time.Now().UTC()
+	h.recordOperation(ctx, OperationInterruption, node.InstanceID, params, now, replaceErr)
+
+	if record, err := h.Inventory.GetNode(ctx, node.InstanceID); err == nil {
+		record.State = node.State
+		record.StateReason = node.Spot.StatusCode
+		if node.Spot.StatusMessage != "" {
+			record.StateReason += ": " + node.Spot.StatusMessage
+		}
+		record.LastSeenAt = &now
+		if err := h.Inventory.PutNode(ctx, record); err != nil {
+			slog.Warn("Failed to record spot interruption", "instance_id", node.InstanceID, "error", err)
+		}
+	} else if !errors.Is(err, inventory.ErrNotFound) {
+		slog.Warn("Failed to look up interrupted node", "instance_id", node.InstanceID, "error", err)
+	}
+
+	data := events.SpotInterrupted{
+		InstanceID: node.InstanceID,
+		Name:       node.Name,
+		StatusCode: node.Spot.StatusCode,
+		Message:    node.Spot.StatusMessage,
+	}
+	if interruption.Replacement != nil {
+		data.ReplacementID = interruption.Replacement.InstanceID
+	}
+	h.Events.Publish(events.TypeSpotInterruption, node.InstanceID, data)
+	h.NodeEvents.Observe(events.NodeStateChanged{
+		InstanceID: node.InstanceID,
+		Name:       node.Name,
+		State:      node.State,
+		Reason:     node.Spot.StatusCode,
+	})
+	return interruption, replaceErr
+}
+
+// shouldReplace reports whether the node opted in to replacement. Stopped
+// and hibernated spot nodes are resumed by their persistent request, so
+// only terminated ones are replaced.
+func shouldReplace(node ec2.InstanceInfo) bool {
+	if node.Tags[ec2.TagSpotReplace] != "true" || node.Tags[ec2.TagPool] != "" {
+		return false
+	}
+	behavior := node.Spot.InterruptionBehavior
+	return behavior == "" || behavior == string(types.InstanceInterruptionBehaviorTerminate)
+}
+
+// replace launches a spot node with the configuration of the interrupted
+// one. It keeps the name if the interrupted node already released it.
+func (h *Handler) replace(ctx context.Context, node ec2.InstanceInfo) (ec2.InstanceInfo, error) {
+	started := time.Now().UTC()
+	params := map[string]string{
+		"replaces":     node.InstanceID,
+		"imageId":      node.AMIID,
+		"instanceType": node.InstanceType,
+	}
+
+	info, err := h.launchReplacement(ctx, node)
+	target := node.InstanceID
+	if err == nil {
+		target = info.InstanceID
+	}
+	h.recordOperation(ctx, OperationReplace, target, params, started, err)
+	if err != nil {
+		return ec2.InstanceInfo{}, err
+	}
+
+	if h.OnChange != nil {
+		h.OnChange()
+	}
+	h.NodeEvents.Observe(events.NodeStateChanged{InstanceID: info.InstanceID, Name: info.Name, State: info.State})
+	if err := h.Inventory.PutNode(ctx, inventory.NodeRecord{
+		InstanceID: info.InstanceID,
+		Name:       info.Name,
+		Region:     h.Region,
+		CreatedBy:  Actor,
+		CreatedAt:  started,
+		Params:     params,
+		State:      info.State,
+	}); err != nil {
+		slog.Warn("Failed to record replacement node", "instance_id", info.InstanceID, "error", err)
+	}
+
+	slog.Info("Replaced interrupted spot node", "instance_id", node.InstanceID, "replacement_id", info.InstanceID, "name", info.Name)
+	return info, nil
+}
+
+func (h *Handler) launchReplacement(ctx context.Context, node ec2.InstanceInfo) (ec2.InstanceInfo, error) {
+	name, err := ec2.AssignNodeName(ctx, h.Client, node.Name)
+	if errors.Is(err, ec2.ErrNodeNameTaken) || errors.Is(err, ec2.ErrInvalidNodeName) {
+		name, err = ec2.AssignNodeName(ctx, h.Client, "")
+	}
+	if err != nil {
+		return ec2.InstanceInfo{}, err
+	}
+
+	userData, err := ec2.GetUserData(ctx, h.Client, node.InstanceID)
+	if err != nil {
+		return ec2.InstanceInfo{}, err
+	}
+
+	// Tags with the aws: prefix are set by AWS itself and rejected on launch
+	tags := maps.Clone(node.Tags)
+	maps.DeleteFunc(tags, func(key, _ string) bool {
+		return strings.HasPrefix(key, "aws:")
+	})
+
+	return ec2.CreateInstance(ctx, h.Client, ec2.CreateInstanceConfig{
+		Name:         name,
+		ImageID:      node.AMIID,
+		InstanceType: types.InstanceType(node.InstanceType),
+		KeyName:      node.KeyName,
+		UserData:     userData,
+		Tags:         tags,
+		Spot: &ec2.SpotOptions{
+			MaxPrice:             node.Spot.MaxPrice,
+			InterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
+		},
+	})
+}
+
+func (h *Handler) recordOperation(ctx context.Context, opType, target string, params map[string]string, started time.Time, err error) {
+	finished := time.Now().UTC()
+	op := inventory.OperationRecord{
+		Type:       opType,
+		Target:     target,
+		Actor:      Actor,
+		Params:     params,
+		Status:     inventory.OperationSucceeded,
+		StartedAt:  started,
+		FinishedAt: &finished,
+	}
+	if err != nil {
+		op.Status = inventory.OperationFailed
+		op.Error = err.Error()
+	}
+	if _, err := h.Inventory.AddOperation(ctx, op); err != nil {
+		slog.Warn("Failed to record operation", "type", opType, "target", target, "error", err)
+	}
+}
@@ -0,0 +1,180 @@
+package spot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/events"
+	"github.com/abteilung6/tilmancloud/pkg/inventory"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// newSpotMock serves a single spot instance with the given tags and spot
+// status code, and counts launched replacements.
+func newSpotMock(t *testing.T, tags map[string]string, statusCode string, launched *[]*awsec2.RunInstancesInput) *ec2.MockEC2Client {
+	t.Helper()
+
+	instanceTags := []types.Tag{
+		{Key: aws.String(ec2.TagManagedBy), Value: aws.String(ec2.ManagedByValue)},
+		{Key: aws.String(ec2.TagName), Value: aws.String("brave-otter")},
+	}
+	for key, value := range tags {
+		instanceTags = append(instanceTags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	return &ec2.MockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *awsec2.DescribeInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstancesOutput, error) {
+			// Name lookups for the replacement find no conflicting node
+			if aws.ToString(params.Filters[0].Name) != "instance-lifecycle" {
+				return &awsec2.DescribeInstancesOutput{}, nil
+			}
+			return &awsec2.DescribeInstancesOutput{
+				Reservations: []types.Reservation{{
+					Instances: []types.Instance{{
+						InstanceId:            aws.String("i-spot"),
+						ImageId:               aws.String("ami-1"),
+						InstanceType:          types.InstanceTypeT4gMicro,
+						KeyName:               aws.String("alice-laptop"),
+						State:                 &types.InstanceState{Name: types.InstanceStateNameShuttingDown},
+						InstanceLifecycle:     types.InstanceLifecycleTypeSpot,
+						SpotInstanceRequestId: aws.String("sir-1"),
+						Tags:                  instanceTags,
+					}},
+				}},
+			}, nil
+		},
+		DescribeSpotInstanceRequestsFunc: func(ctx context.Context, params *awsec2.DescribeSpotInstanceRequestsInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeSpotInstanceRequestsOutput, error) {
+			return &awsec2.DescribeSpotInstanceRequestsOutput{
+				SpotInstanceRequests: []types.SpotInstanceRequest{{
+					SpotInstanceRequestId:        aws.String("sir-1"),
+					State:                        types.SpotInstanceStateClosed,
+					SpotPrice:                    aws.String("0.005"),
+					InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
+					Status:                       &types.SpotInstanceStatus{Code: aws.String(statusCode)},
+				}},
+			}, nil
+		},
+		DescribeInstanceAttributeFunc: func(ctx context.Context, params *awsec2.DescribeInstanceAttributeInput, optFns ...func(*awsec2.Options)) (*awsec2.DescribeInstanceAttributeOutput, error) {
+			return &awsec2.DescribeInstanceAttributeOutput{}, nil
+		},
+		RunInstancesFunc: func(ctx context.Context, params *awsec2.RunInstancesInput, optFns ...func(*awsec2.Options)) (*awsec2.RunInstancesOutput, error) {
+			*launched = append(*launched, params)
+			return &awsec2.RunInstancesOutput{
+				Instances: []types.Instance{{
+					InstanceId: aws.String("i-replacement"),
+					State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+				}},
+			}, nil
+		},
+	}
+}
+
+func TestHandler_Check_Replace(t *testing.T) {
+	ctx := context.Background()
+	var launched []*awsec2.RunInstancesInput
+	tags := map[string]string{ec2.TagSpotReplace: "true", "aws:ec2launchtemplate:id": "lt-1"}
+	client := newSpotMock(t, tags, "instance-terminated-no-capacity", &launched)
+
+	store := inventory.NewMemoryStore()
+	if err := store.PutNode(ctx, inventory.NodeRecord{InstanceID: "i-spot", Name: "brave-otter", State: "running"}); err != nil {
+		t.Fatalf("failed to seed inventory: %v", err)
+	}
+
+	bus := events.NewBus(0)
+	sub := bus.Subscribe(ctx, 0, events.TypeSpotInterruption)
+	handler := NewHandler(client, store)
+	handler.Events = bus
+	changed := 0
+	handler.OnChange = func() { changed++ }
+
+	interruptions, err := handler.Check(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(interruptions) != 1 || interruptions[0].Replacement == nil {
+		t.Fatalf("expected one replaced interruption, got %+v", interruptions)
+	}
+	if len(launched) != 1 || changed != 1 {
+		t.Fatalf("expected one replacement launch and change, got %d and %d", len(launched), changed)
+	}
+
+	input := launched[0]
+	if aws.ToString(input.ImageId) != "ami-1" || aws.ToString(input.KeyName) != "alice-laptop" {
+		t.Errorf("expected replacement with the same AMI and key, got %s and %s", aws.ToString(input.ImageId), aws.ToString(input.KeyName))
+	}
+	if input.InstanceMarketOptions == nil || aws.ToString(input.InstanceMarketOptions.SpotOptions.MaxPrice) != "0.005" {
+		t.Errorf("expected replacement spot launch with max price 0.005, got %+v", input.InstanceMarketOptions)
+	}
+	var name, replace string
+	for _, tag := range input.TagSpecifications[0].Tags {
+		switch aws.ToString(tag.Key) {
+		case ec2.TagName:
+			name = aws.ToString(tag.Value)
+		case ec2.TagSpotReplace:
+			replace = aws.ToString(tag.Value)
+		case "aws:ec2launchtemplate:id":
+			t.Error("expected reserved aws: tags to be dropped from the replacement")
+		}
+	}
+	if name != "brave-otter" || replace != "true" {
+		t.Errorf("expected replacement to keep name and replace tag, got %q and %q", name, replace)
+	}
+
+	record, err := store.GetNode(ctx, "i-spot")
+	if err != nil || record.StateReason != "instance-terminated-no-capacity" {
+		t.Errorf("expected interruption on node record, got %+v (%v)", record, err)
+	}
+	if _, err := store.GetNode(ctx, "i-replacement"); err != nil {
+		t.Errorf("expected replacement to be recorded, got %v", err)
+	}
+	ops, _ := store.ListOperations(ctx, "i-spot")
+	if len(ops) != 1 || ops[0].Type != OperationInterruption || ops[0].Params["replacementId"] != "i-replacement" {
+		t.Errorf("expected interruption operation, got %+v", ops)
+	}
+
+	event := <-sub.C
+	data := event.Data.(events.SpotInterrupted)
+	if data.InstanceID != "i-spot" || data.ReplacementID != "i-replacement" {
+		t.Errorf("unexpected interruption event %+v", data)
+	}
+
+	// The interruption is only handled once
+	interruptions, err = handler.Check(ctx)
+	if err != nil || len(interruptions) != 0 || len(launched) != 1 {
+		t.Errorf("expected second check to do nothing, got %+v, %d launches (%v)", interruptions, len(launched), err)
+	}
+}
+
+func TestHandler_Check_NoReplace(t *testing.T) {
+	tests := []struct {
+		name       string
+		tags       map[string]string
+		statusCode string
+		handled    int
+	}{
+		{"not opted in", nil, "instance-terminated-no-capacity", 1},
+		{"pool member", map[string]string{ec2.TagSpotReplace: "true", ec2.TagPool: "web"}, "instance-terminated-no-capacity", 1},
+		{"terminated by user", map[string]string{ec2.TagSpotReplace: "true"}, "instance-terminated-by-user", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var launched []*awsec2.RunInstancesInput
+			handler := NewHandler(newSpotMock(t, tt.tags, tt.statusCode, &launched), inventory.NewMemoryStore())
+
+			interruptions, err := handler.Check(context.Background())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(interruptions) != tt.handled {
+				t.Errorf("expected %d interruptions, got %d", tt.handled, len(interruptions))
+			}
+			if len(launched) != 0 {
+				t.Errorf("expected no replacement, got %d", len(launched))
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package sshkey
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/abteilung6/tilmancloud/pkg/errkind"
+)
+
+const (
+	TypeED25519 = "ssh-ed25519"
+	TypeRSA     = "ssh-rsa"
+
+	// MinRSABits is the smallest RSA modulus accepted. EC2 also requires at
+	// least 2048 bits for imported RSA keys.
+	MinRSABits = 2048
+)
+
+var ErrInvalidKey = errkind.New(errkind.InvalidInput, "invalid public key")
+
+type PublicKey struct {
+	Type    string
+	Comment string
+	Bits    int
+	blob    []byte
+}
+
+// Parse parses a public key in OpenSSH authorized_keys format, e.g.
+// "ssh-ed25519 AAAAC3Nza... alice@laptop". Only ed25519 and RSA keys are
+// accepted.
+func Parse(authorizedKey string) (*PublicKey, error) {
+	line := strings.TrimSpace(authorizedKey)
+	if strings.HasPrefix(line, "-----BEGIN") {
+		return nil, fmt.Errorf("%w: looks like a private key or PEM file, expected an OpenSSH public key", ErrInvalidKey)
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("%w: expected \"<type> <base64> [comment]\"", ErrInvalidKey)
+	}
+
+	keyType := fields[0]
+	if keyType != TypeED25519 && keyType != TypeRSA {
+		return nil, fmt.Errorf("%w: unsupported key type %q, only %s and %s are supported", ErrInvalidKey, keyType, TypeED25519, TypeRSA)
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode base64: %v", ErrInvalidKey, err)
+	}
+
+	key := &PublicKey{
+		Type:    keyType,
+		Comment: strings.Join(fields[2:], " "),
+		blob:    blob,
+	}
+
+	reader := bytes.NewReader(blob)
+	blobType, err := readString(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read key type: %v", ErrInvalidKey, err)
+	}
+	if string(blobType) != keyType {
+		return nil, fmt.Errorf("%w: key type %q does not match encoded type %q", ErrInvalidKey, keyType, blobType)
+	}
+
+	switch keyType {
+	case TypeED25519:
+		point, err := readString(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: read ed25519 key: %v", ErrInvalidKey, err)
+		}
+		if len(point) != 32 {
+			return nil, fmt.Errorf("%w: ed25519 key must be 32 bytes, got %d", ErrInvalidKey, len(point))
+		}
+		key.Bits = 256
+	case TypeRSA:
+		if _, err := readString(reader); err != nil {
+			return nil, fmt.Errorf("%w: read RSA exponent: %v", ErrInvalidKey, err)
+		}
+		modulus, err := readString(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: read RSA modulus: %v", ErrInvalidKey, err)
+		}
+		key.Bits = new(big.Int).SetBytes(modulus).BitLen()
+		if key.Bits < MinRSABits {
+			return nil, fmt.Errorf("%w: RSA key must be at least %d bits, got %d", ErrInvalidKey, MinRSABits, key.Bits)
+		}
+	}
+
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes after key data", ErrInvalidKey, reader.Len())
+	}
+
+	return key, nil
+}
+
+// Fingerprint returns the SHA256 fingerprint as printed by ssh-keygen -l.
+func (k *PublicKey) Fingerprint() string {
+	sum := sha256.Sum256(k.blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Algorithm returns the short algorithm name, "ed25519" or "rsa".
+func (k *PublicKey) Algorithm() string {
+	return strings.TrimPrefix(k.Type, "ssh-")
+}
+
+// String returns the key in authorized_keys format.
+func (k *PublicKey) String() string {
+	line := k.Type + " " + base64.StdEncoding.EncodeToString(k.blob)
+	if k.Comment != "" {
+		line += " " + k.Comment
+	}
+	return line
+}
+
+// readString reads an SSH wire-format string: a uint32 length followed by
+// that many bytes.
+func readString(r *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if int64(length) > int64(r.Len()) {
+		return nil, fmt.Errorf("length %d exceeds remaining %d bytes", length, r.Len())
+	}
+	buf := make([]byte, length)
+	if _, err := r.Read(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
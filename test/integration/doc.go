@@ -0,0 +1,9 @@
+// Package integration runs the build-and-launch flow against an AWS API
+// emulator such as LocalStack or moto. The tests are behind the integration
+// build tag and need AWS_ENDPOINT_URL pointing at the emulator:
+//
+//	docker run --rm -p 4566:4566 localstack/localstack
+//	AWS_ENDPOINT_URL=http://localhost:4566 go test -tags integration ./test/integration/...
+//
+// Static test credentials are used unless AWS_ACCESS_KEY_ID is set.
+package integration
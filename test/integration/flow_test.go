@@ -0,0 +1,149 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abteilung6/tilmancloud/pkg/awsconfig"
+	"github.com/abteilung6/tilmancloud/pkg/ec2"
+	"github.com/abteilung6/tilmancloud/pkg/image"
+	"github.com/abteilung6/tilmancloud/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// emulatorConfig loads the shared configuration for the emulator, skipping
+// the test when no endpoint is configured.
+func emulatorConfig(t *testing.T) (awsconfig.Config, aws.Config) {
+	t.Helper()
+	settings := awsconfig.FromEnv()
+	if settings.Endpoint == "" {
+		t.Skipf("%s not set, skipping integration test", awsconfig.EnvEndpoint)
+	}
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		settings.AccessKeyID = "test"
+		settings.SecretAccessKey = "test"
+	}
+	cfg, err := awsconfig.Load(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return settings, cfg
+}
+
+// createBucket creates a bucket for the test and empties and removes it
+// afterwards.
+func createBucket(t *testing.T, client *s3.Client, region string) string {
+	t.Helper()
+	ctx := context.Background()
+	bucket := fmt.Sprintf("tilman-integration-%d", time.Now().UnixNano())
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	if region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3types.CreateBucketConfiguration{
+			LocationConstraint: s3types.BucketLocationConstraint(region),
+		}
+	}
+	if _, err := client.CreateBucket(ctx, input); err != nil {
+		t.Fatalf("failed to create bucket: %v", err)
+	}
+	t.Cleanup(func() {
+		objects, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+		if err == nil {
+			for _, object := range objects.Contents {
+				client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: object.Key})
+			}
+		}
+		client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+	})
+	return bucket
+}
+
+// writeRawImage writes a small random disk image, so every run imports a
+// new image.
+func writeRawImage(t *testing.T) string {
+	t.Helper()
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	path := filepath.Join(t.TempDir(), "tilman-integration.aarch64.raw")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	return path
+}
+
+func TestBuildAndLaunch(t *testing.T) {
+	settings, cfg := emulatorConfig(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+
+	bucket := createBucket(t, s3.NewFromConfig(cfg, settings.S3Options()...), cfg.Region)
+	rawPath := writeRawImage(t)
+	imageID, err := image.GenerateImageIDFromFile(rawPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	uploader := image.NewS3Uploader(cfg, bucket, settings.S3Options()...)
+	s3Key := image.GenerateS3Key(rawPath)
+	if err := uploader.Upload(ctx, rawPath, s3Key); err != nil {
+		t.Fatalf("failed to upload image: %v", err)
+	}
+	if exists, err := uploader.Exists(ctx, s3Key); err != nil || !exists {
+		t.Fatalf("expected the uploaded image to exist, got %v, %v", exists, err)
+	}
+
+	snapshotID, err := image.NewImporter(cfg).ImportSnapshot(ctx, bucket, s3Key, "integration test image", imageID)
+	if err != nil {
+		t.Fatalf("failed to import snapshot: %v", err)
+	}
+
+	registrar := image.NewAMIRegistrar(cfg)
+	amiID, err := registrar.RegisterAMI(ctx, snapshotID, imageID, "tilman-integration-"+imageID, "integration test image")
+	if err != nil {
+		t.Fatalf("failed to register AMI: %v", err)
+	}
+
+	nodes := provider.NewEC2(ec2.NewClient(cfg), registrar)
+	info, err := nodes.CreateNode(ctx, ec2.CreateInstanceConfig{
+		Name:         "integration",
+		ImageID:      amiID,
+		InstanceType: types.InstanceTypeT4gMicro,
+		UserData:     "#cloud-config\n",
+	})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	t.Cleanup(func() {
+		nodes.DeleteNode(context.Background(), info.InstanceID)
+	})
+
+	info, err = nodes.WaitForNode(ctx, info.InstanceID, ec2.WaitOptions{
+		TargetStates: []types.InstanceStateName{types.InstanceStateNameRunning},
+		Timeout:      5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("node did not reach running: %v", err)
+	}
+	if info.AMIID != amiID || info.Name != "integration" {
+		t.Errorf("expected the node to boot the registered AMI, got %+v", info)
+	}
+
+	if err := nodes.DeleteNode(ctx, info.InstanceID); err != nil {
+		t.Fatalf("failed to delete node: %v", err)
+	}
+	if _, err := nodes.WaitForNode(ctx, info.InstanceID, ec2.WaitOptions{
+		TargetStates: []types.InstanceStateName{types.InstanceStateNameTerminated},
+		Timeout:      5 * time.Minute,
+	}); err != nil {
+		t.Errorf("node did not terminate: %v", err)
+	}
+}